@@ -17,4 +17,5 @@ require (
 	google.golang.org/api v0.7.0
 	google.golang.org/genproto v0.0.0-20200207204624-4f3edf09f4f6
 	google.golang.org/grpc v1.27.0
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -14,6 +14,7 @@
 
 #include "src/api_proxy/path_matcher/path_matcher.h"
 
+#include "absl/strings/ascii.h"
 #include "absl/strings/str_split.h"
 
 namespace google {
@@ -170,7 +171,8 @@ void ExtractBindingsFromPath(const std::vector<HttpTemplate::Variable>& vars,
 }
 
 std::vector<std::string> ExtractRequestParts(
-    std::string path, const std::set<std::string>& custom_verbs) {
+    std::string path, const std::set<std::string>& custom_verbs,
+    bool case_insensitive) {
   // Remove query parameters.
   path = path.substr(0, path.find_first_of('?'));
 
@@ -180,6 +182,9 @@ std::vector<std::string> ExtractRequestParts(
   std::size_t last_slash_pos = path.find_last_of('/');
   if (last_colon_pos != std::string::npos && last_colon_pos > last_slash_pos) {
     std::string verb = path.substr(last_colon_pos + 1);
+    if (case_insensitive) {
+      absl::AsciiStrToLower(&verb);
+    }
     // only verb in the configured custom verbs, treat it as verb
     // replace ":" with / as a separate segment.
     if (custom_verbs.find(verb) != custom_verbs.end()) {
@@ -198,6 +203,15 @@ std::vector<std::string> ExtractRequestParts(
   return result;
 }
 
+std::vector<std::string> LowerCaseParts(const std::vector<std::string>& parts) {
+  std::vector<std::string> result;
+  result.reserve(parts.size());
+  for (const std::string& part : parts) {
+    result.push_back(absl::AsciiStrToLower(part));
+  }
+  return result;
+}
+
 PathMatcherLookupResult LookupInPathMatcherNode(
     const PathMatcherNode& root, const std::vector<std::string>& parts,
     const HttpMethod& http_method) {
@@ -206,14 +220,18 @@ PathMatcherLookupResult LookupInPathMatcherNode(
   return result;
 }
 
-PathMatcherNode::PathInfo TransformHttpTemplate(const HttpTemplate& ht) {
+PathMatcherNode::PathInfo TransformHttpTemplate(const HttpTemplate& ht,
+                                                bool case_insensitive) {
   PathMatcherNode::PathInfo::Builder builder;
 
+  // The wildcard segments are not affected by the conversion to lowercase.
   for (const std::string& part : ht.segments()) {
-    builder.AppendLiteralNode(part);
+    builder.AppendLiteralNode(case_insensitive ? absl::AsciiStrToLower(part)
+                                               : part);
   }
   if (!ht.verb().empty()) {
-    builder.AppendLiteralNode(ht.verb());
+    builder.AppendLiteralNode(
+        case_insensitive ? absl::AsciiStrToLower(ht.verb()) : ht.verb());
   }
 
   return builder.Build();
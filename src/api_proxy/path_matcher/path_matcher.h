@@ -21,6 +21,7 @@
 #include <string>
 #include <unordered_map>
 
+#include "absl/strings/ascii.h"
 #include "src/api_proxy/path_matcher/http_template.h"
 #include "src/api_proxy/path_matcher/path_matcher_node.h"
 
@@ -84,6 +85,8 @@ class PathMatcher {
   std::unique_ptr<PathMatcherNode> root_ptr_;
   // Holds the set of custom verbs found in configured templates.
   std::set<std::string> custom_verbs_;
+  // If true, the literal segments and the custom verbs match in any case.
+  bool case_insensitive_;
   // Data we store per each registered method
   struct MethodData {
     Method method;
@@ -119,6 +122,13 @@ class PathMatcherBuilder {
   bool Register(std::string http_method, std::string path,
                 std::string body_field_path, Method method);
 
+  // Makes the literal segments and the custom verbs of the templates match
+  // the request paths case-insensitively. The variable bindings keep the case
+  // of the request path. Must be called before any Register().
+  void SetCaseInsensitive(bool case_insensitive) {
+    case_insensitive_ = case_insensitive;
+  }
+
   // Returns a unique_ptr to a thread safe PathMatcher that contains all
   // registered path-WrapperGraph pairs. Note the PathMatchBuilder instance
   // will be moved so cannot use after invoking Build().
@@ -133,6 +143,7 @@ class PathMatcherBuilder {
   // be multiple templates in different services on a server. Consider moving
   // this to PathMatcherNode.
   std::set<std::string> custom_verbs_;
+  bool case_insensitive_;
   typedef typename PathMatcher<Method>::MethodData MethodData;
   std::vector<std::unique_ptr<MethodData>> methods_;
 
@@ -155,20 +166,32 @@ void ExtractBindingsFromPath(const std::vector<HttpTemplate::Variable>& vars,
 //
 // - Strips off query string: "/a?foo=bar" --> "/a"
 // - Collapses extra slashes: "///" --> "/"
+//
+// With case_insensitive, custom_verbs must be lowercase and the custom verb
+// of the request path is matched in any case. The parts keep their case.
 std::vector<std::string> ExtractRequestParts(
-    std::string path, const std::set<std::string>& custom_verbs);
+    std::string path, const std::set<std::string>& custom_verbs,
+    bool case_insensitive = false);
+
+// Returns the parts converted to lowercase, to look them up in a trie of
+// lowercase templates.
+std::vector<std::string> LowerCaseParts(const std::vector<std::string>& parts);
 
 // Looks up on a PathMatcherNode.
 PathMatcherLookupResult LookupInPathMatcherNode(
     const PathMatcherNode& root, const std::vector<std::string>& parts,
     const HttpMethod& http_method);
 
-PathMatcherNode::PathInfo TransformHttpTemplate(const HttpTemplate& ht);
+// With case_insensitive, the literal segments and the verb are converted to
+// lowercase.
+PathMatcherNode::PathInfo TransformHttpTemplate(const HttpTemplate& ht,
+                                                bool case_insensitive = false);
 
 template <class Method>
 PathMatcher<Method>::PathMatcher(PathMatcherBuilder<Method>&& builder)
     : root_ptr_(std::move(builder.root_ptr_)),
       custom_verbs_(std::move(builder.custom_verbs_)),
+      case_insensitive_(builder.case_insensitive_),
       methods_(std::move(builder.methods_)) {}
 
 template <class Method>
@@ -176,7 +199,7 @@ Method PathMatcher<Method>::Lookup(
     const std::string& http_method, const std::string& path,
     std::vector<VariableBinding>* variable_bindings) const {
   const std::vector<std::string> parts =
-      ExtractRequestParts(path, custom_verbs_);
+      ExtractRequestParts(path, custom_verbs_, case_insensitive_);
 
   // If service_name has not been registered to ESPv2 and
   // strict_service_matching_ is set to false, tries to lookup the method in all
@@ -185,8 +208,13 @@ Method PathMatcher<Method>::Lookup(
     return nullptr;
   }
 
-  PathMatcherLookupResult lookup_result =
-      LookupInPathMatcherNode(*root_ptr_, parts, http_method);
+  // The trie has lowercase literals, the bindings use the original parts.
+  std::vector<std::string> lower_parts;
+  if (case_insensitive_) {
+    lower_parts = LowerCaseParts(parts);
+  }
+  PathMatcherLookupResult lookup_result = LookupInPathMatcherNode(
+      *root_ptr_, case_insensitive_ ? lower_parts : parts, http_method);
   // Return nullptr if nothing is found.
   // Not need to check duplication. Only first item is stored for duplicated
   if (lookup_result.data == nullptr) {
@@ -206,7 +234,7 @@ template <class Method>
 Method PathMatcher<Method>::Lookup(const std::string& http_method,
                                    const std::string& path) const {
   const std::vector<std::string> parts =
-      ExtractRequestParts(path, custom_verbs_);
+      ExtractRequestParts(path, custom_verbs_, case_insensitive_);
 
   // If service_name has not been registered to ESP and strict_service_matching_
   // is set to false, tries to lookup the method in all registered services.
@@ -214,8 +242,13 @@ Method PathMatcher<Method>::Lookup(const std::string& http_method,
     return nullptr;
   }
 
-  PathMatcherLookupResult lookup_result =
-      LookupInPathMatcherNode(*root_ptr_, parts, http_method);
+  // The trie has lowercase literals, the bindings use the original parts.
+  std::vector<std::string> lower_parts;
+  if (case_insensitive_) {
+    lower_parts = LowerCaseParts(parts);
+  }
+  PathMatcherLookupResult lookup_result = LookupInPathMatcherNode(
+      *root_ptr_, case_insensitive_ ? lower_parts : parts, http_method);
   // Return nullptr if nothing is found.
   // Not need to check duplication. Only first item is stored for duplicated
   if (lookup_result.data == nullptr) {
@@ -228,7 +261,7 @@ Method PathMatcher<Method>::Lookup(const std::string& http_method,
 // Initializes the builder with a root Path Segment
 template <class Method>
 PathMatcherBuilder<Method>::PathMatcherBuilder()
-    : root_ptr_(new PathMatcherNode()) {}
+    : root_ptr_(new PathMatcherNode()), case_insensitive_(false) {}
 
 template <class Method>
 PathMatcherPtr<Method> PathMatcherBuilder<Method>::Build() {
@@ -246,7 +279,8 @@ bool PathMatcherBuilder<Method>::Register(std::string http_method,
   if (nullptr == ht) {
     return false;
   }
-  PathMatcherNode::PathInfo path_info = TransformHttpTemplate(*ht);
+  PathMatcherNode::PathInfo path_info =
+      TransformHttpTemplate(*ht, case_insensitive_);
 
   // Create & initialize a MethodData struct. Then insert its pointer
   // into the path matcher trie.
@@ -261,7 +295,8 @@ bool PathMatcherBuilder<Method>::Register(std::string http_method,
   // Add the method_data to the methods_ vector for cleanup
   methods_.emplace_back(std::move(method_data));
   if (!ht->verb().empty()) {
-    custom_verbs_.insert(ht->verb());
+    custom_verbs_.insert(case_insensitive_ ? absl::AsciiStrToLower(ht->verb())
+                                           : ht->verb());
   }
   return true;
 }
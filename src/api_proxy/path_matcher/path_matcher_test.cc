@@ -83,6 +83,8 @@ class PathMatcherTest : public ::testing::Test {
 
   MethodInfo* AddGetPath(std::string path) { return AddPath("GET", path); }
 
+  void SetCaseInsensitive() { builder_.SetCaseInsensitive(true); }
+
   void Build() { matcher_ = builder_.Build(); }
 
   MethodInfo* Lookup(std::string method, std::string path,
@@ -529,6 +531,44 @@ TEST_F(PathMatcherTest, CustomVerbMatch4) {
   EXPECT_EQ(Lookup("GET", "/foo/other:verb/hello"), a);
 }
 
+TEST_F(PathMatcherTest, CaseInsensitiveMatches) {
+  SetCaseInsensitive();
+  MethodInfo* shelves = AddGetPath("/v1/Shelves");
+  MethodInfo* shelf_books = AddGetPath("/v1/shelves/{shelf}/books:Clear");
+  Build();
+
+  EXPECT_NE(nullptr, shelves);
+  EXPECT_NE(nullptr, shelf_books);
+
+  EXPECT_EQ(Lookup("GET", "/v1/shelves"), shelves);
+  EXPECT_EQ(Lookup("GET", "/V1/SHELVES"), shelves);
+  EXPECT_EQ(Lookup("GET", "/v1/shelve"), nullptr);
+
+  // The bindings keep the case of the request path.
+  VariableBindings bindings;
+  EXPECT_EQ(Lookup("GET", "/V1/Shelves/MyShelf/Books:clear", &bindings),
+            shelf_books);
+  EXPECT_EQ(VariableBindings({
+                VariableBinding{FieldPath{"shelf"}, "MyShelf"},
+            }),
+            bindings);
+  EXPECT_EQ(Lookup("GET", "/v1/shelves/MyShelf/books:CLEAR", &bindings),
+            shelf_books);
+  EXPECT_EQ(VariableBindings({
+                VariableBinding{FieldPath{"shelf"}, "MyShelf"},
+            }),
+            bindings);
+}
+
+TEST_F(PathMatcherTest, CaseSensitiveByDefault) {
+  MethodInfo* shelves = AddGetPath("/v1/shelves");
+  Build();
+
+  EXPECT_NE(nullptr, shelves);
+  EXPECT_EQ(Lookup("GET", "/v1/shelves"), shelves);
+  EXPECT_EQ(Lookup("GET", "/V1/Shelves"), nullptr);
+}
+
 TEST_F(PathMatcherTest, RejectPartialMatches) {
   MethodInfo* prefix_middle_suffix = AddGetPath("/prefix/middle/suffix");
   MethodInfo* prefix_middle = AddGetPath("/prefix/middle");
@@ -28,8 +28,7 @@ using Utils::ImdsTokenSubscriber;
 // TODO(kyuc): add unit tests for all possible backend rule configs.
 
 AudienceContext::AudienceContext(
-    const ::google::api::envoy::http::backend_auth::BackendAuthRule&
-        proto_config,
+    const std::string& jwt_audience,
     Server::Configuration::FactoryContext& context,
     const FilterConfig& filter_config,
     const Utils::TokenSubscriberFactory& token_subscriber_factory,
@@ -53,7 +52,7 @@ AudienceContext::AudienceContext(
       const std::string& cluster =
           filter_config.iam_token().iam_uri().cluster();
       const std::string real_uri =
-          absl::StrCat(uri, "?audience=", proto_config.jwt_audience());
+          absl::StrCat(uri, "?audience=", jwt_audience);
       const ::google::protobuf::RepeatedPtrField<std::string>& delegates =
           filter_config.iam_token().delegates();
       iam_token_sub_ptr_ = token_subscriber_factory.createIamTokenSubscriber(
@@ -65,8 +64,8 @@ AudienceContext::AudienceContext(
     case FilterConfig::kImdsToken: {
       const std::string& uri = filter_config.imds_token().uri();
       const std::string& cluster = filter_config.imds_token().cluster();
-      const std::string real_uri = absl::StrCat(
-          uri, "?format=standard&audience=", proto_config.jwt_audience());
+      const std::string real_uri =
+          absl::StrCat(uri, "?format=standard&audience=", jwt_audience);
 
       imds_token_sub_ptr_ =
           token_subscriber_factory.createImdsTokenSubscriber(cluster, real_uri,
@@ -111,12 +110,24 @@ FilterConfigParserImpl::FilterConfigParserImpl(
 
   for (const auto& rule : config.rules()) {
     operation_map_[rule.operation()] = rule.jwt_audience();
-    auto it = audience_map_.find(rule.jwt_audience());
-    if (it == audience_map_.end()) {
-      audience_map_[rule.jwt_audience()] = AudienceContextPtr(
-          new AudienceContext(rule, context, config, token_subscriber_factory,
-                              [this]() { return access_token_; }));
-    }
+    addAudience(rule.jwt_audience(), config, context,
+                token_subscriber_factory);
+  }
+  // The audiences of the per-route configs are only known by the routes.
+  for (const auto& audience : config.per_route_jwt_audiences()) {
+    addAudience(audience, config, context, token_subscriber_factory);
+  }
+}
+
+void FilterConfigParserImpl::addAudience(
+    const std::string& audience, const FilterConfig& config,
+    Server::Configuration::FactoryContext& context,
+    const Utils::TokenSubscriberFactory& token_subscriber_factory) {
+  auto it = audience_map_.find(audience);
+  if (it == audience_map_.end()) {
+    audience_map_[audience] = AudienceContextPtr(
+        new AudienceContext(audience, context, config, token_subscriber_factory,
+                            [this]() { return access_token_; }));
   }
 }
 }  // namespace BackendAuth
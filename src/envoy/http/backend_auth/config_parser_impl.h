@@ -37,8 +37,7 @@ class TokenCache : public ThreadLocal::ThreadLocalObject {
 class AudienceContext {
  public:
   AudienceContext(
-      const ::google::api::envoy::http::backend_auth::BackendAuthRule&
-          proto_config,
+      const std::string& jwt_audience,
       Server::Configuration::FactoryContext& context,
       const ::google::api::envoy::http::backend_auth::FilterConfig& config,
       const Utils::TokenSubscriberFactory& token_subscriber_factory,
@@ -85,6 +84,13 @@ class FilterConfigParserImpl
   }
 
  private:
+  // Subscribes the token of the audience, if it is not subscribed yet.
+  void addAudience(
+      const std::string& audience,
+      const ::google::api::envoy::http::backend_auth::FilterConfig& config,
+      Server::Configuration::FactoryContext& context,
+      const Utils::TokenSubscriberFactory& token_subscriber_factory);
+
   //  access_token_ is required for authentication during fetching id_token from
   //  IAM server.
   std::string access_token_;
@@ -198,6 +198,54 @@ rules {
   EXPECT_EQ(*config_parser_->getJwtToken("audience-bar"), "id-token-bar");
 }
 
+TEST_F(ConfigParserImplTest, GetIdTokenOfPerRouteAudience) {
+  const char filter_config[] = R"(
+imds_token {
+  uri: "this-is-uri"
+  cluster: "this-is-cluster"
+}
+rules {
+  operation: "operation-foo"
+  jwt_audience: "audience-foo"
+}
+per_route_jwt_audiences: "audience-foo"
+per_route_jwt_audiences: "audience-route"
+)";
+  const std::string token_foo("token-foo");
+  const std::string token_route("token-route");
+
+  // The audience shared with a rule is only subscribed once.
+  EXPECT_CALL(
+      mock_token_subscriber_factory_,
+      createImdsTokenSubscriber(
+          "this-is-cluster",
+          "this-is-uri?format=standard&audience=audience-foo", false, _))
+      .WillOnce(Invoke(
+          [&token_foo](const std::string&, const std::string&, const bool,
+                       Utils::ImdsTokenSubscriber::TokenUpdateFunc callback)
+              -> Utils::ImdsTokenSubscriberPtr {
+            callback(token_foo);
+            return nullptr;
+          }));
+  EXPECT_CALL(
+      mock_token_subscriber_factory_,
+      createImdsTokenSubscriber(
+          "this-is-cluster",
+          "this-is-uri?format=standard&audience=audience-route", false, _))
+      .WillOnce(Invoke(
+          [&token_route](const std::string&, const std::string&, const bool,
+                         Utils::ImdsTokenSubscriber::TokenUpdateFunc callback)
+              -> Utils::ImdsTokenSubscriberPtr {
+            callback(token_route);
+            return nullptr;
+          }));
+
+  setUp(filter_config);
+
+  EXPECT_EQ(*config_parser_->getJwtToken("audience-foo"), "token-foo");
+  EXPECT_EQ(*config_parser_->getJwtToken("audience-route"), "token-route");
+}
+
 }  // namespace BackendAuth
 }  // namespace HttpFilters
 }  // namespace Extensions
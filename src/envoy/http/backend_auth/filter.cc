@@ -16,11 +16,18 @@
 
 #include "src/envoy/http/backend_auth/filter.h"
 
+#include <cmath>
 #include <string>
 
+#include "absl/strings/str_cat.h"
+#include "common/common/fmt.h"
+#include "common/config/metadata.h"
 #include "common/http/headers.h"
 #include "common/http/utility.h"
+#include "common/grpc/common.h"
+#include "extensions/filters/http/well_known_names.h"
 #include "src/envoy/utils/filter_state_utils.h"
+#include "src/envoy/utils/local_reply_utils.h"
 
 namespace Envoy {
 namespace Extensions {
@@ -34,6 +41,7 @@ using Http::HeaderMap;
 
 namespace {
 constexpr char kBearer[] = "Bearer ";
+constexpr char kIssuerClaim[] = "iss";
 
 struct RcDetailsValues {
   // The request is rejected due to missing backend auth token.
@@ -41,38 +49,129 @@ struct RcDetailsValues {
 };
 typedef ConstSingleton<RcDetailsValues> RcDetails;
 
+// Formats a claim value as a header value. Only string, number and boolean
+// claims are forwarded, returns false for the other claims.
+bool formatClaim(const ProtobufWkt::Value& claim, std::string& value) {
+  switch (claim.kind_case()) {
+    case ProtobufWkt::Value::kStringValue:
+      value = claim.string_value();
+      return true;
+    case ProtobufWkt::Value::kNumberValue: {
+      const double number = claim.number_value();
+      // The JSON numbers are doubles, the integers are formatted as such,
+      // e.g. the "exp" claim.
+      if (std::trunc(number) == number && std::abs(number) < 1e15) {
+        value = absl::StrCat(static_cast<int64_t>(number));
+      } else {
+        value = fmt::format("{}", number);
+      }
+      return true;
+    }
+    case ProtobufWkt::Value::kBoolValue:
+      value = claim.bool_value() ? "true" : "false";
+      return true;
+    default:
+      return false;
+  }
+}
+
 }  // namespace
 
+bool Filter::forwardJwtClaims(HeaderMap& headers) {
+  const std::string& metadata_name = config_->jwt_payload_metadata_name();
+  if (metadata_name.empty()) {
+    return false;
+  }
+  const ProtobufWkt::Value& payload = Config::Metadata::metadataValue(
+      decoder_callbacks_->streamInfo().dynamicMetadata(),
+      HttpFilterNames::get().JwtAuthn, metadata_name);
+  if (payload.kind_case() != ProtobufWkt::Value::kStructValue) {
+    // No verified JWT.
+    return false;
+  }
+
+  const auto& claims = payload.struct_value().fields();
+  const auto issuer_it = claims.find(kIssuerClaim);
+  if (issuer_it == claims.end() ||
+      issuer_it->second.kind_case() != ProtobufWkt::Value::kStringValue) {
+    return false;
+  }
+  const auto* rule =
+      config_->findJwtClaimHeadersRule(issuer_it->second.string_value());
+  if (rule == nullptr) {
+    return false;
+  }
+
+  for (const auto& claim_to_header : rule->claim_to_headers()) {
+    const auto claim_it = claims.find(claim_to_header.claim());
+    std::string value;
+    if (claim_it == claims.end() || !formatClaim(claim_it->second, value)) {
+      continue;
+    }
+    headers.addCopy(Http::LowerCaseString(claim_to_header.header()), value);
+  }
+  return rule->strip_authorization();
+}
+
 FilterHeadersStatus Filter::decodeHeaders(HeaderMap& headers, bool) {
+  // The generated headers are only set from the verified JWT.
+  for (const auto& header : config_->generated_headers()) {
+    headers.remove(header);
+  }
+  const bool strip_authorization = forwardJwtClaims(headers);
+  const auto& authorization = Http::Headers::get().Authorization;
+
   absl::string_view operation = Utils::getStringFilterState(
       decoder_callbacks_->streamInfo().filterState(), Utils::kOperation);
   // NOTE: this shouldn't happen in practice because Path Matcher filter would
   // have already rejected the request.
   if (operation.empty()) {
     ENVOY_LOG(debug, "No operation found from DynamicMetadata");
+    if (strip_authorization) {
+      headers.remove(authorization);
+    }
     return FilterHeadersStatus::Continue;
   }
 
   ENVOY_LOG(debug, "Found operation: {}", operation);
   absl::string_view audience = config_->cfg_parser().getAudience(operation);
+  // The route, e.g. of a backend of a split, can override the audience.
+  const auto* per_route =
+      Http::Utility::resolveMostSpecificPerFilterConfig<PerRouteFilterConfig>(
+          kFilterName, decoder_callbacks_->route());
+  if (per_route != nullptr) {
+    audience = per_route->jwt_audience();
+  }
   if (audience.empty()) {
     // This filter does not need to set a JWT Token for this operation.
-    // If the request already has an Authorization header, it will be preserved.
+    // If the request already has an Authorization header, it will be preserved
+    // unless the issuer of its verified JWT strips it.
+    if (strip_authorization) {
+      headers.remove(authorization);
+    }
     return FilterHeadersStatus::Continue;
   }
 
   const TokenSharedPtr jwt_token = config_->cfg_parser().getJwtToken(audience);
   if (!jwt_token) {
     ENVOY_LOG(debug, "Token not found for audience: {}", audience);
-    decoder_callbacks_->sendLocalReply(Http::Code::InternalServerError,
-                                       "missing tokens", nullptr, absl::nullopt,
-                                       RcDetails::get().MissingBackendToken);
+    Utils::sendLocalReply(*decoder_callbacks_, config_->local_reply_config(),
+                          Grpc::Common::hasGrpcContentType(headers),
+                          Http::Code::InternalServerError, "missing tokens",
+                          RcDetails::get().MissingBackendToken);
     decoder_callbacks_->streamInfo().setResponseFlag(
         StreamInfo::ResponseFlag::UnauthorizedExternalService);
     return FilterHeadersStatus::StopIteration;
   }
 
-  const auto& authorization = Http::Headers::get().Authorization;
+  if (strip_authorization) {
+    // The Authorization header of the client is kept for the backend.
+    const Http::HeaderEntry* entry = headers.get(authorization);
+    if (entry != nullptr) {
+      headers.addCopy(Http::LowerCaseString(kForwardedAuthorizationHeader),
+                      std::string(entry->value().getStringView()));
+    }
+  }
   headers.remove(authorization);
   headers.addCopy(authorization, kBearer + *jwt_token);
   config_->stats().token_added_.inc();
@@ -36,6 +36,10 @@ class Filter : public Http::PassThroughDecoderFilter,
   Http::FilterHeadersStatus decodeHeaders(Http::HeaderMap&, bool) override;
 
  private:
+  // Sets the headers forwarding the claims of the verified JWT. Returns
+  // whether the issuer of the JWT strips the Authorization header.
+  bool forwardJwtClaims(Http::HeaderMap& headers);
+
   const FilterConfigSharedPtr config_;
 };
 
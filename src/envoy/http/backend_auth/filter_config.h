@@ -14,8 +14,12 @@
 
 #pragma once
 
+#include <vector>
+
 #include "api/envoy/http/backend_auth/config.pb.h"
 #include "common/common/logger.h"
+#include "envoy/http/header_map.h"
+#include "envoy/router/router.h"
 #include "src/envoy/http/backend_auth/config_parser.h"
 
 namespace Envoy {
@@ -23,6 +27,13 @@ namespace Extensions {
 namespace HttpFilters {
 namespace BackendAuth {
 
+// The header keeping the Authorization header of the client, when it is
+// replaced by the backend auth token.
+constexpr char kForwardedAuthorizationHeader[] = "x-forwarded-authorization";
+
+// The name of the filter, also used for its per-route configs.
+constexpr char kFilterName[] = "envoy.filters.http.backend_auth";
+
 /**
  * All stats for the backend auth filter. @see stats_macros.h
  */
@@ -47,10 +58,41 @@ class FilterConfig {
   virtual FilterStats& stats() PURE;
 
   virtual const FilterConfigParser& cfg_parser() const PURE;
+
+  virtual const ::google::api::envoy::http::common::LocalReplyConfig&
+  local_reply_config() const PURE;
+
+  // The field name for the verified JWT payload in the JWT Authn metadata,
+  // empty if no JWT claim is forwarded.
+  virtual const std::string& jwt_payload_metadata_name() const PURE;
+
+  // Returns the rule forwarding the claims of the JWT of the issuer, or
+  // nullptr if there is none.
+  virtual const ::google::api::envoy::http::backend_auth::JwtClaimHeadersRule*
+  findJwtClaimHeadersRule(absl::string_view issuer) const PURE;
+
+  // The headers only set by this filter, removed from all the requests.
+  virtual const std::vector<Http::LowerCaseString>& generated_headers()
+      const PURE;
 };
 
 typedef std::shared_ptr<FilterConfig> FilterConfigSharedPtr;
 
+// The per-route config, overriding the JWT audience of the operation, e.g.
+// for the backends of a split.
+class PerRouteFilterConfig : public Router::RouteSpecificFilterConfig {
+ public:
+  PerRouteFilterConfig(
+      const ::google::api::envoy::http::backend_auth::PerRouteFilterConfig&
+          proto_config)
+      : jwt_audience_(proto_config.jwt_audience()) {}
+
+  const std::string& jwt_audience() const { return jwt_audience_; }
+
+ private:
+  const std::string jwt_audience_;
+};
+
 }  // namespace BackendAuth
 }  // namespace HttpFilters
 }  // namespace Extensions
@@ -13,6 +13,10 @@
 // limitations under the License.
 #pragma once
 
+#include <vector>
+
+#include "absl/container/flat_hash_map.h"
+#include "absl/container/flat_hash_set.h"
 #include "api/envoy/http/backend_auth/config.pb.h"
 #include "common/common/logger.h"
 #include "src/envoy/http/backend_auth/config_parser.h"
@@ -37,7 +41,24 @@ class FilterConfigImpl : public FilterConfig,
         stats_(generateStats(stats_prefix, context.scope())),
         token_subscriber_factory_(context),
         config_parser_(std::make_unique<FilterConfigParserImpl>(
-            proto_config_, context, token_subscriber_factory_)) {}
+            proto_config_, context, token_subscriber_factory_)) {
+    absl::flat_hash_set<std::string> seen_headers;
+    auto add_generated_header = [&](const std::string& header) {
+      Http::LowerCaseString lower_header(header);
+      if (seen_headers.insert(lower_header.get()).second) {
+        generated_headers_.push_back(lower_header);
+      }
+    };
+    for (const auto& rule : proto_config_.jwt_claim_headers_rules()) {
+      claim_headers_rules_.emplace(rule.issuer(), &rule);
+      for (const auto& claim_to_header : rule.claim_to_headers()) {
+        add_generated_header(claim_to_header.header());
+      }
+      if (rule.strip_authorization()) {
+        add_generated_header(kForwardedAuthorizationHeader);
+      }
+    }
+  }
 
   const ::google::api::envoy::http::backend_auth::FilterConfig& config() const {
     return proto_config_;
@@ -47,6 +68,28 @@ class FilterConfigImpl : public FilterConfig,
   const FilterConfigParser& cfg_parser() const override {
     return *config_parser_;
   }
+  const ::google::api::envoy::http::common::LocalReplyConfig&
+  local_reply_config() const override {
+    return proto_config_.local_reply_config();
+  }
+
+  const std::string& jwt_payload_metadata_name() const override {
+    return proto_config_.jwt_payload_metadata_name();
+  }
+
+  const ::google::api::envoy::http::backend_auth::JwtClaimHeadersRule*
+  findJwtClaimHeadersRule(absl::string_view issuer) const override {
+    auto it = claim_headers_rules_.find(issuer);
+    if (it == claim_headers_rules_.end()) {
+      return nullptr;
+    }
+    return it->second;
+  }
+
+  const std::vector<Http::LowerCaseString>& generated_headers()
+      const override {
+    return generated_headers_;
+  }
 
  private:
   FilterStats generateStats(const std::string& prefix, Stats::Scope& scope) {
@@ -59,6 +102,12 @@ class FilterConfigImpl : public FilterConfig,
   FilterStats stats_;
   const Utils::TokenSubscriberFactoryImpl token_subscriber_factory_;
   FilterConfigParserPtr config_parser_;
+  // The rules of proto_config_, by issuer.
+  absl::flat_hash_map<
+      std::string,
+      const ::google::api::envoy::http::backend_auth::JwtClaimHeadersRule*>
+      claim_headers_rules_;
+  std::vector<Http::LowerCaseString> generated_headers_;
 };
 
 }  // namespace BackendAuth
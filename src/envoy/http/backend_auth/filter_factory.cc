@@ -25,16 +25,15 @@ namespace Extensions {
 namespace HttpFilters {
 namespace BackendAuth {
 
-const std::string FilterName = "envoy.filters.http.backend_auth";
-
 /**
  * Config registration for ESPv2 backend auth filter.
  */
 class FilterFactory
     : public Common::FactoryBase<
-          ::google::api::envoy::http::backend_auth::FilterConfig> {
+          ::google::api::envoy::http::backend_auth::FilterConfig,
+          ::google::api::envoy::http::backend_auth::PerRouteFilterConfig> {
  public:
-  FilterFactory() : FactoryBase(FilterName) {}
+  FilterFactory() : FactoryBase(kFilterName) {}
 
  private:
   Http::FilterFactoryCb createFilterFactoryFromProtoTyped(
@@ -51,6 +50,15 @@ class FilterFactory
               Http::StreamDecoderFilterSharedPtr(filter));
         };
   }
+
+  Router::RouteSpecificFilterConfigConstSharedPtr
+  createRouteSpecificFilterConfigTyped(
+      const ::google::api::envoy::http::backend_auth::PerRouteFilterConfig&
+          proto_config,
+      Server::Configuration::ServerFactoryContext&,
+      ProtobufMessage::ValidationVisitor&) override {
+    return std::make_shared<const PerRouteFilterConfig>(proto_config);
+  }
 };
 /**
  * Static registration for the rate limit filter. @see RegisterFactory.
@@ -38,12 +38,21 @@ class BackendAuthFilterTest : public ::testing::Test {
     mock_filter_config_parser_ =
         std::make_shared<NiceMock<MockFilterConfigParser>>();
     mock_filter_config_ = std::make_shared<NiceMock<MockFilterConfig>>();
+    ON_CALL(*mock_filter_config_, local_reply_config)
+        .WillByDefault(testing::ReturnRef(local_reply_config_));
+    ON_CALL(*mock_filter_config_, jwt_payload_metadata_name)
+        .WillByDefault(testing::ReturnRef(jwt_payload_metadata_name_));
+    ON_CALL(*mock_filter_config_, generated_headers)
+        .WillByDefault(testing::ReturnRef(generated_headers_));
     filter_ = std::make_unique<Filter>(mock_filter_config_);
     filter_->setDecoderFilterCallbacks(mock_decoder_callbacks_);
   }
 
   std::shared_ptr<MockFilterConfigParser> mock_filter_config_parser_;
   std::shared_ptr<MockFilterConfig> mock_filter_config_;
+  ::google::api::envoy::http::common::LocalReplyConfig local_reply_config_;
+  std::string jwt_payload_metadata_name_;
+  std::vector<Http::LowerCaseString> generated_headers_;
   testing::NiceMock<Envoy::Http::MockStreamDecoderFilterCallbacks>
       mock_decoder_callbacks_;
   std::unique_ptr<Filter> filter_;
@@ -104,6 +113,38 @@ TEST_F(BackendAuthFilterTest, HasAudienceButGetsEmptyToken) {
   ASSERT_EQ(status, Envoy::Http::FilterHeadersStatus::StopIteration);
 }
 
+TEST_F(BackendAuthFilterTest, EmptyTokenLocalReplyConfig) {
+  Http::TestHeaderMapImpl headers{{":method", "GET"}, {":path", "/books/1"}};
+  Utils::setStringFilterState(
+      mock_decoder_callbacks_.stream_info_.filter_state_, Utils::kOperation,
+      "operation-with-audience");
+  local_reply_config_.set_body_format(R"({"code":%CODE%})");
+  local_reply_config_.set_content_type("application/json");
+  local_reply_config_.set_status_code(503);
+
+  EXPECT_CALL(*mock_filter_config_, cfg_parser)
+      .WillRepeatedly(testing::ReturnRef(*mock_filter_config_parser_));
+  EXPECT_CALL(*mock_filter_config_parser_, getAudience)
+      .WillRepeatedly(testing::Return("this-is-audience"));
+  EXPECT_CALL(*mock_filter_config_parser_, getJwtToken)
+      .WillRepeatedly(testing::Return(nullptr));
+  EXPECT_CALL(mock_decoder_callbacks_, encodeHeaders_(_, false))
+      .WillOnce(testing::Invoke([](Http::HeaderMap& headers, bool) {
+        EXPECT_EQ(headers.Status()->value().getStringView(), "503");
+        EXPECT_EQ(headers.ContentType()->value().getStringView(),
+                  "application/json");
+      }));
+  EXPECT_CALL(mock_decoder_callbacks_, encodeData(_, true))
+      .WillOnce(testing::Invoke([](Buffer::Instance& data, bool) {
+        EXPECT_EQ(data.toString(), R"({"code":503})");
+      }));
+
+  Envoy::Http::FilterHeadersStatus status =
+      filter_->decodeHeaders(headers, false);
+
+  ASSERT_EQ(status, Envoy::Http::FilterHeadersStatus::StopIteration);
+}
+
 TEST_F(BackendAuthFilterTest, SucceedAppendToken) {
   Http::TestHeaderMapImpl headers{{":method", "GET"}, {":path", "/books/1"}};
   Utils::setStringFilterState(
@@ -136,6 +177,178 @@ TEST_F(BackendAuthFilterTest, SucceedAppendToken) {
   EXPECT_EQ(status, Envoy::Http::FilterHeadersStatus::Continue);
 }
 
+TEST_F(BackendAuthFilterTest, PerRouteAudienceOverridesOperationAudience) {
+  Http::TestHeaderMapImpl headers{{":method", "GET"}, {":path", "/books/1"}};
+  Utils::setStringFilterState(
+      mock_decoder_callbacks_.stream_info_.filter_state_, Utils::kOperation,
+      "operation-with-audience");
+  testing::NiceMock<Stats::MockStore> scope;
+  const std::string prefix = "";
+  FilterStats filter_stats{
+      ALL_BACKEND_AUTH_FILTER_STATS(POOL_COUNTER_PREFIX(scope, prefix))};
+
+  ::google::api::envoy::http::backend_auth::PerRouteFilterConfig proto_config;
+  proto_config.set_jwt_audience("this-is-route-audience");
+  const PerRouteFilterConfig per_route_config(proto_config);
+  ON_CALL(mock_decoder_callbacks_.route_->route_entry_,
+          perFilterConfig(kFilterName))
+      .WillByDefault(testing::Return(&per_route_config));
+
+  EXPECT_CALL(*mock_filter_config_, cfg_parser)
+      .WillRepeatedly(testing::ReturnRef(*mock_filter_config_parser_));
+  EXPECT_CALL(*mock_filter_config_, stats)
+      .WillRepeatedly(testing::ReturnRef(filter_stats));
+
+  EXPECT_CALL(*mock_filter_config_parser_, getAudience)
+      .WillRepeatedly(testing::Return("this-is-audience"));
+  EXPECT_CALL(*mock_filter_config_parser_,
+              getJwtToken(absl::string_view("this-is-route-audience")))
+      .WillOnce(testing::Return(
+          std::make_shared<std::string>("this-is-route-token")));
+
+  Envoy::Http::FilterHeadersStatus status =
+      filter_->decodeHeaders(headers, false);
+
+  EXPECT_EQ(
+      headers.get(Http::Headers::get().Authorization)->value().getStringView(),
+      "Bearer this-is-route-token");
+  EXPECT_EQ(status, Envoy::Http::FilterHeadersStatus::Continue);
+}
+
+/**
+ * Test fixture with a verified JWT whose issuer forwards claims.
+ */
+class BackendAuthFilterJwtClaimsTest : public BackendAuthFilterTest {
+ protected:
+  void SetUp() override {
+    BackendAuthFilterTest::SetUp();
+    jwt_payload_metadata_name_ = "jwt_payloads";
+    generated_headers_ = {Http::LowerCaseString("x-user-id"),
+                          Http::LowerCaseString("x-exp"),
+                          Http::LowerCaseString("x-groups"),
+                          Http::LowerCaseString("x-forwarded-authorization")};
+    ASSERT_TRUE(google::protobuf::TextFormat::ParseFromString(
+        R"(
+issuer: "https://issuer.example.com"
+claim_to_headers {
+  claim: "sub"
+  header: "X-User-Id"
+}
+claim_to_headers {
+  claim: "exp"
+  header: "X-Exp"
+}
+claim_to_headers {
+  claim: "groups"
+  header: "X-Groups"
+}
+strip_authorization: true
+)",
+        &rule_));
+    ON_CALL(*mock_filter_config_,
+            findJwtClaimHeadersRule(absl::string_view(rule_.issuer())))
+        .WillByDefault(testing::Return(&rule_));
+
+    ProtobufWkt::Struct payload;
+    TestUtility::loadFromJson(R"({
+      "iss": "https://issuer.example.com",
+      "sub": "user-1",
+      "exp": 1580000000,
+      "groups": ["admin"]
+    })",
+                              payload);
+    ProtobufWkt::Struct& jwt_authn_metadata =
+        (*mock_decoder_callbacks_.stream_info_.metadata_
+              .mutable_filter_metadata())["envoy.filters.http.jwt_authn"];
+    (*jwt_authn_metadata.mutable_fields())[jwt_payload_metadata_name_]
+        .mutable_struct_value()
+        ->CopyFrom(payload);
+  }
+
+  ::google::api::envoy::http::backend_auth::JwtClaimHeadersRule rule_;
+};
+
+TEST_F(BackendAuthFilterJwtClaimsTest, ForwardClaimsAndStripAuthorization) {
+  Http::TestHeaderMapImpl headers{{":method", "GET"},
+                                  {":path", "/books/1"},
+                                  {"authorization", "Bearer client-jwt"},
+                                  {"x-user-id", "spoofed"},
+                                  {"x-groups", "spoofed"},
+                                  {"x-forwarded-authorization", "spoofed"}};
+  Utils::setStringFilterState(
+      mock_decoder_callbacks_.stream_info_.filter_state_, Utils::kOperation,
+      "operation-without-audience");
+
+  EXPECT_CALL(*mock_filter_config_, cfg_parser)
+      .WillRepeatedly(testing::ReturnRef(*mock_filter_config_parser_));
+  EXPECT_CALL(*mock_filter_config_parser_, getAudience)
+      .WillRepeatedly(testing::Return(""));
+
+  EXPECT_EQ(filter_->decodeHeaders(headers, false),
+            Envoy::Http::FilterHeadersStatus::Continue);
+
+  EXPECT_EQ(headers.get_("x-user-id"), "user-1");
+  EXPECT_EQ(headers.get_("x-exp"), "1580000000");
+  // Only string, number and boolean claims are forwarded.
+  EXPECT_FALSE(headers.has("x-groups"));
+  // Without a backend auth token, the Authorization header is removed.
+  EXPECT_FALSE(headers.has("authorization"));
+  EXPECT_FALSE(headers.has("x-forwarded-authorization"));
+}
+
+TEST_F(BackendAuthFilterJwtClaimsTest, MoveAuthorizationForBackendToken) {
+  Http::TestHeaderMapImpl headers{{":method", "GET"},
+                                  {":path", "/books/1"},
+                                  {"authorization", "Bearer client-jwt"}};
+  Utils::setStringFilterState(
+      mock_decoder_callbacks_.stream_info_.filter_state_, Utils::kOperation,
+      "operation-with-audience");
+  testing::NiceMock<Stats::MockStore> scope;
+  const std::string prefix = "";
+  FilterStats filter_stats{
+      ALL_BACKEND_AUTH_FILTER_STATS(POOL_COUNTER_PREFIX(scope, prefix))};
+
+  EXPECT_CALL(*mock_filter_config_, cfg_parser)
+      .WillRepeatedly(testing::ReturnRef(*mock_filter_config_parser_));
+  EXPECT_CALL(*mock_filter_config_, stats)
+      .WillRepeatedly(testing::ReturnRef(filter_stats));
+  EXPECT_CALL(*mock_filter_config_parser_, getAudience)
+      .WillRepeatedly(testing::Return("this-is-audience"));
+  EXPECT_CALL(*mock_filter_config_parser_, getJwtToken)
+      .WillRepeatedly(
+          testing::Return(std::make_shared<std::string>("this-is-token")));
+
+  EXPECT_EQ(filter_->decodeHeaders(headers, false),
+            Envoy::Http::FilterHeadersStatus::Continue);
+
+  EXPECT_EQ(headers.get_("x-user-id"), "user-1");
+  EXPECT_EQ(headers.get_("authorization"), "Bearer this-is-token");
+  EXPECT_EQ(headers.get_("x-forwarded-authorization"), "Bearer client-jwt");
+}
+
+TEST_F(BackendAuthFilterJwtClaimsTest, NoVerifiedJwt) {
+  mock_decoder_callbacks_.stream_info_.metadata_.Clear();
+  Http::TestHeaderMapImpl headers{{":method", "GET"},
+                                  {":path", "/books/1"},
+                                  {"authorization", "Bearer client-jwt"},
+                                  {"x-user-id", "spoofed"}};
+  Utils::setStringFilterState(
+      mock_decoder_callbacks_.stream_info_.filter_state_, Utils::kOperation,
+      "operation-without-audience");
+
+  EXPECT_CALL(*mock_filter_config_, cfg_parser)
+      .WillRepeatedly(testing::ReturnRef(*mock_filter_config_parser_));
+  EXPECT_CALL(*mock_filter_config_parser_, getAudience)
+      .WillRepeatedly(testing::Return(""));
+
+  EXPECT_EQ(filter_->decodeHeaders(headers, false),
+            Envoy::Http::FilterHeadersStatus::Continue);
+
+  // The client headers are removed, the Authorization header is kept.
+  EXPECT_FALSE(headers.has("x-user-id"));
+  EXPECT_EQ(headers.get_("authorization"), "Bearer client-jwt");
+}
+
 }  // namespace BackendAuth
 }  // namespace HttpFilters
 }  // namespace Extensions
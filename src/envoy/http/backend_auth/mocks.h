@@ -34,6 +34,18 @@ class MockFilterConfig : public FilterConfig {
   MOCK_METHOD(const FilterConfigParser&, cfg_parser, (), (const));
 
   MOCK_METHOD(FilterStats&, stats, (), ());
+
+  MOCK_METHOD(const ::google::api::envoy::http::common::LocalReplyConfig&,
+              local_reply_config, (), (const));
+
+  MOCK_METHOD(const std::string&, jwt_payload_metadata_name, (), (const));
+
+  MOCK_METHOD(
+      const ::google::api::envoy::http::backend_auth::JwtClaimHeadersRule*,
+      findJwtClaimHeadersRule, (absl::string_view issuer), (const));
+
+  MOCK_METHOD(const std::vector<Http::LowerCaseString>&, generated_headers,
+              (), (const));
 };
 }  // namespace BackendAuth
 }  // namespace HttpFilters
@@ -16,10 +16,12 @@
 
 #include "src/envoy/http/path_matcher/filter.h"
 
+#include "common/grpc/common.h"
 #include "common/http/utility.h"
 #include "src/api_proxy/path_matcher/variable_binding_utils.h"
 #include "src/envoy/utils/filter_state_utils.h"
 #include "src/envoy/utils/http_header_utils.h"
+#include "src/envoy/utils/local_reply_utils.h"
 
 using ::google::api_proxy::path_matcher::VariableBinding;
 using ::google::api_proxy::path_matcher::VariableBindingsToQueryParameters;
@@ -44,17 +46,34 @@ Http::FilterHeadersStatus Filter::decodeHeaders(Http::HeaderMap& headers,
   std::string method(Utils::getRequestHTTPMethodWithOverride(
       headers.Method()->value().getStringView(), headers));
   std::string path(headers.Path()->value().getStringView());
+  const Http::LowerCaseString& operation_header = config_->operation_header();
+  if (!operation_header.get().empty()) {
+    // The operation header is only set by this filter.
+    headers.remove(operation_header);
+  }
   const std::string* operation = config_->findOperation(method, path);
   if (operation == nullptr) {
-    rejectRequest(Http::Code(404),
+    rejectRequest(headers, Http::Code(404),
                   "Path does not match any requirement URI template.");
     return Http::FilterHeadersStatus::StopIteration;
   }
 
   ENVOY_LOG(debug, "matched operation: {}", *operation);
+  // Spans are named by operation, also for the operations routed by the
+  // catch-all route.
+  decoder_callbacks_->activeSpan().setOperation(*operation);
   StreamInfo::FilterState& filter_state =
       decoder_callbacks_->streamInfo().filterState();
   Utils::setStringFilterState(filter_state, Utils::kOperation, *operation);
+  if (!operation_header.get().empty()) {
+    headers.addCopy(operation_header, *operation);
+  }
+
+  ProtobufWkt::Struct metadata;
+  (*metadata.mutable_fields())[kMetadataOperationKey].set_string_value(
+      *operation);
+  decoder_callbacks_->streamInfo().setDynamicMetadata(kMetadataNamespace,
+                                                      metadata);
 
   if (config_->needParameterExtraction(*operation)) {
     std::vector<VariableBinding> variable_bindings;
@@ -71,11 +90,13 @@ Http::FilterHeadersStatus Filter::decodeHeaders(Http::HeaderMap& headers,
   return Http::FilterHeadersStatus::Continue;
 }
 
-void Filter::rejectRequest(Http::Code code, absl::string_view error_msg) {
+void Filter::rejectRequest(const Http::HeaderMap& headers, Http::Code code,
+                           absl::string_view error_msg) {
   config_->stats().denied_.inc();
 
-  decoder_callbacks_->sendLocalReply(code, error_msg, nullptr, absl::nullopt,
-                                     RcDetails::get().PathNotDefined);
+  Utils::sendLocalReply(*decoder_callbacks_, config_->local_reply_config(),
+                        Grpc::Common::hasGrpcContentType(headers), code,
+                        error_msg, RcDetails::get().PathNotDefined);
   decoder_callbacks_->streamInfo().setResponseFlag(
       StreamInfo::ResponseFlag::UnauthorizedExternalService);
 }
@@ -24,6 +24,11 @@ namespace Extensions {
 namespace HttpFilters {
 namespace PathMatcher {
 
+// The operation is also set in the dynamic metadata, for the Envoy filters
+// that can not read the filter state, e.g. RBAC.
+constexpr char kMetadataNamespace[] = "envoy.filters.http.path_matcher";
+constexpr char kMetadataOperationKey[] = "operation";
+
 class Filter : public Http::PassThroughDecoderFilter,
                public Logger::Loggable<Logger::Id::filter> {
  public:
@@ -32,7 +37,8 @@ class Filter : public Http::PassThroughDecoderFilter,
   Http::FilterHeadersStatus decodeHeaders(Http::HeaderMap&, bool) override;
 
  private:
-  void rejectRequest(Http::Code code, absl::string_view error_msg);
+  void rejectRequest(const Http::HeaderMap& headers, Http::Code code,
+                     absl::string_view error_msg);
 
   const FilterConfigSharedPtr config_;
 };
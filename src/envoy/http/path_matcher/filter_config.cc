@@ -24,8 +24,10 @@ FilterConfig::FilterConfig(
     const std::string& stats_prefix,
     Server::Configuration::FactoryContext& context)
     : proto_config_(proto_config),
+      operation_header_(proto_config.operation_header()),
       stats_(generateStats(stats_prefix, context.scope())) {
   ::google::api_proxy::path_matcher::PathMatcherBuilder<const std::string*> pmb;
+  pmb.SetCaseInsensitive(proto_config_.case_insensitive_matching());
   for (const auto& rule : proto_config_.rules()) {
     if (!pmb.Register(rule.pattern().http_method(),
                       rule.pattern().uri_template(),
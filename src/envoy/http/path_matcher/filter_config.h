@@ -18,6 +18,7 @@
 
 #include "api/envoy/http/path_matcher/config.pb.h"
 #include "common/common/logger.h"
+#include "envoy/http/header_map.h"
 #include "envoy/runtime/runtime.h"
 #include "envoy/server/filter_config.h"
 #include "src/api_proxy/path_matcher/path_matcher.h"
@@ -74,6 +75,16 @@ class FilterConfig : public Logger::Loggable<Logger::Id::filter> {
 
   FilterStats& stats() { return stats_; }
 
+  const ::google::api::envoy::http::common::LocalReplyConfig&
+  local_reply_config() const {
+    return proto_config_.local_reply_config();
+  }
+
+  // The request header set to the operation, empty if it is not set.
+  const Http::LowerCaseString& operation_header() const {
+    return operation_header_;
+  }
+
   // Returns the mapp from snake-case segment name to JSON name.
   const absl::flat_hash_map<std::string, std::string>& getSnakeToJsonMap() {
     return snake_to_json_map_;
@@ -93,6 +104,7 @@ class FilterConfig : public Logger::Loggable<Logger::Id::filter> {
   // `Service.types` (e.g. "foo_bar" -> "fooBar").
   absl::flat_hash_map<std::string, std::string> snake_to_json_map_;
   absl::flat_hash_set<std::string> path_params_operations_;
+  const Http::LowerCaseString operation_header_;
   FilterStats stats_;
 };
 
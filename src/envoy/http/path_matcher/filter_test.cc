@@ -30,6 +30,7 @@ namespace {
 using Envoy::Http::MockStreamDecoderFilterCallbacks;
 using Envoy::Server::Configuration::MockFactoryContext;
 using ::google::protobuf::TextFormat;
+using ::testing::Eq;
 
 const char kFilterConfig[] = R"(
 rules {
@@ -73,6 +74,8 @@ class FilterTest : public ::testing::Test {
 TEST_F(FilterTest, DecodeHeadersWithOperation) {
   // Test: a request matches a operation
   Http::TestHeaderMapImpl headers{{":method", "GET"}, {":path", "/bar"}};
+  EXPECT_CALL(mock_cb_.active_span_,
+              setOperation(Eq("1.cloudesf_testing_cloud_goog.Bar")));
   EXPECT_EQ(Http::FilterHeadersStatus::Continue,
             filter_->decodeHeaders(headers, false));
 
@@ -82,6 +85,12 @@ TEST_F(FilterTest, DecodeHeadersWithOperation) {
   EXPECT_EQ(Utils::getStringFilterState(mock_cb_.stream_info_.filter_state_,
                                         Utils::kQueryParams),
             "");
+  EXPECT_EQ(mock_cb_.stream_info_.metadata_.filter_metadata()
+                .at(kMetadataNamespace)
+                .fields()
+                .at(kMetadataOperationKey)
+                .string_value(),
+            "1.cloudesf_testing_cloud_goog.Bar");
 
   EXPECT_EQ(1L, TestUtility::findCounter(mock_factory_context_.scope_,
                                          "path_matcher.allowed")
@@ -161,6 +170,65 @@ TEST_F(FilterTest, DecodeHeadersNoMatch) {
                     ->value());
 }
 
+TEST_F(FilterTest, DecodeHeadersNoMatchLocalReplyConfig) {
+  // Test: the rejection uses the local reply config
+  ::google::api::envoy::http::path_matcher::FilterConfig config_pb;
+  ASSERT_TRUE(TextFormat::ParseFromString(kFilterConfig, &config_pb));
+  auto* local_reply_config = config_pb.mutable_local_reply_config();
+  local_reply_config->set_body_format(
+      R"({"code":%CODE%,"message":"%MESSAGE%"})");
+  local_reply_config->set_content_type("application/json");
+  local_reply_config->set_status_code(400);
+  config_ =
+      std::make_shared<FilterConfig>(config_pb, "", mock_factory_context_);
+  filter_ = std::make_unique<Filter>(config_);
+  filter_->setDecoderFilterCallbacks(mock_cb_);
+
+  Http::TestHeaderMapImpl headers{{":method", "POST"}, {":path", "/bar"}};
+  EXPECT_CALL(mock_cb_, encodeHeaders_(testing::_, false))
+      .WillOnce(testing::Invoke([](Http::HeaderMap& headers, bool) {
+        EXPECT_EQ(headers.Status()->value().getStringView(), "400");
+        EXPECT_EQ(headers.ContentType()->value().getStringView(),
+                  "application/json");
+      }));
+  EXPECT_CALL(mock_cb_, encodeData(testing::_, true))
+      .WillOnce(testing::Invoke([](Buffer::Instance& data, bool) {
+        EXPECT_EQ(data.toString(),
+                  R"({"code":400,"message":"Path does not match any )"
+                  R"(requirement URI template."})");
+      }));
+
+  EXPECT_EQ(Http::FilterHeadersStatus::StopIteration,
+            filter_->decodeHeaders(headers, true));
+}
+
+TEST_F(FilterTest, DecodeHeadersSetsOperationHeader) {
+  // Test: the operation header is set to the operation, replacing the value
+  // sent by the client
+  ::google::api::envoy::http::path_matcher::FilterConfig config_pb;
+  ASSERT_TRUE(TextFormat::ParseFromString(kFilterConfig, &config_pb));
+  config_pb.set_operation_header("x-operation");
+  config_ =
+      std::make_shared<FilterConfig>(config_pb, "", mock_factory_context_);
+  filter_ = std::make_unique<Filter>(config_);
+  filter_->setDecoderFilterCallbacks(mock_cb_);
+
+  Http::TestHeaderMapImpl headers{{":method", "GET"},
+                                  {":path", "/bar"},
+                                  {"x-operation", "spoofed"}};
+  EXPECT_EQ(Http::FilterHeadersStatus::Continue,
+            filter_->decodeHeaders(headers, false));
+  EXPECT_EQ(headers.get_("x-operation"), "1.cloudesf_testing_cloud_goog.Bar");
+
+  // The header is also removed from the rejected requests.
+  Http::TestHeaderMapImpl no_match_headers{{":method", "POST"},
+                                           {":path", "/bar"},
+                                           {"x-operation", "spoofed"}};
+  EXPECT_EQ(Http::FilterHeadersStatus::StopIteration,
+            filter_->decodeHeaders(no_match_headers, true));
+  EXPECT_FALSE(no_match_headers.has("x-operation"));
+}
+
 }  // namespace
 
 }  // namespace PathMatcher
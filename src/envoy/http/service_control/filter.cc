@@ -14,10 +14,12 @@
 
 #include <chrono>
 
+#include "common/grpc/common.h"
 #include "common/grpc/status.h"
 #include "envoy/http/header_map.h"
 #include "src/envoy/http/service_control/filter.h"
 #include "src/envoy/http/service_control/handler.h"
+#include "src/envoy/utils/local_reply_utils.h"
 
 namespace Envoy {
 namespace Extensions {
@@ -51,6 +53,7 @@ Http::FilterHeadersStatus ServiceControlFilter::decodeHeaders(
 
   state_ = Calling;
   stopped_ = false;
+  is_grpc_ = Grpc::Common::hasGrpcContentType(headers);
 
   handler_->callCheck(headers, parent_span, *this);
 
@@ -88,9 +91,9 @@ void ServiceControlFilter::rejectRequest(Http::Code code,
   stats_.denied_.inc();
   state_ = Responded;
 
-  decoder_callbacks_->sendLocalReply(
-      code, error_msg, nullptr, absl::nullopt,
-      RcDetails::get().RejectedByServiceControlCheck);
+  Utils::sendLocalReply(*decoder_callbacks_, local_reply_config_, is_grpc_,
+                        code, error_msg,
+                        RcDetails::get().RejectedByServiceControlCheck);
   decoder_callbacks_->streamInfo().setResponseFlag(
       StreamInfo::ResponseFlag::UnauthorizedExternalService);
 }
@@ -18,6 +18,7 @@
 #include "envoy/access_log/access_log.h"
 #include "envoy/http/filter.h"
 #include "envoy/http/header_map.h"
+#include "api/envoy/http/common/base.pb.h"
 #include "extensions/filters/http/common/pass_through_filter.h"
 #include "src/envoy/http/service_control/filter_stats.h"
 #include "src/envoy/http/service_control/handler.h"
@@ -35,9 +36,14 @@ class ServiceControlFilter : public Http::PassThroughFilter,
                              public ServiceControlHandler::CheckDoneCallback,
                              public Logger::Loggable<Logger::Id::filter> {
  public:
-  ServiceControlFilter(ServiceControlFilterStats& stats,
-                       const ServiceControlHandlerFactory& factory)
-      : stats_(stats), factory_(factory) {}
+  ServiceControlFilter(
+      ServiceControlFilterStats& stats,
+      const ServiceControlHandlerFactory& factory,
+      const ::google::api::envoy::http::common::LocalReplyConfig&
+          local_reply_config)
+      : stats_(stats),
+        factory_(factory),
+        local_reply_config_(local_reply_config) {}
 
   void onDestroy() override;
 
@@ -68,6 +74,8 @@ class ServiceControlFilter : public Http::PassThroughFilter,
 
   ServiceControlFilterStats& stats_;
   const ServiceControlHandlerFactory& factory_;
+  const ::google::api::envoy::http::common::LocalReplyConfig&
+      local_reply_config_;
 
   // The service control request handler
   std::unique_ptr<ServiceControlHandler> handler_;
@@ -77,6 +85,8 @@ class ServiceControlFilter : public Http::PassThroughFilter,
   State state_ = Init;
   // Mark if request has been stopped.
   bool stopped_ = false;
+  // Mark if the request is a gRPC request, for the local replies.
+  bool is_grpc_ = false;
 };
 
 }  // namespace ServiceControl
@@ -50,6 +50,11 @@ class ServiceControlFilterConfig : public Logger::Loggable<Logger::Id::filter>,
     return handler_factory_;
   }
 
+  const ::google::api::envoy::http::common::LocalReplyConfig&
+  local_reply_config() const {
+    return proto_config_->local_reply_config();
+  }
+
  private:
   FilterConfigProtoSharedPtr proto_config_;
   ServiceControlCallFactoryImpl call_factory_;
@@ -47,7 +47,8 @@ class FilterFactory
     return
         [filter_config](Http::FilterChainFactoryCallbacks& callbacks) -> void {
           auto filter = std::make_shared<ServiceControlFilter>(
-              filter_config->stats(), filter_config->handler_factory());
+              filter_config->stats(), filter_config->handler_factory(),
+              filter_config->local_reply_config());
           callbacks.addStreamFilter(Http::StreamFilterSharedPtr(filter));
           callbacks.addAccessLogHandler(AccessLog::InstanceSharedPtr(filter));
         };
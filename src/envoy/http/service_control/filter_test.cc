@@ -46,13 +46,14 @@ class FilterTest : public ::testing::Test {
   FilterTest() : stats_base_("", mock_stats_scope_) {}
 
   void SetUp() override {
-    filter_ = std::make_unique<ServiceControlFilter>(stats_base_.stats(),
-                                                     mock_handler_factory_);
+    filter_ = std::make_unique<ServiceControlFilter>(
+        stats_base_.stats(), mock_handler_factory_, local_reply_config_);
     filter_->setDecoderFilterCallbacks(mock_decoder_callbacks_);
 
     mock_span_ = std::make_unique<Envoy::Tracing::MockSpan>();
   }
 
+  ::google::api::envoy::http::common::LocalReplyConfig local_reply_config_;
   std::unique_ptr<ServiceControlFilter> filter_;
   testing::NiceMock<MockStreamDecoderFilterCallbacks> mock_decoder_callbacks_;
   testing::NiceMock<MockFactoryContext> mock_factory_context_;
@@ -114,6 +115,34 @@ TEST_F(FilterTest, DecodeHeadersSyncBadStatus) {
             filter_->decodeHeaders(headers_, true));
 }
 
+TEST_F(FilterTest, DecodeHeadersSyncBadStatusLocalReplyConfig) {
+  // Test: The rejection uses the local reply config
+  local_reply_config_.set_body_format(R"({"message":"%MESSAGE%"})");
+  local_reply_config_.set_content_type("application/json");
+  auto* mock_handler = new testing::NiceMock<MockServiceControlHandler>();
+  EXPECT_CALL(mock_handler_factory_, createHandler_(_, _))
+      .WillOnce(Return(mock_handler));
+  EXPECT_CALL(*mock_handler, callCheck(_, _, _))
+      .WillOnce(Invoke([](Http::HeaderMap&, Envoy::Tracing::Span&,
+                          ServiceControlHandler::CheckDoneCallback& callback) {
+        callback.onCheckDone(kBadStatus);
+      }));
+
+  EXPECT_CALL(mock_decoder_callbacks_, encodeHeaders_(_, false))
+      .WillOnce(Invoke([](Http::HeaderMap& headers, bool) {
+        EXPECT_EQ(headers.Status()->value().getStringView(), "401");
+        EXPECT_EQ(headers.ContentType()->value().getStringView(),
+                  "application/json");
+      }));
+  EXPECT_CALL(mock_decoder_callbacks_, encodeData(_, true))
+      .WillOnce(Invoke([](Buffer::Instance& data, bool) {
+        EXPECT_EQ(data.toString(), R"({"message":"UNAUTHENTICATED:test"})");
+      }));
+
+  EXPECT_EQ(Http::FilterHeadersStatus::StopIteration,
+            filter_->decodeHeaders(headers_, true));
+}
+
 TEST_F(FilterTest, DecodeHeadersAsyncGoodStatus) {
   // Test: While Filter is Calling/stopped, onCheckDone calls
   // continueDecoding
@@ -15,6 +15,7 @@
 #include <chrono>
 
 #include "absl/strings/match.h"
+#include "absl/strings/str_cat.h"
 #include "common/http/utility.h"
 #include "extensions/filters/http/grpc_stats/grpc_stats_filter.h"
 #include "src/envoy/http/service_control/handler_impl.h"
@@ -43,6 +44,7 @@ const Http::LowerCaseString kRefererHeader{"referer"};
 
 constexpr char JwtPayloadIssuerPath[] = "iss";
 constexpr char JwtPayloadAuidencePath[] = "aud";
+constexpr char JwtPayloadSubPath[] = "sub";
 
 ServiceControlHandlerImpl::ServiceControlHandlerImpl(
     const Http::HeaderMap& headers, const StreamInfo::StreamInfo& stream_info,
@@ -144,6 +146,8 @@ void ServiceControlHandlerImpl::prepareReportRequest(
 void ServiceControlHandlerImpl::callCheck(Http::HeaderMap& headers,
                                           Envoy::Tracing::Span& parent_span,
                                           CheckDoneCallback& callback) {
+  setConsumerHeaders(headers);
+
   if (!isConfigured()) {
     callback.onCheckDone(Status(Code::NOT_FOUND, "Method does not exist."));
     return;
@@ -191,8 +195,55 @@ void ServiceControlHandlerImpl::callCheck(Http::HeaderMap& headers,
   }
 }
 
+void ServiceControlHandlerImpl::setConsumerHeaders(Http::HeaderMap& headers) {
+  // Always remove the client values so they can not be spoofed.
+  const auto& api_key_header = cfg_parser_.config().api_key_header();
+  if (!api_key_header.empty()) {
+    const Http::LowerCaseString header(api_key_header);
+    headers.remove(header);
+    // Only an api key verified by Check identifies the consumer.
+    if (isConfigured() && isCheckRequired() && hasApiKey()) {
+      headers.addCopy(header, api_key_);
+    }
+  }
+
+  const auto& jwt_sub_header = cfg_parser_.config().jwt_sub_header();
+  if (!jwt_sub_header.empty()) {
+    const Http::LowerCaseString header(jwt_sub_header);
+    headers.remove(header);
+    if (isConfigured()) {
+      std::string sub;
+      fillJwtPayload(
+          stream_info_.dynamicMetadata(),
+          require_ctx_->service_ctx().config().jwt_payload_metadata_name(),
+          JwtPayloadSubPath, sub);
+      if (!sub.empty()) {
+        headers.addCopy(header, sub);
+      }
+    }
+  }
+}
+
 // TODO(taoxuy): add unit test
 void ServiceControlHandlerImpl::callQuota() {
+  const auto& local_quota_limits = require_ctx_->config().local_quota_limits();
+  if (!local_quota_limits.empty()) {
+    // The api key is only trusted once Check has verified it, otherwise a
+    // client could get new buckets by sending new keys.
+    const std::string consumer =
+        isCheckRequired()
+            ? absl::StrCat("api_key:", api_key_)
+            : absl::StrCat("ip:", stream_info_.downstreamRemoteAddress()
+                                      ->ip()
+                                      ->addressAsString());
+    check_status_ = require_ctx_->service_ctx().call().allocateLocalQuota(
+        local_quota_limits, consumer);
+    if (!check_status_.ok()) {
+      check_callback_->onCheckDone(check_status_);
+      return;
+    }
+  }
+
   if (!isQuotaRequired()) {
     check_callback_->onCheckDone(check_status_);
     return;
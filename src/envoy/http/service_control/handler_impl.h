@@ -64,6 +64,9 @@ class ServiceControlHandlerImpl : public Logger::Loggable<Logger::Id::filter>,
  private:
   void callQuota();
 
+  // Sets the headers the rate limit descriptors are built from.
+  void setConsumerHeaders(Http::HeaderMap& headers);
+
   void fillOperationInfo(
       ::google::api_proxy::service_control::OperationInfo& info);
   void prepareReportRequest(
@@ -37,6 +37,7 @@ using ::google::protobuf::TextFormat;
 using ::google::protobuf::util::Status;
 using ::google::protobuf::util::error::Code;
 using ::testing::_;
+using ::testing::Eq;
 using ::testing::MockFunction;
 using ::testing::Return;
 
@@ -144,6 +145,37 @@ requirements {
       cookie: "api_key"
     }
   }
+}
+requirements {
+  service_name: "echo"
+  api_name: "test_api"
+  api_version: "test_version"
+  operation_name: "get_header_key_local_quota"
+  api_key: {
+    allow_without_api_key: false
+    locations: {
+      header: "x-api-key"
+    }
+  }
+  local_quota_limits: {
+    name: "local_limit"
+    cost: 1
+    tokens_per_minute: 10
+  }
+}
+requirements {
+  service_name: "echo"
+  api_name: "test_api"
+  api_version: "test_version"
+  operation_name: "get_no_key_local_quota"
+  api_key: {
+    allow_without_api_key: true
+  }
+  local_quota_limits: {
+    name: "local_limit"
+    cost: 1
+    tokens_per_minute: 10
+  }
 })";
 
 class HandlerTest : public ::testing::Test {
@@ -1129,6 +1161,140 @@ TEST_F(HandlerTest, FinalReports) {
   handler.callReport(&headers, &response_headers, &response_headers, time);
 }
 
+TEST_F(HandlerTest, HandlerLocalQuotaKeyedByApiKey) {
+  // Test: the local quota is allocated after Check, for the verified api key.
+  Utils::setStringFilterState(mock_stream_info_.filter_state_,
+                              Utils::kOperation, "get_header_key_local_quota");
+  Http::TestHeaderMapImpl headers{
+      {":method", "GET"}, {":path", "/echo"}, {"x-api-key", "foobar"}};
+  ServiceControlHandlerImpl handler(headers, mock_stream_info_, "test-uuid",
+                                    *cfg_parser_);
+
+  CheckResponseInfo response_info;
+  response_info.is_api_key_valid = true;
+  response_info.service_is_activated = true;
+  EXPECT_CALL(*mock_call_, callCheck(_, _, _))
+      .WillOnce(Invoke([&response_info](const CheckRequestInfo&,
+                                        Envoy::Tracing::Span&,
+                                        CheckDoneFunc on_done) {
+        on_done(Status::OK, response_info);
+        return nullptr;
+      }));
+  EXPECT_CALL(*mock_call_, allocateLocalQuota(_, Eq("api_key:foobar")))
+      .WillOnce(Return(Status::OK));
+  EXPECT_CALL(*mock_call_, callQuota(_, _)).Times(0);
+  EXPECT_CALL(mock_check_done_callback_, onCheckDone(Status::OK));
+  handler.callCheck(headers, *mock_span_, mock_check_done_callback_);
+}
+
+TEST_F(HandlerTest, HandlerLocalQuotaKeyedByClientIp) {
+  // Test: without Check, the local quota is allocated for the client IP, and
+  // its rejection is the check status.
+  Utils::setStringFilterState(mock_stream_info_.filter_state_,
+                              Utils::kOperation, "get_no_key_local_quota");
+  Http::TestHeaderMapImpl headers{
+      {":method", "GET"}, {":path", "/echo"}, {"x-api-key", "foobar"}};
+  ServiceControlHandlerImpl handler(headers, mock_stream_info_, "test-uuid",
+                                    *cfg_parser_);
+
+  const Status exhausted(Code::RESOURCE_EXHAUSTED,
+                         "Quota exceeded for local quota limit local_limit");
+  EXPECT_CALL(*mock_call_, callCheck(_, _, _)).Times(0);
+  EXPECT_CALL(*mock_call_, allocateLocalQuota(_, Eq("ip:127.0.0.1")))
+      .WillOnce(Return(exhausted));
+  EXPECT_CALL(mock_check_done_callback_, onCheckDone(exhausted));
+  handler.callCheck(headers, *mock_span_, mock_check_done_callback_);
+}
+
+const char kConsumerHeadersFilterConfig[] = R"(
+services {
+  service_name: "echo"
+  backend_protocol: "http1"
+  producer_project_id: "project-id"
+  jwt_payload_metadata_name: "jwt_payloads"
+}
+requirements {
+  service_name: "echo"
+  operation_name: "get_header_key"
+  api_key: {
+    locations: {
+      header: "x-api-key"
+    }
+  }
+}
+requirements {
+  service_name: "echo"
+  operation_name: "get_no_key"
+  api_key: {
+    allow_without_api_key: true
+    locations: {
+      header: "x-api-key"
+    }
+  }
+}
+api_key_header: "x-rate-limit-api-key"
+jwt_sub_header: "x-rate-limit-jwt-sub")";
+
+const char kJwtSubMetadata[] = R"(
+filter_metadata {
+  key: "envoy.filters.http.jwt_authn"
+  value {
+    fields {
+      key: "jwt_payloads"
+      value {
+        struct_value {
+          fields {
+            key: "sub"
+            value { string_value: "test-user" }
+          }
+        }
+      }
+    }
+  }
+})";
+
+TEST_F(HandlerTest, HandlerSetsConsumerHeaders) {
+  // Test: the api key and the JWT sub claim are copied to the configured
+  // headers, replacing the values sent by the client.
+  setUp(kConsumerHeadersFilterConfig);
+  ASSERT_TRUE(TextFormat::ParseFromString(kJwtSubMetadata,
+                                          &mock_stream_info_.metadata_));
+  Utils::setStringFilterState(mock_stream_info_.filter_state_,
+                              Utils::kOperation, "get_header_key");
+  Http::TestHeaderMapImpl headers{{":method", "GET"},
+                                  {":path", "/echo"},
+                                  {"x-api-key", "foobar"},
+                                  {"x-rate-limit-api-key", "spoofed"},
+                                  {"x-rate-limit-jwt-sub", "spoofed"}};
+  ServiceControlHandlerImpl handler(headers, mock_stream_info_, "test-uuid",
+                                    *cfg_parser_);
+
+  EXPECT_CALL(*mock_call_, callCheck(_, _, _)).WillOnce(Return(nullptr));
+  handler.callCheck(headers, *mock_span_, mock_check_done_callback_);
+  EXPECT_EQ(headers.get_("x-rate-limit-api-key"), "foobar");
+  EXPECT_EQ(headers.get_("x-rate-limit-jwt-sub"), "test-user");
+}
+
+TEST_F(HandlerTest, HandlerRemovesUnverifiedConsumerHeaders) {
+  // Test: an api key that is not checked is not copied, and the client values
+  // are still removed.
+  setUp(kConsumerHeadersFilterConfig);
+  Utils::setStringFilterState(mock_stream_info_.filter_state_,
+                              Utils::kOperation, "get_no_key");
+  Http::TestHeaderMapImpl headers{{":method", "GET"},
+                                  {":path", "/echo"},
+                                  {"x-api-key", "foobar"},
+                                  {"x-rate-limit-api-key", "spoofed"},
+                                  {"x-rate-limit-jwt-sub", "spoofed"}};
+  ServiceControlHandlerImpl handler(headers, mock_stream_info_, "test-uuid",
+                                    *cfg_parser_);
+
+  EXPECT_CALL(mock_check_done_callback_, onCheckDone(Status::OK));
+  handler.callCheck(headers, *mock_span_, mock_check_done_callback_);
+  EXPECT_FALSE(headers.has("x-rate-limit-api-key"));
+  EXPECT_FALSE(headers.has("x-rate-limit-jwt-sub"));
+}
+
 }  // namespace
 }  // namespace ServiceControl
 }  // namespace HttpFilters
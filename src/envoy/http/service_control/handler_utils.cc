@@ -63,7 +63,8 @@ bool extractAPIKeyFromQuery(const Http::HeaderMap& headers,
 
   const auto& it = parsed_params.find(query);
   if (it != parsed_params.end()) {
-    api_key = it->second;
+    // parseQueryString() does not decode the values.
+    api_key = Http::Utility::PercentEncoding::decode(it->second);
     return true;
   }
   return false;
@@ -229,6 +229,13 @@ TEST(ServiceControlUtils, ExtractApiKey) {
           "foobar",
       },
 
+      // Test: apikey in query location is URL decoded
+      {
+          R"(locations: { query: "apikey" } )",
+          {{":path", "/echo?apikey=foo%2Bbar%3D"}},
+          "foo+bar=",
+      },
+
       // Test: find apikey in one of multiple query locations
       {
           R"(
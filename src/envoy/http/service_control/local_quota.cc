@@ -0,0 +1,100 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <algorithm>
+#include <chrono>
+#include <vector>
+
+#include "absl/strings/str_cat.h"
+#include "src/envoy/http/service_control/local_quota.h"
+
+using ::google::api::envoy::http::service_control::LocalQuotaLimit;
+using ::google::protobuf::util::Status;
+using ::google::protobuf::util::error::Code;
+
+namespace Envoy {
+namespace Extensions {
+namespace HttpFilters {
+namespace ServiceControl {
+namespace {
+
+constexpr std::chrono::seconds kRefillPeriod(60);
+
+}  // namespace
+
+LocalQuotaBuckets::LocalQuotaBuckets(TimeSource& time_source)
+    : time_source_(time_source), last_sweep_(time_source.monotonicTime()) {}
+
+void LocalQuotaBuckets::refill(Bucket& bucket, MonotonicTime now) {
+  const double elapsed =
+      std::chrono::duration<double>(now - bucket.updated).count();
+  const double refilled =
+      elapsed * bucket.tokens_per_minute / kRefillPeriod.count();
+  bucket.tokens =
+      std::min<double>(bucket.tokens_per_minute, bucket.tokens + refilled);
+  bucket.updated = now;
+}
+
+void LocalQuotaBuckets::sweep(MonotonicTime now) {
+  if (now - last_sweep_ < kRefillPeriod) {
+    return;
+  }
+  last_sweep_ = now;
+  for (auto it = buckets_.begin(); it != buckets_.end();) {
+    refill(it->second, now);
+    if (it->second.tokens >= it->second.tokens_per_minute) {
+      it = buckets_.erase(it);
+    } else {
+      ++it;
+    }
+  }
+}
+
+Status LocalQuotaBuckets::allocate(
+    const ::google::protobuf::RepeatedPtrField<LocalQuotaLimit>& limits,
+    absl::string_view consumer) {
+  const MonotonicTime now = time_source_.monotonicTime();
+  sweep(now);
+
+  // The tokens are only taken if all the limits allow the request.
+  std::vector<std::pair<Bucket*, int64_t>> taken;
+  for (const auto& limit : limits) {
+    const std::string key = absl::StrCat(limit.name(), "|", consumer);
+    auto it = buckets_.find(key);
+    if (it == buckets_.end()) {
+      it = buckets_
+               .emplace(key,
+                        Bucket{static_cast<double>(limit.tokens_per_minute()),
+                               limit.tokens_per_minute(), now})
+               .first;
+    } else {
+      refill(it->second, now);
+    }
+    if (it->second.tokens < limit.cost()) {
+      return Status(Code::RESOURCE_EXHAUSTED,
+                    absl::StrCat("Quota exceeded for local quota limit ",
+                                 limit.name()));
+    }
+    taken.emplace_back(&it->second, limit.cost());
+  }
+  for (const auto& bucket_cost : taken) {
+    bucket_cost.first->tokens -= bucket_cost.second;
+  }
+  return Status::OK;
+}
+
+}  // namespace ServiceControl
+}  // namespace HttpFilters
+}  // namespace Extensions
+}  // namespace Envoy
@@ -0,0 +1,69 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#pragma once
+
+#include <string>
+#include <unordered_map>
+
+#include "absl/strings/string_view.h"
+#include "api/envoy/http/service_control/requirement.pb.h"
+#include "envoy/common/time.h"
+#include "google/protobuf/repeated_field.h"
+#include "google/protobuf/stubs/status.h"
+
+namespace Envoy {
+namespace Extensions {
+namespace HttpFilters {
+namespace ServiceControl {
+
+// The token buckets of the local quota limits, one per limit and consumer.
+// It is not thread safe: each worker thread has its own buckets.
+class LocalQuotaBuckets {
+ public:
+  explicit LocalQuotaBuckets(TimeSource& time_source);
+
+  // Takes the cost of each limit from the bucket of the consumer, only if all
+  // the buckets have enough tokens. Otherwise returns RESOURCE_EXHAUSTED with
+  // the name of the exceeded limit.
+  ::google::protobuf::util::Status allocate(
+      const ::google::protobuf::RepeatedPtrField<
+          ::google::api::envoy::http::service_control::LocalQuotaLimit>&
+          limits,
+      absl::string_view consumer);
+
+ private:
+  struct Bucket {
+    double tokens;
+    int64_t tokens_per_minute;
+    MonotonicTime updated;
+  };
+
+  // Adds the tokens refilled since the last update.
+  static void refill(Bucket& bucket, MonotonicTime now);
+
+  // Drops the full buckets once a minute, to bound the memory.
+  void sweep(MonotonicTime now);
+
+  TimeSource& time_source_;
+  // The buckets keyed by limit name and consumer. The buckets must not move
+  // when new ones are added, as allocate() holds pointers to them.
+  std::unordered_map<std::string, Bucket> buckets_;
+  MonotonicTime last_sweep_;
+};
+
+}  // namespace ServiceControl
+}  // namespace HttpFilters
+}  // namespace Extensions
+}  // namespace Envoy
@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "src/envoy/http/service_control/local_quota.h"
+#include "gmock/gmock.h"
+#include "google/protobuf/text_format.h"
+#include "gtest/gtest.h"
+#include "test/mocks/common.h"
+
+using ::google::api::envoy::http::service_control::Requirement;
+using ::google::protobuf::TextFormat;
+using ::google::protobuf::util::Status;
+using ::google::protobuf::util::error::Code;
+using ::testing::Invoke;
+using ::testing::NiceMock;
+
+namespace Envoy {
+namespace Extensions {
+namespace HttpFilters {
+namespace ServiceControl {
+namespace {
+
+const char kRequirement[] = R"(
+service_name: "echo"
+operation_name: "echo"
+local_quota_limits {
+  name: "read-limit"
+  cost: 1
+  tokens_per_minute: 3
+}
+local_quota_limits {
+  name: "write-limit"
+  cost: 2
+  tokens_per_minute: 4
+}
+)";
+
+class LocalQuotaBucketsTest : public ::testing::Test {
+ protected:
+  void SetUp() override {
+    ASSERT_TRUE(TextFormat::ParseFromString(kRequirement, &requirement_));
+    ON_CALL(time_source_, monotonicTime()).WillByDefault(Invoke([this]() {
+      return now_;
+    }));
+    buckets_ = std::make_unique<LocalQuotaBuckets>(time_source_);
+  }
+
+  Status allocate(absl::string_view consumer) {
+    return buckets_->allocate(requirement_.local_quota_limits(), consumer);
+  }
+
+  Requirement requirement_;
+  MonotonicTime now_;
+  NiceMock<MockTimeSystem> time_source_;
+  std::unique_ptr<LocalQuotaBuckets> buckets_;
+};
+
+TEST_F(LocalQuotaBucketsTest, ExceededLimit) {
+  // Test: the write limit allows 2 requests, the third one is rejected.
+  EXPECT_TRUE(allocate("api_key:key-1").ok());
+  EXPECT_TRUE(allocate("api_key:key-1").ok());
+  EXPECT_EQ(allocate("api_key:key-1"),
+            Status(Code::RESOURCE_EXHAUSTED,
+                   "Quota exceeded for local quota limit write-limit"));
+}
+
+TEST_F(LocalQuotaBucketsTest, RejectedRequestTakesNoToken) {
+  // Test: the tokens of the read limit are not taken by the requests rejected
+  // by the write limit.
+  requirement_.mutable_local_quota_limits(1)->set_tokens_per_minute(1);
+  EXPECT_FALSE(allocate("api_key:key-1").ok());
+  EXPECT_FALSE(allocate("api_key:key-1").ok());
+
+  requirement_.mutable_local_quota_limits()->RemoveLast();
+  EXPECT_TRUE(allocate("api_key:key-1").ok());
+  EXPECT_TRUE(allocate("api_key:key-1").ok());
+  EXPECT_TRUE(allocate("api_key:key-1").ok());
+  EXPECT_FALSE(allocate("api_key:key-1").ok());
+}
+
+TEST_F(LocalQuotaBucketsTest, ConsumersHaveTheirOwnBuckets) {
+  EXPECT_TRUE(allocate("api_key:key-1").ok());
+  EXPECT_TRUE(allocate("api_key:key-1").ok());
+  EXPECT_FALSE(allocate("api_key:key-1").ok());
+
+  EXPECT_TRUE(allocate("api_key:key-2").ok());
+  EXPECT_TRUE(allocate("ip:10.0.0.1").ok());
+}
+
+TEST_F(LocalQuotaBucketsTest, Refill) {
+  // Test: the buckets are refilled in one minute, and never above their size.
+  EXPECT_TRUE(allocate("api_key:key-1").ok());
+  EXPECT_TRUE(allocate("api_key:key-1").ok());
+  EXPECT_FALSE(allocate("api_key:key-1").ok());
+
+  // Half a minute refills 2 tokens of the write limit.
+  now_ += std::chrono::seconds(30);
+  EXPECT_TRUE(allocate("api_key:key-1").ok());
+  EXPECT_FALSE(allocate("api_key:key-1").ok());
+
+  // Ten minutes only fill the buckets.
+  now_ += std::chrono::minutes(10);
+  EXPECT_TRUE(allocate("api_key:key-1").ok());
+  EXPECT_TRUE(allocate("api_key:key-1").ok());
+  EXPECT_FALSE(allocate("api_key:key-1").ok());
+}
+
+}  // namespace
+}  // namespace ServiceControl
+}  // namespace HttpFilters
+}  // namespace Extensions
+}  // namespace Envoy
@@ -71,6 +71,14 @@ class MockServiceControlCall : public ServiceControlCall {
       void(const ::google::api_proxy::service_control::QuotaRequestInfo& info,
            QuotaDoneFunc on_done));
 
+  MOCK_METHOD2(
+      allocateLocalQuota,
+      ::google::protobuf::util::Status(
+          const ::google::protobuf::RepeatedPtrField<
+              ::google::api::envoy::http::service_control::LocalQuotaLimit>&
+              limits,
+          absl::string_view consumer));
+
   MOCK_METHOD1(
       callReport,
       void(const ::google::api_proxy::service_control::ReportRequestInfo&
@@ -14,6 +14,7 @@
 
 #pragma once
 
+#include "absl/strings/string_view.h"
 #include "api/envoy/http/service_control/config.pb.h"
 #include "envoy/common/pure.h"
 #include "envoy/tracing/http_tracer.h"
@@ -38,6 +39,14 @@ class ServiceControlCall {
           request_info,
       QuotaDoneFunc on_done) PURE;
 
+  // Takes the tokens of the local quota limits from the buckets of the
+  // consumer. The buckets are not shared by the worker threads.
+  virtual ::google::protobuf::util::Status allocateLocalQuota(
+      const ::google::protobuf::RepeatedPtrField<
+          ::google::api::envoy::http::service_control::LocalQuotaLimit>&
+          limits,
+      absl::string_view consumer) PURE;
+
   virtual void callReport(
       const ::google::api_proxy::service_control::ReportRequestInfo&
           request_info) PURE;
@@ -184,6 +184,13 @@ void ServiceControlCallImpl::callQuota(
   getTLCache().client_cache().callQuota(request, on_done);
 }
 
+::google::protobuf::util::Status ServiceControlCallImpl::allocateLocalQuota(
+    const ::google::protobuf::RepeatedPtrField<
+        ::google::api::envoy::http::service_control::LocalQuotaLimit>& limits,
+    absl::string_view consumer) {
+  return getTLCache().local_quota_buckets().allocate(limits, consumer);
+}
+
 void ServiceControlCallImpl::callReport(
     const ::google::api_proxy::service_control::ReportRequestInfo&
         request_info) {
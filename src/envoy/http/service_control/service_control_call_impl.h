@@ -22,6 +22,7 @@
 #include "google/api/service.pb.h"
 #include "src/api_proxy/service_control/request_builder.h"
 #include "src/envoy/http/service_control/client_cache.h"
+#include "src/envoy/http/service_control/local_quota.h"
 #include "src/envoy/http/service_control/service_control_call.h"
 #include "src/envoy/utils/iam_token_subscriber.h"
 #include "src/envoy/utils/imds_token_subscriber.h"
@@ -51,7 +52,8 @@ class ThreadLocalCache : public ThreadLocal::ThreadLocalObject {
       : client_cache_(
             config, filter_config, cm, time_source, dispatcher,
             [this]() -> const std::string& { return sc_token(); },
-            [this]() -> const std::string& { return quota_token(); }) {}
+            [this]() -> const std::string& { return quota_token(); }),
+        local_quota_buckets_(time_source) {}
 
   void set_sc_token(TokenSharedPtr sc_token) { sc_token_ = sc_token; }
   const std::string& sc_token() const {
@@ -72,10 +74,13 @@ class ThreadLocalCache : public ThreadLocal::ThreadLocalObject {
 
   ClientCache& client_cache() { return client_cache_; }
 
+  LocalQuotaBuckets& local_quota_buckets() { return local_quota_buckets_; }
+
  private:
   TokenSharedPtr sc_token_;
   TokenSharedPtr quota_token_;
   ClientCache client_cache_;
+  LocalQuotaBuckets local_quota_buckets_;
 };
 
 typedef std::shared_ptr<
@@ -99,6 +104,12 @@ class ServiceControlCallImpl : public ServiceControlCall,
                      request_info,
                  QuotaDoneFunc on_done) override;
 
+  ::google::protobuf::util::Status allocateLocalQuota(
+      const ::google::protobuf::RepeatedPtrField<
+          ::google::api::envoy::http::service_control::LocalQuotaLimit>&
+          limits,
+      absl::string_view consumer) override;
+
   void callReport(const ::google::api_proxy::service_control::ReportRequestInfo&
                       request_info) override;
 
@@ -0,0 +1,116 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "src/envoy/utils/local_reply_utils.h"
+
+#include "absl/strings/str_cat.h"
+#include "absl/strings/str_replace.h"
+#include "common/common/enum_to_int.h"
+#include "common/grpc/status.h"
+#include "common/http/headers.h"
+
+namespace Envoy {
+namespace Extensions {
+namespace Utils {
+
+namespace {
+
+constexpr char kCodeKey[] = "%CODE%";
+constexpr char kGrpcCodeKey[] = "%GRPC_CODE%";
+constexpr char kMessageKey[] = "%MESSAGE%";
+
+// Escapes the message to be put inside a JSON string.
+std::string jsonEscape(absl::string_view message) {
+  std::string escaped;
+  escaped.reserve(message.size());
+  for (const char c : message) {
+    switch (c) {
+      case '"':
+        escaped.append("\\\"");
+        break;
+      case '\\':
+        escaped.append("\\\\");
+        break;
+      case '\n':
+        escaped.append("\\n");
+        break;
+      case '\r':
+        escaped.append("\\r");
+        break;
+      case '\t':
+        escaped.append("\\t");
+        break;
+      default:
+        if (static_cast<unsigned char>(c) < 0x20) {
+          absl::StrAppend(&escaped, "\\u00",
+                          absl::Hex(static_cast<unsigned char>(c),
+                                    absl::kZeroPad2));
+        } else {
+          escaped.push_back(c);
+        }
+    }
+  }
+  return escaped;
+}
+
+}  // namespace
+
+std::string renderLocalReplyBody(
+    const ::google::api::envoy::http::common::LocalReplyConfig& config,
+    Envoy::Http::Code code, absl::string_view message) {
+  if (config.body_format().empty()) {
+    return std::string(message);
+  }
+  const uint64_t http_code = enumToInt(code);
+  const uint64_t grpc_code =
+      enumToInt(Grpc::Utility::httpToGrpcStatus(http_code));
+  // The message is substituted last, so that it can not inject the other keys.
+  std::string body = absl::StrReplaceAll(
+      config.body_format(), {{kCodeKey, absl::StrCat(http_code)},
+                             {kGrpcCodeKey, absl::StrCat(grpc_code)}});
+  return absl::StrReplaceAll(body, {{kMessageKey, jsonEscape(message)}});
+}
+
+void sendLocalReply(
+    Envoy::Http::StreamDecoderFilterCallbacks& callbacks,
+    const ::google::api::envoy::http::common::LocalReplyConfig& config,
+    bool is_grpc, Envoy::Http::Code code, absl::string_view message,
+    absl::string_view details) {
+  if (config.status_code() != 0) {
+    code = static_cast<Envoy::Http::Code>(config.status_code());
+  }
+  if (is_grpc || config.body_format().empty()) {
+    callbacks.sendLocalReply(code, message, nullptr, absl::nullopt, details);
+    return;
+  }
+
+  // Envoy sets a text/plain content type for the body, so it is replaced
+  // after the fact.
+  const std::string content_type = config.content_type();
+  callbacks.sendLocalReply(
+      code, renderLocalReplyBody(config, code, message),
+      [content_type](Envoy::Http::HeaderMap& headers) {
+        if (content_type.empty()) {
+          return;
+        }
+        headers.remove(Envoy::Http::Headers::get().ContentType);
+        headers.addCopy(Envoy::Http::Headers::get().ContentType,
+                        content_type);
+      },
+      absl::nullopt, details);
+}
+
+}  // namespace Utils
+}  // namespace Extensions
+}  // namespace Envoy
@@ -0,0 +1,44 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#pragma once
+
+#include <string>
+
+#include "api/envoy/http/common/base.pb.h"
+#include "envoy/http/codes.h"
+#include "envoy/http/filter.h"
+
+namespace Envoy {
+namespace Extensions {
+namespace Utils {
+
+// Returns the body of a local reply for the error message, rendered from the
+// body format of the config. Returns the message if there is no body format.
+std::string renderLocalReplyBody(
+    const ::google::api::envoy::http::common::LocalReplyConfig& config,
+    Envoy::Http::Code code, absl::string_view message);
+
+// Sends the local reply of a filter rejecting a request, with the status code
+// and the body of the local reply config. gRPC requests only get the status
+// code overridden, the message is sent in grpc-message.
+void sendLocalReply(
+    Envoy::Http::StreamDecoderFilterCallbacks& callbacks,
+    const ::google::api::envoy::http::common::LocalReplyConfig& config,
+    bool is_grpc, Envoy::Http::Code code, absl::string_view message,
+    absl::string_view details);
+
+}  // namespace Utils
+}  // namespace Extensions
+}  // namespace Envoy
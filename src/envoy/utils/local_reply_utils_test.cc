@@ -0,0 +1,96 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "src/envoy/utils/local_reply_utils.h"
+
+#include "gmock/gmock.h"
+#include "gtest/gtest.h"
+#include "test/mocks/http/mocks.h"
+#include "test/test_common/utility.h"
+
+using ::google::api::envoy::http::common::LocalReplyConfig;
+using ::testing::_;
+using ::testing::Invoke;
+using ::testing::NiceMock;
+
+namespace Envoy {
+namespace Extensions {
+namespace Utils {
+namespace {
+
+TEST(LocalReplyUtilsTest, RenderWithoutBodyFormat) {
+  LocalReplyConfig config;
+  EXPECT_EQ(renderLocalReplyBody(config, Http::Code::NotFound, "not found"),
+            "not found");
+}
+
+TEST(LocalReplyUtilsTest, RenderBodyFormat) {
+  LocalReplyConfig config;
+  config.set_body_format(
+      R"({"code":%CODE%,"grpcCode":%GRPC_CODE%,"message":"%MESSAGE%"})");
+  EXPECT_EQ(renderLocalReplyBody(config, Http::Code::NotFound, "not found"),
+            R"({"code":404,"grpcCode":5,"message":"not found"})");
+}
+
+TEST(LocalReplyUtilsTest, RenderEscapesMessage) {
+  LocalReplyConfig config;
+  config.set_body_format(R"({"message":"%MESSAGE%"})");
+  EXPECT_EQ(renderLocalReplyBody(config, Http::Code::Forbidden,
+                                 "a \"quoted\"\n\\%CODE%\x01"),
+            R"({"message":"a \"quoted\"\n\\%CODE%\u0001"})");
+}
+
+TEST(LocalReplyUtilsTest, SendOverridesStatusCodeAndContentType) {
+  NiceMock<Http::MockStreamDecoderFilterCallbacks> callbacks;
+  LocalReplyConfig config;
+  config.set_body_format(R"({"code":%CODE%})");
+  config.set_content_type("application/problem+json");
+  config.set_status_code(403);
+
+  EXPECT_CALL(callbacks, encodeHeaders_(_, false))
+      .WillOnce(Invoke([](Http::HeaderMap& headers, bool) {
+        EXPECT_EQ(headers.Status()->value().getStringView(), "403");
+        EXPECT_EQ(headers.ContentType()->value().getStringView(),
+                  "application/problem+json");
+      }));
+  EXPECT_CALL(callbacks, encodeData(_, true))
+      .WillOnce(Invoke([](Buffer::Instance& data, bool) {
+        EXPECT_EQ(data.toString(), R"({"code":403})");
+      }));
+  sendLocalReply(callbacks, config, false, Http::Code::NotFound, "not found",
+                 "details");
+  EXPECT_EQ(callbacks.details_, "details");
+}
+
+TEST(LocalReplyUtilsTest, SendGrpcKeepsMessage) {
+  NiceMock<Http::MockStreamDecoderFilterCallbacks> callbacks;
+  callbacks.is_grpc_request_ = true;
+  LocalReplyConfig config;
+  config.set_body_format(R"({"code":%CODE%})");
+  config.set_status_code(403);
+
+  EXPECT_CALL(callbacks, encodeHeaders_(_, true))
+      .WillOnce(Invoke([](Http::HeaderMap& headers, bool) {
+        EXPECT_EQ(headers.GrpcStatus()->value().getStringView(), "7");
+        EXPECT_EQ(headers.GrpcMessage()->value().getStringView(),
+                  "not found");
+      }));
+  sendLocalReply(callbacks, config, true, Http::Code::NotFound, "not found",
+                 "details");
+}
+
+}  // namespace
+}  // namespace Utils
+}  // namespace Extensions
+}  // namespace Envoy
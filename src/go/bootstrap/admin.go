@@ -21,11 +21,19 @@ import (
 	bootstrappb "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v2"
 )
 
+const loopbackAddress = "127.0.0.1"
+
 // CreateAdmin outputs Admin struct for bootstrap config
 func CreateAdmin(opts options.CommonOptions) *bootstrappb.Admin {
 
+	adminAddress := opts.AdminAddress
 	if !opts.EnableAdmin {
-		return &bootstrappb.Admin{}
+		if opts.PrometheusPort == 0 {
+			return &bootstrappb.Admin{}
+		}
+		// The Prometheus listener proxies to the admin interface, so it is
+		// still needed, but only reachable from inside the container.
+		adminAddress = loopbackAddress
 	}
 
 	return &bootstrappb.Admin{
@@ -33,7 +41,7 @@ func CreateAdmin(opts options.CommonOptions) *bootstrappb.Admin {
 		Address: &corepb.Address{
 			Address: &corepb.Address_SocketAddress{
 				SocketAddress: &corepb.SocketAddress{
-					Address: opts.AdminAddress,
+					Address: adminAddress,
 					PortSpecifier: &corepb.SocketAddress_PortValue{
 						PortValue: uint32(opts.AdminPort),
 					},
@@ -26,9 +26,10 @@ import (
 
 func TestCreateAdmin(t *testing.T) {
 	testData := []struct {
-		desc        string
-		enableAdmin bool
-		want        *bootstrappb.Admin
+		desc           string
+		enableAdmin    bool
+		prometheusPort int
+		want           *bootstrappb.Admin
 	}{
 		{
 			desc:        "Admin interface is disabled",
@@ -52,12 +53,31 @@ func TestCreateAdmin(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc:           "Admin interface is disabled, but bound to loopback for Prometheus",
+			enableAdmin:    false,
+			prometheusPort: 9090,
+			want: &bootstrappb.Admin{
+				AccessLogPath: "/dev/null",
+				Address: &corepb.Address{
+					Address: &corepb.Address_SocketAddress{
+						SocketAddress: &corepb.SocketAddress{
+							Address: "127.0.0.1",
+							PortSpecifier: &corepb.SocketAddress_PortValue{
+								PortValue: 8001,
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tc := range testData {
 
 		opts := options.DefaultCommonOptions()
 		opts.EnableAdmin = tc.enableAdmin
+		opts.PrometheusPort = tc.prometheusPort
 
 		got := CreateAdmin(opts)
 
@@ -94,6 +94,19 @@ func CreateBootstrapConfig(opts options.AdsBootstrapperOptions) (string, error)
 		}
 	}
 
+	if bt.StatsSinks, err = bootstrap.CreateStatsSinks(opts.CommonOptions); err != nil {
+		return "", fmt.Errorf("failed to create stats sinks, error: %v", err)
+	}
+
+	promListener, promCluster, err := bootstrap.CreatePrometheusResources(opts.CommonOptions)
+	if err != nil {
+		return "", fmt.Errorf("failed to create prometheus config, error: %v", err)
+	}
+	if promListener != nil {
+		bt.StaticResources.Listeners = append(bt.StaticResources.Listeners, promListener)
+		bt.StaticResources.Clusters = append(bt.StaticResources.Clusters, promCluster)
+	}
+
 	jsonStr, err := util.ProtoToJson(bt)
 	if err != nil {
 		return "", fmt.Errorf("failed to MarshalToString, error: %v", err)
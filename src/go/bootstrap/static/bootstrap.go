@@ -56,11 +56,24 @@ func ServiceToBootstrapConfig(serviceConfig *confpb.Service, id string, opts opt
 		}
 	}
 
+	if bt.StatsSinks, err = bootstrap.CreateStatsSinks(opts.CommonOptions); err != nil {
+		return nil, fmt.Errorf("failed to create stats sinks, error: %v", err)
+	}
+
 	bt.StaticResources = &bootstrappb.Bootstrap_StaticResources{
 		Listeners: []*v2pb.Listener{
 			listener,
 		},
 		Clusters: clusters,
 	}
+
+	promListener, promCluster, err := bootstrap.CreatePrometheusResources(opts.CommonOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create prometheus config, error: %v", err)
+	}
+	if promListener != nil {
+		bt.StaticResources.Listeners = append(bt.StaticResources.Listeners, promListener)
+		bt.StaticResources.Clusters = append(bt.StaticResources.Clusters, promCluster)
+	}
 	return bt, nil
 }
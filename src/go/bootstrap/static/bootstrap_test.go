@@ -23,6 +23,7 @@ import (
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configmanager/flags"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
 	"github.com/GoogleCloudPlatform/esp-v2/tests/env/platform"
 	"github.com/golang/protobuf/jsonpb"
 
@@ -35,6 +36,11 @@ var (
 )
 
 func TestServiceToBootstrapConfig(t *testing.T) {
+	var openIDCachePath string
+	defer testutil.WriteTempFiles(t, map[*string]string{
+		&openIDCachePath: `{"https://accounts.google.com": "https://www.googleapis.com/oauth2/v3/certs"}`,
+	})()
+
 	testData := []struct {
 		desc              string
 		opt_mod           func(opt *options.ConfigGeneratorOptions)
@@ -109,6 +115,10 @@ func TestServiceToBootstrapConfig(t *testing.T) {
 
 		opts := flags.EnvoyConfigOptionsFromFlags()
 		tc.opt_mod(&opts)
+		// The jwks_uri of the providers without it is resolved from the cache
+		// when OpenID Connect Discovery is not reachable.
+		opts.OpenIDDiscoveryRetries = 0
+		opts.OpenIDDiscoveryCache = util.NewJwksUriCache(openIDCachePath)
 
 		// Function under test
 		gotBootstrap, err := ServiceToBootstrapConfig(&s, FakeConfigID, opts)
@@ -0,0 +1,206 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	v2pb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	listenerpb "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	routepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	metricspb "github.com/envoyproxy/go-control-plane/envoy/config/metrics/v2"
+)
+
+const (
+	prometheusStatsPath  = "/stats/prometheus"
+	prometheusStatPrefix = "prometheus_http"
+
+	// The admin interface is local, so the connection is expected to be fast.
+	adminClusterConnectTimeout = 1 * time.Second
+)
+
+// CreateStatsSinks outputs the stats sinks for bootstrap config.
+// No sink is created if StatsdAddress is empty.
+func CreateStatsSinks(opts options.CommonOptions) ([]*metricspb.StatsSink, error) {
+	if opts.StatsdAddress == "" {
+		return nil, nil
+	}
+
+	host, portStr, err := net.SplitHostPort(opts.StatsdAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid statsd address %s: %v", opts.StatsdAddress, err)
+	}
+	if net.ParseIP(host) == nil {
+		return nil, fmt.Errorf("invalid statsd address %s: host must be an IP address", opts.StatsdAddress)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid statsd address %s: %v", opts.StatsdAddress, err)
+	}
+
+	address := &corepb.Address{
+		Address: &corepb.Address_SocketAddress{
+			SocketAddress: &corepb.SocketAddress{
+				Protocol: corepb.SocketAddress_UDP,
+				Address:  host,
+				PortSpecifier: &corepb.SocketAddress_PortValue{
+					PortValue: uint32(port),
+				},
+			},
+		},
+	}
+
+	var name string
+	var sink proto.Message
+	switch opts.StatsdFormat {
+	case "statsd":
+		name = util.StatsdSink
+		sink = &metricspb.StatsdSink{
+			StatsdSpecifier: &metricspb.StatsdSink_Address{
+				Address: address,
+			},
+		}
+	case "dogstatsd":
+		name = util.DogStatsdSink
+		sink = &metricspb.DogStatsdSink{
+			DogStatsdSpecifier: &metricspb.DogStatsdSink_Address{
+				Address: address,
+			},
+		}
+	default:
+		return nil, fmt.Errorf(`invalid statsd format: %s. It must be one of (statsd|dogstatsd)`, opts.StatsdFormat)
+	}
+
+	sinkAny, err := ptypes.MarshalAny(sink)
+	if err != nil {
+		return nil, err
+	}
+	return []*metricspb.StatsSink{
+		{
+			Name:       name,
+			ConfigType: &metricspb.StatsSink_TypedConfig{TypedConfig: sinkAny},
+		},
+	}, nil
+}
+
+// CreatePrometheusResources outputs the static listener and cluster that
+// expose the Prometheus stats of the admin interface on PrometheusPort.
+// Nothing is created if PrometheusPort is 0.
+func CreatePrometheusResources(opts options.CommonOptions) (*v2pb.Listener, *v2pb.Cluster, error) {
+	if opts.PrometheusPort == 0 {
+		return nil, nil, nil
+	}
+	if opts.PrometheusPort == opts.AdminPort {
+		return nil, nil, fmt.Errorf("prometheus port %d must be different from the admin port", opts.PrometheusPort)
+	}
+
+	httpConMgr := &hcmpb.HttpConnectionManager{
+		CodecType:  hcmpb.HttpConnectionManager_AUTO,
+		StatPrefix: prometheusStatPrefix,
+		RouteSpecifier: &hcmpb.HttpConnectionManager_RouteConfig{
+			RouteConfig: &v2pb.RouteConfiguration{
+				Name: "prometheus_route",
+				VirtualHosts: []*routepb.VirtualHost{
+					{
+						Name:    "prometheus",
+						Domains: []string{"*"},
+						Routes: []*routepb.Route{
+							{
+								Match: &routepb.RouteMatch{
+									PathSpecifier: &routepb.RouteMatch_Path{
+										Path: prometheusStatsPath,
+									},
+								},
+								Action: &routepb.Route_Route{
+									Route: &routepb.RouteAction{
+										ClusterSpecifier: &routepb.RouteAction_Cluster{
+											Cluster: util.AdminClusterName,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		HttpFilters: []*hcmpb.HttpFilter{
+			{
+				Name: util.Router,
+			},
+		},
+	}
+	httpConMgrAny, err := ptypes.MarshalAny(httpConMgr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listener := &v2pb.Listener{
+		Name: "prometheus_listener",
+		Address: &corepb.Address{
+			Address: &corepb.Address_SocketAddress{
+				SocketAddress: &corepb.SocketAddress{
+					Address: opts.PrometheusAddress,
+					PortSpecifier: &corepb.SocketAddress_PortValue{
+						PortValue: uint32(opts.PrometheusPort),
+					},
+				},
+			},
+		},
+		FilterChains: []*listenerpb.FilterChain{
+			{
+				Filters: []*listenerpb.Filter{
+					{
+						Name:       util.HTTPConnectionManager,
+						ConfigType: &listenerpb.Filter_TypedConfig{TypedConfig: httpConMgrAny},
+					},
+				},
+			},
+		},
+	}
+
+	cluster := &v2pb.Cluster{
+		Name:           util.AdminClusterName,
+		LbPolicy:       v2pb.Cluster_ROUND_ROBIN,
+		ConnectTimeout: ptypes.DurationProto(adminClusterConnectTimeout),
+		ClusterDiscoveryType: &v2pb.Cluster_Type{
+			Type: v2pb.Cluster_STATIC,
+		},
+		LoadAssignment: util.CreateLoadAssignment(adminLoopbackAddress(opts), uint32(opts.AdminPort)),
+	}
+	return listener, cluster, nil
+}
+
+// adminLoopbackAddress returns the address the Prometheus cluster uses to
+// reach the admin interface.
+func adminLoopbackAddress(opts options.CommonOptions) string {
+	if !opts.EnableAdmin {
+		return loopbackAddress
+	}
+	if ip := net.ParseIP(opts.AdminAddress); ip == nil || ip.IsUnspecified() {
+		return loopbackAddress
+	}
+	return opts.AdminAddress
+}
@@ -0,0 +1,213 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	metricspb "github.com/envoyproxy/go-control-plane/envoy/config/metrics/v2"
+)
+
+func TestCreateStatsSinks(t *testing.T) {
+	wantAddress := &corepb.Address{
+		Address: &corepb.Address_SocketAddress{
+			SocketAddress: &corepb.SocketAddress{
+				Protocol: corepb.SocketAddress_UDP,
+				Address:  "127.0.0.1",
+				PortSpecifier: &corepb.SocketAddress_PortValue{
+					PortValue: 8125,
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc          string
+		statsdAddress string
+		statsdFormat  string
+		wantName      string
+		wantSink      proto.Message
+		wantError     string
+	}{
+		{
+			desc: "No sink without statsd address",
+		},
+		{
+			desc:          "StatsD sink",
+			statsdAddress: "127.0.0.1:8125",
+			statsdFormat:  "statsd",
+			wantName:      util.StatsdSink,
+			wantSink: &metricspb.StatsdSink{
+				StatsdSpecifier: &metricspb.StatsdSink_Address{
+					Address: wantAddress,
+				},
+			},
+		},
+		{
+			desc:          "DogStatsD sink",
+			statsdAddress: "127.0.0.1:8125",
+			statsdFormat:  "dogstatsd",
+			wantName:      util.DogStatsdSink,
+			wantSink: &metricspb.DogStatsdSink{
+				DogStatsdSpecifier: &metricspb.DogStatsdSink_Address{
+					Address: wantAddress,
+				},
+			},
+		},
+		{
+			desc:          "Hostname is not allowed",
+			statsdAddress: "statsd:8125",
+			statsdFormat:  "statsd",
+			wantError:     "host must be an IP address",
+		},
+		{
+			desc:          "Missing port",
+			statsdAddress: "127.0.0.1",
+			statsdFormat:  "statsd",
+			wantError:     "invalid statsd address 127.0.0.1",
+		},
+		{
+			desc:          "Invalid format",
+			statsdAddress: "127.0.0.1:8125",
+			statsdFormat:  "prometheus",
+			wantError:     "invalid statsd format: prometheus",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultCommonOptions()
+		opts.StatsdAddress = tc.statsdAddress
+		opts.StatsdFormat = tc.statsdFormat
+
+		got, err := CreateStatsSinks(opts)
+		if tc.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test (%s): failed, expected err: %v, got: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tc.wantSink == nil {
+			if len(got) != 0 {
+				t.Errorf("Test (%s): failed, expected no sink, got: %v", tc.desc, got)
+			}
+			continue
+		}
+		if len(got) != 1 || got[0].Name != tc.wantName {
+			t.Errorf("Test (%s): failed, got: %v, want one sink named %s", tc.desc, got, tc.wantName)
+			continue
+		}
+
+		gotSink := proto.Clone(tc.wantSink)
+		gotSink.Reset()
+		if err := ptypes.UnmarshalAny(got[0].GetTypedConfig(), gotSink); err != nil {
+			t.Errorf("Test (%s): failed, failed to unmarshall any", tc.desc)
+		}
+		if !proto.Equal(gotSink, tc.wantSink) {
+			t.Errorf("Test (%s): failed, got: %v, want: %v", tc.desc, gotSink, tc.wantSink)
+		}
+	}
+}
+
+func TestCreatePrometheusResources(t *testing.T) {
+	testData := []struct {
+		desc               string
+		enableAdmin        bool
+		adminAddress       string
+		prometheusPort     int
+		wantListener       bool
+		wantClusterAddress string
+		wantError          string
+	}{
+		{
+			desc: "Prometheus is disabled",
+		},
+		{
+			desc:               "Admin interface is disabled, cluster uses loopback",
+			prometheusPort:     9090,
+			wantListener:       true,
+			wantClusterAddress: "127.0.0.1",
+		},
+		{
+			desc:               "Admin interface listens on all addresses, cluster uses loopback",
+			enableAdmin:        true,
+			adminAddress:       "0.0.0.0",
+			prometheusPort:     9090,
+			wantListener:       true,
+			wantClusterAddress: "127.0.0.1",
+		},
+		{
+			desc:               "Admin interface listens on a specific address",
+			enableAdmin:        true,
+			adminAddress:       "10.0.0.1",
+			prometheusPort:     9090,
+			wantListener:       true,
+			wantClusterAddress: "10.0.0.1",
+		},
+		{
+			desc:           "Prometheus port conflicts with admin port",
+			prometheusPort: 8001,
+			wantError:      "prometheus port 8001 must be different from the admin port",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultCommonOptions()
+		opts.EnableAdmin = tc.enableAdmin
+		if tc.adminAddress != "" {
+			opts.AdminAddress = tc.adminAddress
+		}
+		opts.PrometheusPort = tc.prometheusPort
+
+		gotListener, gotCluster, err := CreatePrometheusResources(opts)
+		if tc.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test (%s): failed, expected err: %v, got: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !tc.wantListener {
+			if gotListener != nil || gotCluster != nil {
+				t.Errorf("Test (%s): failed, expected no resources, got listener: %v, cluster: %v", tc.desc, gotListener, gotCluster)
+			}
+			continue
+		}
+
+		if gotPort := gotListener.GetAddress().GetSocketAddress().GetPortValue(); gotPort != uint32(tc.prometheusPort) {
+			t.Errorf("Test (%s): failed, got listener port: %v, want: %v", tc.desc, gotPort, tc.prometheusPort)
+		}
+		if gotCluster.Name != util.AdminClusterName {
+			t.Errorf("Test (%s): failed, got cluster name: %v, want: %v", tc.desc, gotCluster.Name, util.AdminClusterName)
+		}
+		gotAddress := gotCluster.GetLoadAssignment().GetEndpoints()[0].GetLbEndpoints()[0].GetEndpoint().GetAddress().GetSocketAddress()
+		if gotAddress.GetAddress() != tc.wantClusterAddress || gotAddress.GetPortValue() != uint32(opts.AdminPort) {
+			t.Errorf("Test (%s): failed, got cluster address: %v, want: %s:%d", tc.desc, gotAddress, tc.wantClusterAddress, opts.AdminPort)
+		}
+	}
+}
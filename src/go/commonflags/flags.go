@@ -45,6 +45,12 @@ var (
 	TracingMaxNumMessageEvents = flag.Int64("tracing_max_num_message_events", 128, "Sets the maximum number of message events that each span can contain. Defaults to the maximum allowed by Stackdriver. In practice, the number of message events published will be much less.")
 	TracingMaxNumLinks         = flag.Int64("tracing_max_num_links", 128, "Sets the maximum number of links that each span can contain. Defaults to the maximum allowed by Stackdriver. In practice, the number of links published will be much less.")
 
+	StatsdAddress     = flag.String("statsd_address", "", `The "ip:port" of a StatsD UDP server to flush Envoy stats to. Stats are not flushed to StatsD if empty.`)
+	StatsdFormat      = flag.String("statsd_format", "statsd", `The format of the stats sent to --statsd_address, must be either "statsd" or "dogstatsd".`)
+	PrometheusAddress = flag.String("prometheus_address", "0.0.0.0", "Address of the listener that serves Envoy stats in Prometheus format at /stats/prometheus.")
+	PrometheusPort    = flag.Int("prometheus_port", 0, `Port of the listener that serves Envoy stats in Prometheus format at /stats/prometheus. The listener is
+	not created if 0. Only the Prometheus stats are exposed on this port, the rest of the admin interface is not.`)
+
 	//Suspected Envoy has listener initialization bug: if a http filter needs to use
 	//a cluster with DSN lookup for initialization, e.g. fetching a remote access
 	//token, the cluster is not ready so the whole listener is destroyed. ADS will
@@ -81,6 +87,10 @@ func DefaultCommonOptionsFromFlags() options.CommonOptions {
 		TracingMaxNumAnnotations:   *TracingMaxNumAnnotations,
 		TracingMaxNumMessageEvents: *TracingMaxNumMessageEvents,
 		TracingMaxNumLinks:         *TracingMaxNumLinks,
+		StatsdAddress:              *StatsdAddress,
+		StatsdFormat:               *StatsdFormat,
+		PrometheusAddress:          *PrometheusAddress,
+		PrometheusPort:             *PrometheusPort,
 		MetadataURL:                *MetadataURL,
 		IamURL:                     *IamURL,
 	}
@@ -16,6 +16,7 @@ package configgenerator
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
@@ -82,6 +83,48 @@ func MakeClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, error) {
 	if providerClusters != nil {
 		clusters = append(clusters, providerClusters...)
 	}
+
+	extAuthzCluster, err := makeExtAuthzCluster(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if extAuthzCluster != nil {
+		clusters = append(clusters, extAuthzCluster)
+	}
+
+	rateLimitCluster, err := makeRateLimitCluster(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if rateLimitCluster != nil {
+		clusters = append(clusters, rateLimitCluster)
+	}
+
+	mirrorCluster, err := makeMirrorCluster(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if mirrorCluster != nil {
+		clusters = append(clusters, mirrorCluster)
+	}
+
+	// Custom clusters must be the last, so they are checked against all the
+	// generated clusters.
+	customClusters, err := makeCustomClusters(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	generated := make(map[string]bool)
+	for _, c := range clusters {
+		generated[c.Name] = true
+	}
+	for _, c := range customClusters {
+		if generated[c.Name] {
+			return nil, fmt.Errorf("custom cluster %s has the name of a generated cluster", c.Name)
+		}
+		generated[c.Name] = true
+	}
+	clusters = append(clusters, customClusters...)
 	return clusters, nil
 }
 
@@ -150,18 +193,35 @@ func makeIamCluster(serviceInfo *sc.ServiceInfo) (*v2pb.Cluster, error) {
 func makeJwtProviderClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, error) {
 	var providerClusters []*v2pb.Cluster
 	authn := serviceInfo.ServiceConfig().GetAuthentication()
-	generatedClusters := map[string]bool{}
+	// The DNS lookup family of the generated clusters, by cluster name.
+	generatedClusters := map[string]string{}
+	// The generated clusters, by cluster name.
+	clustersByName := map[string]*v2pb.Cluster{}
 
 	for _, provider := range authn.GetProviders() {
+		// No cluster is needed to fetch a local JWKS.
+		if _, ok := serviceInfo.LocalJwks[provider.GetId()]; ok {
+			continue
+		}
 		jwksUri := provider.GetJwksUri()
 		clusterName, err := util.ExtraAddressFromURI(jwksUri)
 		if err != nil {
 			return nil, err
 		}
-		if ok, _ := generatedClusters[clusterName]; ok {
+		dnsLookupFamily := serviceInfo.JwksDnsLookupFamily(provider.GetId())
+		connectTimeout := serviceInfo.JwksConnectTimeout(provider.GetId())
+		if family, ok := generatedClusters[clusterName]; ok {
+			if family != dnsLookupFamily {
+				return nil, fmt.Errorf("JWT providers sharing the jwks_uri address %s have different dns_lookup_family: %s and %s", clusterName, family, dnsLookupFamily)
+			}
+			// A shared cluster uses the shortest timeout of its providers.
+			c := clustersByName[clusterName]
+			if d, _ := ptypes.Duration(c.ConnectTimeout); connectTimeout < d {
+				c.ConnectTimeout = ptypes.DurationProto(connectTimeout)
+			}
 			continue
 		}
-		generatedClusters[clusterName] = true
+		generatedClusters[clusterName] = dnsLookupFamily
 
 		scheme, hostname, port, _, err := util.ParseURI(jwksUri)
 
@@ -169,17 +229,23 @@ func makeJwtProviderClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, erro
 			return nil, fmt.Errorf("Fail to parse jwksUri %s with error %v", jwksUri, err)
 		}
 
-		connectTimeoutProto := ptypes.DurationProto(serviceInfo.Options.ClusterConnectTimeout)
+		connectTimeoutProto := ptypes.DurationProto(connectTimeout)
 
 		c := &v2pb.Cluster{
-			Name:           clusterName,
-			LbPolicy:       v2pb.Cluster_ROUND_ROBIN,
-			ConnectTimeout: connectTimeoutProto,
-			// Note: It may not be V4.
-			DnsLookupFamily:      v2pb.Cluster_V4_ONLY,
+			Name:                 clusterName,
+			LbPolicy:             v2pb.Cluster_ROUND_ROBIN,
+			ConnectTimeout:       connectTimeoutProto,
 			ClusterDiscoveryType: &v2pb.Cluster_Type{v2pb.Cluster_LOGICAL_DNS},
 			LoadAssignment:       util.CreateLoadAssignment(hostname, port),
 		}
+		switch dnsLookupFamily {
+		case "auto":
+			c.DnsLookupFamily = v2pb.Cluster_AUTO
+		case "v4only":
+			c.DnsLookupFamily = v2pb.Cluster_V4_ONLY
+		case "v6only":
+			c.DnsLookupFamily = v2pb.Cluster_V6_ONLY
+		}
 		if scheme == "https" {
 			transportSocket, err := util.CreateTransportSocket(hostname, serviceInfo.Options.RootCertsPath, nil)
 			if err != nil {
@@ -190,12 +256,106 @@ func makeJwtProviderClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, erro
 		}
 
 		providerClusters = append(providerClusters, c)
+		clustersByName[clusterName] = c
 
 		glog.Infof("Add provider cluster configuration for %v: %v", provider.JwksUri, c)
 	}
 	return providerClusters, nil
 }
 
+func makeExtAuthzCluster(serviceInfo *sc.ServiceInfo) (*v2pb.Cluster, error) {
+	if serviceInfo.Options.ExtAuthzAddress == "" {
+		return nil, nil
+	}
+	protocol, tls, hostname, port, _, err := parseExtAuthzAddress(serviceInfo.Options.ExtAuthzAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := makeBackendCluster(&serviceInfo.Options, &sc.BackendRoutingCluster{
+		ClusterName:  util.ExtAuthzClusterName,
+		Hostname:     hostname,
+		Port:         port,
+		UseTLS:       tls,
+		Protocol:     protocol,
+		HttpProtocol: util.HTTP1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("adding ext_authz cluster Configuration for uri: %s: %v", serviceInfo.Options.ExtAuthzAddress, c)
+	return c, nil
+}
+
+// parseExtAuthzAddress parses the address of the external authorization
+// server, whose scheme must be one of grpc, grpcs, http or https.
+func parseExtAuthzAddress(address string) (util.BackendProtocol, bool, string, uint32, string, error) {
+	if !strings.Contains(address, "://") {
+		return util.HTTP, false, "", 0, "", fmt.Errorf("invalid ext_authz address %s: scheme must be one of grpc, grpcs, http or https", address)
+	}
+	scheme, hostname, port, path, err := util.ParseURI(address)
+	if err != nil {
+		return util.HTTP, false, "", 0, "", fmt.Errorf("invalid ext_authz address %s: %v", address, err)
+	}
+	protocol, tls, err := util.ParseBackendProtocol(scheme)
+	if err != nil {
+		return util.HTTP, false, "", 0, "", fmt.Errorf("invalid ext_authz address %s: %v", address, err)
+	}
+	return protocol, tls, hostname, port, path, nil
+}
+
+func makeRateLimitCluster(serviceInfo *sc.ServiceInfo) (*v2pb.Cluster, error) {
+	if serviceInfo.Options.RateLimitServiceAddress == "" {
+		return nil, nil
+	}
+	tls, hostname, port, err := parseRateLimitServiceAddress(serviceInfo.Options.RateLimitServiceAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := makeBackendCluster(&serviceInfo.Options, &sc.BackendRoutingCluster{
+		ClusterName: util.RateLimitClusterName,
+		Hostname:    hostname,
+		Port:        port,
+		UseTLS:      tls,
+		Protocol:    util.GRPC,
+	})
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("adding rate limit cluster Configuration for uri: %s: %v", serviceInfo.Options.RateLimitServiceAddress, c)
+	return c, nil
+}
+
+// parseRateLimitServiceAddress parses the address of the rate limit service,
+// whose scheme must be one of grpc or grpcs.
+func parseRateLimitServiceAddress(address string) (bool, string, uint32, error) {
+	if !strings.Contains(address, "://") {
+		return false, "", 0, fmt.Errorf("invalid rate limit service address %s: scheme must be one of grpc or grpcs", address)
+	}
+	scheme, hostname, port, _, err := util.ParseURI(address)
+	if err != nil {
+		return false, "", 0, fmt.Errorf("invalid rate limit service address %s: %v", address, err)
+	}
+	protocol, tls, err := util.ParseBackendProtocol(scheme)
+	if err != nil || protocol != util.GRPC {
+		return false, "", 0, fmt.Errorf("invalid rate limit service address %s: scheme must be one of grpc or grpcs", address)
+	}
+	return tls, hostname, port, nil
+}
+
+func makeMirrorCluster(serviceInfo *sc.ServiceInfo) (*v2pb.Cluster, error) {
+	if serviceInfo.MirrorBackend == nil {
+		return nil, nil
+	}
+	c, err := makeBackendCluster(&serviceInfo.Options, serviceInfo.MirrorBackend)
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("adding mirror backend cluster Configuration for uri: %s: %v", serviceInfo.Options.MirrorBackendAddress, c)
+	return c, nil
+}
+
 func makeBackendCluster(opt *options.ConfigGeneratorOptions, brc *sc.BackendRoutingCluster) (*v2pb.Cluster, error) {
 	c := &v2pb.Cluster{
 		Name:                 brc.ClusterName,
@@ -22,6 +22,7 @@ import (
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/google/go-cmp/cmp"
@@ -579,13 +580,245 @@ func TestMakeBackendRoutingCluster(t *testing.T) {
 	}
 }
 
-func TestMakeJwtProviderClusters(t *testing.T) {
+func TestMakeExtAuthzCluster(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+	}
+
 	testData := []struct {
 		desc            string
-		fakeProviders   []*confpb.AuthProvider
-		backendProtocol string
-		wantedClusters  []*v2pb.Cluster
-		wantedError     string
+		extAuthzAddress string
+		wantedCluster   *v2pb.Cluster
+	}{
+		{
+			desc: "No external authorization server",
+		},
+		{
+			desc:            "gRPC authorization server with TLS",
+			extAuthzAddress: "grpcs://authz.example.com",
+			wantedCluster: &v2pb.Cluster{
+				Name:                 "ext-authz-cluster",
+				LbPolicy:             v2pb.Cluster_ROUND_ROBIN,
+				ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+				ClusterDiscoveryType: &v2pb.Cluster_Type{v2pb.Cluster_LOGICAL_DNS},
+				LoadAssignment:       util.CreateLoadAssignment("authz.example.com", 443),
+				TransportSocket:      createH2TransportSocket("authz.example.com"),
+				Http2ProtocolOptions: &corepb.Http2ProtocolOptions{},
+			},
+		},
+		{
+			desc:            "HTTP authorization server",
+			extAuthzAddress: "http://127.0.0.1:8080/check",
+			wantedCluster: &v2pb.Cluster{
+				Name:                 "ext-authz-cluster",
+				LbPolicy:             v2pb.Cluster_ROUND_ROBIN,
+				ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+				ClusterDiscoveryType: &v2pb.Cluster_Type{v2pb.Cluster_LOGICAL_DNS},
+				LoadAssignment:       util.CreateLoadAssignment("127.0.0.1", 8080),
+			},
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.ExtAuthzAddress = tc.extAuthzAddress
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cluster, err := makeExtAuthzCluster(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !proto.Equal(cluster, tc.wantedCluster) {
+			t.Errorf("Test Desc(%d): %s, makeExtAuthzCluster\ngot Clusters: %v,\nwant: %v", i, tc.desc, cluster, tc.wantedCluster)
+		}
+	}
+}
+
+func TestMakeRateLimitCluster(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                    string
+		rateLimitServiceAddress string
+		wantedCluster           *v2pb.Cluster
+		wantError               string
+	}{
+		{
+			desc: "No rate limit service",
+		},
+		{
+			desc:                    "Rate limit service without TLS",
+			rateLimitServiceAddress: "grpc://ratelimit:8081",
+			wantedCluster: &v2pb.Cluster{
+				Name:                 "rate-limit-cluster",
+				LbPolicy:             v2pb.Cluster_ROUND_ROBIN,
+				ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+				ClusterDiscoveryType: &v2pb.Cluster_Type{v2pb.Cluster_LOGICAL_DNS},
+				LoadAssignment:       util.CreateLoadAssignment("ratelimit", 8081),
+				Http2ProtocolOptions: &corepb.Http2ProtocolOptions{},
+			},
+		},
+		{
+			desc:                    "Rate limit service with TLS",
+			rateLimitServiceAddress: "grpcs://ratelimit.example.com",
+			wantedCluster: &v2pb.Cluster{
+				Name:                 "rate-limit-cluster",
+				LbPolicy:             v2pb.Cluster_ROUND_ROBIN,
+				ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+				ClusterDiscoveryType: &v2pb.Cluster_Type{v2pb.Cluster_LOGICAL_DNS},
+				LoadAssignment:       util.CreateLoadAssignment("ratelimit.example.com", 443),
+				TransportSocket:      createH2TransportSocket("ratelimit.example.com"),
+				Http2ProtocolOptions: &corepb.Http2ProtocolOptions{},
+			},
+		},
+		{
+			desc:                    "HTTP rate limit service",
+			rateLimitServiceAddress: "http://ratelimit:8080",
+			wantError:               "scheme must be one of grpc or grpcs",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.RateLimitServiceAddress = tc.rateLimitServiceAddress
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cluster, err := makeRateLimitCluster(fakeServiceInfo)
+		if tc.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !proto.Equal(cluster, tc.wantedCluster) {
+			t.Errorf("Test Desc(%d): %s, makeRateLimitCluster\ngot Clusters: %v,\nwant: %v", i, tc.desc, cluster, tc.wantedCluster)
+		}
+	}
+}
+
+func TestMakeMirrorCluster(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                   string
+		mirrorBackendAddress   string
+		backendDnsLookupFamily string
+		wantedCluster          *v2pb.Cluster
+		wantError              string
+	}{
+		{
+			desc: "No mirror backend",
+		},
+		{
+			desc:                   "HTTP mirror backend with the DNS lookup family of the backends",
+			mirrorBackendAddress:   "http://bookstore-v2:8080",
+			backendDnsLookupFamily: "v4only",
+			wantedCluster: &v2pb.Cluster{
+				Name:                 "mirror-backend-cluster",
+				LbPolicy:             v2pb.Cluster_ROUND_ROBIN,
+				ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+				ClusterDiscoveryType: &v2pb.Cluster_Type{v2pb.Cluster_LOGICAL_DNS},
+				LoadAssignment:       util.CreateLoadAssignment("bookstore-v2", 8080),
+				DnsLookupFamily:      v2pb.Cluster_V4_ONLY,
+			},
+		},
+		{
+			desc:                 "gRPC mirror backend with TLS",
+			mirrorBackendAddress: "grpcs://bookstore-v2.example.com",
+			wantedCluster: &v2pb.Cluster{
+				Name:                 "mirror-backend-cluster",
+				LbPolicy:             v2pb.Cluster_ROUND_ROBIN,
+				ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+				ClusterDiscoveryType: &v2pb.Cluster_Type{v2pb.Cluster_LOGICAL_DNS},
+				LoadAssignment:       util.CreateLoadAssignment("bookstore-v2.example.com", 443),
+				TransportSocket:      createH2TransportSocket("bookstore-v2.example.com"),
+				Http2ProtocolOptions: &corepb.Http2ProtocolOptions{},
+			},
+		},
+		{
+			desc:                 "Mirror backend without scheme",
+			mirrorBackendAddress: "bookstore-v2:8080",
+			wantError:            "scheme must be one of grpc, grpcs, http or https",
+		},
+		{
+			desc:                 "Mirror backend with a path",
+			mirrorBackendAddress: "https://bookstore-v2.example.com/v2",
+			wantError:            "path is not allowed",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.MirrorBackendAddress = tc.mirrorBackendAddress
+		if tc.backendDnsLookupFamily != "" {
+			opts.BackendDnsLookupFamily = tc.backendDnsLookupFamily
+		}
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cluster, err := makeMirrorCluster(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !proto.Equal(cluster, tc.wantedCluster) {
+			t.Errorf("Test Desc(%d): %s, makeMirrorCluster\ngot Clusters: %v,\nwant: %v", i, tc.desc, cluster, tc.wantedCluster)
+		}
+	}
+}
+
+func TestMakeJwtProviderClusters(t *testing.T) {
+	var jwksPath string
+	defer testutil.WriteTempFiles(t, map[*string]string{&jwksPath: `{"keys": [{"kty": "RSA", "kid": "key-0", "n": "fake-n", "e": "AQAB"}]}`})()
+
+	testData := []struct {
+		desc               string
+		fakeProviders      []*confpb.AuthProvider
+		backendProtocol    string
+		jwtProviderOptions string
+		wantedClusters     []*v2pb.Cluster
+		wantedError        string
 	}{
 		{
 			desc: "Use https jwksUri and http jwksUri",
@@ -654,6 +887,121 @@ func TestMakeJwtProviderClusters(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "No cluster for local JWKS",
+			fakeProviders: []*confpb.AuthProvider{
+				&confpb.AuthProvider{
+					Id:      "auth_provider_0",
+					Issuer:  "issuer_0",
+					JwksUri: "https://metadata.com/pkey",
+				},
+				&confpb.AuthProvider{
+					Id:      "auth_provider_1",
+					Issuer:  "issuer_1",
+					JwksUri: "file://" + jwksPath,
+				},
+			},
+			wantedClusters: []*v2pb.Cluster{
+				{
+					Name:                 "metadata.com:443",
+					ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+					ClusterDiscoveryType: &v2pb.Cluster_Type{v2pb.Cluster_LOGICAL_DNS},
+					DnsLookupFamily:      v2pb.Cluster_V4_ONLY,
+					LoadAssignment:       util.CreateLoadAssignment("metadata.com", 443),
+					TransportSocket:      createTransportSocket("metadata.com"),
+				},
+			},
+		},
+		{
+			desc: "DNS lookup family set per issuer",
+			fakeProviders: []*confpb.AuthProvider{
+				&confpb.AuthProvider{
+					Id:      "auth_provider_0",
+					Issuer:  "issuer_0",
+					JwksUri: "https://metadata.com/pkey",
+				},
+				&confpb.AuthProvider{
+					Id:      "auth_provider_1",
+					Issuer:  "issuer_1",
+					JwksUri: "https://ipv6.example.com/pkey",
+				},
+			},
+			jwtProviderOptions: `{"default": {"dns_lookup_family": "auto"}, "issuers": {"issuer_1": {"dns_lookup_family": "v6only"}}}`,
+			wantedClusters: []*v2pb.Cluster{
+				{
+					Name:                 "metadata.com:443",
+					ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+					ClusterDiscoveryType: &v2pb.Cluster_Type{v2pb.Cluster_LOGICAL_DNS},
+					DnsLookupFamily:      v2pb.Cluster_AUTO,
+					LoadAssignment:       util.CreateLoadAssignment("metadata.com", 443),
+					TransportSocket:      createTransportSocket("metadata.com"),
+				},
+				{
+					Name:                 "ipv6.example.com:443",
+					ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+					ClusterDiscoveryType: &v2pb.Cluster_Type{v2pb.Cluster_LOGICAL_DNS},
+					DnsLookupFamily:      v2pb.Cluster_V6_ONLY,
+					LoadAssignment:       util.CreateLoadAssignment("ipv6.example.com", 443),
+					TransportSocket:      createTransportSocket("ipv6.example.com"),
+				},
+			},
+		},
+		{
+			desc: "Connect timeout capped by the JWKS fetch timeout",
+			fakeProviders: []*confpb.AuthProvider{
+				&confpb.AuthProvider{
+					Id:      "auth_provider_0",
+					Issuer:  "issuer_0",
+					JwksUri: "https://metadata.com/pkey",
+				},
+				&confpb.AuthProvider{
+					Id:      "auth_provider_1",
+					Issuer:  "issuer_1",
+					JwksUri: "https://metadata.com/another_pkey",
+				},
+				&confpb.AuthProvider{
+					Id:      "auth_provider_2",
+					Issuer:  "issuer_2",
+					JwksUri: "https://slow.example.com/pkey",
+				},
+			},
+			jwtProviderOptions: `{"issuers": {"issuer_1": {"jwks_fetch_timeout": "3s"}, "issuer_2": {"jwks_fetch_timeout": "30s"}}}`,
+			wantedClusters: []*v2pb.Cluster{
+				{
+					Name:                 "metadata.com:443",
+					ConnectTimeout:       ptypes.DurationProto(3 * time.Second),
+					ClusterDiscoveryType: &v2pb.Cluster_Type{v2pb.Cluster_LOGICAL_DNS},
+					DnsLookupFamily:      v2pb.Cluster_V4_ONLY,
+					LoadAssignment:       util.CreateLoadAssignment("metadata.com", 443),
+					TransportSocket:      createTransportSocket("metadata.com"),
+				},
+				{
+					Name:                 "slow.example.com:443",
+					ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+					ClusterDiscoveryType: &v2pb.Cluster_Type{v2pb.Cluster_LOGICAL_DNS},
+					DnsLookupFamily:      v2pb.Cluster_V4_ONLY,
+					LoadAssignment:       util.CreateLoadAssignment("slow.example.com", 443),
+					TransportSocket:      createTransportSocket("slow.example.com"),
+				},
+			},
+		},
+		{
+			desc: "Providers sharing a cluster with different DNS lookup families",
+			fakeProviders: []*confpb.AuthProvider{
+				&confpb.AuthProvider{
+					Id:      "auth_provider_0",
+					Issuer:  "issuer_0",
+					JwksUri: "https://metadata.com/pkey",
+				},
+				&confpb.AuthProvider{
+					Id:      "auth_provider_1",
+					Issuer:  "issuer_1",
+					JwksUri: "https://metadata.com/another_pkey",
+				},
+			},
+			jwtProviderOptions: `{"issuers": {"issuer_1": {"dns_lookup_family": "v6only"}}}`,
+			wantedError:        "JWT providers sharing the jwks_uri address metadata.com:443 have different dns_lookup_family: v4only and v6only",
+		},
 	}
 	for i, tc := range testData {
 		fakeServiceConfig := &confpb.Service{
@@ -669,6 +1017,7 @@ func TestMakeJwtProviderClusters(t *testing.T) {
 
 		opts := options.DefaultConfigGeneratorOptions()
 		opts.BackendProtocol = "grpc"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.JwtProviderOptionsPath: tc.jwtProviderOptions})()
 		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
 		if err != nil {
 			t.Fatal(err)
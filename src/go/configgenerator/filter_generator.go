@@ -0,0 +1,277 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configgenerator
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+
+	sc "github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	v2pb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+)
+
+// FilterGenerator generates the HTTP filters for one step of the filter chain.
+type FilterGenerator interface {
+	// Name of the generator, only used in logs.
+	Name() string
+	// GenFilters returns the HTTP filters to add to the filter chain.
+	// It returns no filter if the step is not needed for the service.
+	GenFilters(serviceInfo *sc.ServiceInfo) ([]*hcmpb.HttpFilter, error)
+}
+
+// ClusterGenerator can be implemented by a custom FilterGenerator whose
+// filters need their own clusters, e.g. the cluster of an ext_authz server.
+type ClusterGenerator interface {
+	GenClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, error)
+}
+
+// Custom filter generators registered by RegisterFilterGenerator, keyed by
+// insertion point.
+var (
+	customFilterGeneratorsMu sync.Mutex
+	customFilterGenerators   = map[sc.InsertionPoint][]FilterGenerator{}
+)
+
+// RegisterFilterGenerator registers a generator of custom filters at the given
+// insertion point. Generators registered at the same insertion point are
+// called in registration order.
+func RegisterFilterGenerator(point sc.InsertionPoint, gen FilterGenerator) error {
+	if !point.IsValid() {
+		return fmt.Errorf("unknown filter insertion point: %s", point)
+	}
+	customFilterGeneratorsMu.Lock()
+	defer customFilterGeneratorsMu.Unlock()
+	customFilterGenerators[point] = append(customFilterGenerators[point], gen)
+	return nil
+}
+
+// registeredFilterGenerators returns a copy of the generators registered at
+// the given insertion point.
+func registeredFilterGenerators(point sc.InsertionPoint) []FilterGenerator {
+	customFilterGeneratorsMu.Lock()
+	defer customFilterGeneratorsMu.Unlock()
+	return append([]FilterGenerator(nil), customFilterGenerators[point]...)
+}
+
+// filterGenerator implements FilterGenerator with a function.
+type filterGenerator struct {
+	name string
+	gen  func(serviceInfo *sc.ServiceInfo) ([]*hcmpb.HttpFilter, error)
+}
+
+func (g *filterGenerator) Name() string {
+	return g.name
+}
+
+func (g *filterGenerator) GenFilters(serviceInfo *sc.ServiceInfo) ([]*hcmpb.HttpFilter, error) {
+	return g.gen(serviceInfo)
+}
+
+// singleFilter wraps a function generating at most one filter.
+func singleFilter(name string, gen func(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error)) FilterGenerator {
+	return &filterGenerator{
+		name: name,
+		gen: func(serviceInfo *sc.ServiceInfo) ([]*hcmpb.HttpFilter, error) {
+			filter, err := gen(serviceInfo)
+			if err != nil || filter == nil {
+				return nil, err
+			}
+			return []*hcmpb.HttpFilter{filter}, nil
+		},
+	}
+}
+
+// insertionPointGenerator generates the custom filters of an insertion point.
+type insertionPointGenerator struct {
+	point      sc.InsertionPoint
+	generators []FilterGenerator
+}
+
+func (g *insertionPointGenerator) Name() string {
+	return fmt.Sprintf("custom filters at %s", g.point)
+}
+
+func (g *insertionPointGenerator) GenFilters(serviceInfo *sc.ServiceInfo) ([]*hcmpb.HttpFilter, error) {
+	var filters []*hcmpb.HttpFilter
+	for _, gen := range g.generators {
+		genFilters, err := gen.GenFilters(serviceInfo)
+		if err != nil {
+			return nil, fmt.Errorf("fail to generate %s: %v", gen.Name(), err)
+		}
+		filters = append(filters, genFilters...)
+	}
+	return filters, nil
+}
+
+// makeCustomFilterGenerators returns the registered generators and the
+// generators of the custom filter file, keyed by insertion point.
+func makeCustomFilterGenerators(serviceInfo *sc.ServiceInfo) map[sc.InsertionPoint][]FilterGenerator {
+	generators := map[sc.InsertionPoint][]FilterGenerator{}
+	for _, point := range sc.InsertionPoints {
+		generators[point] = registeredFilterGenerators(point)
+		if serviceInfo.CustomFilters == nil {
+			continue
+		}
+		if filters := serviceInfo.CustomFilters.FiltersAt(point); len(filters) > 0 {
+			generators[point] = append(generators[point], &filterGenerator{
+				name: fmt.Sprintf("custom filters from %s", serviceInfo.Options.CustomFiltersPath),
+				gen: func(serviceInfo *sc.ServiceInfo) ([]*hcmpb.HttpFilter, error) {
+					return filters, nil
+				},
+			})
+		}
+	}
+	return generators
+}
+
+// makeFilterGenerators returns the generators of the whole filter chain, in
+// the order of the filters.
+func makeFilterGenerators(serviceInfo *sc.ServiceInfo) []FilterGenerator {
+	custom := makeCustomFilterGenerators(serviceInfo)
+	at := func(point sc.InsertionPoint) FilterGenerator {
+		return &insertionPointGenerator{
+			point:      point,
+			generators: custom[point],
+		}
+	}
+
+	return []FilterGenerator{
+		singleFilter("CORS Filter", makeCorsFilter),
+		// The following filters rely on the dynamic metadata populated by
+		// Path Matcher filter.
+		// * Jwt Authentication filter
+		// * Service Control filter
+		// * Backend Authentication filter
+		// * Backend Routing filter
+		singleFilter("Path Matcher Filter", func(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+			return makePathMatcherFilter(serviceInfo), nil
+		}),
+		// Health Check filter must be behind Path Matcher filter, since Service Control
+		// filter needs to get the corresponding rule for health check calls, in order to skip Report
+		singleFilter("Healthz Filter", func(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+			if serviceInfo.Options.Healthz == "" {
+				return nil, nil
+			}
+			return makeHealthCheckFilter(serviceInfo)
+		}),
+		at(sc.BeforeAuth),
+		singleFilter("JWT Authn Filter", func(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+			if serviceInfo.Options.SkipJwtAuthnFilter {
+				return nil, nil
+			}
+			return makeJwtAuthnFilter(serviceInfo), nil
+		}),
+		singleFilter("Service Control Filter", func(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+			if serviceInfo.Options.SkipServiceControlFilter {
+				return nil, nil
+			}
+			return makeServiceControlFilter(serviceInfo), nil
+		}),
+		at(sc.AfterServiceControl),
+		// External authorization must be after JWT Authn filter, to use the
+		// JWT payloads, and after Service Control filter, so that the
+		// requests it denies are reported with 403.
+		singleFilter("Ext Authz Filter", makeExtAuthzFilter),
+		// RBAC filter must be after Service Control filter, so that the
+		// requests it denies are reported with 403.
+		singleFilter("RBAC Filter", makeRbacFilter),
+		// Rate Limit filter must be after Service Control filter, which sets
+		// the headers read by the rate limit actions of the routes.
+		singleFilter("Rate Limit Filter", makeRateLimitFilter),
+		// Buffer filter is after Service Control filter, so that the requests
+		// it rejects with 413 are reported.
+		singleFilter("Buffer Filter", makeBufferFilter),
+		// Gzip filter must be before Transcoder and gRPC Web filters, so that
+		// it encodes the responses after them, e.g. the transcoded JSON.
+		singleFilter("Gzip Filter", makeGzipFilter),
+		// gRPC Transcoder filter and gRPCWeb filter configs for gRPC backend.
+		singleFilter("Transcoder Filter", func(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+			if !serviceInfo.BackendIsGrpc {
+				return nil, nil
+			}
+			return makeTranscoderFilter(serviceInfo), nil
+		}),
+		singleFilter("gRPC Web Filter", func(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+			if !serviceInfo.BackendIsGrpc {
+				return nil, nil
+			}
+			return &hcmpb.HttpFilter{
+				Name: util.GRPCWeb,
+			}, nil
+		}),
+		// GrpcStats filter is used to count gRPC frames.
+		// The data is stored in filterState and used by ServiceControl
+		// filter in the final report call.
+		singleFilter("gRPC Stats Filter", func(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+			if !serviceInfo.BackendIsGrpc {
+				return nil, nil
+			}
+			return makeGrpcStatsFilter(), nil
+		}),
+		singleFilter("Backend Auth Filter", func(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+			return makeBackendAuthFilter(serviceInfo), nil
+		}),
+		singleFilter("Backend Routing Filter", makeBackendRoutingFilter),
+		at(sc.BeforeRouter),
+		// Router filter should be the last.
+		singleFilter("Router Filter", func(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+			return makeRouterFilter(serviceInfo.Options), nil
+		}),
+	}
+}
+
+// makeHttpFilters generates the HTTP filter chain.
+func makeHttpFilters(serviceInfo *sc.ServiceInfo) ([]*hcmpb.HttpFilter, error) {
+	var httpFilters []*hcmpb.HttpFilter
+	for _, gen := range makeFilterGenerators(serviceInfo) {
+		filters, err := gen.GenFilters(serviceInfo)
+		if err != nil {
+			return nil, err
+		}
+		for _, filter := range filters {
+			jsonStr, _ := util.ProtoToJson(filter)
+			glog.Infof("adding %s config: %v", gen.Name(), jsonStr)
+		}
+		httpFilters = append(httpFilters, filters...)
+	}
+	return httpFilters, nil
+}
+
+// makeCustomClusters generates the clusters needed by the custom filters.
+func makeCustomClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, error) {
+	var clusters []*v2pb.Cluster
+	for _, point := range sc.InsertionPoints {
+		for _, gen := range registeredFilterGenerators(point) {
+			clusterGen, ok := gen.(ClusterGenerator)
+			if !ok {
+				continue
+			}
+			genClusters, err := clusterGen.GenClusters(serviceInfo)
+			if err != nil {
+				return nil, fmt.Errorf("fail to generate clusters of %s: %v", gen.Name(), err)
+			}
+			clusters = append(clusters, genClusters...)
+		}
+	}
+
+	if serviceInfo.CustomFilters != nil {
+		clusters = append(clusters, serviceInfo.CustomFilters.Clusters...)
+	}
+	return clusters, nil
+}
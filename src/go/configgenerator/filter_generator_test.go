@@ -0,0 +1,355 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configgenerator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+	"github.com/google/go-cmp/cmp"
+
+	sc "github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	v2pb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	anypb "github.com/golang/protobuf/ptypes/any"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+type fakeFilterGenerator struct {
+	filterName  string
+	clusterName string
+}
+
+func (g *fakeFilterGenerator) Name() string {
+	return "fake filter"
+}
+
+func (g *fakeFilterGenerator) GenFilters(serviceInfo *sc.ServiceInfo) ([]*hcmpb.HttpFilter, error) {
+	return []*hcmpb.HttpFilter{{Name: g.filterName}}, nil
+}
+
+func (g *fakeFilterGenerator) GenClusters(serviceInfo *sc.ServiceInfo) ([]*v2pb.Cluster, error) {
+	return []*v2pb.Cluster{{Name: g.clusterName}}, nil
+}
+
+func TestMakeHttpFiltersWithCustomFilters(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+		Control: &confpb.Control{
+			Environment: "servicecontrol.googleapis.com",
+		},
+	}
+
+	testData := []struct {
+		desc             string
+		customFilters    string
+		registered       map[sc.InsertionPoint]*fakeFilterGenerator
+		wantFilterNames  []string
+		wantClusterNames []string
+		wantError        string
+		wantClusterError string
+	}{
+		{
+			desc: "Built-in filters only",
+			wantFilterNames: []string{
+				"envoy.filters.http.service_control",
+				"envoy.router",
+			},
+		},
+		{
+			desc: "Filters and clusters from the custom filter file",
+			customFilters: `{
+  "filters": [
+    {
+      "insertion_point": "before_router",
+      "filter": {
+        "name": "envoy.lua",
+        "typed_config": {
+          "@type": "type.googleapis.com/envoy.config.filter.http.lua.v2.Lua",
+          "inline_code": "function envoy_on_request(request_handle) end"
+        }
+      }
+    },
+    {
+      "insertion_point": "before_auth",
+      "filter": {
+        "name": "envoy.ext_authz",
+        "typed_config": {
+          "@type": "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthz",
+          "grpc_service": {
+            "envoy_grpc": {
+              "cluster_name": "ext-authz-cluster"
+            }
+          }
+        }
+      }
+    }
+  ],
+  "clusters": [
+    {
+      "name": "ext-authz-cluster",
+      "connect_timeout": "1s",
+      "type": "STRICT_DNS"
+    }
+  ]
+}`,
+			wantFilterNames: []string{
+				"envoy.ext_authz",
+				"envoy.filters.http.service_control",
+				"envoy.lua",
+				"envoy.router",
+			},
+			wantClusterNames: []string{
+				"ext-authz-cluster",
+			},
+		},
+		{
+			desc: "Filters and clusters from a YAML custom filter file",
+			customFilters: `
+filters:
+- insertion_point: before_router
+  filter:
+    name: envoy.lua
+    typed_config:
+      "@type": type.googleapis.com/envoy.config.filter.http.lua.v2.Lua
+      inline_code: function envoy_on_request(request_handle) end
+clusters:
+- name: lua-cluster
+  connect_timeout: 1s
+  type: STRICT_DNS
+`,
+			wantFilterNames: []string{
+				"envoy.filters.http.service_control",
+				"envoy.lua",
+				"envoy.router",
+			},
+			wantClusterNames: []string{
+				"lua-cluster",
+			},
+		},
+		{
+			desc: "Registered generators",
+			registered: map[sc.InsertionPoint]*fakeFilterGenerator{
+				sc.AfterServiceControl: {
+					filterName:  "envoy.rate_limit",
+					clusterName: "rate-limit-cluster",
+				},
+			},
+			wantFilterNames: []string{
+				"envoy.filters.http.service_control",
+				"envoy.rate_limit",
+				"envoy.router",
+			},
+			wantClusterNames: []string{
+				"rate-limit-cluster",
+			},
+		},
+		{
+			desc:          "Unknown insertion point",
+			customFilters: `{"filters": [{"insertion_point": "after_router", "filter": {"name": "envoy.lua"}}]}`,
+			wantError:     `custom filter 0 has unknown insertion point: "after_router"`,
+		},
+		{
+			desc:          "Invalid cluster",
+			customFilters: `{"clusters": [{"connect_timeout": "1s"}]}`,
+			wantError:     "invalid custom cluster 0",
+		},
+		{
+			desc:             "Custom cluster with the name of a generated cluster",
+			customFilters:    `{"clusters": [{"name": "service-control-cluster", "connect_timeout": "1s", "type": "STRICT_DNS"}]}`,
+			wantClusterError: "custom cluster service-control-cluster has the name of a generated cluster",
+		},
+	}
+
+	defer resetFilterGenerators()
+	for i, tc := range testData {
+		resetFilterGenerators()
+		for point, gen := range tc.registered {
+			if err := RegisterFilterGenerator(point, gen); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.CustomFiltersPath: tc.customFilters})()
+		fakeServiceInfo, err := sc.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.wantClusterError != "" {
+			if _, err := MakeClusters(fakeServiceInfo); err == nil || !strings.Contains(err.Error(), tc.wantClusterError) {
+				t.Errorf("Test Desc(%d): %s, expected MakeClusters err: %v, got: %v", i, tc.desc, tc.wantClusterError, err)
+			}
+			continue
+		}
+
+		gotFilters, err := makeHttpFilters(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var gotFilterNames []string
+		for _, filter := range gotFilters {
+			gotFilterNames = append(gotFilterNames, filter.Name)
+		}
+		if !cmp.Equal(gotFilterNames, tc.wantFilterNames) {
+			t.Errorf("Test Desc(%d): %s, makeHttpFilters failed,\ngot filters: %v,\nwant filters: %v", i, tc.desc, gotFilterNames, tc.wantFilterNames)
+		}
+
+		gotClusters, err := makeCustomClusters(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var gotClusterNames []string
+		for _, cluster := range gotClusters {
+			gotClusterNames = append(gotClusterNames, cluster.Name)
+		}
+		if !cmp.Equal(gotClusterNames, tc.wantClusterNames) {
+			t.Errorf("Test Desc(%d): %s, makeCustomClusters failed,\ngot clusters: %v,\nwant clusters: %v", i, tc.desc, gotClusterNames, tc.wantClusterNames)
+		}
+	}
+}
+
+// resetFilterGenerators removes the generators registered by a test.
+func resetFilterGenerators() {
+	customFilterGeneratorsMu.Lock()
+	defer customFilterGeneratorsMu.Unlock()
+	customFilterGenerators = map[sc.InsertionPoint][]FilterGenerator{}
+}
+
+func TestMakeHttpFiltersWithCompression(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+		Control: &confpb.Control{
+			Environment: "servicecontrol.googleapis.com",
+		},
+		SourceInfo: &confpb.SourceInfo{
+			SourceFiles: []*anypb.Any{content},
+		},
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendProtocol = "grpc"
+	opts.EnableResponseCompression = true
+	fakeServiceInfo, err := sc.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotFilters, err := makeHttpFilters(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotFilterNames []string
+	for _, filter := range gotFilters {
+		gotFilterNames = append(gotFilterNames, filter.Name)
+	}
+	// The Gzip filter encodes the responses after the Transcoder and gRPC Web
+	// filters.
+	wantFilterNames := []string{
+		"envoy.filters.http.path_matcher",
+		"envoy.filters.http.service_control",
+		"envoy.filters.http.gzip",
+		"envoy.grpc_json_transcoder",
+		"envoy.grpc_web",
+		"envoy.filters.http.grpc_stats",
+		"envoy.router",
+	}
+	if !cmp.Equal(gotFilterNames, wantFilterNames) {
+		t.Errorf("makeHttpFilters failed,\ngot filters: %v,\nwant filters: %v", gotFilterNames, wantFilterNames)
+	}
+}
+
+func TestRegisterFilterGeneratorWithUnknownInsertionPoint(t *testing.T) {
+	err := RegisterFilterGenerator("after_router", &fakeFilterGenerator{})
+	if err == nil || err.Error() != "unknown filter insertion point: after_router" {
+		t.Errorf("expected unknown insertion point error, got: %v", err)
+	}
+}
+
+func TestMakeHttpFiltersWithExtAuthz(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+		Control: &confpb.Control{
+			Environment: "servicecontrol.googleapis.com",
+		},
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendProtocol = "http"
+	opts.ExtAuthzAddress = "https://authz.example.com/check"
+	fakeServiceInfo, err := sc.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotFilters, err := makeHttpFilters(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotFilterNames []string
+	for _, filter := range gotFilters {
+		gotFilterNames = append(gotFilterNames, filter.Name)
+	}
+	// The Ext Authz filter is after the Service Control filter, so that the
+	// requests it denies are reported.
+	wantFilterNames := []string{
+		"envoy.filters.http.service_control",
+		"envoy.filters.http.ext_authz",
+		"envoy.router",
+	}
+	if !cmp.Equal(gotFilterNames, wantFilterNames) {
+		t.Errorf("makeHttpFilters failed,\ngot filters: %v,\nwant filters: %v", gotFilterNames, wantFilterNames)
+	}
+}
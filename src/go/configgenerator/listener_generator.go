@@ -16,7 +16,12 @@ package configgenerator
 
 import (
 	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
@@ -33,14 +38,22 @@ import (
 	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	listenerpb "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
 	routepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	bufferpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/buffer/v2"
+	extauthzpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/ext_authz/v2"
 	gspb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/grpc_stats/v2alpha"
+	gzippb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/gzip/v2"
 	hcpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/health_check/v2"
 	jwtpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/jwt_authn/v2alpha"
+	ratelimitpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rate_limit/v2"
+	rbacfilterpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rbac/v2"
 	routerpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/router/v2"
 	transcoderpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/transcoder/v2"
 	hcmpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	rlspb "github.com/envoyproxy/go-control-plane/envoy/config/ratelimit/v2"
+	rbacpb "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v2"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
 	anypb "github.com/golang/protobuf/ptypes/any"
-	durationpb "github.com/golang/protobuf/ptypes/duration"
+	emptypb "github.com/golang/protobuf/ptypes/empty"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
 	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
@@ -52,106 +65,11 @@ const (
 
 // MakeListener provides a dynamic listener for Envoy
 func MakeListener(serviceInfo *sc.ServiceInfo) (*v2pb.Listener, error) {
-	httpFilters := []*hcmpb.HttpFilter{}
-
-	if serviceInfo.Options.CorsPreset == "basic" || serviceInfo.Options.CorsPreset == "cors_with_regex" {
-		corsFilter := &hcmpb.HttpFilter{
-			Name: util.CORS,
-		}
-		httpFilters = append(httpFilters, corsFilter)
-		jsonStr, _ := util.ProtoToJson(corsFilter)
-		glog.Infof("adding CORS Filter config: %v", jsonStr)
-	}
-
-	// Add Path Matcher filter. The following filters rely on the dynamic
-	// metadata populated by Path Matcher filter.
-	// * Jwt Authentication filter
-	// * Service Control filter
-	// * Backend Authentication filter
-	// * Backend Routing filter
-	pathMathcherFilter := makePathMatcherFilter(serviceInfo)
-	if pathMathcherFilter != nil {
-		httpFilters = append(httpFilters, pathMathcherFilter)
-		jsonStr, _ := util.ProtoToJson(pathMathcherFilter)
-		glog.Infof("adding Path Matcher Filter config: %v", jsonStr)
-	}
-
-	// Add Health Check filter if needed. It must behind Path Matcher filter, since Service Control
-	// filter needs to get the corresponding rule for health check calls, in order to skip Report
-	if serviceInfo.Options.Healthz != "" {
-		hcFilter, err := makeHealthCheckFilter(serviceInfo)
-		if err != nil {
-			return nil, err
-		}
-		httpFilters = append(httpFilters, hcFilter)
-		jsonStr, _ := util.ProtoToJson(hcFilter)
-		glog.V(1).Infof("adding Healthz filter config: %v", jsonStr)
-	}
-
-	// Add JWT Authn filter if needed.
-	if !serviceInfo.Options.SkipJwtAuthnFilter {
-		jwtAuthnFilter := makeJwtAuthnFilter(serviceInfo)
-		if jwtAuthnFilter != nil {
-			httpFilters = append(httpFilters, jwtAuthnFilter)
-			jsonStr, _ := util.ProtoToJson(jwtAuthnFilter)
-			glog.Infof("adding JWT Authn Filter config: %v", jsonStr)
-		}
-	}
-
-	// Add Service Control filter if needed.
-	if !serviceInfo.Options.SkipServiceControlFilter {
-		serviceControlFilter := makeServiceControlFilter(serviceInfo)
-		if serviceControlFilter != nil {
-			httpFilters = append(httpFilters, serviceControlFilter)
-			jsonStr, _ := util.ProtoToJson(serviceControlFilter)
-			glog.Infof("adding Service Control Filter config: %v", jsonStr)
-		}
-	}
-
-	// Add gRPC Transcoder filter and gRPCWeb filter configs for gRPC backend.
-	if serviceInfo.BackendIsGrpc {
-		transcoderFilter := makeTranscoderFilter(serviceInfo)
-		if transcoderFilter != nil {
-			httpFilters = append(httpFilters, transcoderFilter)
-			jsonStr, _ := util.ProtoToJson(transcoderFilter)
-			glog.Infof("adding Transcoder Filter config: %v", jsonStr)
-		}
-
-		grpcWebFilter := &hcmpb.HttpFilter{
-			Name: util.GRPCWeb,
-		}
-		httpFilters = append(httpFilters, grpcWebFilter)
-
-		// GrpcStats filter is used to count gRPC frames.
-		// The data is stored in filterState and used by ServiceControl
-		// filter in the final report call.
-		httpFilters = append(httpFilters, makeGrpcStatsFilter())
-	}
-
-	// Add Backend Auth filter and Backend Routing if needed.
-	backendAuthFilter := makeBackendAuthFilter(serviceInfo)
-	if backendAuthFilter != nil {
-		httpFilters = append(httpFilters, backendAuthFilter)
-		jsonStr, _ := util.ProtoToJson(backendAuthFilter)
-		glog.Infof("adding Backend Auth Filter config: %v", jsonStr)
-	}
-
-	backendRoutingFilter, err := makeBackendRoutingFilter(serviceInfo)
+	httpFilters, err := makeHttpFilters(serviceInfo)
 	if err != nil {
 		return nil, err
 	}
 
-	if backendRoutingFilter != nil {
-		httpFilters = append(httpFilters, backendRoutingFilter)
-		jsonStr, _ := util.ProtoToJson(backendRoutingFilter)
-		glog.Infof("adding Backend Routing Filter config: %v", jsonStr)
-	}
-
-	// Add Envoy Router filter so requests are routed upstream.
-	// Router filter should be the last.
-	routerFilter := makeRouterFilter(serviceInfo.Options)
-	httpFilters = append(httpFilters, routerFilter)
-
 	route, err := MakeRouteConfig(serviceInfo)
 
 	if err != nil {
@@ -159,7 +77,6 @@ func MakeListener(serviceInfo *sc.ServiceInfo) (*v2pb.Listener, error) {
 	}
 
 	httpConMgr := &hcmpb.HttpConnectionManager{
-		CodecType:  hcmpb.HttpConnectionManager_AUTO,
 		StatPrefix: statPrefix,
 		RouteSpecifier: &hcmpb.HttpConnectionManager_RouteConfig{
 			RouteConfig: route,
@@ -168,8 +85,38 @@ func MakeListener(serviceInfo *sc.ServiceInfo) (*v2pb.Listener, error) {
 		UseRemoteAddress:  &wrapperspb.BoolValue{Value: serviceInfo.Options.EnvoyUseRemoteAddress},
 		XffNumTrustedHops: uint32(serviceInfo.Options.EnvoyXffNumTrustedHops),
 	}
+	if err := applyHttpConnectionManagerOptions(httpConMgr, serviceInfo.Options); err != nil {
+		return nil, err
+	}
+	// The upgrades are only enabled by the WebSocket routes, matching the
+	// upgrade requests.
+	if serviceInfo.HasWebsocket() {
+		httpConMgr.UpgradeConfigs = []*hcmpb.HttpConnectionManager_UpgradeConfig{
+			{
+				UpgradeType: util.WebsocketUpgradeType,
+				Enabled:     &wrapperspb.BoolValue{Value: false},
+			},
+		}
+	}
+	secHeaders, err := makeSecurityHeaders(serviceInfo.Options)
+	if err != nil {
+		return nil, err
+	}
+	if secHeaders.serverName != "" {
+		httpConMgr.ServerName = secHeaders.serverName
+	} else if secHeaders.hideServer {
+		httpConMgr.ServerHeaderTransformation = hcmpb.HttpConnectionManager_PASS_THROUGH
+	}
+
 	if !serviceInfo.Options.DisableTracing {
 		httpConMgr.Tracing = &hcmpb.HttpConnectionManager_Tracing{}
+		if serviceInfo.Options.TracingRequestHeadersForTags != "" {
+			for _, header := range strings.Split(serviceInfo.Options.TracingRequestHeadersForTags, ",") {
+				if header = strings.TrimSpace(header); header != "" {
+					httpConMgr.Tracing.RequestHeadersForTags = append(httpConMgr.Tracing.RequestHeadersForTags, header)
+				}
+			}
+		}
 	}
 
 	jsonStr, _ := util.ProtoToJson(httpConMgr)
@@ -206,6 +153,95 @@ func MakeListener(serviceInfo *sc.ServiceInfo) (*v2pb.Listener, error) {
 	}, nil
 }
 
+var listenerCodecTypes = map[string]hcmpb.HttpConnectionManager_CodecType{
+	"auto":  hcmpb.HttpConnectionManager_AUTO,
+	"http1": hcmpb.HttpConnectionManager_HTTP1,
+	"http2": hcmpb.HttpConnectionManager_HTTP2,
+}
+
+// applyHttpConnectionManagerOptions sets the codec, timeouts and limits of
+// the Http Connection Manager. The options left to 0 keep the Envoy defaults.
+func applyHttpConnectionManagerOptions(httpConMgr *hcmpb.HttpConnectionManager, opts options.ConfigGeneratorOptions) error {
+	codecType, ok := listenerCodecTypes[opts.ListenerCodecType]
+	if !ok {
+		return fmt.Errorf(`listener_codec_type must be one of "auto", "http1" and "http2", got %q`, opts.ListenerCodecType)
+	}
+	httpConMgr.CodecType = codecType
+
+	// The filters and the routes see the normalized path.
+	if opts.NormalizePath {
+		httpConMgr.NormalizePath = &wrapperspb.BoolValue{Value: true}
+	}
+	httpConMgr.MergeSlashes = opts.MergeSlashes
+
+	for name, timeout := range map[string]time.Duration{
+		"connection_idle_timeout": opts.ConnectionIdleTimeout,
+		"stream_idle_timeout":     opts.StreamIdleTimeout,
+		"request_timeout":         opts.RequestTimeout,
+		"drain_timeout":           opts.DrainTimeout,
+		"streaming_idle_timeout":  opts.StreamingIdleTimeout,
+	} {
+		if timeout < 0 {
+			return fmt.Errorf("%s must be >= 0, got %v", name, timeout)
+		}
+	}
+	if opts.ConnectionIdleTimeout > 0 {
+		httpConMgr.CommonHttpProtocolOptions = &corepb.HttpProtocolOptions{
+			IdleTimeout: ptypes.DurationProto(opts.ConnectionIdleTimeout),
+		}
+	}
+	if opts.StreamIdleTimeout > 0 {
+		httpConMgr.StreamIdleTimeout = ptypes.DurationProto(opts.StreamIdleTimeout)
+	}
+	if opts.RequestTimeout > 0 {
+		httpConMgr.RequestTimeout = ptypes.DurationProto(opts.RequestTimeout)
+	}
+	if opts.DrainTimeout > 0 {
+		httpConMgr.DrainTimeout = ptypes.DurationProto(opts.DrainTimeout)
+	}
+
+	if opts.MaxRequestHeadersKb < 0 || opts.MaxRequestHeadersKb > 96 {
+		return fmt.Errorf("max_request_headers_kb must be >= 0 and <= 96, got %d", opts.MaxRequestHeadersKb)
+	}
+	if opts.MaxRequestHeadersKb > 0 {
+		httpConMgr.MaxRequestHeadersKb = &wrapperspb.UInt32Value{Value: uint32(opts.MaxRequestHeadersKb)}
+	}
+
+	for name, value := range map[string]int{
+		"http2_initial_stream_window_size":     opts.Http2StreamWindowSize,
+		"http2_initial_connection_window_size": opts.Http2ConnectionWindowSize,
+	} {
+		if value != 0 && (value < 65535 || value > math.MaxInt32) {
+			return fmt.Errorf("%s must be 0, or >= 65535 and <= %d, got %d", name, math.MaxInt32, value)
+		}
+	}
+	if opts.Http2MaxConcurrentStreams < 0 || opts.Http2MaxConcurrentStreams > math.MaxInt32 {
+		return fmt.Errorf("http2_max_concurrent_streams must be >= 0 and <= %d, got %d", math.MaxInt32, opts.Http2MaxConcurrentStreams)
+	}
+	if opts.Http2MaxConcurrentStreams > 0 || opts.Http2StreamWindowSize > 0 || opts.Http2ConnectionWindowSize > 0 {
+		httpConMgr.Http2ProtocolOptions = &corepb.Http2ProtocolOptions{}
+		if opts.Http2MaxConcurrentStreams > 0 {
+			httpConMgr.Http2ProtocolOptions.MaxConcurrentStreams = &wrapperspb.UInt32Value{Value: uint32(opts.Http2MaxConcurrentStreams)}
+		}
+		if opts.Http2StreamWindowSize > 0 {
+			httpConMgr.Http2ProtocolOptions.InitialStreamWindowSize = &wrapperspb.UInt32Value{Value: uint32(opts.Http2StreamWindowSize)}
+		}
+		if opts.Http2ConnectionWindowSize > 0 {
+			httpConMgr.Http2ProtocolOptions.InitialConnectionWindowSize = &wrapperspb.UInt32Value{Value: uint32(opts.Http2ConnectionWindowSize)}
+		}
+	}
+	return nil
+}
+
+func makeCorsFilter(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+	if serviceInfo.Options.CorsPreset != "basic" && serviceInfo.Options.CorsPreset != "cors_with_regex" && serviceInfo.CorsPolicies == nil {
+		return nil, nil
+	}
+	return &hcmpb.HttpFilter{
+		Name: util.CORS,
+	}, nil
+}
+
 func makePathMatcherFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 	rules := []*pmpb.PathMatcherRule{}
 	for _, operation := range serviceInfo.Operations {
@@ -229,7 +265,16 @@ func makePathMatcherFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 		return nil
 	}
 
-	pathMathcherConfig := &pmpb.FilterConfig{Rules: rules}
+	pathMathcherConfig := &pmpb.FilterConfig{
+		Rules: rules,
+		// Consistent with the routes, see makeHttpRouteMatcher.
+		CaseInsensitiveMatching: serviceInfo.Options.CaseInsensitiveMatching,
+		LocalReplyConfig:        serviceInfo.LocalReplyConfigs[sc.LocalReplyPathNotFound],
+	}
+	if serviceInfo.Options.ExtAuthzAddress != "" {
+		// Sent to the external authorization server in the check requests.
+		pathMathcherConfig.OperationHeader = util.ExtAuthzOperationHeader
+	}
 	if len(serviceInfo.SegmentNames) > 0 {
 		pathMathcherConfig.SegmentNames = serviceInfo.SegmentNames
 	}
@@ -258,6 +303,34 @@ func hasPathParameter(httpPattern string) bool {
 	return strings.ContainsRune(httpPattern, '{')
 }
 
+// makeIgnoredQueryParameters returns the query parameters carrying credentials,
+// which are not part of the gRPC request message.
+func makeIgnoredQueryParameters(serviceInfo *sc.ServiceInfo) []string {
+	params := []string{"api_key", "key", "access_token"}
+	seen := make(map[string]bool)
+	for _, param := range params {
+		seen[param] = true
+	}
+	addParam := func(param string) {
+		if !seen[param] {
+			seen[param] = true
+			params = append(params, param)
+		}
+	}
+
+	for _, param := range serviceInfo.JwtQueryParameters() {
+		addParam(param)
+	}
+	for _, operation := range serviceInfo.Operations {
+		for _, loc := range serviceInfo.Methods[operation].APIKeyLocations {
+			if query := loc.GetQuery(); query != "" {
+				addParam(query)
+			}
+		}
+	}
+	return params
+}
+
 func makeJwtAuthnFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 	auth := serviceInfo.ServiceConfig().GetAuthentication()
 	if len(auth.GetProviders()) == 0 {
@@ -265,39 +338,50 @@ func makeJwtAuthnFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 	}
 	providers := make(map[string]*jwtpb.JwtProvider)
 	for _, provider := range auth.GetProviders() {
-		clusterName, err := util.ExtraAddressFromURI(provider.GetJwksUri())
-		if err != nil {
-			return nil
-		}
 		jp := &jwtpb.JwtProvider{
-			Issuer: provider.GetIssuer(),
-			JwksSourceSpecifier: &jwtpb.JwtProvider_RemoteJwks{
+			Issuer:               provider.GetIssuer(),
+			ForwardPayloadHeader: util.JwtPayloadHeader,
+		}
+
+		// The local JWKS is inlined, so that a new config is pushed to Envoy
+		// when the JWKS file changes.
+		if jwks, ok := serviceInfo.LocalJwks[provider.GetId()]; ok {
+			jp.JwksSourceSpecifier = &jwtpb.JwtProvider_LocalJwks{
+				LocalJwks: &corepb.DataSource{
+					Specifier: &corepb.DataSource_InlineString{
+						InlineString: jwks.Content,
+					},
+				},
+			}
+		} else {
+			clusterName, err := util.ExtraAddressFromURI(provider.GetJwksUri())
+			if err != nil {
+				return nil
+			}
+			jp.JwksSourceSpecifier = &jwtpb.JwtProvider_RemoteJwks{
 				RemoteJwks: &jwtpb.RemoteJwks{
 					HttpUri: &corepb.HttpUri{
 						Uri: provider.GetJwksUri(),
 						HttpUpstreamType: &corepb.HttpUri_Cluster{
 							Cluster: clusterName,
 						},
-						Timeout: ptypes.DurationProto(serviceInfo.Options.HttpRequestTimeout),
+						Timeout: ptypes.DurationProto(serviceInfo.JwksFetchTimeout(provider.GetId())),
 					},
-					CacheDuration: &durationpb.Duration{
-						Seconds: int64(serviceInfo.Options.JwksCacheDurationInS),
-					},
-				},
-			},
-			FromHeaders: []*jwtpb.JwtHeader{
-				{
-					Name:        "Authorization",
-					ValuePrefix: "Bearer ",
+					CacheDuration: ptypes.DurationProto(serviceInfo.JwksCacheDuration(provider.GetId())),
 				},
-				{
-					Name: "X-Goog-Iap-Jwt-Assertion",
-				},
-			},
-			FromParams: []string{
-				"access_token",
-			},
-			ForwardPayloadHeader: "X-Endpoint-API-UserInfo",
+			}
+		}
+
+		for _, loc := range serviceInfo.JwtLocations(provider.GetId()) {
+			switch {
+			case loc.Header != "":
+				jp.FromHeaders = append(jp.FromHeaders, &jwtpb.JwtHeader{
+					Name:        loc.Header,
+					ValuePrefix: loc.ValuePrefix,
+				})
+			case loc.Query != "":
+				jp.FromParams = append(jp.FromParams, loc.Query)
+			}
 		}
 
 		if len(provider.GetAudiences()) != 0 {
@@ -326,7 +410,11 @@ func makeJwtAuthnFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 	requirements := make(map[string]*jwtpb.JwtRequirement)
 	for _, rule := range auth.GetRules() {
 		if len(rule.GetRequirements()) > 0 {
-			requirements[rule.GetSelector()] = makeJwtRequirement(rule.GetRequirements())
+			requirement := makeJwtRequirement(rule.GetRequirements())
+			if method := serviceInfo.Methods[rule.GetSelector()]; method != nil && method.AuthenticationPolicy != nil && method.AuthenticationPolicy.Mode != "" {
+				requirement = makeAllowMissingOrFailedRequirement(requirement)
+			}
+			requirements[rule.GetSelector()] = requirement
 		}
 	}
 
@@ -346,6 +434,451 @@ func makeJwtAuthnFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 	return jwtAuthnFilter
 }
 
+func makeExtAuthzFilter(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+	if serviceInfo.Options.ExtAuthzAddress == "" {
+		return nil, nil
+	}
+	protocol, _, _, _, path, err := parseExtAuthzAddress(serviceInfo.Options.ExtAuthzAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	extAuthz := &extauthzpb.ExtAuthz{
+		FailureModeAllow: serviceInfo.Options.ExtAuthzFailureModeAllow,
+	}
+	timeout := ptypes.DurationProto(serviceInfo.Options.ExtAuthzTimeout)
+	if protocol == util.GRPC {
+		extAuthz.Services = &extauthzpb.ExtAuthz_GrpcService{
+			GrpcService: &corepb.GrpcService{
+				TargetSpecifier: &corepb.GrpcService_EnvoyGrpc_{
+					EnvoyGrpc: &corepb.GrpcService_EnvoyGrpc{
+						ClusterName: util.ExtAuthzClusterName,
+					},
+				},
+				Timeout: timeout,
+			},
+		}
+		// Send the JWT payloads, written by the JWT Authn filter, in the check requests.
+		extAuthz.MetadataContextNamespaces = []string{util.JwtAuthn}
+	} else {
+		// HTTP servers only get the allowed headers. The operation header is
+		// set by the Path Matcher filter.
+		var allowedHeaders []*matcher.StringMatcher
+		for _, header := range []string{"authorization", util.JwtPayloadHeader, util.ExtAuthzOperationHeader} {
+			allowedHeaders = append(allowedHeaders, &matcher.StringMatcher{
+				MatchPattern: &matcher.StringMatcher_Exact{
+					Exact: strings.ToLower(header),
+				},
+			})
+		}
+		extAuthz.Services = &extauthzpb.ExtAuthz_HttpService{
+			HttpService: &extauthzpb.HttpService{
+				ServerUri: &corepb.HttpUri{
+					Uri: serviceInfo.Options.ExtAuthzAddress,
+					HttpUpstreamType: &corepb.HttpUri_Cluster{
+						Cluster: util.ExtAuthzClusterName,
+					},
+					Timeout: timeout,
+				},
+				PathPrefix: path,
+				AuthorizationRequest: &extauthzpb.AuthorizationRequest{
+					AllowedHeaders: &matcher.ListStringMatcher{
+						Patterns: allowedHeaders,
+					},
+				},
+			},
+		}
+	}
+
+	extAuthzAny, err := ptypes.MarshalAny(extAuthz)
+	if err != nil {
+		return nil, err
+	}
+	return &hcmpb.HttpFilter{
+		Name:       util.ExtAuthz,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: extAuthzAny},
+	}, nil
+}
+
+// makeRateLimitFilter makes the filter calling the rate limit service with
+// the descriptors of the rate limit actions of the routes.
+func makeRateLimitFilter(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+	if serviceInfo.Options.RateLimitServiceAddress == "" {
+		return nil, nil
+	}
+	domain := serviceInfo.Options.RateLimitDomain
+	if domain == "" {
+		domain = serviceInfo.Name
+	}
+
+	rateLimit := &ratelimitpb.RateLimit{
+		Domain:          domain,
+		Timeout:         ptypes.DurationProto(serviceInfo.Options.RateLimitTimeout),
+		FailureModeDeny: serviceInfo.Options.RateLimitFailureModeDeny,
+		// gRPC clients get RESOURCE_EXHAUSTED, as from service control quota.
+		RateLimitedAsResourceExhausted: true,
+		RateLimitService: &rlspb.RateLimitServiceConfig{
+			GrpcService: &corepb.GrpcService{
+				TargetSpecifier: &corepb.GrpcService_EnvoyGrpc_{
+					EnvoyGrpc: &corepb.GrpcService_EnvoyGrpc{
+						ClusterName: util.RateLimitClusterName,
+					},
+				},
+			},
+		},
+	}
+	rateLimitAny, err := ptypes.MarshalAny(rateLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &hcmpb.HttpFilter{
+		Name:       util.RateLimit,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: rateLimitAny},
+	}, nil
+}
+
+// hasRequestBodyLimits returns whether the request body size is limited,
+// globally or for some operations.
+func hasRequestBodyLimits(serviceInfo *sc.ServiceInfo) bool {
+	if serviceInfo.Options.MaxRequestBytes > 0 {
+		return true
+	}
+	for _, method := range serviceInfo.Methods {
+		if method.RequestBodyPolicy != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// makeBufferFilter makes the filter rejecting the requests with a body larger
+// than --max_request_bytes, or the limit of their route.
+func makeBufferFilter(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+	if !hasRequestBodyLimits(serviceInfo) {
+		return nil, nil
+	}
+	if serviceInfo.Options.MaxRequestBytes > math.MaxUint32 {
+		return nil, fmt.Errorf("max_request_bytes must be <= %d, got %d", uint32(math.MaxUint32), serviceInfo.Options.MaxRequestBytes)
+	}
+
+	maxRequestBytes := uint32(serviceInfo.Options.MaxRequestBytes)
+	if maxRequestBytes == 0 {
+		// Only the operations with a limit buffer the requests, the virtual
+		// host disables the filter for the other routes. The filter config
+		// still needs a limit.
+		for _, method := range serviceInfo.Methods {
+			if method.RequestBodyPolicy != nil && method.RequestBodyPolicy.MaxRequestBytes > maxRequestBytes {
+				maxRequestBytes = method.RequestBodyPolicy.MaxRequestBytes
+			}
+		}
+	}
+
+	buffer, err := ptypes.MarshalAny(&bufferpb.Buffer{
+		MaxRequestBytes: &wrapperspb.UInt32Value{
+			Value: maxRequestBytes,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &hcmpb.HttpFilter{
+		Name:       util.Buffer,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: buffer},
+	}, nil
+}
+
+// The compression levels of --compression_level.
+var gzipCompressionLevels = map[string]gzippb.Gzip_CompressionLevel_Enum{
+	"default": gzippb.Gzip_CompressionLevel_DEFAULT,
+	"best":    gzippb.Gzip_CompressionLevel_BEST,
+	"speed":   gzippb.Gzip_CompressionLevel_SPEED,
+}
+
+// makeGzipFilter makes the filter compressing the responses.
+func makeGzipFilter(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+	if !serviceInfo.Options.EnableResponseCompression {
+		return nil, nil
+	}
+	level, ok := gzipCompressionLevels[serviceInfo.Options.CompressionLevel]
+	if !ok {
+		return nil, fmt.Errorf(`compression_level must be one of "default", "best" and "speed", got %q`, serviceInfo.Options.CompressionLevel)
+	}
+	if serviceInfo.Options.CompressionMinLength < 0 {
+		return nil, fmt.Errorf("compression_min_length must be >= 0, got %d", serviceInfo.Options.CompressionMinLength)
+	}
+
+	gzip := &gzippb.Gzip{
+		ContentLength: &wrapperspb.UInt32Value{
+			Value: uint32(serviceInfo.Options.CompressionMinLength),
+		},
+		CompressionLevel: level,
+	}
+	for _, contentType := range strings.Split(serviceInfo.Options.CompressionContentTypes, ",") {
+		if contentType = strings.TrimSpace(contentType); contentType != "" {
+			gzip.ContentType = append(gzip.ContentType, contentType)
+		}
+	}
+
+	gzipAny, err := ptypes.MarshalAny(gzip)
+	if err != nil {
+		return nil, err
+	}
+	return &hcmpb.HttpFilter{
+		Name:       util.Gzip,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: gzipAny},
+	}, nil
+}
+
+// makeRbacFilter compiles the authorization policies of the operations into
+// an RBAC filter. The operation is matched on the dynamic metadata set by the
+// Path Matcher filter, the claims on the JWT payloads set by the JWT Authn
+// filter.
+func makeRbacFilter(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
+	policies := make(map[string]*rbacpb.Policy)
+	var restrictedOperations []*rbacpb.Permission
+	for _, operation := range serviceInfo.Operations {
+		authzPolicy := serviceInfo.Methods[operation].AuthorizationPolicy
+		if authzPolicy == nil {
+			continue
+		}
+		operationPermission := makeOperationPermission(operation)
+		restrictedOperations = append(restrictedOperations, operationPermission)
+		policies[operation] = &rbacpb.Policy{
+			Permissions: []*rbacpb.Permission{operationPermission},
+			Principals:  []*rbacpb.Principal{makeAuthorizationPrincipal(authzPolicy)},
+		}
+	}
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	// Requests to the other operations, or not matching any operation, are allowed.
+	policies["unrestricted-operations"] = &rbacpb.Policy{
+		Permissions: []*rbacpb.Permission{
+			{
+				Rule: &rbacpb.Permission_NotRule{
+					NotRule: &rbacpb.Permission{
+						Rule: &rbacpb.Permission_OrRules{
+							OrRules: &rbacpb.Permission_Set{
+								Rules: restrictedOperations,
+							},
+						},
+					},
+				},
+			},
+		},
+		Principals: []*rbacpb.Principal{
+			{
+				Identifier: &rbacpb.Principal_Any{
+					Any: true,
+				},
+			},
+		},
+	}
+
+	rbac := &rbacfilterpb.RBAC{
+		Rules: &rbacpb.RBAC{
+			Action:   rbacpb.RBAC_ALLOW,
+			Policies: policies,
+		},
+	}
+	rbacAny, err := ptypes.MarshalAny(rbac)
+	if err != nil {
+		return nil, err
+	}
+	return &hcmpb.HttpFilter{
+		Name:       util.RBAC,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: rbacAny},
+	}, nil
+}
+
+func makeOperationPermission(operation string) *rbacpb.Permission {
+	return &rbacpb.Permission{
+		Rule: &rbacpb.Permission_Metadata{
+			Metadata: &matcher.MetadataMatcher{
+				Filter: util.PathMatcher,
+				Path: []*matcher.MetadataMatcher_PathSegment{
+					{
+						Segment: &matcher.MetadataMatcher_PathSegment_Key{
+							Key: util.OperationMetadataName,
+						},
+					},
+				},
+				Value: &matcher.ValueMatcher{
+					MatchPattern: &matcher.ValueMatcher_StringMatch{
+						StringMatch: &matcher.StringMatcher{
+							MatchPattern: &matcher.StringMatcher_Exact{
+								Exact: operation,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// makeAuthorizationPrincipal makes the principal matching all the conditions
+// of the policy.
+func makeAuthorizationPrincipal(authzPolicy *sc.AuthorizationPolicy) *rbacpb.Principal {
+	var ids []*rbacpb.Principal
+
+	// Sort claims for a stable config.
+	var claims []string
+	for claim := range authzPolicy.RequiredClaims {
+		claims = append(claims, claim)
+	}
+	sort.Strings(claims)
+	for _, claim := range claims {
+		values := authzPolicy.RequiredClaims[claim]
+		if len(values) == 0 {
+			ids = append(ids, makeClaimPrincipal(claim, &matcher.ValueMatcher{
+				MatchPattern: &matcher.ValueMatcher_PresentMatch{
+					PresentMatch: true,
+				},
+			}))
+			continue
+		}
+
+		var valueIds []*rbacpb.Principal
+		for _, value := range values {
+			exact := &matcher.ValueMatcher{
+				MatchPattern: &matcher.ValueMatcher_StringMatch{
+					StringMatch: &matcher.StringMatcher{
+						MatchPattern: &matcher.StringMatcher_Exact{
+							Exact: value,
+						},
+					},
+				},
+			}
+			// The claim is either the value, or a list containing it.
+			valueIds = append(valueIds, makeClaimPrincipal(claim, exact), makeClaimPrincipal(claim, &matcher.ValueMatcher{
+				MatchPattern: &matcher.ValueMatcher_ListMatch{
+					ListMatch: &matcher.ListMatcher{
+						MatchPattern: &matcher.ListMatcher_OneOf{
+							OneOf: exact,
+						},
+					},
+				},
+			}))
+		}
+		ids = append(ids, &rbacpb.Principal{
+			Identifier: &rbacpb.Principal_OrIds{
+				OrIds: &rbacpb.Principal_Set{
+					Ids: valueIds,
+				},
+			},
+		})
+	}
+
+	for _, scope := range authzPolicy.Scopes {
+		ids = append(ids, makeClaimPrincipal("scope", &matcher.ValueMatcher{
+			MatchPattern: &matcher.ValueMatcher_StringMatch{
+				StringMatch: &matcher.StringMatcher{
+					MatchPattern: &matcher.StringMatcher_SafeRegex{
+						SafeRegex: &matcher.RegexMatcher{
+							EngineType: &matcher.RegexMatcher_GoogleRe2{
+								GoogleRe2: &matcher.RegexMatcher_GoogleRE2{
+									MaxProgramSize: &wrapperspb.UInt32Value{
+										Value: util.GoogleRE2MaxProgramSize,
+									},
+								},
+							},
+							Regex: `(.* )?` + regexp.QuoteMeta(scope) + `( .*)?`,
+						},
+					},
+				},
+			},
+		}))
+	}
+
+	if len(authzPolicy.SourceCidrs) > 0 {
+		var cidrIds []*rbacpb.Principal
+		for _, cidr := range authzPolicy.SourceCidrs {
+			// Already validated when reading the policy.
+			_, ipNet, _ := net.ParseCIDR(cidr)
+			prefixLen, _ := ipNet.Mask.Size()
+			cidrIds = append(cidrIds, &rbacpb.Principal{
+				Identifier: &rbacpb.Principal_SourceIp{
+					SourceIp: &corepb.CidrRange{
+						AddressPrefix: ipNet.IP.String(),
+						PrefixLen: &wrapperspb.UInt32Value{
+							Value: uint32(prefixLen),
+						},
+					},
+				},
+			})
+		}
+		ids = append(ids, &rbacpb.Principal{
+			Identifier: &rbacpb.Principal_OrIds{
+				OrIds: &rbacpb.Principal_Set{
+					Ids: cidrIds,
+				},
+			},
+		})
+	}
+
+	if len(ids) == 0 {
+		return &rbacpb.Principal{
+			Identifier: &rbacpb.Principal_Any{
+				Any: true,
+			},
+		}
+	}
+	return &rbacpb.Principal{
+		Identifier: &rbacpb.Principal_AndIds{
+			AndIds: &rbacpb.Principal_Set{
+				Ids: ids,
+			},
+		},
+	}
+}
+
+// makeClaimPrincipal matches a claim of the JWT payloads.
+func makeClaimPrincipal(claim string, value *matcher.ValueMatcher) *rbacpb.Principal {
+	return &rbacpb.Principal{
+		Identifier: &rbacpb.Principal_Metadata{
+			Metadata: &matcher.MetadataMatcher{
+				Filter: util.JwtAuthn,
+				Path: []*matcher.MetadataMatcher_PathSegment{
+					{
+						Segment: &matcher.MetadataMatcher_PathSegment_Key{
+							Key: util.JwtPayloadMetadataName,
+						},
+					},
+					{
+						Segment: &matcher.MetadataMatcher_PathSegment_Key{
+							Key: claim,
+						},
+					},
+				},
+				Value: value,
+			},
+		},
+	}
+}
+
+// makeAllowMissingOrFailedRequirement makes the requirement still verify the
+// JWT, but accept the requests without JWT or with an invalid JWT.
+func makeAllowMissingOrFailedRequirement(requirement *jwtpb.JwtRequirement) *jwtpb.JwtRequirement {
+	allowMissingOrFailed := &jwtpb.JwtRequirement{
+		RequiresType: &jwtpb.JwtRequirement_AllowMissingOrFailed{
+			AllowMissingOrFailed: &emptypb.Empty{},
+		},
+	}
+	if requiresAny := requirement.GetRequiresAny(); requiresAny != nil {
+		requiresAny.Requirements = append(requiresAny.Requirements, allowMissingOrFailed)
+		return requirement
+	}
+	return &jwtpb.JwtRequirement{
+		RequiresType: &jwtpb.JwtRequirement_RequiresAny{
+			RequiresAny: &jwtpb.JwtRequirementOrList{
+				Requirements: []*jwtpb.JwtRequirement{requirement, allowMissingOrFailed},
+			},
+		},
+	}
+}
+
 func makeJwtRequirement(requirements []*confpb.AuthRequirement) *jwtpb.JwtRequirement {
 	// By default, if there are multi requirements, treat it as RequireAny.
 	requires := &jwtpb.JwtRequirement{
@@ -465,6 +998,13 @@ func makeServiceControlFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 			Cluster: util.ServiceControlClusterName,
 			Timeout: ptypes.DurationProto(serviceInfo.Options.HttpRequestTimeout),
 		},
+		LocalReplyConfig: serviceInfo.LocalReplyConfigs[sc.LocalReplyServiceControlDenied],
+	}
+	if serviceInfo.Options.RateLimitServiceAddress != "" {
+		// The rate limit actions of the routes read the API key and the JWT
+		// sub claim from these headers.
+		filterConfig.ApiKeyHeader = util.RateLimitApiKeyHeader
+		filterConfig.JwtSubHeader = util.RateLimitJwtSubHeader
 	}
 
 	if serviceInfo.Options.ServiceControlCredentials != nil {
@@ -514,9 +1054,18 @@ func makeServiceControlFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 		requirement := &scpb.Requirement{
 			ServiceName:        serviceName,
 			OperationName:      operation,
+			ApiName:            method.ApiName,
+			ApiVersion:         serviceInfo.ApiVersions[method.ApiName],
 			SkipServiceControl: method.SkipServiceControl,
 			MetricCosts:        method.MetricCosts,
 		}
+		for _, limit := range method.LocalQuotaLimits {
+			requirement.LocalQuotaLimits = append(requirement.LocalQuotaLimits, &scpb.LocalQuotaLimit{
+				Name:            limit.Name,
+				Cost:            limit.Cost,
+				TokensPerMinute: limit.PerMinute,
+			})
+		}
 
 		// For these OPTIONS methods, auth should be disabled and AllowWithoutApiKey
 		// should be true for each CORS.
@@ -576,7 +1125,7 @@ func makeTranscoderFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 				DescriptorSet: &transcoderpb.GrpcJsonTranscoder_ProtoDescriptorBin{
 					ProtoDescriptorBin: configContent,
 				},
-				IgnoredQueryParameters: []string{"api_key", "key", "access_token"},
+				IgnoredQueryParameters: makeIgnoredQueryParameters(serviceInfo),
 				ConvertGrpcStatus:      true,
 			}
 			transcodeConfig.Services = append(transcodeConfig.Services, serviceInfo.ApiNames...)
@@ -611,15 +1160,26 @@ func makeBackendAuthFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 				JwtAudience: method.BackendInfo.JwtAudience,
 			})
 	}
-	// If none of BackendRules need auth, rules will be empty, not need to add the filter.
-	if len(rules) == 0 {
+	perRouteAudiences := serviceInfo.BackendSplitJwtAudiences()
+	claimHeadersRules := makeJwtClaimHeadersRules(serviceInfo)
+	// If none of BackendRules and backend splits need auth and no JWT claim is forwarded, not need to add the filter.
+	if len(rules) == 0 && len(perRouteAudiences) == 0 && len(claimHeadersRules) == 0 {
 		return nil
 	}
 
 	backendAuthConfig := &bapb.FilterConfig{
-		Rules: rules,
+		Rules:                rules,
+		PerRouteJwtAudiences: perRouteAudiences,
+		LocalReplyConfig:     serviceInfo.LocalReplyConfigs[sc.LocalReplyBackendAuthFailure],
 	}
-	if serviceInfo.Options.BackendAuthCredentials != nil {
+	if len(claimHeadersRules) > 0 {
+		backendAuthConfig.JwtClaimHeadersRules = claimHeadersRules
+		backendAuthConfig.JwtPayloadMetadataName = util.JwtPayloadMetadataName
+	}
+	switch {
+	case len(rules) == 0 && len(perRouteAudiences) == 0:
+		// Only forwarding JWT claims, no ID token is fetched.
+	case serviceInfo.Options.BackendAuthCredentials != nil:
 		backendAuthConfig.IdTokenInfo = &bapb.FilterConfig_IamToken{
 			IamToken: &commonpb.IamTokenInfo{
 				IamUri: &commonpb.HttpUri{
@@ -633,7 +1193,7 @@ func makeBackendAuthFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 				ServiceAccountEmail: serviceInfo.Options.BackendAuthCredentials.ServiceAccountEmail,
 				Delegates:           serviceInfo.Options.BackendAuthCredentials.Delegates,
 			}}
-	} else {
+	default:
 		backendAuthConfig.IdTokenInfo = &bapb.FilterConfig_ImdsToken{
 			ImdsToken: &commonpb.HttpUri{
 				Uri:     fmt.Sprintf("%s%s", serviceInfo.Options.MetadataURL, util.IdentityTokenSuffix),
@@ -650,6 +1210,42 @@ func makeBackendAuthFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 	return backendAuthFilter
 }
 
+// makeJwtClaimHeadersRules makes the rules of the Backend Auth filter
+// forwarding the claims of the verified JWT as headers, as configured in the
+// JWT provider options.
+func makeJwtClaimHeadersRules(serviceInfo *sc.ServiceInfo) []*bapb.JwtClaimHeadersRule {
+	if serviceInfo.Options.SkipJwtAuthnFilter {
+		return nil
+	}
+
+	var rules []*bapb.JwtClaimHeadersRule
+	seenIssuers := make(map[string]bool)
+	for _, provider := range serviceInfo.ServiceConfig().GetAuthentication().GetProviders() {
+		opts := serviceInfo.JwtProviderOptions[provider.GetId()]
+		if opts == nil || seenIssuers[provider.GetIssuer()] {
+			continue
+		}
+		stripAuthorization := opts.StripAuthorization != nil && *opts.StripAuthorization
+		if len(opts.ClaimToHeaders) == 0 && !stripAuthorization {
+			continue
+		}
+		seenIssuers[provider.GetIssuer()] = true
+
+		rule := &bapb.JwtClaimHeadersRule{
+			Issuer:             provider.GetIssuer(),
+			StripAuthorization: stripAuthorization,
+		}
+		for _, c := range opts.ClaimToHeaders {
+			rule.ClaimToHeaders = append(rule.ClaimToHeaders, &bapb.JwtClaimHeadersRule_ClaimToHeader{
+				Claim:  c.Claim,
+				Header: c.Header,
+			})
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
 func makeBackendRoutingFilter(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, error) {
 	rules := []*brpb.BackendRoutingRule{}
 	for _, operation := range serviceInfo.Operations {
@@ -18,14 +18,24 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
 	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
+	"github.com/google/go-cmp/cmp"
 
+	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/service_control"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	jwtpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/jwt_authn/v2alpha"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
 	anypb "github.com/golang/protobuf/ptypes/any"
 	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
@@ -49,6 +59,7 @@ func TestTranscoderFilter(t *testing.T) {
 	testData := []struct {
 		desc                 string
 		fakeServiceConfig    *confpb.Service
+		jwtProviderOptions   string
 		wantTranscoderFilter string
 	}{
 		{
@@ -80,6 +91,72 @@ func TestTranscoderFilter(t *testing.T) {
          "%s"
       ]
    }
+}
+      `, fakeProtoDescriptor, testApiName),
+		},
+		{
+			desc: "Query parameters of JWT and API key locations are ignored",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "ListShelves",
+							},
+						},
+					},
+				},
+				SourceInfo: &confpb.SourceInfo{
+					SourceFiles: []*anypb.Any{content},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:      "auth_provider",
+							Issuer:  "issuer-0",
+							JwksUri: "https://fake-jwks.com",
+						},
+					},
+				},
+				SystemParameters: &confpb.SystemParameters{
+					Rules: []*confpb.SystemParameterRule{
+						{
+							Selector: fmt.Sprintf("%s.ListShelves", testApiName),
+							Parameters: []*confpb.SystemParameter{
+								{
+									Name:              "api_key",
+									UrlQueryParameter: "key",
+								},
+								{
+									Name:              "api_key",
+									UrlQueryParameter: "client_key",
+								},
+							},
+						},
+					},
+				},
+			},
+			jwtProviderOptions: `{"issuers": {"issuer-0": {"jwt_locations": [{"query": "id_token"}, {"query": "access_token"}]}}}`,
+			wantTranscoderFilter: fmt.Sprintf(`
+{
+   "name":"envoy.grpc_json_transcoder",
+   "typedConfig":{
+      "@type":"type.googleapis.com/envoy.config.filter.http.transcoder.v2.GrpcJsonTranscoder",
+      "convertGrpcStatus":true,
+      "ignoredQueryParameters":[
+         "api_key",
+         "key",
+         "access_token",
+         "id_token",
+         "client_key"
+      ],
+      "protoDescriptorBin":"%s",
+      "services":[
+         "%s"
+      ]
+   }
 }
       `, fakeProtoDescriptor, testApiName),
 		},
@@ -88,6 +165,7 @@ func TestTranscoderFilter(t *testing.T) {
 	for i, tc := range testData {
 		opts := options.DefaultConfigGeneratorOptions()
 		opts.BackendProtocol = "gRPC"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.JwtProviderOptionsPath: tc.jwtProviderOptions})()
 		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
 		if err != nil {
 			t.Fatal(err)
@@ -386,6 +464,7 @@ func TestBackendAuthFilter(t *testing.T) {
 		iamServiceAccount     string
 		fakeServiceConfig     *confpb.Service
 		delegates             []string
+		backendSplit          string
 		wantBackendAuthFilter string
 	}{
 		{
@@ -599,6 +678,39 @@ func TestBackendAuthFilter(t *testing.T) {
       ]
    }
 }
+`,
+		},
+		{
+			desc: "Success, fetch the tokens of the JWT audiences of the backend splits",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: "testapi",
+						Methods: []*apipb.Method{
+							{
+								Name: "foo",
+							},
+						},
+					},
+				},
+			},
+			backendSplit: `{"catch_all": {"backends": [
+				{"address": "grpc://127.0.0.1:8082", "weight": 9},
+				{"address": "grpc://canary.example.com:8080", "weight": 1, "jwt_audience": "canary.com"}]}}`,
+			wantBackendAuthFilter: `
+{
+   "name":"envoy.filters.http.backend_auth",
+   "typedConfig":{
+      "@type":"type.googleapis.com/google.api.envoy.http.backend_auth.FilterConfig",
+      "imdsToken":{
+          "cluster":"metadata-cluster",
+          "timeout":"5s",
+          "uri":"http://169.254.169.254/computeMetadata/v1/instance/service-accounts/default/identity"
+      },
+      "perRouteJwtAudiences":["canary.com"]
+   }
+}
 `,
 		},
 	}
@@ -606,6 +718,7 @@ func TestBackendAuthFilter(t *testing.T) {
 	for i, tc := range testdata {
 		opts := options.DefaultConfigGeneratorOptions()
 		opts.BackendProtocol = "grpc"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.BackendSplitPath: tc.backendSplit})()
 		if tc.iamServiceAccount != "" {
 			opts.BackendAuthCredentials = &options.IAMCredentialsOptions{
 				ServiceAccountEmail: tc.iamServiceAccount,
@@ -632,11 +745,15 @@ func TestBackendAuthFilter(t *testing.T) {
 
 func TestPathMatcherFilter(t *testing.T) {
 	testData := []struct {
-		desc                  string
-		fakeServiceConfig     *confpb.Service
-		backendProtocol       string
-		healthz               string
-		wantPathMatcherFilter string
+		desc                    string
+		fakeServiceConfig       *confpb.Service
+		backendProtocol         string
+		healthz                 string
+		caseInsensitiveMatching bool
+		localReplyBodyFormat    string
+		localReplyStatusCodes   string
+		extAuthzAddress         string
+		wantPathMatcherFilter   string
 	}{
 		{
 			desc: "Path Matcher filter with Healthz - gRPC backend",
@@ -967,6 +1084,146 @@ func TestPathMatcherFilter(t *testing.T) {
          }
       ]
    }
+}`,
+		},
+		{
+			desc: "Path Matcher filter - case-insensitive matching",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "ListShelves",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/v1/shelves",
+							},
+						},
+					},
+				},
+			},
+			backendProtocol:         "http",
+			caseInsensitiveMatching: true,
+			wantPathMatcherFilter: `
+{
+   "name":"envoy.filters.http.path_matcher",
+   "typedConfig":{
+      "@type":"type.googleapis.com/google.api.envoy.http.path_matcher.FilterConfig",
+      "rules":[
+         {
+            "operation":"endpoints.examples.bookstore.Bookstore.ListShelves",
+            "pattern":{
+               "httpMethod":"GET",
+               "uriTemplate":"/v1/shelves"
+            }
+         }
+      ],
+      "caseInsensitiveMatching":true
+   }
+}`,
+		},
+		{
+			desc: "Path Matcher filter - local reply config",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "ListShelves",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/v1/shelves",
+							},
+						},
+					},
+				},
+			},
+			backendProtocol:       "http",
+			localReplyBodyFormat:  `{"code":%CODE%,"message":"%MESSAGE%"}`,
+			localReplyStatusCodes: "path_not_found=400",
+			wantPathMatcherFilter: `
+{
+   "name":"envoy.filters.http.path_matcher",
+   "typedConfig":{
+      "@type":"type.googleapis.com/google.api.envoy.http.path_matcher.FilterConfig",
+      "rules":[
+         {
+            "operation":"endpoints.examples.bookstore.Bookstore.ListShelves",
+            "pattern":{
+               "httpMethod":"GET",
+               "uriTemplate":"/v1/shelves"
+            }
+         }
+      ],
+      "localReplyConfig":{
+         "bodyFormat":"{\"code\":%CODE%,\"message\":\"%MESSAGE%\"}",
+         "contentType":"application/json",
+         "statusCode":400
+      }
+   }
+}`,
+		},
+		{
+			desc: "Path Matcher filter - ext authz operation header",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "ListShelves",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/v1/shelves",
+							},
+						},
+					},
+				},
+			},
+			backendProtocol: "http",
+			extAuthzAddress: "grpc://authz.example.com:9000",
+			wantPathMatcherFilter: `
+{
+   "name":"envoy.filters.http.path_matcher",
+   "typedConfig":{
+      "@type":"type.googleapis.com/google.api.envoy.http.path_matcher.FilterConfig",
+      "rules":[
+         {
+            "operation":"endpoints.examples.bookstore.Bookstore.ListShelves",
+            "pattern":{
+               "httpMethod":"GET",
+               "uriTemplate":"/v1/shelves"
+            }
+         }
+      ],
+      "operationHeader":"x-esp-v2-ext-authz-operation"
+   }
 }`,
 		},
 	}
@@ -975,6 +1232,10 @@ func TestPathMatcherFilter(t *testing.T) {
 		opts := options.DefaultConfigGeneratorOptions()
 		opts.BackendProtocol = tc.backendProtocol
 		opts.Healthz = tc.healthz
+		opts.ExtAuthzAddress = tc.extAuthzAddress
+		opts.CaseInsensitiveMatching = tc.caseInsensitiveMatching
+		opts.LocalReplyBodyFormat = tc.localReplyBodyFormat
+		opts.LocalReplyStatusCodes = tc.localReplyStatusCodes
 		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
 		if err != nil {
 			t.Fatal(err)
@@ -991,6 +1252,57 @@ func TestPathMatcherFilter(t *testing.T) {
 	}
 }
 
+func TestTracingRequestHeadersForTags(t *testing.T) {
+	testData := []struct {
+		desc                         string
+		tracingRequestHeadersForTags string
+		wantTags                     []string
+	}{
+		{
+			desc: "No tags by default",
+		},
+		{
+			desc:                         "Header names are trimmed",
+			tracingRequestHeadersForTags: "x-client-id, x-request-source",
+			wantTags:                     []string{"x-client-id", "x-request-source"},
+		},
+		{
+			desc:                         "Empty header names are dropped",
+			tracingRequestHeadersForTags: "x-client-id,, ,x-request-source,",
+			wantTags:                     []string{"x-client-id", "x-request-source"},
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.TracingRequestHeadersForTags = tc.tracingRequestHeadersForTags
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(&confpb.Service{
+			Name: testProjectName,
+			Apis: []*apipb.Api{
+				{
+					Name: testApiName,
+				},
+			},
+		}, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listener, err := MakeListener(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpConMgr := &hcmpb.HttpConnectionManager{}
+		if err := ptypes.UnmarshalAny(listener.GetFilterChains()[0].GetFilters()[0].GetTypedConfig(), httpConMgr); err != nil {
+			t.Fatal(err)
+		}
+		if gotTags := httpConMgr.GetTracing().GetRequestHeadersForTags(); !reflect.DeepEqual(gotTags, tc.wantTags) {
+			t.Errorf("Test Desc(%d): %s, got tags: %v, want: %v", i, tc.desc, gotTags, tc.wantTags)
+		}
+	}
+}
+
 func TestHealthCheckFilter(t *testing.T) {
 	testdata := []struct {
 		desc                  string
@@ -1102,6 +1414,1690 @@ func TestHealthCheckFilter(t *testing.T) {
 	}
 }
 
+func TestJwtAuthnFilterWithJwtLocations(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "mobile_provider",
+					Issuer:  "https://mobile.example.com",
+					JwksUri: "https://mobile.example.com/jwks",
+				},
+				{
+					Id:      "web_provider",
+					Issuer:  "https://web.example.com",
+					JwksUri: "https://web.example.com/jwks",
+				},
+			},
+		},
+	}
+
+	defaultLocations := &jwtpb.JwtProvider{
+		FromHeaders: []*jwtpb.JwtHeader{
+			{
+				Name:        "Authorization",
+				ValuePrefix: "Bearer ",
+			},
+			{
+				Name: "X-Goog-Iap-Jwt-Assertion",
+			},
+		},
+		FromParams: []string{
+			"access_token",
+		},
+	}
+
+	testData := []struct {
+		desc               string
+		jwtProviderOptions string
+		wantLocations      map[string]*jwtpb.JwtProvider
+	}{
+		{
+			desc: "Default locations",
+			wantLocations: map[string]*jwtpb.JwtProvider{
+				"mobile_provider": defaultLocations,
+				"web_provider":    defaultLocations,
+			},
+		},
+		{
+			desc: "Configured locations for one issuer",
+			jwtProviderOptions: `{
+  "issuers": {
+    "https://mobile.example.com": {
+      "jwt_locations": [
+        {
+          "header": "X-Mobile-Token",
+          "value_prefix": "Token "
+        },
+        {
+          "query": "mobile_token"
+        }
+      ]
+    }
+  }
+}`,
+			wantLocations: map[string]*jwtpb.JwtProvider{
+				"mobile_provider": {
+					FromHeaders: []*jwtpb.JwtHeader{
+						{
+							Name:        "X-Mobile-Token",
+							ValuePrefix: "Token ",
+						},
+					},
+					FromParams: []string{
+						"mobile_token",
+					},
+				},
+				"web_provider": defaultLocations,
+			},
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.JwtProviderOptionsPath: tc.jwtProviderOptions})()
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		jwtAuthn := &jwtpb.JwtAuthentication{}
+		if err := ptypes.UnmarshalAny(makeJwtAuthnFilter(fakeServiceInfo).GetTypedConfig(), jwtAuthn); err != nil {
+			t.Fatal(err)
+		}
+		for id, want := range tc.wantLocations {
+			got := &jwtpb.JwtProvider{
+				FromHeaders: jwtAuthn.Providers[id].GetFromHeaders(),
+				FromParams:  jwtAuthn.Providers[id].GetFromParams(),
+			}
+			if !proto.Equal(got, want) {
+				t.Errorf("Test Desc(%d): %s, provider %s,\ngot locations: %v,\nwant locations: %v", i, tc.desc, id, got, want)
+			}
+		}
+	}
+}
+
+func TestJwtAuthnFilterWithLocalJwks(t *testing.T) {
+	fakeJwks := `{"keys": [{"kty": "RSA", "kid": "key-0", "n": "fake-n", "e": "AQAB"}]}`
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:     "local_provider",
+					Issuer: "https://local.example.com",
+				},
+			},
+		},
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendProtocol = "http"
+	defer testutil.WriteTempFiles(t, map[*string]string{&opts.JwtProviderOptionsPath: fmt.Sprintf(`{"issuers": {"https://local.example.com": {"jwks": %s}}}`, fakeJwks)})()
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwtAuthn := &jwtpb.JwtAuthentication{}
+	if err := ptypes.UnmarshalAny(makeJwtAuthnFilter(fakeServiceInfo).GetTypedConfig(), jwtAuthn); err != nil {
+		t.Fatal(err)
+	}
+	got := jwtAuthn.Providers["local_provider"].GetLocalJwks()
+	want := &corepb.DataSource{
+		Specifier: &corepb.DataSource_InlineString{
+			InlineString: fakeJwks,
+		},
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("makeJwtAuthnFilter failed,\ngot LocalJwks: %v,\nwant LocalJwks: %v", got, want)
+	}
+}
+
+func TestJwtAuthnFilterWithRemoteJwksOptions(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "google_provider",
+					Issuer:  "https://google.example.com",
+					JwksUri: "https://google.example.com/jwks",
+				},
+				{
+					Id:      "idp_provider",
+					Issuer:  "https://idp.example.com",
+					JwksUri: "https://idp.example.com/jwks",
+				},
+			},
+		},
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendProtocol = "http"
+	defer testutil.WriteTempFiles(t, map[*string]string{&opts.JwtProviderOptionsPath: `{"default": {"jwks_cache_duration": "24h"}, "issuers": {"https://idp.example.com": {"jwks_fetch_timeout": "10s", "jwks_cache_duration": "1h"}}}`})()
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwtAuthn := &jwtpb.JwtAuthentication{}
+	if err := ptypes.UnmarshalAny(makeJwtAuthnFilter(fakeServiceInfo).GetTypedConfig(), jwtAuthn); err != nil {
+		t.Fatal(err)
+	}
+	wantRemoteJwks := map[string]*jwtpb.RemoteJwks{
+		"google_provider": {
+			HttpUri: &corepb.HttpUri{
+				Uri: "https://google.example.com/jwks",
+				HttpUpstreamType: &corepb.HttpUri_Cluster{
+					Cluster: "google.example.com:443",
+				},
+				Timeout: ptypes.DurationProto(5 * time.Second),
+			},
+			CacheDuration: ptypes.DurationProto(24 * time.Hour),
+		},
+		"idp_provider": {
+			HttpUri: &corepb.HttpUri{
+				Uri: "https://idp.example.com/jwks",
+				HttpUpstreamType: &corepb.HttpUri_Cluster{
+					Cluster: "idp.example.com:443",
+				},
+				Timeout: ptypes.DurationProto(10 * time.Second),
+			},
+			CacheDuration: ptypes.DurationProto(time.Hour),
+		},
+	}
+	for id, want := range wantRemoteJwks {
+		if got := jwtAuthn.Providers[id].GetRemoteJwks(); !proto.Equal(got, want) {
+			t.Errorf("makeJwtAuthnFilter failed for provider %s,\ngot RemoteJwks: %v,\nwant RemoteJwks: %v", id, got, want)
+		}
+	}
+}
+
+func TestServiceControlRequirements(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name:    testApiName,
+				Version: "1.0.0",
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "GetShelf",
+					},
+				},
+			},
+		},
+		SystemParameters: &confpb.SystemParameters{
+			Rules: []*confpb.SystemParameterRule{
+				{
+					Selector: fmt.Sprintf("%s.GetShelf", testApiName),
+					Parameters: []*confpb.SystemParameter{
+						{
+							Name:       "api_key",
+							HttpHeader: "X-Shelf-Key",
+						},
+					},
+				},
+			},
+		},
+		Control: &confpb.Control{
+			Environment: "servicecontrol.googleapis.com",
+		},
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendProtocol = "http"
+	defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: `{"default": {"api_key": {"cookies": ["apikey"]}}}`})()
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scFilter := &scpb.FilterConfig{}
+	if err := ptypes.UnmarshalAny(makeServiceControlFilter(fakeServiceInfo).GetTypedConfig(), scFilter); err != nil {
+		t.Fatal(err)
+	}
+	cookieLocation := &scpb.APIKeyLocation{
+		Key: &scpb.APIKeyLocation_Cookie{
+			Cookie: "apikey",
+		},
+	}
+	wantRequirements := []*scpb.Requirement{
+		{
+			ServiceName:   testProjectName,
+			OperationName: fmt.Sprintf("%s.GetShelf", testApiName),
+			ApiName:       testApiName,
+			ApiVersion:    "1.0.0",
+			ApiKey: &scpb.APIKeyRequirement{
+				Locations: []*scpb.APIKeyLocation{
+					{
+						Key: &scpb.APIKeyLocation_Header{
+							Header: "X-Shelf-Key",
+						},
+					},
+					cookieLocation,
+				},
+			},
+		},
+		{
+			ServiceName:   testProjectName,
+			OperationName: fmt.Sprintf("%s.ListShelves", testApiName),
+			ApiName:       testApiName,
+			ApiVersion:    "1.0.0",
+			ApiKey: &scpb.APIKeyRequirement{
+				Locations: []*scpb.APIKeyLocation{
+					{
+						Key: &scpb.APIKeyLocation_Query{
+							Query: "key",
+						},
+					},
+					{
+						Key: &scpb.APIKeyLocation_Query{
+							Query: "api_key",
+						},
+					},
+					{
+						Key: &scpb.APIKeyLocation_Header{
+							Header: "x-api-key",
+						},
+					},
+					cookieLocation,
+				},
+			},
+		},
+	}
+	if !cmp.Equal(scFilter.Requirements, wantRequirements, cmp.Comparer(proto.Equal)) {
+		t.Errorf("makeServiceControlFilter failed,\ngot Requirements: %v,\nwant Requirements: %v", scFilter.Requirements, wantRequirements)
+	}
+}
+
+func TestHttpConnectionManagerServerHeader(t *testing.T) {
+	testData := []struct {
+		desc                           string
+		preset                         string
+		overrides                      string
+		wantServerName                 string
+		wantServerHeaderTransformation hcmpb.HttpConnectionManager_ServerHeaderTransformation
+	}{
+		{
+			desc:                           "Envoy server header by default",
+			preset:                         "off",
+			wantServerHeaderTransformation: hcmpb.HttpConnectionManager_OVERWRITE,
+		},
+		{
+			desc:                           "Server header is hidden by the preset",
+			preset:                         "basic",
+			wantServerHeaderTransformation: hcmpb.HttpConnectionManager_PASS_THROUGH,
+		},
+		{
+			desc:                           "Server header is overridden",
+			preset:                         "strict",
+			overrides:                      `{"Server": "bookstore"}`,
+			wantServerName:                 "bookstore",
+			wantServerHeaderTransformation: hcmpb.HttpConnectionManager_OVERWRITE,
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.SecurityHeadersPreset = tc.preset
+		opts.SecurityHeadersOverrides = tc.overrides
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(&confpb.Service{
+			Name: testProjectName,
+			Apis: []*apipb.Api{
+				{
+					Name: testApiName,
+				},
+			},
+		}, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listener, err := MakeListener(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpConMgr := &hcmpb.HttpConnectionManager{}
+		if err := ptypes.UnmarshalAny(listener.GetFilterChains()[0].GetFilters()[0].GetTypedConfig(), httpConMgr); err != nil {
+			t.Fatal(err)
+		}
+		if httpConMgr.GetServerName() != tc.wantServerName || httpConMgr.GetServerHeaderTransformation() != tc.wantServerHeaderTransformation {
+			t.Errorf("Test Desc(%d): %s, got server name: %q, server header transformation: %v, want: %q, %v", i, tc.desc,
+				httpConMgr.GetServerName(), httpConMgr.GetServerHeaderTransformation(), tc.wantServerName, tc.wantServerHeaderTransformation)
+		}
+	}
+}
+
+func TestHttpConnectionManagerOptions(t *testing.T) {
+	testData := []struct {
+		desc                 string
+		setOptions           func(opts *options.ConfigGeneratorOptions)
+		wantHttpConMgrFields string
+		wantError            string
+	}{
+		{
+			desc:                 "Envoy defaults",
+			setOptions:           func(opts *options.ConfigGeneratorOptions) {},
+			wantHttpConMgrFields: `{}`,
+		},
+		{
+			desc: "Codec, timeouts and limits",
+			setOptions: func(opts *options.ConfigGeneratorOptions) {
+				opts.ListenerCodecType = "http1"
+				opts.ConnectionIdleTimeout = 10 * time.Minute
+				opts.StreamIdleTimeout = time.Minute
+				opts.RequestTimeout = 30 * time.Second
+				opts.DrainTimeout = 2 * time.Second
+				opts.MaxRequestHeadersKb = 96
+				opts.Http2MaxConcurrentStreams = 100
+				opts.Http2StreamWindowSize = 65535
+				opts.Http2ConnectionWindowSize = 1048576
+			},
+			wantHttpConMgrFields: `{
+  "codecType": "HTTP1",
+  "commonHttpProtocolOptions": {
+    "idleTimeout": "600s"
+  },
+  "http2ProtocolOptions": {
+    "maxConcurrentStreams": 100,
+    "initialStreamWindowSize": 65535,
+    "initialConnectionWindowSize": 1048576
+  },
+  "maxRequestHeadersKb": 96,
+  "streamIdleTimeout": "60s",
+  "requestTimeout": "30s",
+  "drainTimeout": "2s"
+}`,
+		},
+		{
+			desc: "Path normalization and slash merging",
+			setOptions: func(opts *options.ConfigGeneratorOptions) {
+				opts.NormalizePath = true
+				opts.MergeSlashes = true
+			},
+			wantHttpConMgrFields: `{
+  "normalizePath": true,
+  "mergeSlashes": true
+}`,
+		},
+		{
+			desc: "Unknown codec type",
+			setOptions: func(opts *options.ConfigGeneratorOptions) {
+				opts.ListenerCodecType = "http3"
+			},
+			wantError: `listener_codec_type must be one of "auto", "http1" and "http2", got "http3"`,
+		},
+		{
+			desc: "Negative timeout",
+			setOptions: func(opts *options.ConfigGeneratorOptions) {
+				opts.StreamIdleTimeout = -time.Second
+			},
+			wantError: "stream_idle_timeout must be >= 0, got -1s",
+		},
+		{
+			desc: "Request headers limit out of range",
+			setOptions: func(opts *options.ConfigGeneratorOptions) {
+				opts.MaxRequestHeadersKb = 100
+			},
+			wantError: "max_request_headers_kb must be >= 0 and <= 96, got 100",
+		},
+		{
+			desc: "HTTP/2 window size too small",
+			setOptions: func(opts *options.ConfigGeneratorOptions) {
+				opts.Http2StreamWindowSize = 1024
+			},
+			wantError: "http2_initial_stream_window_size must be 0, or >= 65535 and <= 2147483647, got 1024",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		tc.setOptions(&opts)
+
+		httpConMgr := &hcmpb.HttpConnectionManager{}
+		err := applyHttpConnectionManagerOptions(httpConMgr, opts)
+		if tc.wantError != "" {
+			if err == nil || err.Error() != tc.wantError {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotHttpConMgr, err := (&jsonpb.Marshaler{}).MarshalToString(httpConMgr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := normalizeJson(gotHttpConMgr), normalizeJson(tc.wantHttpConMgrFields); got != want {
+			t.Errorf("Test Desc(%d): %s, applyHttpConnectionManagerOptions failed,\ngot: %s, \nwant: %s", i, tc.desc, got, want)
+		}
+	}
+}
+
+func TestHttpConnectionManagerUpgradeConfigs(t *testing.T) {
+	testData := []struct {
+		desc               string
+		enableWebsocket    bool
+		policy             string
+		wantUpgradeConfigs string
+	}{
+		{
+			desc: "No upgrade configs by default",
+		},
+		{
+			desc:               "Enabled globally, only the WebSocket routes enable it",
+			enableWebsocket:    true,
+			wantUpgradeConfigs: `[{"upgradeType": "websocket", "enabled": false}]`,
+		},
+		{
+			desc:               "Disabled globally, the WebSocket route of one operation enables it",
+			policy:             `{"operations": {"endpoints.examples.bookstore.Bookstore.ListShelves": {"websocket": {"enabled": true}}}}`,
+			wantUpgradeConfigs: `[{"upgradeType": "websocket", "enabled": false}]`,
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.EnableWebsocket = tc.enableWebsocket
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: tc.policy})()
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(&confpb.Service{
+			Name: testProjectName,
+			Apis: []*apipb.Api{
+				{
+					Name: testApiName,
+					Methods: []*apipb.Method{
+						{
+							Name: "ListShelves",
+						},
+					},
+				},
+			},
+		}, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listener, err := MakeListener(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpConMgr := &hcmpb.HttpConnectionManager{}
+		if err := ptypes.UnmarshalAny(listener.GetFilterChains()[0].GetFilters()[0].GetTypedConfig(), httpConMgr); err != nil {
+			t.Fatal(err)
+		}
+
+		var gotConfigs []string
+		for _, config := range httpConMgr.GetUpgradeConfigs() {
+			gotConfig, err := (&jsonpb.Marshaler{}).MarshalToString(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotConfigs = append(gotConfigs, gotConfig)
+		}
+		got := ""
+		if gotConfigs != nil {
+			got = normalizeJson(`{"upgradeConfigs": [` + strings.Join(gotConfigs, ",") + "]}")
+		}
+		want := ""
+		if tc.wantUpgradeConfigs != "" {
+			want = normalizeJson(`{"upgradeConfigs": ` + tc.wantUpgradeConfigs + "}")
+		}
+		if got != want {
+			t.Errorf("Test Desc(%d): %s, got upgrade configs: %s, want: %s", i, tc.desc, got, want)
+		}
+	}
+}
+
+func TestBackendAuthFilterWithJwtClaimHeaders(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "GetShelf",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "mobile_provider",
+					Issuer:  "https://mobile.example.com",
+					JwksUri: "https://mobile.example.com/jwks",
+				},
+				{
+					Id:      "web_provider",
+					Issuer:  "https://web.example.com",
+					JwksUri: "https://web.example.com/jwks",
+				},
+			},
+		},
+	}
+	backendAuthRules := &confpb.Backend{
+		Rules: []*confpb.BackendRule{
+			{
+				Selector:        fmt.Sprintf("%s.GetShelf", testApiName),
+				Address:         "https://mybackend.com",
+				Authentication:  &confpb.BackendRule_JwtAudience{JwtAudience: "mybackend.com"},
+				PathTranslation: confpb.BackendRule_APPEND_PATH_TO_ADDRESS,
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                  string
+		jwtProviderOptions    string
+		backend               *confpb.Backend
+		wantBackendAuthFilter string
+	}{
+		{
+			desc:    "No claim headers",
+			backend: backendAuthRules,
+			wantBackendAuthFilter: `{
+  "name": "envoy.filters.http.backend_auth",
+  "typedConfig": {
+    "@type": "type.googleapis.com/google.api.envoy.http.backend_auth.FilterConfig",
+    "imdsToken": {
+      "cluster": "metadata-cluster",
+      "timeout": "5s",
+      "uri": "http://169.254.169.254/computeMetadata/v1/instance/service-accounts/default/identity"
+    },
+    "rules": [
+      {
+        "jwtAudience": "mybackend.com",
+        "operation": "endpoints.examples.bookstore.Bookstore.GetShelf"
+      }
+    ]
+  }
+}`,
+		},
+		{
+			desc: "Global claim headers, one issuer strips Authorization",
+			jwtProviderOptions: `{
+  "default": {
+    "claim_to_headers": [
+      {
+        "claim": "sub",
+        "header": "X-User-Id"
+      },
+      {
+        "claim": "email",
+        "header": "X-User-Email"
+      }
+    ]
+  },
+  "issuers": {
+    "https://web.example.com": {
+      "strip_authorization": true
+    }
+  }
+}`,
+			backend: backendAuthRules,
+			wantBackendAuthFilter: `{
+  "name": "envoy.filters.http.backend_auth",
+  "typedConfig": {
+    "@type": "type.googleapis.com/google.api.envoy.http.backend_auth.FilterConfig",
+    "imdsToken": {
+      "cluster": "metadata-cluster",
+      "timeout": "5s",
+      "uri": "http://169.254.169.254/computeMetadata/v1/instance/service-accounts/default/identity"
+    },
+    "jwtClaimHeadersRules": [
+      {
+        "claimToHeaders": [
+          {
+            "claim": "sub",
+            "header": "X-User-Id"
+          },
+          {
+            "claim": "email",
+            "header": "X-User-Email"
+          }
+        ],
+        "issuer": "https://mobile.example.com"
+      },
+      {
+        "claimToHeaders": [
+          {
+            "claim": "sub",
+            "header": "X-User-Id"
+          },
+          {
+            "claim": "email",
+            "header": "X-User-Email"
+          }
+        ],
+        "issuer": "https://web.example.com",
+        "stripAuthorization": true
+      }
+    ],
+    "jwtPayloadMetadataName": "jwt_payloads",
+    "rules": [
+      {
+        "jwtAudience": "mybackend.com",
+        "operation": "endpoints.examples.bookstore.Bookstore.GetShelf"
+      }
+    ]
+  }
+}`,
+		},
+		{
+			desc:               "Claim headers without backend authentication",
+			jwtProviderOptions: `{"issuers": {"https://mobile.example.com": {"claim_to_headers": [{"claim": "sub", "header": "X-User-Id"}]}}}`,
+			wantBackendAuthFilter: `{
+  "name": "envoy.filters.http.backend_auth",
+  "typedConfig": {
+    "@type": "type.googleapis.com/google.api.envoy.http.backend_auth.FilterConfig",
+    "jwtClaimHeadersRules": [
+      {
+        "claimToHeaders": [
+          {
+            "claim": "sub",
+            "header": "X-User-Id"
+          }
+        ],
+        "issuer": "https://mobile.example.com"
+      }
+    ],
+    "jwtPayloadMetadataName": "jwt_payloads"
+  }
+}`,
+		},
+		{
+			desc: "No claim headers without backend authentication",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.JwtProviderOptionsPath: tc.jwtProviderOptions})()
+		serviceConfig := proto.Clone(fakeServiceConfig).(*confpb.Service)
+		serviceConfig.Backend = tc.backend
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(serviceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter := makeBackendAuthFilter(fakeServiceInfo)
+		if tc.wantBackendAuthFilter == "" {
+			if filter != nil {
+				t.Errorf("Test Desc(%d): %s, makeBackendAuthFilter got: %v, want: nil", i, tc.desc, filter)
+			}
+			continue
+		}
+
+		marshaler := &jsonpb.Marshaler{}
+		gotFilter, err := marshaler.MarshalToString(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := normalizeJson(gotFilter), normalizeJson(tc.wantBackendAuthFilter); got != want {
+			t.Errorf("Test Desc(%d): %s, makeBackendAuthFilter failed,\ngot: %s, \nwant: %s", i, tc.desc, got, want)
+		}
+	}
+}
+
+func TestServiceControlFilterWithLocalQuota(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Control: &confpb.Control{
+			Environment: "servicecontrol.googleapis.com",
+		},
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+		SystemParameters: &confpb.SystemParameters{
+			Rules: []*confpb.SystemParameterRule{
+				{
+					Selector: fmt.Sprintf("%s.CreateShelf", testApiName),
+					Parameters: []*confpb.SystemParameter{
+						{
+							Name:       "api_key",
+							HttpHeader: "X-Shelf-Key",
+						},
+					},
+				},
+			},
+		},
+		Quota: &confpb.Quota{
+			Limits: []*confpb.QuotaLimit{
+				{
+					Name:   "read-limit",
+					Metric: "read-requests",
+					Unit:   "1/min/{project}",
+					Values: map[string]int64{"STANDARD": 100},
+				},
+				{
+					Name:   "write-limit",
+					Metric: "write-requests",
+					Unit:   "1/min/{project}",
+					Values: map[string]int64{"STANDARD": 10},
+				},
+			},
+			MetricRules: []*confpb.MetricRule{
+				{
+					Selector:    fmt.Sprintf("%s.ListShelves", testApiName),
+					MetricCosts: map[string]int64{"read-requests": 1},
+				},
+				{
+					Selector:    fmt.Sprintf("%s.CreateShelf", testApiName),
+					MetricCosts: map[string]int64{"read-requests": 1, "write-requests": 2},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                      string
+		enablePerWorkerLocalQuota bool
+		wantLimits                map[string][]*scpb.LocalQuotaLimit
+	}{
+		{
+			desc: "Local quota is disabled",
+		},
+		{
+			desc:                      "Limits of the operations are set in their requirements",
+			enablePerWorkerLocalQuota: true,
+			wantLimits: map[string][]*scpb.LocalQuotaLimit{
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": {
+					{
+						Name:            "read-limit",
+						Cost:            1,
+						TokensPerMinute: 100,
+					},
+					{
+						Name:            "write-limit",
+						Cost:            2,
+						TokensPerMinute: 10,
+					},
+				},
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					{
+						Name:            "read-limit",
+						Cost:            1,
+						TokensPerMinute: 100,
+					},
+				},
+			},
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.EnablePerWorkerLocalQuota = tc.enablePerWorkerLocalQuota
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter := makeServiceControlFilter(fakeServiceInfo)
+		filterConfig := &scpb.FilterConfig{}
+		if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), filterConfig); err != nil {
+			t.Fatal(err)
+		}
+		for _, requirement := range filterConfig.Requirements {
+			gotLimits := requirement.LocalQuotaLimits
+			wantLimits := tc.wantLimits[requirement.OperationName]
+			if len(gotLimits) != len(wantLimits) {
+				t.Errorf("Test Desc(%d): %s, operation %s got local quota limits: %v, want: %v", i, tc.desc, requirement.OperationName, gotLimits, wantLimits)
+				continue
+			}
+			for j := range gotLimits {
+				if !proto.Equal(gotLimits[j], wantLimits[j]) {
+					t.Errorf("Test Desc(%d): %s, operation %s got local quota limit: %v, want: %v", i, tc.desc, requirement.OperationName, gotLimits[j], wantLimits[j])
+				}
+			}
+		}
+	}
+}
+
+func TestExtAuthzFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+	}
+
+	testData := []struct {
+		desc               string
+		extAuthzAddress    string
+		wantExtAuthzFilter string
+		wantError          string
+	}{
+		{
+			desc:            "gRPC authorization server",
+			extAuthzAddress: "grpc://authz.example.com:9000",
+			wantExtAuthzFilter: `{
+  "name": "envoy.filters.http.ext_authz",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthz",
+    "failureModeAllow": true,
+    "grpcService": {
+      "envoyGrpc": {
+        "clusterName": "ext-authz-cluster"
+      },
+      "timeout": "0.500s"
+    },
+    "metadataContextNamespaces": [
+      "envoy.filters.http.jwt_authn"
+    ]
+  }
+}`,
+		},
+		{
+			desc:            "HTTP authorization server",
+			extAuthzAddress: "https://authz.example.com/check",
+			wantExtAuthzFilter: `{
+  "name": "envoy.filters.http.ext_authz",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthz",
+    "failureModeAllow": true,
+    "httpService": {
+      "authorizationRequest": {
+        "allowedHeaders": {
+          "patterns": [
+            {
+              "exact": "authorization"
+            },
+            {
+              "exact": "x-endpoint-api-userinfo"
+            },
+            {
+              "exact": "x-esp-v2-ext-authz-operation"
+            }
+          ]
+        }
+      },
+      "pathPrefix": "/check",
+      "serverUri": {
+        "cluster": "ext-authz-cluster",
+        "timeout": "0.500s",
+        "uri": "https://authz.example.com/check"
+      }
+    }
+  }
+}`,
+		},
+		{
+			desc:            "Address without scheme",
+			extAuthzAddress: "authz.example.com:9000",
+			wantError:       "scheme must be one of grpc, grpcs, http or https",
+		},
+		{
+			desc:            "Unknown scheme",
+			extAuthzAddress: "tcp://authz.example.com:9000",
+			wantError:       "unknown backend protocol [tcp]",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.ExtAuthzAddress = tc.extAuthzAddress
+		opts.ExtAuthzTimeout = 500 * time.Millisecond
+		opts.ExtAuthzFailureModeAllow = true
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter, err := makeExtAuthzFilter(fakeServiceInfo)
+		if tc.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		marshaler := &jsonpb.Marshaler{}
+		gotFilter, err := marshaler.MarshalToString(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := normalizeJson(gotFilter), normalizeJson(tc.wantExtAuthzFilter); got != want {
+			t.Errorf("Test Desc(%d): %s, makeExtAuthzFilter failed,\ngot: %s, \nwant: %s", i, tc.desc, got, want)
+		}
+	}
+}
+
+func TestRateLimitFilters(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Control: &confpb.Control{
+			Environment: "servicecontrol.googleapis.com",
+		},
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+	}
+	policy := `{
+  "operations": {
+    "endpoints.examples.bookstore.Bookstore.CreateShelf": {
+      "api_key": {"cookies": ["shelf_key"]},
+      "rate_limit": {"descriptors": [["operation", "api_key"], ["jwt_sub"], ["client_ip"]]}
+    }
+  }
+}`
+
+	testData := []struct {
+		desc                    string
+		rateLimitServiceAddress string
+		rateLimitDomain         string
+		wantRateLimitFilter     string
+		wantHeaders             bool
+	}{
+		{
+			desc: "No rate limit service",
+		},
+		{
+			desc:                    "Domain defaults to the service name, API key and JWT sub headers set by the service control filter",
+			rateLimitServiceAddress: "grpc://ratelimit:8081",
+			wantRateLimitFilter: `{
+  "name": "envoy.filters.http.ratelimit",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.config.filter.http.rate_limit.v2.RateLimit",
+    "domain": "bookstore.endpoints.project123.cloud.goog",
+    "rateLimitService": {
+      "grpcService": {
+        "envoyGrpc": {
+          "clusterName": "rate-limit-cluster"
+        }
+      }
+    },
+    "rateLimitedAsResourceExhausted": true,
+    "timeout": "0.020s"
+  }
+}`,
+			wantHeaders: true,
+		},
+		{
+			desc:                    "Configured domain",
+			rateLimitServiceAddress: "grpc://ratelimit:8081",
+			rateLimitDomain:         "bookstore",
+			wantHeaders:             true,
+			wantRateLimitFilter: `{
+  "name": "envoy.filters.http.ratelimit",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.config.filter.http.rate_limit.v2.RateLimit",
+    "domain": "bookstore",
+    "rateLimitService": {
+      "grpcService": {
+        "envoyGrpc": {
+          "clusterName": "rate-limit-cluster"
+        }
+      }
+    },
+    "rateLimitedAsResourceExhausted": true,
+    "timeout": "0.020s"
+  }
+}`,
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.RateLimitServiceAddress = tc.rateLimitServiceAddress
+		opts.RateLimitDomain = tc.rateLimitDomain
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: policy})()
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter, err := makeRateLimitFilter(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.wantRateLimitFilter == "" {
+			if filter != nil {
+				t.Errorf("Test Desc(%d): %s, makeRateLimitFilter got: %v, want: nil", i, tc.desc, filter)
+			}
+		} else {
+			marshaler := &jsonpb.Marshaler{}
+			gotFilter, err := marshaler.MarshalToString(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := normalizeJson(gotFilter), normalizeJson(tc.wantRateLimitFilter); got != want {
+				t.Errorf("Test Desc(%d): %s, makeRateLimitFilter failed,\ngot: %s, \nwant: %s", i, tc.desc, got, want)
+			}
+		}
+
+		scConfig := &scpb.FilterConfig{}
+		if err := ptypes.UnmarshalAny(makeServiceControlFilter(fakeServiceInfo).GetTypedConfig(), scConfig); err != nil {
+			t.Fatal(err)
+		}
+		gotHeaders := scConfig.ApiKeyHeader == util.RateLimitApiKeyHeader && scConfig.JwtSubHeader == util.RateLimitJwtSubHeader
+		if gotHeaders != tc.wantHeaders || (!tc.wantHeaders && (scConfig.ApiKeyHeader != "" || scConfig.JwtSubHeader != "")) {
+			t.Errorf("Test Desc(%d): %s, service control filter got api_key_header: %q and jwt_sub_header: %q, want headers: %v", i, tc.desc, scConfig.ApiKeyHeader, scConfig.JwtSubHeader, tc.wantHeaders)
+		}
+	}
+}
+
+func TestBufferFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "UploadBook",
+					},
+				},
+			},
+		},
+	}
+	policy := `{
+  "operations": {
+    "endpoints.examples.bookstore.Bookstore.UploadBook": {
+      "request_body": {"max_request_bytes": 52428800}
+    }
+  }
+}`
+
+	testData := []struct {
+		desc             string
+		maxRequestBytes  uint64
+		policy           string
+		wantBufferFilter string
+		wantError        string
+	}{
+		{
+			desc: "No request body limit",
+		},
+		{
+			desc:            "Global request body limit",
+			maxRequestBytes: 1048576,
+			policy:          policy,
+			wantBufferFilter: `{
+  "name": "envoy.buffer",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.config.filter.http.buffer.v2.Buffer",
+    "maxRequestBytes": 1048576
+  }
+}`,
+		},
+		{
+			desc:   "Only per-operation request body limits",
+			policy: policy,
+			wantBufferFilter: `{
+  "name": "envoy.buffer",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.config.filter.http.buffer.v2.Buffer",
+    "maxRequestBytes": 52428800
+  }
+}`,
+		},
+		{
+			desc:            "Global request body limit too large",
+			maxRequestBytes: 1 << 32,
+			wantError:       "max_request_bytes must be <= 4294967295, got 4294967296",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.MaxRequestBytes = tc.maxRequestBytes
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: tc.policy})()
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter, err := makeBufferFilter(fakeServiceInfo)
+		if tc.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.wantBufferFilter == "" {
+			if filter != nil {
+				t.Errorf("Test Desc(%d): %s, makeBufferFilter got: %v, want: nil", i, tc.desc, filter)
+			}
+			continue
+		}
+
+		marshaler := &jsonpb.Marshaler{}
+		gotFilter, err := marshaler.MarshalToString(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := normalizeJson(gotFilter), normalizeJson(tc.wantBufferFilter); got != want {
+			t.Errorf("Test Desc(%d): %s, makeBufferFilter failed,\ngot: %s, \nwant: %s", i, tc.desc, got, want)
+		}
+	}
+}
+
+func TestGzipFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                    string
+		enableCompression       bool
+		compressionContentTypes string
+		compressionMinLength    int
+		compressionLevel        string
+		wantGzipFilter          string
+		wantError               string
+	}{
+		{
+			desc:                 "Compression is disabled",
+			compressionMinLength: 30,
+			compressionLevel:     "default",
+		},
+		{
+			desc:                 "Default content types",
+			enableCompression:    true,
+			compressionMinLength: 30,
+			compressionLevel:     "default",
+			wantGzipFilter: `{
+  "name": "envoy.filters.http.gzip",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.config.filter.http.gzip.v2.Gzip",
+    "contentLength": 30
+  }
+}`,
+		},
+		{
+			desc:                    "Content types, minimum length and compression level",
+			enableCompression:       true,
+			compressionContentTypes: "application/json, text/html",
+			compressionMinLength:    1024,
+			compressionLevel:        "speed",
+			wantGzipFilter: `{
+  "name": "envoy.filters.http.gzip",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.config.filter.http.gzip.v2.Gzip",
+    "compressionLevel": "SPEED",
+    "contentLength": 1024,
+    "contentType": ["application/json", "text/html"]
+  }
+}`,
+		},
+		{
+			desc:                 "Unknown compression level",
+			enableCompression:    true,
+			compressionMinLength: 30,
+			compressionLevel:     "fast",
+			wantError:            `compression_level must be one of "default", "best" and "speed", got "fast"`,
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.EnableResponseCompression = tc.enableCompression
+		opts.CompressionContentTypes = tc.compressionContentTypes
+		opts.CompressionMinLength = tc.compressionMinLength
+		opts.CompressionLevel = tc.compressionLevel
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter, err := makeGzipFilter(fakeServiceInfo)
+		if tc.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.wantGzipFilter == "" {
+			if filter != nil {
+				t.Errorf("Test Desc(%d): %s, makeGzipFilter got: %v, want: nil", i, tc.desc, filter)
+			}
+			continue
+		}
+
+		marshaler := &jsonpb.Marshaler{}
+		gotFilter, err := marshaler.MarshalToString(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := normalizeJson(gotFilter), normalizeJson(tc.wantGzipFilter); got != want {
+			t.Errorf("Test Desc(%d): %s, makeGzipFilter failed,\ngot: %s, \nwant: %s", i, tc.desc, got, want)
+		}
+	}
+}
+
+func TestRbacFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "DeleteShelf",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc           string
+		policy         string
+		wantRbacFilter string
+	}{
+		{
+			desc:   "No authorization policy",
+			policy: `{"default": {"tracing": {"random_sampling": 1}}}`,
+		},
+		{
+			desc: "Authorization policy with claims, scopes and source CIDRs",
+			policy: `{
+  "operations": {
+    "endpoints.examples.bookstore.Bookstore.DeleteShelf": {
+      "authorization": {
+        "required_claims": {
+          "role": ["admin"],
+          "sub": []
+        },
+        "scopes": ["shelves.delete"],
+        "source_cidrs": ["10.1.2.3/8", "2001:db8::/32"]
+      }
+    }
+  }
+}`,
+			wantRbacFilter: `{
+  "name": "envoy.filters.http.rbac",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.config.filter.http.rbac.v2.RBAC",
+    "rules": {
+      "policies": {
+        "endpoints.examples.bookstore.Bookstore.DeleteShelf": {
+          "permissions": [
+            {
+              "metadata": {
+                "filter": "envoy.filters.http.path_matcher",
+                "path": [
+                  {
+                    "key": "operation"
+                  }
+                ],
+                "value": {
+                  "stringMatch": {
+                    "exact": "endpoints.examples.bookstore.Bookstore.DeleteShelf"
+                  }
+                }
+              }
+            }
+          ],
+          "principals": [
+            {
+              "andIds": {
+                "ids": [
+                  {
+                    "orIds": {
+                      "ids": [
+                        {
+                          "metadata": {
+                            "filter": "envoy.filters.http.jwt_authn",
+                            "path": [
+                              {
+                                "key": "jwt_payloads"
+                              },
+                              {
+                                "key": "role"
+                              }
+                            ],
+                            "value": {
+                              "stringMatch": {
+                                "exact": "admin"
+                              }
+                            }
+                          }
+                        },
+                        {
+                          "metadata": {
+                            "filter": "envoy.filters.http.jwt_authn",
+                            "path": [
+                              {
+                                "key": "jwt_payloads"
+                              },
+                              {
+                                "key": "role"
+                              }
+                            ],
+                            "value": {
+                              "listMatch": {
+                                "oneOf": {
+                                  "stringMatch": {
+                                    "exact": "admin"
+                                  }
+                                }
+                              }
+                            }
+                          }
+                        }
+                      ]
+                    }
+                  },
+                  {
+                    "metadata": {
+                      "filter": "envoy.filters.http.jwt_authn",
+                      "path": [
+                        {
+                          "key": "jwt_payloads"
+                        },
+                        {
+                          "key": "sub"
+                        }
+                      ],
+                      "value": {
+                        "presentMatch": true
+                      }
+                    }
+                  },
+                  {
+                    "metadata": {
+                      "filter": "envoy.filters.http.jwt_authn",
+                      "path": [
+                        {
+                          "key": "jwt_payloads"
+                        },
+                        {
+                          "key": "scope"
+                        }
+                      ],
+                      "value": {
+                        "stringMatch": {
+                          "safeRegex": {
+                            "googleRe2": {
+                              "maxProgramSize": 1000
+                            },
+                            "regex": "(.* )?shelves\\.delete( .*)?"
+                          }
+                        }
+                      }
+                    }
+                  },
+                  {
+                    "orIds": {
+                      "ids": [
+                        {
+                          "sourceIp": {
+                            "addressPrefix": "10.0.0.0",
+                            "prefixLen": 8
+                          }
+                        },
+                        {
+                          "sourceIp": {
+                            "addressPrefix": "2001:db8::",
+                            "prefixLen": 32
+                          }
+                        }
+                      ]
+                    }
+                  }
+                ]
+              }
+            }
+          ]
+        },
+        "unrestricted-operations": {
+          "permissions": [
+            {
+              "notRule": {
+                "orRules": {
+                  "rules": [
+                    {
+                      "metadata": {
+                        "filter": "envoy.filters.http.path_matcher",
+                        "path": [
+                          {
+                            "key": "operation"
+                          }
+                        ],
+                        "value": {
+                          "stringMatch": {
+                            "exact": "endpoints.examples.bookstore.Bookstore.DeleteShelf"
+                          }
+                        }
+                      }
+                    }
+                  ]
+                }
+              }
+            }
+          ],
+          "principals": [
+            {
+              "any": true
+            }
+          ]
+        }
+      }
+    }
+  }
+}`,
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "grpc"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: tc.policy})()
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter, err := makeRbacFilter(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.wantRbacFilter == "" {
+			if filter != nil {
+				t.Errorf("Test Desc(%d): %s, makeRbacFilter should not make a filter, got: %v", i, tc.desc, filter)
+			}
+			continue
+		}
+
+		marshaler := &jsonpb.Marshaler{}
+		gotFilter, err := marshaler.MarshalToString(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := normalizeJson(gotFilter), normalizeJson(tc.wantRbacFilter); got != want {
+			t.Errorf("Test Desc(%d): %s, makeRbacFilter failed,\ngot: %s, \nwant: %s", i, tc.desc, got, want)
+		}
+	}
+}
+
+func TestJwtAuthenticationModes(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "GetShelf",
+					},
+					{
+						Name: "DeleteShelf",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					Issuer:  "issuer-0",
+					JwksUri: "https://fake-jwks.com",
+				},
+			},
+			Rules: []*confpb.AuthenticationRule{
+				{
+					Selector: fmt.Sprintf("%s.ListShelves", testApiName),
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider",
+						},
+					},
+				},
+				{
+					Selector: fmt.Sprintf("%s.GetShelf", testApiName),
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider",
+						},
+					},
+				},
+				{
+					Selector: fmt.Sprintf("%s.DeleteShelf", testApiName),
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendProtocol = "http"
+	defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: `{
+  "operations": {
+    "endpoints.examples.bookstore.Bookstore.GetShelf": {
+      "authentication": {
+        "mode": "allow_missing_or_failed"
+      }
+    }
+  }
+}`})()
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFilterStateRules := `{
+  "name": "envoy.filters.http.path_matcher.operation",
+  "requires": {
+    "endpoints.examples.bookstore.Bookstore.DeleteShelf": {
+      "providerName": "auth_provider"
+    },
+    "endpoints.examples.bookstore.Bookstore.GetShelf": {
+      "requiresAny": {
+        "requirements": [
+          {
+            "providerName": "auth_provider"
+          },
+          {
+            "allowMissingOrFailed": {}
+          }
+        ]
+      }
+    },
+    "endpoints.examples.bookstore.Bookstore.ListShelves": {
+      "providerName": "auth_provider"
+    }
+  }
+}`
+	jwtAuthn := &jwtpb.JwtAuthentication{}
+	if err := ptypes.UnmarshalAny(makeJwtAuthnFilter(fakeServiceInfo).GetTypedConfig(), jwtAuthn); err != nil {
+		t.Fatal(err)
+	}
+	marshaler := &jsonpb.Marshaler{}
+	gotFilterStateRules, err := marshaler.MarshalToString(jwtAuthn.FilterStateRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := normalizeJson(gotFilterStateRules), normalizeJson(wantFilterStateRules); got != want {
+		t.Errorf("makeJwtAuthnFilter failed,\ngot FilterStateRules: %s,\nwant: %s", got, want)
+	}
+}
+
 func normalizeJson(input string) string {
 	var jsonObject map[string]interface{}
 	json.Unmarshal([]byte(input), &jsonObject)
@@ -15,19 +15,33 @@
 package configgenerator
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"net/http"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 
+	bapb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/backend_auth"
 	commonpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/common"
 	v2pb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	routepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	bufferpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/buffer/v2"
+	extauthzpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/ext_authz/v2"
+	typepb "github.com/envoyproxy/go-control-plane/envoy/type"
 	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
+	anypb "github.com/golang/protobuf/ptypes/any"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 )
 
@@ -49,8 +63,17 @@ func MakeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*v2pb.RouteConfigurat
 		return nil, err
 	}
 	host.Routes = brRoutes
+	corsRoutes := makeCorsPathPrefixRoutes(serviceInfo)
 
 	if len(host.Routes) == 0 {
+		// Per-selector routes to the catch-all backend, for the operations
+		// with settings the catch-all route does not have.
+		opRoutes, err := makeCatchAllOperationRoutes(serviceInfo)
+		if err != nil {
+			return nil, err
+		}
+		host.Routes = append(opRoutes, corsRoutes...)
+
 		// Catch-all route if dynamic routing is not enabled.
 		catchAllRt := &routepb.Route{
 			Match: &routepb.RouteMatch{
@@ -70,10 +93,23 @@ func MakeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*v2pb.RouteConfigurat
 				},
 			},
 		}
-		host.Routes = append(host.Routes, catchAllRt)
+		catchAllRt.Tracing = makeRouteTracing(serviceInfo.DefaultTracingPolicy)
+		applyHeadersPolicy(catchAllRt, serviceInfo.DefaultHeadersPolicy)
+		catchAllRoutes, err := makeSplitRoutes(serviceInfo, catchAllRt, serviceInfo.CatchAllBackendSplit, false, serviceInfo.Options.EnableWebsocket)
+		if err != nil {
+			return nil, err
+		}
+		host.Routes = append(host.Routes, catchAllRoutes...)
 
 		jsonStr, _ := util.ProtoToJson(catchAllRt)
 		glog.Infof("adding catch-all routing configuration: %v", jsonStr)
+	} else {
+		host.Routes = append(host.Routes, corsRoutes...)
+	}
+	if serviceInfo.Options.RejectEncodedSlashes {
+		// Path normalization does not decode the encoded slashes, which could
+		// be decoded by the backend into a different path.
+		host.Routes = append([]*routepb.Route{makeEncodedSlashesRoute()}, host.Routes...)
 	}
 
 	switch serviceInfo.Options.CorsPreset {
@@ -128,7 +164,12 @@ func MakeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*v2pb.RouteConfigurat
 		host.GetCors().AllowHeaders = serviceInfo.Options.CorsAllowHeaders
 		host.GetCors().ExposeHeaders = serviceInfo.Options.CorsExposeHeaders
 		host.GetCors().AllowCredentials = &wrapperspb.BoolValue{Value: serviceInfo.Options.CorsAllowCredentials}
+	}
+	if serviceInfo.CorsPolicies != nil {
+		host.Cors = makeCorsPolicy(serviceInfo.CorsPolicies.Default)
+	}
 
+	if host.GetCors() != nil {
 		// In order apply Envoy cors policy, need to have a route rule
 		// to route OPTIONS request to this host
 		corsRoute := &routepb.Route{
@@ -159,6 +200,59 @@ func MakeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*v2pb.RouteConfigurat
 		glog.Infof("adding cors route configuration: %v", jsonStr)
 	}
 
+	secHeaders, err := makeSecurityHeaders(serviceInfo.Options)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range secHeaders.responseHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		host.ResponseHeadersToAdd = append(host.ResponseHeadersToAdd, &corepb.HeaderValueOption{
+			Header: &corepb.HeaderValue{
+				Key:   name,
+				Value: secHeaders.responseHeaders[name],
+			},
+			Append: &wrapperspb.BoolValue{
+				Value: false,
+			},
+		})
+	}
+	if secHeaders.hideServer {
+		// The Http Connection Manager passes the server header of the backend
+		// through, which is removed here.
+		host.ResponseHeadersToRemove = append(host.ResponseHeadersToRemove, "server")
+	}
+
+	if serviceInfo.Options.EnableOperationStats {
+		host.VirtualClusters = makeOperationVirtualClusters(serviceInfo)
+	}
+	if serviceInfo.Options.ExtAuthzAddress != "" {
+		// The header set for the external authorization server is not sent to the backend.
+		host.RequestHeadersToRemove = append(host.RequestHeadersToRemove, util.ExtAuthzOperationHeader)
+	}
+	if hasRequestBodyLimits(serviceInfo) && serviceInfo.Options.MaxRequestBytes == 0 {
+		// Without a global limit, only the routes of the operations with a
+		// limit buffer the requests.
+		bufferDisabled, err := ptypes.MarshalAny(&bufferpb.BufferPerRoute{
+			Override: &bufferpb.BufferPerRoute_Disabled{
+				Disabled: true,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		host.TypedPerFilterConfig = map[string]*anypb.Any{
+			util.Buffer: bufferDisabled,
+		}
+	}
+	if serviceInfo.Options.RateLimitServiceAddress != "" {
+		// The headers set for the rate limit actions are not sent to the backend.
+		host.RequestHeadersToRemove = append(host.RequestHeadersToRemove, util.RateLimitApiKeyHeader, util.RateLimitJwtSubHeader)
+	}
+
 	virtualHosts = append(virtualHosts, &host)
 	return &v2pb.RouteConfiguration{
 		Name:         routeName,
@@ -166,11 +260,90 @@ func MakeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*v2pb.RouteConfigurat
 	}, nil
 }
 
+// The response headers added by each --security_headers_preset.
+var securityHeadersPresets = map[string]map[string]string{
+	"off": {},
+	"basic": {
+		"Strict-Transport-Security": "max-age=31536000",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "SAMEORIGIN",
+		"Referrer-Policy":           "strict-origin-when-cross-origin",
+	},
+	"strict": {
+		"Strict-Transport-Security": "max-age=63072000; includeSubDomains; preload",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "no-referrer",
+	},
+}
+
+// securityHeaders are the security related response headers of all routes.
+type securityHeaders struct {
+	// Headers to add, overwriting the ones from the backend.
+	responseHeaders map[string]string
+	// Value of the server header, instead of "envoy".
+	serverName string
+	// Whether to send no server header at all.
+	hideServer bool
+}
+
+// makeSecurityHeaders applies --security_headers_overrides to the headers of
+// --security_headers_preset.
+func makeSecurityHeaders(opts options.ConfigGeneratorOptions) (*securityHeaders, error) {
+	presetName := opts.SecurityHeadersPreset
+	if presetName == "" {
+		presetName = "off"
+	}
+	preset, ok := securityHeadersPresets[presetName]
+	if !ok {
+		return nil, fmt.Errorf(`security_headers_preset must be one of "off", "basic" and "strict", got %q`, presetName)
+	}
+	h := &securityHeaders{
+		responseHeaders: make(map[string]string),
+		hideServer:      presetName != "off",
+	}
+	for name, value := range preset {
+		h.responseHeaders[name] = value
+	}
+	if opts.SecurityHeadersOverrides == "" {
+		return h, nil
+	}
+
+	var overrides map[string]string
+	if err := json.Unmarshal([]byte(opts.SecurityHeadersOverrides), &overrides); err != nil {
+		return nil, fmt.Errorf("fail to unmarshal security_headers_overrides: %v", err)
+	}
+	for name, value := range overrides {
+		lowerName := strings.ToLower(name)
+		switch {
+		case lowerName == "server":
+			h.serverName = value
+			h.hideServer = value == ""
+			continue
+		case name == "" || strings.HasPrefix(name, ":"):
+			return nil, fmt.Errorf("security_headers_overrides has invalid header name %q", name)
+		case strings.HasPrefix(lowerName, "access-control-"):
+			return nil, fmt.Errorf("security_headers_overrides cannot set CORS header %s, use the cors flags instead", name)
+		}
+
+		// Header names are case insensitive, the override replaces the preset
+		// header of any case.
+		for presetName := range h.responseHeaders {
+			if strings.ToLower(presetName) == lowerName {
+				delete(h.responseHeaders, presetName)
+			}
+		}
+		if value != "" {
+			h.responseHeaders[name] = value
+		}
+	}
+	return h, nil
+}
+
 func makeDynamicRoutingConfig(serviceInfo *configinfo.ServiceInfo) ([]*routepb.Route, error) {
 	var backendRoutes []*routepb.Route
-	for _, operation := range serviceInfo.Operations {
-		method := serviceInfo.Methods[operation]
-		var routeMatcher *routepb.RouteMatch
+	for _, rule := range sortedOperationHttpRules(serviceInfo) {
+		method := serviceInfo.Methods[rule.operation]
 		if method.BackendInfo == nil {
 			continue
 		}
@@ -185,46 +358,442 @@ func makeDynamicRoutingConfig(serviceInfo *configinfo.ServiceInfo) ([]*routepb.R
 			respTimeout = method.BackendInfo.Deadline
 		}
 
-		for _, httpRule := range method.HttpRule {
-			if routeMatcher = makeHttpRouteMatcher(httpRule); routeMatcher == nil {
-				return nil, fmt.Errorf("error making HTTP route matcher for selector: %v", operation)
+		r, err := makeOperationRoute(serviceInfo, rule.operation, rule.httpRule, &routepb.RouteAction{
+			ClusterSpecifier: &routepb.RouteAction_Cluster{
+				Cluster: method.BackendInfo.ClusterName,
+			},
+			HostRewriteSpecifier: &routepb.RouteAction_HostRewrite{
+				HostRewrite: method.BackendInfo.Hostname,
+			},
+			Timeout: ptypes.DurationProto(respTimeout),
+		})
+		if err != nil {
+			return nil, err
+		}
+		splitRoutes, err := makeSplitRoutes(serviceInfo, r, method.BackendSplit, true, method.AllowWebsocket)
+		if err != nil {
+			return nil, err
+		}
+		backendRoutes = append(backendRoutes, splitRoutes...)
+
+		jsonStr, _ := util.ProtoToJson(r)
+		glog.Infof("adding Dynamic Routing configuration: %v", jsonStr)
+	}
+	return backendRoutes, nil
+}
+
+// makeCatchAllOperationRoutes makes the routes of the HttpRules with
+// operation settings the catch-all route does not have, such as a rate limit.
+// The requests of the other HttpRules are routed by the catch-all route, the
+// path matcher filter still names their spans by operation.
+func makeCatchAllOperationRoutes(serviceInfo *configinfo.ServiceInfo) ([]*routepb.Route, error) {
+	rules := sortedOperationHttpRules(serviceInfo)
+	needed := make([]bool, len(rules))
+	for i, rule := range rules {
+		var err error
+		if needed[i], err = needsOperationRoute(serviceInfo, rule.operation, rule.httpRule); err != nil {
+			return nil, err
+		}
+	}
+	// The HttpRules matched first by the path matcher also need a route if
+	// they share some paths with a route, or their requests would get the
+	// settings of another operation.
+	for j := len(rules) - 1; j >= 0; j-- {
+		if !needed[j] {
+			continue
+		}
+		for i := 0; i < j; i++ {
+			if rules[i].httpRule.HttpMethod == rules[j].httpRule.HttpMethod &&
+				rules[i].template.overlaps(rules[j].template, serviceInfo.Options.CaseInsensitiveMatching) {
+				needed[i] = true
 			}
+		}
+	}
 
-			r := routepb.Route{
-				Match: routeMatcher,
-				Action: &routepb.Route_Route{
-					Route: &routepb.RouteAction{
-						ClusterSpecifier: &routepb.RouteAction_Cluster{
-							Cluster: method.BackendInfo.ClusterName,
-						},
-						HostRewriteSpecifier: &routepb.RouteAction_HostRewrite{
-							HostRewrite: method.BackendInfo.Hostname,
+	var routes []*routepb.Route
+	for i, rule := range rules {
+		if !needed[i] {
+			continue
+		}
+		method := serviceInfo.Methods[rule.operation]
+		// Same deadline as the catch-all route, so the operation routes
+		// do not change the routing of the methods.
+		r, err := makeOperationRoute(serviceInfo, rule.operation, rule.httpRule, &routepb.RouteAction{
+			ClusterSpecifier: &routepb.RouteAction_Cluster{
+				Cluster: serviceInfo.BackendClusterName(),
+			},
+			Timeout: ptypes.DurationProto(util.DefaultResponseDeadline),
+		})
+		if err != nil {
+			return nil, err
+		}
+		splitRoutes, err := makeSplitRoutes(serviceInfo, r, method.BackendSplit, false, method.AllowWebsocket)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, splitRoutes...)
+
+		jsonStr, _ := util.ProtoToJson(r)
+		glog.V(1).Infof("adding catch-all operation routing configuration: %v", jsonStr)
+	}
+	return routes, nil
+}
+
+// needsOperationRoute returns whether the route of the HttpRule has operation
+// settings the catch-all route does not have.
+func needsOperationRoute(serviceInfo *configinfo.ServiceInfo, operation string, httpRule *commonpb.Pattern) (bool, error) {
+	method := serviceInfo.Methods[operation]
+	opts := serviceInfo.Options
+	switch {
+	case method.TracingPolicy != serviceInfo.DefaultTracingPolicy,
+		method.HeadersPolicy != serviceInfo.DefaultHeadersPolicy,
+		serviceInfo.CorsPolicies.PolicyFor(method.ApiName, httpRule.UriTemplate) != nil:
+		return true, nil
+	case opts.RateLimitServiceAddress != "":
+		// The rate limits are by operation.
+		return true, nil
+	case opts.ExtAuthzAddress != "" && method.ExtAuthzPolicy != nil && method.ExtAuthzPolicy.Disabled:
+		return true, nil
+	case method.IsStreaming && opts.StreamingIdleTimeout > 0,
+		hasRequestBodyLimits(serviceInfo) && (method.IsStreaming || method.RequestBodyPolicy != nil),
+		method.AllowWebsocket != opts.EnableWebsocket,
+		method.BackendSplit != serviceInfo.CatchAllBackendSplit:
+		return true, nil
+	case serviceInfo.MirrorBackend != nil:
+		// The catch-all route does not mirror the requests.
+		mirrorPolicy, err := makeRequestMirrorPolicy(opts, operation, httpRule.HttpMethod, method.IsStreaming, method.MirrorPolicy)
+		return mirrorPolicy != nil, err
+	}
+	return false, nil
+}
+
+// operationHttpRule is an HttpRule of an operation, with its parsed uri
+// template.
+type operationHttpRule struct {
+	operation string
+	httpRule  *commonpb.Pattern
+	template  *uriTemplate
+}
+
+// sortedOperationHttpRules returns the HttpRules of all operations, in the
+// order the path matcher filter tries them. Envoy uses the first matching
+// route, so the routes are made in this order too.
+func sortedOperationHttpRules(serviceInfo *configinfo.ServiceInfo) []*operationHttpRule {
+	var rules []*operationHttpRule
+	for _, operation := range serviceInfo.Operations {
+		for _, httpRule := range serviceInfo.Methods[operation].HttpRule {
+			rules = append(rules, &operationHttpRule{
+				operation: operation,
+				httpRule:  httpRule,
+				template:  parseUriTemplate(httpRule.UriTemplate),
+			})
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].template.precedes(rules[j].template)
+	})
+	return rules
+}
+
+// makeOperationRoute makes the route for one HttpRule of an operation.
+// The route is decorated with the selector, so spans are named by operation instead of path.
+func makeOperationRoute(serviceInfo *configinfo.ServiceInfo, operation string, httpRule *commonpb.Pattern, action *routepb.RouteAction) (*routepb.Route, error) {
+	routeMatcher := makeHttpRouteMatcher(httpRule, serviceInfo.Options.TrailingSlashMatching, serviceInfo.Options.CaseInsensitiveMatching)
+	if routeMatcher == nil {
+		return nil, fmt.Errorf("error making HTTP route matcher for selector: %v", operation)
+	}
+	method := serviceInfo.Methods[operation]
+
+	r := &routepb.Route{
+		Match: routeMatcher,
+		Action: &routepb.Route_Route{
+			Route: action,
+		},
+		Decorator: &routepb.Decorator{
+			Operation: operation,
+		},
+		Tracing: makeRouteTracing(method.TracingPolicy),
+	}
+	applyHeadersPolicy(r, method.HeadersPolicy)
+	if corsPolicy := serviceInfo.CorsPolicies.PolicyFor(method.ApiName, httpRule.UriTemplate); corsPolicy != nil {
+		action.Cors = makeCorsPolicy(corsPolicy)
+	}
+
+	if serviceInfo.Options.RateLimitServiceAddress != "" {
+		action.RateLimits = makeRateLimits(operation, method.RateLimitPolicy)
+	}
+	if method.IsStreaming && serviceInfo.Options.StreamingIdleTimeout > 0 {
+		// Streaming methods have no response timeout, the idle timeout closes
+		// the streams without activity.
+		action.IdleTimeout = ptypes.DurationProto(serviceInfo.Options.StreamingIdleTimeout)
+	}
+	if serviceInfo.MirrorBackend != nil {
+		// The mirrored requests are buffered, which streams do not allow.
+		mirrorPolicy, err := makeRequestMirrorPolicy(serviceInfo.Options, operation, httpRule.HttpMethod, method.IsStreaming, method.MirrorPolicy)
+		if err != nil {
+			return nil, err
+		}
+		action.RequestMirrorPolicy = mirrorPolicy
+	}
+
+	r.TypedPerFilterConfig = make(map[string]*anypb.Any)
+	if serviceInfo.Options.ExtAuthzAddress != "" {
+		extAuthzPerRoute, err := makeExtAuthzPerRoute(method.ExtAuthzPolicy)
+		if err != nil {
+			return nil, err
+		}
+		if extAuthzPerRoute != nil {
+			r.TypedPerFilterConfig[util.ExtAuthz] = extAuthzPerRoute
+		}
+	}
+	if hasRequestBodyLimits(serviceInfo) {
+		bufferPerRoute, err := makeBufferPerRoute(operation, method.IsStreaming, method.RequestBodyPolicy)
+		if err != nil {
+			return nil, err
+		}
+		if bufferPerRoute != nil {
+			r.TypedPerFilterConfig[util.Buffer] = bufferPerRoute
+		}
+	}
+	if len(r.TypedPerFilterConfig) == 0 {
+		r.TypedPerFilterConfig = nil
+	}
+	return r, nil
+}
+
+// makeSplitRoutes makes the routes of a route, split across the backends of
+// the split if it is not nil. With allowWebsocket, each route is preceded by
+// its WebSocket upgrade route.
+func makeSplitRoutes(serviceInfo *configinfo.ServiceInfo, r *routepb.Route, split *configinfo.BackendSplit, autoHostRewrite bool, allowWebsocket bool) ([]*routepb.Route, error) {
+	routes := []*routepb.Route{r}
+	if split != nil {
+		var err error
+		if routes, err = makeBackendSplitRoutes(r, split, autoHostRewrite); err != nil {
+			return nil, err
+		}
+	}
+	if !allowWebsocket {
+		return routes, nil
+	}
+
+	var withWebsocket []*routepb.Route
+	for _, route := range routes {
+		wr, err := makeWebsocketRoute(serviceInfo, route)
+		if err != nil {
+			return nil, err
+		}
+		withWebsocket = append(withWebsocket, wr, route)
+	}
+	return withWebsocket, nil
+}
+
+// makeBackendSplitRoutes splits the traffic of the route across the weighted
+// backends of the split. The backends with a pin header get a copy of the
+// route, matching the header and placed before it. The backends with a JWT
+// audience override the one of the Backend Auth filter, on their weighted
+// cluster and on their pinned route.
+// With autoHostRewrite, the Host header is rewritten to the hostname of the
+// chosen backend instead of the one of the route.
+func makeBackendSplitRoutes(r *routepb.Route, split *configinfo.BackendSplit, autoHostRewrite bool) ([]*routepb.Route, error) {
+	action := r.GetRoute()
+	if autoHostRewrite {
+		action.HostRewriteSpecifier = &routepb.RouteAction_AutoHostRewrite{
+			AutoHostRewrite: &wrapperspb.BoolValue{Value: true},
+		}
+	}
+
+	var routes []*routepb.Route
+	weightedClusters := &routepb.WeightedCluster{
+		TotalWeight: &wrapperspb.UInt32Value{Value: split.TotalWeight()},
+	}
+	for _, backend := range split.Backends {
+		clusterWeight := &routepb.WeightedCluster_ClusterWeight{
+			Name:   backend.ClusterName,
+			Weight: &wrapperspb.UInt32Value{Value: backend.Weight},
+		}
+		var backendAuthPerRoute *anypb.Any
+		if backend.JwtAudience != "" {
+			var err error
+			backendAuthPerRoute, err = ptypes.MarshalAny(&bapb.PerRouteFilterConfig{
+				JwtAudience: backend.JwtAudience,
+			})
+			if err != nil {
+				return nil, err
+			}
+			clusterWeight.TypedPerFilterConfig = map[string]*anypb.Any{
+				util.BackendAuth: backendAuthPerRoute,
+			}
+		}
+		weightedClusters.Clusters = append(weightedClusters.Clusters, clusterWeight)
+		if backend.PinHeader == nil {
+			continue
+		}
+
+		pinned := proto.Clone(r).(*routepb.Route)
+		pinned.Match.Headers = append(pinned.Match.Headers, &routepb.HeaderMatcher{
+			Name: backend.PinHeader.Name,
+			HeaderMatchSpecifier: &routepb.HeaderMatcher_ExactMatch{
+				ExactMatch: backend.PinHeader.Value,
+			},
+		})
+		pinned.GetRoute().ClusterSpecifier = &routepb.RouteAction_Cluster{
+			Cluster: backend.ClusterName,
+		}
+		if backendAuthPerRoute != nil {
+			if pinned.TypedPerFilterConfig == nil {
+				pinned.TypedPerFilterConfig = make(map[string]*anypb.Any)
+			}
+			pinned.TypedPerFilterConfig[util.BackendAuth] = backendAuthPerRoute
+		}
+		routes = append(routes, pinned)
+	}
+
+	action.ClusterSpecifier = &routepb.RouteAction_WeightedClusters{
+		WeightedClusters: weightedClusters,
+	}
+	return append(routes, r), nil
+}
+
+// makeEncodedSlashesRoute makes the route rejecting the requests with
+// percent-encoded slashes or backslashes in their path.
+func makeEncodedSlashesRoute() *routepb.Route {
+	return &routepb.Route{
+		Match: &routepb.RouteMatch{
+			PathSpecifier: &routepb.RouteMatch_SafeRegex{
+				SafeRegex: makeRouteRegexMatcher(`.*%(2[fF]|5[cC]).*`),
+			},
+		},
+		Action: &routepb.Route_DirectResponse{
+			DirectResponse: &routepb.DirectResponseAction{
+				Status: http.StatusBadRequest,
+				Body: &corepb.DataSource{
+					Specifier: &corepb.DataSource_InlineString{
+						InlineString: "Path with encoded slashes is not allowed",
+					},
+				},
+			},
+		},
+	}
+}
+
+// makeWebsocketRoute makes the route of the WebSocket upgrade requests
+// matching r, to be placed before it. Only this route enables the upgrades,
+// the other requests keep the timeouts and body limits of r. The upgraded
+// connections have no response timeout, which would cut them off, but an
+// idle timeout, and are never buffered, as they have no end to wait for.
+func makeWebsocketRoute(serviceInfo *configinfo.ServiceInfo, r *routepb.Route) (*routepb.Route, error) {
+	wr := proto.Clone(r).(*routepb.Route)
+	wr.Match.Headers = append(wr.Match.Headers, &routepb.HeaderMatcher{
+		Name: util.UpgradeHeader,
+		HeaderMatchSpecifier: &routepb.HeaderMatcher_SafeRegexMatch{
+			SafeRegexMatch: &matcher.RegexMatcher{
+				EngineType: &matcher.RegexMatcher_GoogleRe2{
+					GoogleRe2: &matcher.RegexMatcher_GoogleRE2{
+						MaxProgramSize: &wrapperspb.UInt32Value{
+							Value: util.GoogleRE2MaxProgramSize,
 						},
-						Timeout: ptypes.DurationProto(respTimeout),
 					},
 				},
-			}
-			backendRoutes = append(backendRoutes, &r)
+				// The upgrade header is case-insensitive.
+				Regex: "(?i)" + util.WebsocketUpgradeType,
+			},
+		},
+	})
+
+	action := wr.GetRoute()
+	// The mirrored requests are buffered, which upgrades do not allow.
+	action.RequestMirrorPolicy = nil
+	action.Timeout = ptypes.DurationProto(0 * time.Second)
+	action.IdleTimeout = ptypes.DurationProto(serviceInfo.Options.WebsocketIdleTimeout)
+	action.UpgradeConfigs = []*routepb.RouteAction_UpgradeConfig{
+		{
+			UpgradeType: util.WebsocketUpgradeType,
+			Enabled:     &wrapperspb.BoolValue{Value: true},
+		},
+	}
 
-			jsonStr, _ := util.ProtoToJson(&r)
-			glog.Infof("adding Dynamic Routing configuration: %v", jsonStr)
+	if hasRequestBodyLimits(serviceInfo) {
+		bufferDisabled, err := makeBufferPerRoute("", true, nil)
+		if err != nil {
+			return nil, err
 		}
+		if wr.TypedPerFilterConfig == nil {
+			wr.TypedPerFilterConfig = make(map[string]*anypb.Any)
+		}
+		wr.TypedPerFilterConfig[util.Buffer] = bufferDisabled
 	}
-	return backendRoutes, nil
+	return wr, nil
 }
 
-func makeHttpRouteMatcher(httpRule *commonpb.Pattern) *routepb.RouteMatch {
-	if httpRule == nil {
+// makeCorsPathPrefixRoutes makes the preflight routes of the path prefixes
+// with their own CORS policy. The generated CORS operations have their own
+// routes, but they only exist for the endpoints with allow_cors.
+func makeCorsPathPrefixRoutes(serviceInfo *configinfo.ServiceInfo) []*routepb.Route {
+	if serviceInfo.CorsPolicies == nil {
 		return nil
 	}
-	var routeMatcher routepb.RouteMatch
-	re := regexp.MustCompile(`{[^{}]+}`)
+	var prefixes []string
+	for prefix := range serviceInfo.CorsPolicies.PathPrefixes {
+		prefixes = append(prefixes, prefix)
+	}
+	// Envoy uses the first matching route, so the longest prefix goes first.
+	sort.Slice(prefixes, func(i, j int) bool {
+		if len(prefixes[i]) != len(prefixes[j]) {
+			return len(prefixes[i]) > len(prefixes[j])
+		}
+		return prefixes[i] < prefixes[j]
+	})
 
-	// Replace path templates inside "{}" by regex "[^\/]+", which means
-	// any character except `/`, also adds `$` to match to the end of the string.
-	if re.MatchString(httpRule.UriTemplate) {
-		routeMatcher = routepb.RouteMatch{
-			PathSpecifier: &routepb.RouteMatch_SafeRegex{
+	var routes []*routepb.Route
+	for _, prefix := range prefixes {
+		r := &routepb.Route{
+			Match: &routepb.RouteMatch{
+				PathSpecifier: &routepb.RouteMatch_Prefix{
+					Prefix: prefix,
+				},
+				Headers: []*routepb.HeaderMatcher{{
+					Name: ":method",
+					HeaderMatchSpecifier: &routepb.HeaderMatcher_ExactMatch{
+						ExactMatch: "OPTIONS",
+					},
+				}},
+			},
+			Action: &routepb.Route_Route{
+				Route: &routepb.RouteAction{
+					ClusterSpecifier: &routepb.RouteAction_Cluster{
+						Cluster: serviceInfo.BackendClusterName(),
+					},
+					Cors: makeCorsPolicy(serviceInfo.CorsPolicies.PathPrefixes[prefix]),
+				},
+			},
+		}
+		if serviceInfo.Options.CaseInsensitiveMatching {
+			r.Match.CaseSensitive = &wrapperspb.BoolValue{Value: false}
+		}
+		routes = append(routes, r)
+
+		jsonStr, _ := util.ProtoToJson(r)
+		glog.Infof("adding cors path prefix route configuration: %v", jsonStr)
+	}
+	return routes
+}
+
+func makeCorsPolicy(corsPolicy *configinfo.CorsPolicy) *routepb.CorsPolicy {
+	p := &routepb.CorsPolicy{
+		AllowMethods:  corsPolicy.AllowMethods,
+		AllowHeaders:  corsPolicy.AllowHeaders,
+		ExposeHeaders: corsPolicy.ExposeHeaders,
+	}
+	for _, origin := range corsPolicy.AllowOrigins {
+		p.AllowOriginStringMatch = append(p.AllowOriginStringMatch, &matcher.StringMatcher{
+			MatchPattern: &matcher.StringMatcher_Exact{
+				Exact: origin,
+			},
+		})
+	}
+	for _, re := range corsPolicy.AllowOriginRegexes {
+		p.AllowOriginStringMatch = append(p.AllowOriginStringMatch, &matcher.StringMatcher{
+			MatchPattern: &matcher.StringMatcher_SafeRegex{
 				SafeRegex: &matcher.RegexMatcher{
 					EngineType: &matcher.RegexMatcher_GoogleRe2{
 						GoogleRe2: &matcher.RegexMatcher_GoogleRE2{
@@ -233,17 +802,471 @@ func makeHttpRouteMatcher(httpRule *commonpb.Pattern) *routepb.RouteMatch {
 							},
 						},
 					},
-					Regex: re.ReplaceAllString(httpRule.UriTemplate, `[^\/]+`) + `$`,
+					Regex: re,
 				},
 			},
+		})
+	}
+	if corsPolicy.MaxAge != nil {
+		p.MaxAge = strconv.FormatUint(uint64(*corsPolicy.MaxAge), 10)
+	}
+	// Set explicitly like the cors_preset policy, so that an unset field is
+	// not left to the Envoy default.
+	p.AllowCredentials = &wrapperspb.BoolValue{
+		Value: corsPolicy.AllowCredentials != nil && *corsPolicy.AllowCredentials,
+	}
+	return p
+}
+
+// rateLimitDescriptors returns the rate limit descriptors of an operation.
+// The operations without policy are limited by operation name.
+func rateLimitDescriptors(policy *configinfo.RateLimitPolicy) [][]string {
+	if policy == nil {
+		return [][]string{{configinfo.RateLimitOperation}}
+	}
+	return policy.Descriptors
+}
+
+// makeRateLimits makes a rate limit per descriptor of the operation. Envoy
+// does not send a descriptor if one of its entries is missing.
+func makeRateLimits(operation string, policy *configinfo.RateLimitPolicy) []*routepb.RateLimit {
+	var rateLimits []*routepb.RateLimit
+	for _, descriptor := range rateLimitDescriptors(policy) {
+		rateLimit := &routepb.RateLimit{}
+		for _, entry := range descriptor {
+			action := &routepb.RateLimit_Action{}
+			switch entry {
+			case configinfo.RateLimitOperation:
+				action.ActionSpecifier = &routepb.RateLimit_Action_GenericKey_{
+					GenericKey: &routepb.RateLimit_Action_GenericKey{
+						DescriptorValue: operation,
+					},
+				}
+			case configinfo.RateLimitApiKey:
+				action.ActionSpecifier = &routepb.RateLimit_Action_RequestHeaders_{
+					RequestHeaders: &routepb.RateLimit_Action_RequestHeaders{
+						HeaderName:    util.RateLimitApiKeyHeader,
+						DescriptorKey: configinfo.RateLimitApiKey,
+					},
+				}
+			case configinfo.RateLimitJwtSub:
+				action.ActionSpecifier = &routepb.RateLimit_Action_RequestHeaders_{
+					RequestHeaders: &routepb.RateLimit_Action_RequestHeaders{
+						HeaderName:    util.RateLimitJwtSubHeader,
+						DescriptorKey: configinfo.RateLimitJwtSub,
+					},
+				}
+			case configinfo.RateLimitClientIP:
+				action.ActionSpecifier = &routepb.RateLimit_Action_RemoteAddress_{
+					RemoteAddress: &routepb.RateLimit_Action_RemoteAddress{},
+				}
+			}
+			rateLimit.Actions = append(rateLimit.Actions, action)
 		}
-	} else {
+		rateLimits = append(rateLimits, rateLimit)
+	}
+	return rateLimits
+}
+
+// idempotentHttpMethods are the HTTP methods whose requests can be mirrored
+// with --mirror_skip_non_idempotent.
+var idempotentHttpMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"PUT":     true,
+	"DELETE":  true,
+	"TRACE":   true,
+}
+
+// makeRequestMirrorPolicy makes the policy mirroring the requests of an
+// HttpRule of the operation to the shadow backend, or returns nil if they are
+// not mirrored.
+func makeRequestMirrorPolicy(opts options.ConfigGeneratorOptions, operation string, httpMethod string, isStreaming bool, mirrorPolicy *configinfo.MirrorPolicy) (*routepb.RouteAction_RequestMirrorPolicy, error) {
+	if opts.MirrorPercent < 0 || opts.MirrorPercent > 100 {
+		return nil, fmt.Errorf("mirror_percent must be >= 0 and <= 100, got %v", opts.MirrorPercent)
+	}
+	percent := opts.MirrorPercent
+	if mirrorPolicy != nil {
+		percent = mirrorPolicy.Percent
+	}
+	if percent == 0 || isStreaming {
+		return nil, nil
+	}
+	if opts.MirrorSkipNonIdempotent && !idempotentHttpMethods[httpMethod] {
+		return nil, nil
+	}
+	return &routepb.RouteAction_RequestMirrorPolicy{
+		Cluster: util.MirrorClusterName,
+		RuntimeFraction: &corepb.RuntimeFractionalPercent{
+			DefaultValue: makeFractionalPercent(&percent),
+			RuntimeKey:   "mirror." + operation,
+		},
+	}, nil
+}
+
+// makeExtAuthzPerRoute disables the check for the operation, or returns nil
+// if it does not. The operation is sent in the header set by the Path Matcher
+// filter.
+func makeExtAuthzPerRoute(extAuthzPolicy *configinfo.ExtAuthzPolicy) (*anypb.Any, error) {
+	if extAuthzPolicy == nil || !extAuthzPolicy.Disabled {
+		return nil, nil
+	}
+	return ptypes.MarshalAny(&extauthzpb.ExtAuthzPerRoute{
+		Override: &extauthzpb.ExtAuthzPerRoute_Disabled{
+			Disabled: true,
+		},
+	})
+}
+
+// makeBufferPerRoute overrides the request body size limit of the virtual
+// host for the operation, or returns nil if it does not. Streaming methods
+// are never buffered.
+func makeBufferPerRoute(operation string, isStreaming bool, requestBodyPolicy *configinfo.RequestBodyPolicy) (*anypb.Any, error) {
+	perRoute := &bufferpb.BufferPerRoute{}
+	switch {
+	case isStreaming:
+		if requestBodyPolicy != nil {
+			glog.Warningf("request_body policy of streaming method %s is ignored", operation)
+		}
+		perRoute.Override = &bufferpb.BufferPerRoute_Disabled{
+			Disabled: true,
+		}
+	case requestBodyPolicy != nil:
+		perRoute.Override = &bufferpb.BufferPerRoute_Buffer{
+			Buffer: &bufferpb.Buffer{
+				MaxRequestBytes: &wrapperspb.UInt32Value{
+					Value: requestBodyPolicy.MaxRequestBytes,
+				},
+			},
+		}
+	default:
+		return nil, nil
+	}
+	return ptypes.MarshalAny(perRoute)
+}
+
+// applyHeadersPolicy sets the header manipulation of the route.
+func applyHeadersPolicy(r *routepb.Route, headersPolicy *configinfo.HeadersPolicy) {
+	if headersPolicy == nil {
+		return
+	}
+	r.RequestHeadersToAdd = makeHeaderValueOptions(headersPolicy.RequestHeadersToAdd)
+	r.RequestHeadersToRemove = headersPolicy.RequestHeadersToRemove
+	r.ResponseHeadersToAdd = makeHeaderValueOptions(headersPolicy.ResponseHeadersToAdd)
+	r.ResponseHeadersToRemove = headersPolicy.ResponseHeadersToRemove
+}
+
+func makeHeaderValueOptions(headers []*configinfo.HeaderToAdd) []*corepb.HeaderValueOption {
+	var options []*corepb.HeaderValueOption
+	for _, header := range headers {
+		options = append(options, &corepb.HeaderValueOption{
+			Header: &corepb.HeaderValue{
+				Key:   header.Name,
+				Value: header.Value,
+			},
+			Append: &wrapperspb.BoolValue{
+				Value: header.Append,
+			},
+		})
+	}
+	return options
+}
+
+func makeRouteTracing(tracingPolicy *configinfo.TracingPolicy) *routepb.Tracing {
+	if tracingPolicy == nil {
+		return nil
+	}
+	return &routepb.Tracing{
+		ClientSampling:  makeFractionalPercent(tracingPolicy.ClientSampling),
+		RandomSampling:  makeFractionalPercent(tracingPolicy.RandomSampling),
+		OverallSampling: makeFractionalPercent(tracingPolicy.OverallSampling),
+	}
+}
+
+// makeFractionalPercent converts a percentage in [0, 100] to a FractionalPercent
+// with a precision of 0.0001%.
+func makeFractionalPercent(percent *float64) *typepb.FractionalPercent {
+	if percent == nil {
+		return nil
+	}
+	return &typepb.FractionalPercent{
+		Numerator:   uint32(math.Round(*percent * 10000)),
+		Denominator: typepb.FractionalPercent_MILLION,
+	}
+}
+
+// makeOperationVirtualClusters makes one virtual cluster per HttpRule, so
+// upstream request stats are emitted per operation. All HttpRules of an
+// operation share the same virtual cluster name, so their stats are merged.
+func makeOperationVirtualClusters(serviceInfo *configinfo.ServiceInfo) []*routepb.VirtualCluster {
+	var vclusters []*routepb.VirtualCluster
+	for _, operation := range serviceInfo.Operations {
+		method := serviceInfo.Methods[operation]
+		for _, httpRule := range method.HttpRule {
+			if httpRule.UriTemplate == "" || httpRule.HttpMethod == "" {
+				continue
+			}
+			vclusters = append(vclusters, &routepb.VirtualCluster{
+				// Envoy extracts the virtual cluster name from the stat name
+				// with a regex that does not allow dots.
+				Name: strings.Replace(operation, ".", "_", -1),
+				Headers: []*routepb.HeaderMatcher{
+					{
+						Name: ":method",
+						HeaderMatchSpecifier: &routepb.HeaderMatcher_ExactMatch{
+							ExactMatch: httpRule.HttpMethod,
+						},
+					},
+					{
+						Name: ":path",
+						HeaderMatchSpecifier: &routepb.HeaderMatcher_SafeRegexMatch{
+							SafeRegexMatch: &matcher.RegexMatcher{
+								EngineType: &matcher.RegexMatcher_GoogleRe2{
+									GoogleRe2: &matcher.RegexMatcher_GoogleRE2{
+										MaxProgramSize: &wrapperspb.UInt32Value{
+											Value: util.GoogleRE2MaxProgramSize,
+										},
+									},
+								},
+								Regex: makePathHeaderRegex(httpRule.UriTemplate, serviceInfo.Options.TrailingSlashMatching, serviceInfo.Options.CaseInsensitiveMatching),
+							},
+						},
+					},
+				},
+			})
+		}
+	}
+	return vclusters
+}
+
+// makePathHeaderRegex converts the uri template to a regex matching the
+// ":path" header, which also contains the query string.
+func makePathHeaderRegex(uriTemplate string, allowTrailingSlash bool, caseInsensitive bool) string {
+	regex := parseUriTemplate(uriTemplate).regex(`[^/?]+`, `(/[^?]*)?`)
+	if allowTrailingSlash {
+		regex += `/*`
+	}
+	regex = "^" + regex + `(\?.*)?$`
+	if caseInsensitive {
+		regex = "(?i)" + regex
+	}
+	return regex
+}
+
+// Kinds of the uri template segments, in the order the path matcher filter
+// tries them on a path segment. The end of a template only competes with the
+// custom verbs, which are tried first, and with "**", which also matches no
+// segment.
+const (
+	literalSegment = iota
+	templateEnd
+	singleSegment
+	multiSegment
+)
+
+// uriTemplateSegment is a path segment of a uri template.
+type uriTemplateSegment struct {
+	kind int
+	// The segment of a literalSegment.
+	literal string
+}
+
+// uriTemplate is a uri template as the path matcher filter matches it. The
+// variables are replaced by their pattern, "*" if they have none, and the
+// custom verb is split from the last segment.
+type uriTemplate struct {
+	segments []uriTemplateSegment
+	verb     string
+}
+
+func parseUriTemplate(template string) *uriTemplate {
+	var sb strings.Builder
+	rest := template
+	for rest != "" {
+		start := strings.Index(rest, "{")
+		end := strings.Index(rest, "}")
+		if start < 0 || end < start {
+			sb.WriteString(rest)
+			break
+		}
+		sb.WriteString(rest[:start])
+		if eq := strings.Index(rest[start:end], "="); eq >= 0 {
+			sb.WriteString(rest[start+eq+1 : end])
+		} else {
+			sb.WriteString("*")
+		}
+		rest = rest[end+1:]
+	}
+
+	path := sb.String()
+	t := &uriTemplate{}
+	if colon := strings.LastIndex(path, ":"); colon > strings.LastIndex(path, "/") {
+		t.verb = path[colon+1:]
+		path = path[:colon]
+	}
+	for _, part := range strings.Split(path, "/") {
+		switch part {
+		case "":
+			// The path matcher ignores the empty segments.
+		case "*":
+			t.segments = append(t.segments, uriTemplateSegment{kind: singleSegment})
+		case "**":
+			t.segments = append(t.segments, uriTemplateSegment{kind: multiSegment})
+		default:
+			t.segments = append(t.segments, uriTemplateSegment{kind: literalSegment, literal: part})
+		}
+	}
+	return t
+}
+
+// isLiteral returns whether the template matches a single path.
+func (t *uriTemplate) isLiteral() bool {
+	for _, segment := range t.segments {
+		if segment.kind != literalSegment {
+			return false
+		}
+	}
+	return true
+}
+
+// regex returns the regex matching the paths of the template. segmentRegex
+// matches a single segment, multiSegmentRegex any number of segments with
+// their leading slashes.
+func (t *uriTemplate) regex(segmentRegex string, multiSegmentRegex string) string {
+	var sb strings.Builder
+	for _, segment := range t.segments {
+		switch segment.kind {
+		case literalSegment:
+			sb.WriteString("/" + regexp.QuoteMeta(segment.literal))
+		case singleSegment:
+			sb.WriteString("/" + segmentRegex)
+		case multiSegment:
+			sb.WriteString(multiSegmentRegex)
+		}
+	}
+	if len(t.segments) == 0 {
+		sb.WriteString("/")
+	}
+	if t.verb != "" {
+		sb.WriteString(":" + regexp.QuoteMeta(t.verb))
+	}
+	return sb.String()
+}
+
+// precedes returns whether the path matcher filter tries the template before
+// the other one. It tries the literals first, then the single segment
+// variables, then "**", segment by segment.
+func (t *uriTemplate) precedes(other *uriTemplate) bool {
+	key, otherKey := t.precedenceKey(), other.precedenceKey()
+	for i := 0; i < len(key) && i < len(otherKey); i++ {
+		if key[i] != otherKey[i] {
+			return key[i] < otherKey[i]
+		}
+	}
+	return false
+}
+
+func (t *uriTemplate) precedenceKey() []int {
+	var key []int
+	for _, segment := range t.segments {
+		key = append(key, segment.kind)
+	}
+	if t.verb != "" {
+		// The custom verb is matched as a last literal segment.
+		key = append(key, literalSegment)
+	}
+	return append(key, templateEnd)
+}
+
+// overlaps returns whether some paths are matched by the regexes of both
+// templates. It may also return true for templates without common paths,
+// which only costs an unneeded route.
+func (t *uriTemplate) overlaps(other *uriTemplate, caseInsensitive bool) bool {
+	return pathSegmentsOverlap(t.pathSegments(caseInsensitive), other.pathSegments(caseInsensitive))
+}
+
+// pathSegments returns the segments of the template with the custom verb
+// appended to the last one. The literal of a single segment variable is the
+// suffix of the segment, ":" and the verb.
+func (t *uriTemplate) pathSegments(caseInsensitive bool) []uriTemplateSegment {
+	segments := append([]uriTemplateSegment(nil), t.segments...)
+	if t.verb != "" && len(segments) > 0 {
+		last := &segments[len(segments)-1]
+		last.literal += ":" + t.verb
+	}
+	if caseInsensitive {
+		for i := range segments {
+			segments[i].literal = strings.ToLower(segments[i].literal)
+		}
+	}
+	return segments
+}
+
+func pathSegmentsOverlap(a, b []uriTemplateSegment) bool {
+	switch {
+	case len(a) > 0 && a[0].kind == multiSegment:
+		return pathSegmentsOverlap(a[1:], b) || len(b) > 0 && pathSegmentsOverlap(a, b[1:])
+	case len(b) > 0 && b[0].kind == multiSegment:
+		return pathSegmentsOverlap(b, a)
+	case len(a) == 0 || len(b) == 0:
+		return len(a) == len(b)
+	}
+
+	x, y := a[0], b[0]
+	if x.kind == singleSegment {
+		x, y = y, x
+	}
+	switch {
+	case x.kind == literalSegment && y.kind == literalSegment:
+		if x.literal != y.literal {
+			return false
+		}
+	case x.kind == literalSegment:
+		// The variable matches the literals ending with its suffix.
+		if !strings.HasSuffix(x.literal, y.literal) || len(x.literal) == len(y.literal) {
+			return false
+		}
+	}
+	return pathSegmentsOverlap(a[1:], b[1:])
+}
+
+// makeHttpRouteMatcher makes the route matcher of the HttpRule. With
+// allowTrailingSlash, the paths with trailing slashes also match, as they do
+// in the path matcher filter. With caseInsensitive, the paths match in any
+// case. Envoy ignores case_sensitive for the regex matchers, so their regex
+// is also made case-insensitive.
+func makeHttpRouteMatcher(httpRule *commonpb.Pattern, allowTrailingSlash bool, caseInsensitive bool) *routepb.RouteMatch {
+	if httpRule == nil {
+		return nil
+	}
+	var routeMatcher routepb.RouteMatch
+	template := parseUriTemplate(httpRule.UriTemplate)
+
+	if template.isLiteral() && !allowTrailingSlash {
 		// Match with HttpHeader method. Some methods may have same path.
 		routeMatcher = routepb.RouteMatch{
 			PathSpecifier: &routepb.RouteMatch_Path{
 				Path: httpRule.UriTemplate,
 			},
 		}
+	} else {
+		// A variable matches any character except `/`, "**" any segments.
+		regex := template.regex(`[^\/]+`, `(\/.*)?`)
+		if allowTrailingSlash {
+			regex += `/*`
+		}
+		if caseInsensitive {
+			regex = "(?i)" + regex
+		}
+		routeMatcher = routepb.RouteMatch{
+			PathSpecifier: &routepb.RouteMatch_SafeRegex{
+				SafeRegex: makeRouteRegexMatcher(regex + `$`),
+			},
+		}
+	}
+	if caseInsensitive {
+		routeMatcher.CaseSensitive = &wrapperspb.BoolValue{Value: false}
 	}
 	routeMatcher.Headers = []*routepb.HeaderMatcher{
 		{
@@ -255,3 +1278,16 @@ func makeHttpRouteMatcher(httpRule *commonpb.Pattern) *routepb.RouteMatch {
 	}
 	return &routeMatcher
 }
+
+func makeRouteRegexMatcher(regex string) *matcher.RegexMatcher {
+	return &matcher.RegexMatcher{
+		EngineType: &matcher.RegexMatcher_GoogleRe2{
+			GoogleRe2: &matcher.RegexMatcher_GoogleRE2{
+				MaxProgramSize: &wrapperspb.UInt32Value{
+					Value: util.GoogleRE2MaxProgramSize,
+				},
+			},
+		},
+		Regex: regex,
+	}
+}
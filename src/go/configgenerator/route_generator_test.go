@@ -15,17 +15,29 @@
 package configgenerator
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
 
 	routepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
 	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
+	anypb "github.com/golang/protobuf/ptypes/any"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
 )
 
 func TestMakeRouteConfigForCors(t *testing.T) {
@@ -157,3 +169,2249 @@ func TestMakeRouteConfigForCors(t *testing.T) {
 		}
 	}
 }
+
+func TestMakeRouteConfigForTracing(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name:              "WatchShelves",
+						ResponseStreaming: true,
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.WatchShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves:watch",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc       string
+		policy     string
+		wantRoutes string
+	}{
+		{
+			desc: "Operations without settings are routed by the catch-all route",
+			wantRoutes: `[
+  {
+    "match": {
+      "prefix": "/"
+    },
+    "route": {
+      "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+      "timeout": "15s"
+    }
+  }
+]`,
+		},
+		{
+			desc:   "Catch-all operation route with sampling overrides",
+			policy: `{"operations": {"endpoints.examples.bookstore.Bookstore.ListShelves": {"tracing": {"random_sampling": 0.5, "overall_sampling": 100}}}}`,
+			wantRoutes: `[
+  {
+    "decorator": {
+      "operation": "endpoints.examples.bookstore.Bookstore.ListShelves"
+    },
+    "match": {
+      "headers": [
+        {
+          "exactMatch": "GET",
+          "name": ":method"
+        }
+      ],
+      "path": "/v1/shelves"
+    },
+    "route": {
+      "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+      "timeout": "15s"
+    },
+    "tracing": {
+      "overallSampling": {
+        "denominator": "MILLION",
+        "numerator": 1000000
+      },
+      "randomSampling": {
+        "denominator": "MILLION",
+        "numerator": 5000
+      }
+    }
+  },
+  {
+    "match": {
+      "prefix": "/"
+    },
+    "route": {
+      "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+      "timeout": "15s"
+    }
+  }
+]`,
+		},
+		{
+			desc:   "Default sampling on the catch-all route, operation routes with their own sampling",
+			policy: `{"default": {"tracing": {"random_sampling": 1}}, "operations": {"endpoints.examples.bookstore.Bookstore.ListShelves": {"tracing": {"random_sampling": 50}}}}`,
+			wantRoutes: `[
+  {
+    "decorator": {
+      "operation": "endpoints.examples.bookstore.Bookstore.ListShelves"
+    },
+    "match": {
+      "headers": [
+        {
+          "exactMatch": "GET",
+          "name": ":method"
+        }
+      ],
+      "path": "/v1/shelves"
+    },
+    "route": {
+      "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+      "timeout": "15s"
+    },
+    "tracing": {
+      "randomSampling": {
+        "denominator": "MILLION",
+        "numerator": 500000
+      }
+    }
+  },
+  {
+    "match": {
+      "prefix": "/"
+    },
+    "route": {
+      "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+      "timeout": "15s"
+    },
+    "tracing": {
+      "randomSampling": {
+        "denominator": "MILLION",
+        "numerator": 10000
+      }
+    }
+  }
+]`,
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: tc.policy})()
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		marshaler := &jsonpb.Marshaler{}
+		var gotRoutes []string
+		for _, route := range gotRoute.GetVirtualHosts()[0].GetRoutes() {
+			gotJson, err := marshaler.MarshalToString(route)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotRoutes = append(gotRoutes, gotJson)
+		}
+
+		got := normalizeJson(`{"routes":[` + strings.Join(gotRoutes, ",") + `]}`)
+		if want := normalizeJson(`{"routes":` + tc.wantRoutes + `}`); got != want {
+			t.Errorf("Test Desc(%d): %s, makeRouteConfig failed,\ngot routes: %s,\nwant routes: %s", i, tc.desc, got, want)
+		}
+	}
+}
+
+func TestMakePathHeaderRegex(t *testing.T) {
+	testData := []struct {
+		desc               string
+		uriTemplate        string
+		allowTrailingSlash bool
+		caseInsensitive    bool
+		wantMatch          []string
+		wantNotMatch       []string
+	}{
+		{
+			desc:         "Variable matches one segment",
+			uriTemplate:  "/v1/shelves/{shelf}",
+			wantMatch:    []string{"/v1/shelves/1", "/v1/shelves/1?key=1"},
+			wantNotMatch: []string{"/v1/shelves/1/books", "/v1/shelves/"},
+		},
+		{
+			desc:         "Variable with a single segment pattern",
+			uriTemplate:  "/v1/{name=shelves/*}",
+			wantMatch:    []string{"/v1/shelves/1"},
+			wantNotMatch: []string{"/v1/shelves/1/books", "/v1/books/1"},
+		},
+		{
+			desc:         "Variable with a multi segment pattern",
+			uriTemplate:  "/v1/{name=**}",
+			wantMatch:    []string{"/v1/shelves/1/books/2", "/v1/", "/v1", "/v1/shelves?key=1"},
+			wantNotMatch: []string{"/v2/shelves", "/v1shelves"},
+		},
+		{
+			desc:         "Wildcards outside variables",
+			uriTemplate:  "/v1/*/books/**",
+			wantMatch:    []string{"/v1/shelves/books/1/2"},
+			wantNotMatch: []string{"/v1/books/1", "/v1/shelves/1/books/1"},
+		},
+		{
+			desc:         "Variable and verb",
+			uriTemplate:  "/v1/shelves/{shelf}:clear",
+			wantMatch:    []string{"/v1/shelves/1:clear"},
+			wantNotMatch: []string{"/v1/shelves/1", "/v1/shelves.json/1:clear"},
+		},
+		{
+			desc:               "Trailing slashes",
+			uriTemplate:        "/v1/shelves/{shelf}",
+			allowTrailingSlash: true,
+			wantMatch:          []string{"/v1/shelves/1", "/v1/shelves/1/", "/v1/shelves/1//?key=1"},
+			wantNotMatch:       []string{"/v1/shelves/1/books", "/V1/shelves/1"},
+		},
+		{
+			desc:            "Case-insensitive",
+			uriTemplate:     "/v1/shelves/{shelf}",
+			caseInsensitive: true,
+			wantMatch:       []string{"/v1/shelves/1", "/V1/Shelves/1?key=1"},
+			wantNotMatch:    []string{"/v1/shelves/1/", "/V1/Shelves/1/books"},
+		},
+	}
+
+	for i, tc := range testData {
+		re := regexp.MustCompile(makePathHeaderRegex(tc.uriTemplate, tc.allowTrailingSlash, tc.caseInsensitive))
+		for _, path := range tc.wantMatch {
+			if !re.MatchString(path) {
+				t.Errorf("Test Desc(%d): %s, regex %s does not match %s", i, tc.desc, re, path)
+			}
+		}
+		for _, path := range tc.wantNotMatch {
+			if re.MatchString(path) {
+				t.Errorf("Test Desc(%d): %s, regex %s matches %s", i, tc.desc, re, path)
+			}
+		}
+	}
+}
+
+func TestCatchAllOperationRoutesFollowPathMatcher(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{Name: "GetAny"},
+					{Name: "GetShelf"},
+					{Name: "GetShelfResource"},
+					{Name: "GetSpecialShelf"},
+					{Name: "ListShelves"},
+					{Name: "WatchShelf"},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: testApiName + ".GetAny",
+					Pattern:  &annotationspb.HttpRule_Get{Get: "/v1/**"},
+				},
+				{
+					Selector: testApiName + ".GetShelf",
+					Pattern:  &annotationspb.HttpRule_Get{Get: "/v1/shelves/{shelf}"},
+				},
+				{
+					Selector: testApiName + ".GetShelfResource",
+					Pattern:  &annotationspb.HttpRule_Get{Get: "/v1/shelves/{shelf}/{resource=**}"},
+				},
+				{
+					Selector: testApiName + ".GetSpecialShelf",
+					Pattern:  &annotationspb.HttpRule_Get{Get: "/v1/shelves/special"},
+				},
+				{
+					Selector: testApiName + ".ListShelves",
+					Pattern:  &annotationspb.HttpRule_Get{Get: "/v1/shelves"},
+				},
+				{
+					Selector: testApiName + ".WatchShelf",
+					Pattern:  &annotationspb.HttpRule_Get{Get: "/v1/shelves/{shelf}:watch"},
+				},
+			},
+		},
+	}
+	// The operation chosen by the path matcher filter for each path.
+	pathMatcherOperations := map[string]string{
+		"/v1":                     "GetAny",
+		"/v1/books/1":             "GetAny",
+		"/v1/shelves":             "ListShelves",
+		"/v1/shelves/1":           "GetShelf",
+		"/v1/shelves/special":     "GetSpecialShelf",
+		"/v1/shelves/1:watch":     "WatchShelf",
+		"/v1/shelves/1/books":     "GetShelfResource",
+		"/v1/shelves/1/books/2":   "GetShelfResource",
+		"/v1/shelves/special/abc": "GetShelfResource",
+	}
+
+	// firstMatchingOperation returns the operation of the first route matching
+	// the GET request of the path, "" for the catch-all route.
+	firstMatchingOperation := func(routes []*routepb.Route, path string) string {
+		for _, route := range routes {
+			match := route.GetMatch()
+			if len(match.GetHeaders()) != 1 && match.GetPrefix() != "/" {
+				t.Fatalf("unexpected route headers: %v", match.GetHeaders())
+			}
+			if len(match.GetHeaders()) == 1 && match.GetHeaders()[0].GetExactMatch() != "GET" {
+				continue
+			}
+			switch {
+			case match.GetPrefix() != "":
+				if strings.HasPrefix(path, match.GetPrefix()) {
+					return ""
+				}
+			case match.GetPath() != "":
+				if path == match.GetPath() {
+					return route.GetDecorator().GetOperation()
+				}
+			default:
+				// Envoy matches the whole path with the regex.
+				if regexp.MustCompile("^(?:" + match.GetSafeRegex().GetRegex() + ")$").MatchString(path) {
+					return route.GetDecorator().GetOperation()
+				}
+			}
+		}
+		return ""
+	}
+
+	methods := []string{"GetAny", "GetShelf", "GetShelfResource", "GetSpecialShelf", "ListShelves", "WatchShelf"}
+	for _, withSettings := range append([][]string{methods}, [][]string{
+		{"GetAny"},
+		{"GetShelf"},
+		{"GetShelfResource"},
+		{"GetSpecialShelf"},
+		{"ListShelves"},
+		{"WatchShelf"},
+	}...) {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		var policies []string
+		hasSettings := make(map[string]bool)
+		for _, method := range withSettings {
+			policies = append(policies, fmt.Sprintf(`"%s.%s": {"tracing": {"random_sampling": 10}}`, testApiName, method))
+			hasSettings[testApiName+"."+method] = true
+		}
+		defer testutil.WriteTempFiles(t, map[*string]string{
+			&opts.OperationPolicyPath: `{"operations": {` + strings.Join(policies, ",") + `}}`,
+		})()
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		routes := gotRoute.GetVirtualHosts()[0].GetRoutes()
+		for path, method := range pathMatcherOperations {
+			want := testApiName + "." + method
+			got := firstMatchingOperation(routes, path)
+			// The requests of an operation without settings may be routed by
+			// the catch-all route, but never by the route of another operation.
+			if got != want && (hasSettings[want] || got != "") {
+				t.Errorf("With settings for %v, path %s is routed to operation %q, want: %q", withSettings, path, got, want)
+			}
+		}
+	}
+}
+
+func TestMakeRouteConfigForOperationStats(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "GetBook",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetBook",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves/{shelf}/books/{book.id}",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                 string
+		enableOperationStats bool
+		wantVirtualClusters  string
+	}{
+		{
+			desc:                 "Operation stats are disabled",
+			enableOperationStats: false,
+			wantVirtualClusters:  `[]`,
+		},
+		{
+			desc:                 "Operation stats are enabled",
+			enableOperationStats: true,
+			wantVirtualClusters: `[
+  {
+    "headers": [
+      {
+        "exactMatch": "GET",
+        "name": ":method"
+      },
+      {
+        "name": ":path",
+        "safeRegexMatch": {
+          "googleRe2": {
+            "maxProgramSize": 1000
+          },
+          "regex": "^/v1/shelves/[^/?]+/books/[^/?]+(\\?.*)?$"
+        }
+      }
+    ],
+    "name": "endpoints_examples_bookstore_Bookstore_GetBook"
+  },
+  {
+    "headers": [
+      {
+        "exactMatch": "GET",
+        "name": ":method"
+      },
+      {
+        "name": ":path",
+        "safeRegexMatch": {
+          "googleRe2": {
+            "maxProgramSize": 1000
+          },
+          "regex": "^/v1/shelves(\\?.*)?$"
+        }
+      }
+    ],
+    "name": "endpoints_examples_bookstore_Bookstore_ListShelves"
+  }
+]`,
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.EnableOperationStats = tc.enableOperationStats
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		marshaler := &jsonpb.Marshaler{}
+		var gotVirtualClusters []string
+		for _, vcluster := range gotRoute.GetVirtualHosts()[0].GetVirtualClusters() {
+			gotJson, err := marshaler.MarshalToString(vcluster)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotVirtualClusters = append(gotVirtualClusters, gotJson)
+		}
+
+		got := normalizeJson(`{"virtualClusters":[` + strings.Join(gotVirtualClusters, ",") + `]}`)
+		if want := normalizeJson(`{"virtualClusters":` + tc.wantVirtualClusters + `}`); got != want {
+			t.Errorf("Test Desc(%d): %s, makeRouteConfig failed,\ngot virtualClusters: %s,\nwant virtualClusters: %s", i, tc.desc, got, want)
+		}
+	}
+}
+
+func TestMakeRouteConfigForExtAuthz(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                string
+		policy              string
+		wantPerFilterConfig string
+	}{
+		{
+			// The operation is sent in the header set by the Path Matcher filter.
+			desc: "Ext authz is enabled for the operation",
+		},
+		{
+			desc:   "Ext authz is disabled for the operation",
+			policy: `{"operations": {"endpoints.examples.bookstore.Bookstore.ListShelves": {"ext_authz": {"disabled": true}}}}`,
+			wantPerFilterConfig: `{
+  "envoy.filters.http.ext_authz": {
+    "@type": "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthzPerRoute",
+    "disabled": true
+  }
+}`,
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.ExtAuthzAddress = "grpc://127.0.0.1:9000"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: tc.policy})()
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		perFilterConfig := func(route *routepb.Route) string {
+			marshaler := &jsonpb.Marshaler{AnyResolver: util.Resolver}
+			gotJson, err := marshaler.MarshalToString(route)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotPerFilterConfig struct {
+				TypedPerFilterConfig json.RawMessage `json:"typedPerFilterConfig"`
+			}
+			if err := json.Unmarshal([]byte(gotJson), &gotPerFilterConfig); err != nil {
+				t.Fatal(err)
+			}
+			return normalizeJson(string(gotPerFilterConfig.TypedPerFilterConfig))
+		}
+
+		// The first route is the operation route, the last one is the catch-all route.
+		routes := gotRoute.GetVirtualHosts()[0].GetRoutes()
+		if got, want := perFilterConfig(routes[0]), normalizeJson(tc.wantPerFilterConfig); got != want {
+			t.Errorf("Test Desc(%d): %s, makeRouteConfig failed,\ngot typedPerFilterConfig: %s,\nwant typedPerFilterConfig: %s", i, tc.desc, got, want)
+		}
+		// The requests without operation are still authorized.
+		if got, want := perFilterConfig(routes[len(routes)-1]), normalizeJson(""); got != want {
+			t.Errorf("Test Desc(%d): %s, makeRouteConfig failed,\ngot catch-all typedPerFilterConfig: %s,\nwant: %s", i, tc.desc, got, want)
+		}
+
+		wantHeadersToRemove := []string{util.ExtAuthzOperationHeader}
+		if got := gotRoute.GetVirtualHosts()[0].GetRequestHeadersToRemove(); !cmp.Equal(got, wantHeadersToRemove) {
+			t.Errorf("Test Desc(%d): %s, got request headers to remove: %v, want: %v", i, tc.desc, got, wantHeadersToRemove)
+		}
+	}
+}
+
+func TestMakeRouteConfigForHeaders(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+			},
+		},
+	}
+	fakeDynamicRoutingServiceConfig := proto.Clone(fakeServiceConfig).(*confpb.Service)
+	fakeDynamicRoutingServiceConfig.Backend = &confpb.Backend{
+		Rules: []*confpb.BackendRule{
+			{
+				Selector:        "endpoints.examples.bookstore.Bookstore.ListShelves",
+				Address:         "https://mybackend.com",
+				PathTranslation: confpb.BackendRule_APPEND_PATH_TO_ADDRESS,
+				Authentication: &confpb.BackendRule_JwtAudience{
+					JwtAudience: "mybackend.com",
+				},
+			},
+		},
+	}
+	policy := `{
+  "default": {
+    "headers": {
+      "response_headers_to_remove": ["X-Internal-Debug"]
+    }
+  },
+  "operations": {
+    "endpoints.examples.bookstore.Bookstore.ListShelves": {
+      "headers": {
+        "request_headers_to_add": [{"name": "X-Backend-Key", "value": "secret"}],
+        "request_headers_to_remove": ["X-Internal-User"],
+        "response_headers_to_add": [{"name": "Cache-Control", "value": "max-age=60", "append": true}]
+      }
+    }
+  }
+}`
+	operationHeaders := `
+    "requestHeadersToAdd": [
+      {
+        "append": false,
+        "header": {
+          "key": "X-Backend-Key",
+          "value": "secret"
+        }
+      }
+    ],
+    "requestHeadersToRemove": ["X-Internal-User"],
+    "responseHeadersToAdd": [
+      {
+        "append": true,
+        "header": {
+          "key": "Cache-Control",
+          "value": "max-age=60"
+        }
+      }
+    ],`
+
+	testData := []struct {
+		desc              string
+		fakeServiceConfig *confpb.Service
+		wantRoutes        string
+	}{
+		{
+			desc:              "Operation headers override the default headers, which apply to the catch-all route",
+			fakeServiceConfig: fakeServiceConfig,
+			wantRoutes: `[
+  {
+    "decorator": {
+      "operation": "endpoints.examples.bookstore.Bookstore.ListShelves"
+    },
+    "match": {
+      "headers": [
+        {
+          "exactMatch": "GET",
+          "name": ":method"
+        }
+      ],
+      "path": "/v1/shelves"
+    },` + operationHeaders + `
+    "route": {
+      "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+      "timeout": "15s"
+    }
+  },
+  {
+    "match": {
+      "prefix": "/"
+    },
+    "responseHeadersToRemove": ["X-Internal-Debug"],
+    "route": {
+      "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+      "timeout": "15s"
+    }
+  }
+]`,
+		},
+		{
+			desc:              "Operation headers apply to the dynamic routing route",
+			fakeServiceConfig: fakeDynamicRoutingServiceConfig,
+			wantRoutes: `[
+  {
+    "decorator": {
+      "operation": "endpoints.examples.bookstore.Bookstore.ListShelves"
+    },
+    "match": {
+      "headers": [
+        {
+          "exactMatch": "GET",
+          "name": ":method"
+        }
+      ],
+      "path": "/v1/shelves"
+    },` + operationHeaders + `
+    "route": {
+      "cluster": "mybackend.com:443",
+      "hostRewrite": "mybackend.com",
+      "timeout": "15s"
+    }
+  }
+]`,
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: policy})()
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		marshaler := &jsonpb.Marshaler{}
+		var gotRoutes []string
+		for _, route := range gotRoute.GetVirtualHosts()[0].GetRoutes() {
+			gotJson, err := marshaler.MarshalToString(route)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotRoutes = append(gotRoutes, gotJson)
+		}
+
+		got := normalizeJson(`{"routes":[` + strings.Join(gotRoutes, ",") + `]}`)
+		if want := normalizeJson(`{"routes":` + tc.wantRoutes + `}`); got != want {
+			t.Errorf("Test Desc(%d): %s, makeRouteConfig failed,\ngot routes: %s,\nwant routes: %s", i, tc.desc, got, want)
+		}
+	}
+}
+
+func TestMakeRouteConfigForSecurityHeaders(t *testing.T) {
+	testData := []struct {
+		desc                        string
+		preset                      string
+		overrides                   string
+		wantResponseHeadersToAdd    map[string]string
+		wantResponseHeadersToRemove []string
+		wantedError                 string
+	}{
+		{
+			desc:   "No security headers by default",
+			preset: "off",
+		},
+		{
+			desc:   "Basic preset",
+			preset: "basic",
+			wantResponseHeadersToAdd: map[string]string{
+				"Strict-Transport-Security": "max-age=31536000",
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "SAMEORIGIN",
+				"Referrer-Policy":           "strict-origin-when-cross-origin",
+			},
+			wantResponseHeadersToRemove: []string{"server"},
+		},
+		{
+			desc:      "Strict preset with overrides",
+			preset:    "strict",
+			overrides: `{"x-frame-options": "SAMEORIGIN", "Referrer-Policy": "", "Permissions-Policy": "camera=()", "Server": "bookstore"}`,
+			wantResponseHeadersToAdd: map[string]string{
+				"Strict-Transport-Security": "max-age=63072000; includeSubDomains; preload",
+				"X-Content-Type-Options":    "nosniff",
+				"x-frame-options":           "SAMEORIGIN",
+				"Permissions-Policy":        "camera=()",
+			},
+		},
+		{
+			desc:      "Overrides without preset",
+			preset:    "off",
+			overrides: `{"X-Content-Type-Options": "nosniff"}`,
+			wantResponseHeadersToAdd: map[string]string{
+				"X-Content-Type-Options": "nosniff",
+			},
+		},
+		{
+			desc:        "Unknown preset",
+			preset:      "paranoid",
+			wantedError: `security_headers_preset must be one of "off", "basic" and "strict", got "paranoid"`,
+		},
+		{
+			desc:        "Overriding CORS headers",
+			preset:      "basic",
+			overrides:   `{"Access-Control-Allow-Origin": "*"}`,
+			wantedError: "security_headers_overrides cannot set CORS header Access-Control-Allow-Origin",
+		},
+		{
+			desc:        "Invalid overrides",
+			preset:      "basic",
+			overrides:   `["X-Frame-Options"]`,
+			wantedError: "fail to unmarshal security_headers_overrides",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.SecurityHeadersPreset = tc.preset
+		opts.SecurityHeadersOverrides = tc.overrides
+		// The security headers do not interfere with the CORS policy.
+		opts.CorsPreset = "basic"
+		opts.CorsAllowOrigin = "http://example.com"
+
+		gotRoute, err := MakeRouteConfig(&configinfo.ServiceInfo{
+			Name:    "test-api",
+			Options: opts,
+		})
+		if tc.wantedError != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantedError) {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotHost := gotRoute.GetVirtualHosts()[0]
+		if gotHost.GetCors() == nil {
+			t.Errorf("Test Desc(%d): %s, got no CORS policy", i, tc.desc)
+		}
+		gotResponseHeadersToAdd := map[string]string{}
+		for _, header := range gotHost.GetResponseHeadersToAdd() {
+			if header.GetAppend().GetValue() {
+				t.Errorf("Test Desc(%d): %s, header %s is appended instead of overwritten", i, tc.desc, header.GetHeader().GetKey())
+			}
+			gotResponseHeadersToAdd[header.GetHeader().GetKey()] = header.GetHeader().GetValue()
+		}
+		if tc.wantResponseHeadersToAdd == nil {
+			tc.wantResponseHeadersToAdd = map[string]string{}
+		}
+		if !cmp.Equal(gotResponseHeadersToAdd, tc.wantResponseHeadersToAdd) {
+			t.Errorf("Test Desc(%d): %s, got ResponseHeadersToAdd: %v, want: %v", i, tc.desc, gotResponseHeadersToAdd, tc.wantResponseHeadersToAdd)
+		}
+		if !cmp.Equal(gotHost.GetResponseHeadersToRemove(), tc.wantResponseHeadersToRemove) {
+			t.Errorf("Test Desc(%d): %s, got ResponseHeadersToRemove: %v, want: %v", i, tc.desc, gotHost.GetResponseHeadersToRemove(), tc.wantResponseHeadersToRemove)
+		}
+	}
+}
+
+func TestMakeRouteConfigForCorsPolicies(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "DeleteUser",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.DeleteUser",
+					Pattern: &annotationspb.HttpRule_Delete{
+						Delete: "/admin/users/{user}",
+					},
+				},
+			},
+		},
+		Endpoints: []*confpb.Endpoint{
+			{
+				Name:      testProjectName,
+				AllowCors: true,
+			},
+		},
+	}
+	policies := `{
+  "default": {
+    "allow_origins": ["https://a.example.com", "https://b.example.com"],
+    "allow_methods": "GET,POST",
+    "max_age": 600
+  },
+  "apis": {
+    "endpoints.examples.bookstore.Bookstore": {
+      "allow_credentials": true
+    }
+  },
+  "path_prefixes": {
+    "/admin": {
+      "allow_origin_regexes": ["https://.*\\.admin\\.example\\.com"],
+      "allow_methods": "DELETE"
+    }
+  }
+}`
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendProtocol = "http"
+	defer testutil.WriteTempFiles(t, map[*string]string{&opts.CorsPolicyPath: policies})()
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaler := &jsonpb.Marshaler{}
+	gotHost, err := marshaler.MarshalToString(gotRoute.GetVirtualHosts()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each operation route carries the policy of its API or path prefix, with
+	// the unset fields taken from the default policy, and the preflight route
+	// of /admin covers the paths without an operation.
+	adminCors := `
+        "cors": {
+          "allowCredentials": false,
+          "allowMethods": "DELETE",
+          "allowOriginStringMatch": [
+            {
+              "safeRegex": {
+                "googleRe2": {
+                  "maxProgramSize": 1000
+                },
+                "regex": "https://.*\\.admin\\.example\\.com"
+              }
+            }
+          ],
+          "maxAge": "600"
+        }`
+	wantHost := `{
+  "cors": {
+    "allowCredentials": false,
+    "allowMethods": "GET,POST",
+    "allowOriginStringMatch": [
+      {
+        "exact": "https://a.example.com"
+      },
+      {
+        "exact": "https://b.example.com"
+      }
+    ],
+    "maxAge": "600"
+  },
+  "domains": ["*"],
+  "name": "backend",
+  "routes": [
+    {
+      "decorator": {
+        "operation": "endpoints.examples.bookstore.Bookstore.CORS_v1_shelves"
+      },
+      "match": {
+        "headers": [
+          {
+            "exactMatch": "OPTIONS",
+            "name": ":method"
+          }
+        ],
+        "path": "/v1/shelves"
+      },
+      "route": {
+        "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+        "cors": {
+          "allowCredentials": true,
+          "allowMethods": "GET,POST",
+          "allowOriginStringMatch": [
+            {
+              "exact": "https://a.example.com"
+            },
+            {
+              "exact": "https://b.example.com"
+            }
+          ],
+          "maxAge": "600"
+        },
+        "timeout": "15s"
+      }
+    },
+    {
+      "decorator": {
+        "operation": "endpoints.examples.bookstore.Bookstore.ListShelves"
+      },
+      "match": {
+        "headers": [
+          {
+            "exactMatch": "GET",
+            "name": ":method"
+          }
+        ],
+        "path": "/v1/shelves"
+      },
+      "route": {
+        "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+        "cors": {
+          "allowCredentials": true,
+          "allowMethods": "GET,POST",
+          "allowOriginStringMatch": [
+            {
+              "exact": "https://a.example.com"
+            },
+            {
+              "exact": "https://b.example.com"
+            }
+          ],
+          "maxAge": "600"
+        },
+        "timeout": "15s"
+      }
+    },
+    {
+      "decorator": {
+        "operation": "endpoints.examples.bookstore.Bookstore.CORS_admin_users_user"
+      },
+      "match": {
+        "headers": [
+          {
+            "exactMatch": "OPTIONS",
+            "name": ":method"
+          }
+        ],
+        "safeRegex": {
+          "googleRe2": {
+            "maxProgramSize": 1000
+          },
+          "regex": "/admin/users/[^\\/]+$"
+        }
+      },
+      "route": {
+        "cluster": "bookstore.endpoints.project123.cloud.goog_local",` + adminCors + `,
+        "timeout": "15s"
+      }
+    },
+    {
+      "decorator": {
+        "operation": "endpoints.examples.bookstore.Bookstore.DeleteUser"
+      },
+      "match": {
+        "headers": [
+          {
+            "exactMatch": "DELETE",
+            "name": ":method"
+          }
+        ],
+        "safeRegex": {
+          "googleRe2": {
+            "maxProgramSize": 1000
+          },
+          "regex": "/admin/users/[^\\/]+$"
+        }
+      },
+      "route": {
+        "cluster": "bookstore.endpoints.project123.cloud.goog_local",` + adminCors + `,
+        "timeout": "15s"
+      }
+    },
+    {
+      "match": {
+        "headers": [
+          {
+            "exactMatch": "OPTIONS",
+            "name": ":method"
+          }
+        ],
+        "prefix": "/admin"
+      },
+      "route": {
+        "cluster": "bookstore.endpoints.project123.cloud.goog_local",` + adminCors + `
+      }
+    },
+    {
+      "match": {
+        "prefix": "/"
+      },
+      "route": {
+        "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+        "timeout": "15s"
+      }
+    },
+    {
+      "match": {
+        "headers": [
+          {
+            "exactMatch": "OPTIONS",
+            "name": ":method"
+          }
+        ],
+        "prefix": "/"
+      },
+      "route": {
+        "cluster": "bookstore.endpoints.project123.cloud.goog_local"
+      }
+    }
+  ]
+}`
+	if got, want := normalizeJson(gotHost), normalizeJson(wantHost); got != want {
+		t.Errorf("makeRouteConfig failed,\ngot virtual host: %s,\nwant: %s", got, want)
+	}
+}
+
+func TestMakeRouteConfigForRateLimits(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Control: &confpb.Control{
+			Environment: "servicecontrol.googleapis.com",
+		},
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+					Pattern: &annotationspb.HttpRule_Post{
+						Post: "/v1/shelves",
+					},
+				},
+			},
+		},
+	}
+	policy := `{
+  "operations": {
+    "endpoints.examples.bookstore.Bookstore.CreateShelf": {
+      "rate_limit": {"descriptors": [["operation", "api_key"], ["jwt_sub"], ["client_ip"]]}
+    }
+  }
+}`
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendProtocol = "http"
+	opts.RateLimitServiceAddress = "grpc://ratelimit:8081"
+	defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: policy})()
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := gotRoute.GetVirtualHosts()[0]
+	wantHeadersToRemove := []string{"x-esp-v2-rate-limit-api-key", "x-esp-v2-rate-limit-jwt-sub"}
+	if !cmp.Equal(host.GetRequestHeadersToRemove(), wantHeadersToRemove) {
+		t.Errorf("makeRouteConfig failed, got request headers to remove: %v, want: %v", host.GetRequestHeadersToRemove(), wantHeadersToRemove)
+	}
+
+	marshaler := &jsonpb.Marshaler{}
+	gotRateLimits := make(map[string]string)
+	for _, route := range host.GetRoutes() {
+		gotJson, err := marshaler.MarshalToString(route.GetRoute())
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotRateLimits[route.GetDecorator().GetOperation()] = normalizeJson(gotJson)
+	}
+
+	// The catch-all route has no operation and no rate limit.
+	wantRateLimits := map[string]string{
+		"": `{
+  "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+  "timeout": "15s"
+}`,
+		"endpoints.examples.bookstore.Bookstore.ListShelves": `{
+  "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+  "rateLimits": [
+    {
+      "actions": [
+        {
+          "genericKey": {
+            "descriptorValue": "endpoints.examples.bookstore.Bookstore.ListShelves"
+          }
+        }
+      ]
+    }
+  ],
+  "timeout": "15s"
+}`,
+		"endpoints.examples.bookstore.Bookstore.CreateShelf": `{
+  "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+  "rateLimits": [
+    {
+      "actions": [
+        {
+          "genericKey": {
+            "descriptorValue": "endpoints.examples.bookstore.Bookstore.CreateShelf"
+          }
+        },
+        {
+          "requestHeaders": {
+            "descriptorKey": "api_key",
+            "headerName": "x-esp-v2-rate-limit-api-key"
+          }
+        }
+      ]
+    },
+    {
+      "actions": [
+        {
+          "requestHeaders": {
+            "descriptorKey": "jwt_sub",
+            "headerName": "x-esp-v2-rate-limit-jwt-sub"
+          }
+        }
+      ]
+    },
+    {
+      "actions": [
+        {
+          "remoteAddress": {}
+        }
+      ]
+    }
+  ],
+  "timeout": "15s"
+}`,
+	}
+	for operation, want := range wantRateLimits {
+		if got := gotRateLimits[operation]; got != normalizeJson(want) {
+			t.Errorf("makeRouteConfig failed for operation %q,\ngot route action: %s,\nwant: %s", operation, got, normalizeJson(want))
+		}
+	}
+}
+
+func TestMakeRouteConfigForRequestBodyLimits(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "UploadBook",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.UploadBook",
+					Pattern: &annotationspb.HttpRule_Post{
+						Post: "/v1/books",
+					},
+				},
+			},
+		},
+	}
+	policy := `{
+  "operations": {
+    "endpoints.examples.bookstore.Bookstore.UploadBook": {
+      "request_body": {"max_request_bytes": 52428800}
+    }
+  }
+}`
+	uploadBookBuffer := `{
+  "envoy.buffer": {
+    "@type": "type.googleapis.com/envoy.config.filter.http.buffer.v2.BufferPerRoute",
+    "buffer": {
+      "maxRequestBytes": 52428800
+    }
+  }
+}`
+
+	testData := []struct {
+		desc            string
+		maxRequestBytes uint64
+		// Typed per filter configs of the virtual host and of the routes,
+		// keyed by operation.
+		wantHostConfig   string
+		wantRouteConfigs map[string]string
+	}{
+		{
+			desc:            "Global limit, overridden for one operation",
+			maxRequestBytes: 1048576,
+			wantRouteConfigs: map[string]string{
+				"endpoints.examples.bookstore.Bookstore.UploadBook":  uploadBookBuffer,
+				"endpoints.examples.bookstore.Bookstore.ListShelves": "",
+			},
+		},
+		{
+			desc: "No global limit, the virtual host disables buffering",
+			wantHostConfig: `{
+  "envoy.buffer": {
+    "@type": "type.googleapis.com/envoy.config.filter.http.buffer.v2.BufferPerRoute",
+    "disabled": true
+  }
+}`,
+			wantRouteConfigs: map[string]string{
+				"endpoints.examples.bookstore.Bookstore.UploadBook":  uploadBookBuffer,
+				"endpoints.examples.bookstore.Bookstore.ListShelves": "",
+			},
+		},
+	}
+
+	marshalConfigs := func(configs map[string]*anypb.Any) string {
+		if len(configs) == 0 {
+			return ""
+		}
+		var fields []string
+		for name, config := range configs {
+			gotJson, err := (&jsonpb.Marshaler{}).MarshalToString(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields = append(fields, fmt.Sprintf("%q: %s", name, gotJson))
+		}
+		return normalizeJson("{" + strings.Join(fields, ",") + "}")
+	}
+	normalize := func(want string) string {
+		if want == "" {
+			return ""
+		}
+		return normalizeJson(want)
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.MaxRequestBytes = tc.maxRequestBytes
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: policy})()
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		host := gotRoute.GetVirtualHosts()[0]
+		if got, want := marshalConfigs(host.GetTypedPerFilterConfig()), normalize(tc.wantHostConfig); got != want {
+			t.Errorf("Test Desc(%d): %s, makeRouteConfig failed,\ngot virtual host configs: %s,\nwant: %s", i, tc.desc, got, want)
+		}
+		for _, route := range host.GetRoutes() {
+			operation := route.GetDecorator().GetOperation()
+			wantConfig, ok := tc.wantRouteConfigs[operation]
+			if !ok {
+				continue
+			}
+			if got, want := marshalConfigs(route.GetTypedPerFilterConfig()), normalize(wantConfig); got != want {
+				t.Errorf("Test Desc(%d): %s, makeRouteConfig failed for operation %s,\ngot route configs: %s,\nwant: %s", i, tc.desc, operation, got, want)
+			}
+		}
+	}
+}
+
+func TestMakeRouteConfigForWebsocket(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "StreamBooks",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.StreamBooks",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/books:stream",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc            string
+		enableWebsocket bool
+		maxRequestBytes uint64
+		policy          string
+		// Actions of the regular routes keyed by operation, the catch-all
+		// route has no operation. The operations without settings of their
+		// own have no route.
+		wantActions map[string]string
+		// Actions of the WebSocket upgrade routes keyed by operation.
+		wantWebsocketActions map[string]string
+	}{
+		{
+			desc:            "Enabled globally, disabled for one operation",
+			enableWebsocket: true,
+			maxRequestBytes: 1048576,
+			policy:          `{"operations": {"endpoints.examples.bookstore.Bookstore.ListShelves": {"websocket": {"enabled": false}}}}`,
+			wantActions: map[string]string{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": `{
+  "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+  "timeout": "15s"
+}`,
+				"": `{
+  "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+  "timeout": "15s"
+}`,
+			},
+			wantWebsocketActions: map[string]string{
+				"": `{
+  "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+  "timeout": "0s",
+  "idleTimeout": "3600s",
+  "upgradeConfigs": [
+    {
+      "upgradeType": "websocket",
+      "enabled": true
+    }
+  ]
+}`,
+			},
+		},
+		{
+			desc:   "Enabled for one operation",
+			policy: `{"operations": {"endpoints.examples.bookstore.Bookstore.StreamBooks": {"websocket": {"enabled": true}}}}`,
+			wantActions: map[string]string{
+				"endpoints.examples.bookstore.Bookstore.StreamBooks": `{
+  "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+  "timeout": "15s"
+}`,
+				"": `{
+  "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+  "timeout": "15s"
+}`,
+			},
+			wantWebsocketActions: map[string]string{
+				"endpoints.examples.bookstore.Bookstore.StreamBooks": `{
+  "cluster": "bookstore.endpoints.project123.cloud.goog_local",
+  "timeout": "0s",
+  "idleTimeout": "3600s",
+  "upgradeConfigs": [
+    {
+      "upgradeType": "websocket",
+      "enabled": true
+    }
+  ]
+}`,
+			},
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.EnableWebsocket = tc.enableWebsocket
+		opts.MaxRequestBytes = tc.maxRequestBytes
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: tc.policy})()
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotActions := make(map[string]string)
+		gotWebsocketActions := make(map[string]string)
+		for _, route := range gotRoute.GetVirtualHosts()[0].GetRoutes() {
+			if route.GetRoute() == nil {
+				continue
+			}
+			operation := route.GetDecorator().GetOperation()
+			gotAction, err := (&jsonpb.Marshaler{}).MarshalToString(route.GetRoute())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			isWebsocket := false
+			for _, h := range route.GetMatch().GetHeaders() {
+				if h.GetName() == util.UpgradeHeader {
+					isWebsocket = true
+				}
+			}
+			_, unbuffered := route.GetTypedPerFilterConfig()[util.Buffer]
+			if isWebsocket {
+				gotWebsocketActions[operation] = normalizeJson(gotAction)
+				if unbuffered != (tc.maxRequestBytes > 0) {
+					t.Errorf("Test Desc(%d): %s, WebSocket route of operation %q disables buffering: %v, want: %v", i, tc.desc, operation, unbuffered, tc.maxRequestBytes > 0)
+				}
+			} else {
+				gotActions[operation] = normalizeJson(gotAction)
+				if unbuffered {
+					t.Errorf("Test Desc(%d): %s, regular route of operation %q should not disable buffering", i, tc.desc, operation)
+				}
+			}
+		}
+
+		if len(gotActions) != len(tc.wantActions) {
+			t.Errorf("Test Desc(%d): %s, got routes: %v, want: %v", i, tc.desc, gotActions, tc.wantActions)
+		}
+		for operation, wantAction := range tc.wantActions {
+			if got, want := gotActions[operation], normalizeJson(wantAction); got != want {
+				t.Errorf("Test Desc(%d): %s, makeRouteConfig failed for operation %q,\ngot route action: %s,\nwant: %s", i, tc.desc, operation, got, want)
+			}
+		}
+		if len(gotWebsocketActions) != len(tc.wantWebsocketActions) {
+			t.Errorf("Test Desc(%d): %s, got WebSocket routes: %v, want: %v", i, tc.desc, gotWebsocketActions, tc.wantWebsocketActions)
+		}
+		for operation, wantAction := range tc.wantWebsocketActions {
+			if got, want := gotWebsocketActions[operation], normalizeJson(wantAction); got != want {
+				t.Errorf("Test Desc(%d): %s, makeRouteConfig failed for the WebSocket route of operation %q,\ngot route action: %s,\nwant: %s", i, tc.desc, operation, got, want)
+			}
+		}
+	}
+}
+
+func TestMakeRouteConfigForStreamingIdleTimeout(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name:              "StreamShelves",
+						ResponseStreaming: true,
+					},
+				},
+			},
+		},
+		// The streaming methods only have no response timeout with dynamic
+		// routing, the catch-all routes keep the default deadline.
+		Backend: &confpb.Backend{
+			Rules: []*confpb.BackendRule{
+				{
+					Selector:        "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Address:         "grpcs://mybackend.com",
+					PathTranslation: confpb.BackendRule_APPEND_PATH_TO_ADDRESS,
+				},
+				{
+					Selector:        "endpoints.examples.bookstore.Bookstore.StreamShelves",
+					Address:         "grpcs://mybackend.com",
+					PathTranslation: confpb.BackendRule_APPEND_PATH_TO_ADDRESS,
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                 string
+		streamingIdleTimeout time.Duration
+		// Route actions keyed by operation.
+		wantActions map[string]string
+	}{
+		{
+			desc: "Streaming methods only disable the response timeout by default",
+			wantActions: map[string]string{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": `{
+  "cluster": "mybackend.com:443",
+  "hostRewrite": "mybackend.com",
+  "timeout": "15s"
+}`,
+				"endpoints.examples.bookstore.Bookstore.StreamShelves": `{
+  "cluster": "mybackend.com:443",
+  "hostRewrite": "mybackend.com",
+  "timeout": "0s"
+}`,
+			},
+		},
+		{
+			desc:                 "Streaming methods have an idle timeout",
+			streamingIdleTimeout: 30 * time.Minute,
+			wantActions: map[string]string{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": `{
+  "cluster": "mybackend.com:443",
+  "hostRewrite": "mybackend.com",
+  "timeout": "15s"
+}`,
+				"endpoints.examples.bookstore.Bookstore.StreamShelves": `{
+  "cluster": "mybackend.com:443",
+  "hostRewrite": "mybackend.com",
+  "timeout": "0s",
+  "idleTimeout": "1800s"
+}`,
+			},
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "grpc"
+		opts.StreamingIdleTimeout = tc.streamingIdleTimeout
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, route := range gotRoute.GetVirtualHosts()[0].GetRoutes() {
+			operation := route.GetDecorator().GetOperation()
+			wantAction, ok := tc.wantActions[operation]
+			if !ok {
+				continue
+			}
+			gotAction, err := (&jsonpb.Marshaler{}).MarshalToString(route.GetRoute())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := normalizeJson(gotAction), normalizeJson(wantAction); got != want {
+				t.Errorf("Test Desc(%d): %s, makeRouteConfig failed for operation %q,\ngot route action: %s,\nwant: %s", i, tc.desc, operation, got, want)
+			}
+		}
+	}
+}
+
+func TestMakeRouteConfigForPathHardening(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "GetShelf",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves/{shelf}",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                    string
+		rejectEncodedSlashes    bool
+		trailingSlashMatching   bool
+		caseInsensitiveMatching bool
+		// Route matchers without the method header, in the order of the path
+		// matcher. The catch-all route is not included.
+		wantMatches []string
+	}{
+		{
+			desc: "Exact paths by default",
+			wantMatches: []string{
+				`{"path": "/v1/shelves"}`,
+				`{"safeRegex": {"googleRe2": {"maxProgramSize": 1000}, "regex": "/v1/shelves/[^\\/]+$"}}`,
+			},
+		},
+		{
+			desc:                  "Encoded slashes are rejected, trailing slashes are allowed",
+			rejectEncodedSlashes:  true,
+			trailingSlashMatching: true,
+			wantMatches: []string{
+				`{"safeRegex": {"googleRe2": {"maxProgramSize": 1000}, "regex": ".*%(2[fF]|5[cC]).*"}}`,
+				`{"safeRegex": {"googleRe2": {"maxProgramSize": 1000}, "regex": "/v1/shelves/*$"}}`,
+				`{"safeRegex": {"googleRe2": {"maxProgramSize": 1000}, "regex": "/v1/shelves/[^\\/]+/*$"}}`,
+			},
+		},
+		{
+			desc:                    "Case-insensitive matching, also in the regexes ignoring case_sensitive",
+			caseInsensitiveMatching: true,
+			wantMatches: []string{
+				`{"path": "/v1/shelves", "caseSensitive": false}`,
+				`{"safeRegex": {"googleRe2": {"maxProgramSize": 1000}, "regex": "(?i)/v1/shelves/[^\\/]+$"}, "caseSensitive": false}`,
+			},
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.RejectEncodedSlashes = tc.rejectEncodedSlashes
+		opts.TrailingSlashMatching = tc.trailingSlashMatching
+		opts.CaseInsensitiveMatching = tc.caseInsensitiveMatching
+		// Both operations have their own sampling, so they have a route.
+		defer testutil.WriteTempFiles(t, map[*string]string{
+			&opts.OperationPolicyPath: `{"operations": {
+  "endpoints.examples.bookstore.Bookstore.ListShelves": {"tracing": {"random_sampling": 10}},
+  "endpoints.examples.bookstore.Bookstore.GetShelf": {"tracing": {"random_sampling": 10}}
+}}`,
+		})()
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		routes := gotRoute.GetVirtualHosts()[0].GetRoutes()
+		// Skip the catch-all route.
+		routes = routes[:len(routes)-1]
+		if len(routes) != len(tc.wantMatches) {
+			t.Fatalf("Test Desc(%d): %s, got %d routes, want: %d", i, tc.desc, len(routes), len(tc.wantMatches))
+		}
+		for j, route := range routes {
+			match := proto.Clone(route.GetMatch()).(*routepb.RouteMatch)
+			match.Headers = nil
+			gotMatch, err := (&jsonpb.Marshaler{}).MarshalToString(match)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := normalizeJson(gotMatch), normalizeJson(tc.wantMatches[j]); got != want {
+				t.Errorf("Test Desc(%d): %s, makeRouteConfig failed for route %d,\ngot match: %s,\nwant: %s", i, tc.desc, j, got, want)
+			}
+		}
+		if tc.rejectEncodedSlashes {
+			if got := routes[0].GetDirectResponse().GetStatus(); got != http.StatusBadRequest {
+				t.Errorf("Test Desc(%d): %s, got direct response status: %d, want: %d", i, tc.desc, got, http.StatusBadRequest)
+			}
+		}
+	}
+}
+
+func TestMakeRouteConfigForMirror(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+					{
+						Name:              "StreamShelves",
+						ResponseStreaming: true,
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+					Pattern: &annotationspb.HttpRule_Post{
+						Post: "/v1/shelves",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.StreamShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/v1/shelves:stream",
+					},
+				},
+			},
+		},
+	}
+	listShelvesMirror := `{
+  "cluster": "mirror-backend-cluster",
+  "runtimeFraction": {
+    "defaultValue": {
+      "numerator": 100000,
+      "denominator": "MILLION"
+    },
+    "runtimeKey": "mirror.endpoints.examples.bookstore.Bookstore.ListShelves"
+  }
+}`
+
+	testData := []struct {
+		desc                    string
+		mirrorPercent           float64
+		mirrorSkipNonIdempotent bool
+		enableWebsocket         bool
+		policy                  string
+		// Request mirror policies keyed by operation, the WebSocket upgrade
+		// routes are never mirrored.
+		wantMirrorPolicies map[string]string
+		wantError          string
+	}{
+		{
+			desc:          "Global percentage, streaming methods are not mirrored",
+			mirrorPercent: 10,
+			wantMirrorPolicies: map[string]string{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": listShelvesMirror,
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": `{
+  "cluster": "mirror-backend-cluster",
+  "runtimeFraction": {
+    "defaultValue": {
+      "numerator": 100000,
+      "denominator": "MILLION"
+    },
+    "runtimeKey": "mirror.endpoints.examples.bookstore.Bookstore.CreateShelf"
+  }
+}`,
+				"endpoints.examples.bookstore.Bookstore.StreamShelves": "",
+			},
+		},
+		{
+			desc:                    "Non-idempotent methods are skipped",
+			mirrorPercent:           10,
+			mirrorSkipNonIdempotent: true,
+			wantMirrorPolicies: map[string]string{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": listShelvesMirror,
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": "",
+			},
+		},
+		{
+			desc:   "Mirroring only one operation",
+			policy: `{"operations": {"endpoints.examples.bookstore.Bookstore.ListShelves": {"mirror": {"percent": 10}}}}`,
+			wantMirrorPolicies: map[string]string{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": listShelvesMirror,
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": "",
+			},
+		},
+		{
+			desc:            "WebSocket upgrade routes are not mirrored",
+			mirrorPercent:   10,
+			enableWebsocket: true,
+			wantMirrorPolicies: map[string]string{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": listShelvesMirror,
+			},
+		},
+		{
+			desc:          "Global percentage out of range",
+			mirrorPercent: 101,
+			wantError:     "mirror_percent must be >= 0 and <= 100, got 101",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.MirrorBackendAddress = "http://bookstore-v2:8080"
+		opts.MirrorPercent = tc.mirrorPercent
+		opts.MirrorSkipNonIdempotent = tc.mirrorSkipNonIdempotent
+		opts.EnableWebsocket = tc.enableWebsocket
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: tc.policy})()
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if tc.wantError != "" {
+			if err == nil || err.Error() != tc.wantError {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, route := range gotRoute.GetVirtualHosts()[0].GetRoutes() {
+			operation := route.GetDecorator().GetOperation()
+			wantMirrorPolicy, ok := tc.wantMirrorPolicies[operation]
+			if !ok {
+				continue
+			}
+			if len(route.GetRoute().GetUpgradeConfigs()) > 0 {
+				wantMirrorPolicy = ""
+			}
+			gotMirrorPolicy := ""
+			if mirrorPolicy := route.GetRoute().GetRequestMirrorPolicy(); mirrorPolicy != nil {
+				gotJson, err := (&jsonpb.Marshaler{}).MarshalToString(mirrorPolicy)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gotMirrorPolicy = normalizeJson(gotJson)
+			}
+			if wantMirrorPolicy != "" {
+				wantMirrorPolicy = normalizeJson(wantMirrorPolicy)
+			}
+			if gotMirrorPolicy != wantMirrorPolicy {
+				t.Errorf("Test Desc(%d): %s, makeRouteConfig failed for operation %s,\ngot request mirror policy: %s,\nwant: %s", i, tc.desc, operation, gotMirrorPolicy, wantMirrorPolicy)
+			}
+		}
+	}
+}
+
+func TestMakeRouteConfigForBackendSplits(t *testing.T) {
+	testData := []struct {
+		desc         string
+		backendRules []*confpb.BackendRule
+		split        string
+		wantHost     string
+	}{
+		{
+			desc:  "Catch-all split, the pinned route is placed first",
+			split: `{"catch_all": {"backends": [{"address": "http://127.0.0.1:8082", "weight": 95}, {"address": "http://bookstore-v2:8080", "weight": 5, "pin_header": {"name": "x-canary", "value": "true"}}]}}`,
+			wantHost: `{
+  "name": "backend",
+  "domains": ["*"],
+  "routes": [
+    {
+      "match": {
+        "prefix": "/",
+        "headers": [
+          {
+            "name": "x-canary",
+            "exactMatch": "true"
+          }
+        ]
+      },
+      "route": {
+        "cluster": "bookstore-v2:8080",
+        "timeout": "15s"
+      }
+    },
+    {
+      "match": {
+        "prefix": "/"
+      },
+      "route": {
+        "weightedClusters": {
+          "clusters": [
+            {
+              "name": "bookstore.endpoints.project123.cloud.goog_local",
+              "weight": 95
+            },
+            {
+              "name": "bookstore-v2:8080",
+              "weight": 5
+            }
+          ],
+          "totalWeight": 100
+        },
+        "timeout": "15s"
+      }
+    }
+  ]
+}`,
+		},
+		{
+			desc: "Dynamic routing split, the Host header is rewritten for the chosen backend",
+			backendRules: []*confpb.BackendRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+					Address:  "https://shelves.example.com",
+					Authentication: &confpb.BackendRule_JwtAudience{
+						JwtAudience: "https://shelves",
+					},
+				},
+			},
+			split: `{"operations": {"endpoints.examples.bookstore.Bookstore.GetShelf": {"backends": [{"address": "https://shelves.example.com", "weight": 90}, {"address": "https://shelves-canary.example.com", "weight": 10, "pin_header": {"name": "x-canary", "value": "true"}}]}}}`,
+			wantHost: `{
+  "name": "backend",
+  "domains": ["*"],
+  "routes": [
+    {
+      "match": {
+        "safeRegex": {
+          "googleRe2": {
+            "maxProgramSize": 1000
+          },
+          "regex": "/v1/shelves/[^\\/]+$"
+        },
+        "headers": [
+          {
+            "name": ":method",
+            "exactMatch": "GET"
+          },
+          {
+            "name": "x-canary",
+            "exactMatch": "true"
+          }
+        ]
+      },
+      "route": {
+        "cluster": "shelves-canary.example.com:443",
+        "autoHostRewrite": true,
+        "timeout": "15s"
+      },
+      "decorator": {
+        "operation": "endpoints.examples.bookstore.Bookstore.GetShelf"
+      }
+    },
+    {
+      "match": {
+        "safeRegex": {
+          "googleRe2": {
+            "maxProgramSize": 1000
+          },
+          "regex": "/v1/shelves/[^\\/]+$"
+        },
+        "headers": [
+          {
+            "name": ":method",
+            "exactMatch": "GET"
+          }
+        ]
+      },
+      "route": {
+        "weightedClusters": {
+          "clusters": [
+            {
+              "name": "shelves.example.com:443",
+              "weight": 90
+            },
+            {
+              "name": "shelves-canary.example.com:443",
+              "weight": 10
+            }
+          ],
+          "totalWeight": 100
+        },
+        "autoHostRewrite": true,
+        "timeout": "15s"
+      },
+      "decorator": {
+        "operation": "endpoints.examples.bookstore.Bookstore.GetShelf"
+      }
+    }
+  ]
+}`,
+		},
+		{
+			desc: "Dynamic routing split, the backend JWT audience overrides the one of the operation",
+			backendRules: []*confpb.BackendRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+					Address:  "https://shelves.example.com",
+					Authentication: &confpb.BackendRule_JwtAudience{
+						JwtAudience: "https://shelves",
+					},
+				},
+			},
+			split: `{"operations": {"endpoints.examples.bookstore.Bookstore.GetShelf": {"backends": [{"address": "https://shelves.example.com", "weight": 90}, {"address": "https://shelves-canary.example.com", "weight": 10, "jwt_audience": "https://shelves-canary", "pin_header": {"name": "x-canary", "value": "true"}}]}}}`,
+			wantHost: `{
+  "name": "backend",
+  "domains": ["*"],
+  "routes": [
+    {
+      "match": {
+        "safeRegex": {
+          "googleRe2": {
+            "maxProgramSize": 1000
+          },
+          "regex": "/v1/shelves/[^\\/]+$"
+        },
+        "headers": [
+          {
+            "name": ":method",
+            "exactMatch": "GET"
+          },
+          {
+            "name": "x-canary",
+            "exactMatch": "true"
+          }
+        ]
+      },
+      "route": {
+        "cluster": "shelves-canary.example.com:443",
+        "autoHostRewrite": true,
+        "timeout": "15s"
+      },
+      "decorator": {
+        "operation": "endpoints.examples.bookstore.Bookstore.GetShelf"
+      },
+      "typedPerFilterConfig": {
+        "envoy.filters.http.backend_auth": {
+          "@type": "type.googleapis.com/google.api.envoy.http.backend_auth.PerRouteFilterConfig",
+          "jwtAudience": "https://shelves-canary"
+        }
+      }
+    },
+    {
+      "match": {
+        "safeRegex": {
+          "googleRe2": {
+            "maxProgramSize": 1000
+          },
+          "regex": "/v1/shelves/[^\\/]+$"
+        },
+        "headers": [
+          {
+            "name": ":method",
+            "exactMatch": "GET"
+          }
+        ]
+      },
+      "route": {
+        "weightedClusters": {
+          "clusters": [
+            {
+              "name": "shelves.example.com:443",
+              "weight": 90
+            },
+            {
+              "name": "shelves-canary.example.com:443",
+              "weight": 10,
+              "typedPerFilterConfig": {
+                "envoy.filters.http.backend_auth": {
+                  "@type": "type.googleapis.com/google.api.envoy.http.backend_auth.PerRouteFilterConfig",
+                  "jwtAudience": "https://shelves-canary"
+                }
+              }
+            }
+          ],
+          "totalWeight": 100
+        },
+        "autoHostRewrite": true,
+        "timeout": "15s"
+      },
+      "decorator": {
+        "operation": "endpoints.examples.bookstore.Bookstore.GetShelf"
+      }
+    }
+  ]
+}`,
+		},
+	}
+
+	for i, tc := range testData {
+		fakeServiceConfig := &confpb.Service{
+			Name: testProjectName,
+			Apis: []*apipb.Api{
+				{
+					Name: testApiName,
+					Methods: []*apipb.Method{
+						{
+							Name: "GetShelf",
+						},
+					},
+				},
+			},
+			Http: &annotationspb.Http{
+				Rules: []*annotationspb.HttpRule{
+					{
+						Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+						Pattern: &annotationspb.HttpRule_Get{
+							Get: "/v1/shelves/{shelf}",
+						},
+					},
+				},
+			},
+			Backend: &confpb.Backend{
+				Rules: tc.backendRules,
+			},
+		}
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.BackendSplitPath: tc.split})()
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotJson, err := (&jsonpb.Marshaler{}).MarshalToString(gotRoute.GetVirtualHosts()[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if normalizeJson(gotJson) != normalizeJson(tc.wantHost) {
+			t.Errorf("Test Desc(%d): %s, makeRouteConfig failed,\ngot virtual host: %s,\nwant: %s", i, tc.desc, gotJson, tc.wantHost)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// BackendSplits is the content of the file specified by --backend_split_path.
+//
+// CatchAll splits the traffic of the catch-all backend, including the
+// operations routed to it. The splits in Operations override it, and also
+// replace the address of the BackendRule of an operation.
+type BackendSplits struct {
+	CatchAll *BackendSplit `json:"catch_all,omitempty"`
+	// Per-operation splits, using selector as key.
+	Operations map[string]*BackendSplit `json:"operations,omitempty"`
+}
+
+// BackendSplit splits the traffic of a route across weighted backends.
+type BackendSplit struct {
+	Backends []*WeightedBackend `json:"backends"`
+}
+
+// WeightedBackend is one of the backends of a BackendSplit.
+type WeightedBackend struct {
+	// Address without path, e.g. "https://bookstore-v2.example.com". The
+	// path translation of the BackendRule applies to all the backends.
+	Address string `json:"address"`
+	// Relative weight of the backend in the split.
+	Weight uint32 `json:"weight"`
+	// The requests with this header are always sent to this backend.
+	PinHeader *PinHeader `json:"pin_header,omitempty"`
+	// JWT audience of the ID token sent to the backend, overriding the one of
+	// the operation. If the JWT audience of the operation is derived from its
+	// BackendRule address, it is set by processBackendSplits to the one
+	// derived from this address when they differ.
+	JwtAudience string `json:"jwt_audience,omitempty"`
+
+	// Name of the cluster of the backend, set by processBackendSplits.
+	ClusterName string `json:"-"`
+}
+
+// PinHeader matches a request header with an exact value.
+type PinHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// readBackendSplits reads and validates the backend split file.
+func readBackendSplits(path string) (*BackendSplits, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read backend split file %s: %v", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	splits := &BackendSplits{}
+	if err := decoder.Decode(splits); err != nil {
+		return nil, fmt.Errorf("fail to unmarshal backend split file %s: %v", path, err)
+	}
+
+	if splits.CatchAll != nil {
+		if err := splits.CatchAll.validate(); err != nil {
+			return nil, fmt.Errorf("invalid catch-all backend split: %v", err)
+		}
+	}
+	for selector, split := range splits.Operations {
+		if err := split.validate(); err != nil {
+			return nil, fmt.Errorf("invalid backend split for %s: %v", selector, err)
+		}
+	}
+	return splits, nil
+}
+
+// TotalWeight returns the sum of the weights of the backends.
+func (b *BackendSplit) TotalWeight() uint32 {
+	var total uint32
+	for _, backend := range b.Backends {
+		total += backend.Weight
+	}
+	return total
+}
+
+func (b *BackendSplit) validate() error {
+	if len(b.Backends) == 0 {
+		return fmt.Errorf("backends must not be empty")
+	}
+	var total uint64
+	pinHeaders := make(map[PinHeader]bool)
+	for i, backend := range b.Backends {
+		if !strings.Contains(backend.Address, "://") {
+			return fmt.Errorf("backends[%d] address %q must have a scheme", i, backend.Address)
+		}
+		total += uint64(backend.Weight)
+		if backend.PinHeader == nil {
+			continue
+		}
+		if !headerNameRegexp.MatchString(backend.PinHeader.Name) {
+			return fmt.Errorf("backends[%d] has invalid pin_header name %q", i, backend.PinHeader.Name)
+		}
+		if pinHeaders[*backend.PinHeader] {
+			return fmt.Errorf("backends[%d] has duplicated pin_header %s: %s", i, backend.PinHeader.Name, backend.PinHeader.Value)
+		}
+		pinHeaders[*backend.PinHeader] = true
+	}
+	if total == 0 || total > 1<<32-1 {
+		return fmt.Errorf("the sum of the weights must be > 0 and fit in 32 bits, got %d", total)
+	}
+	return nil
+}
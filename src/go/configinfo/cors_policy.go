@@ -0,0 +1,163 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// CorsPolicies is the content of the file specified by --cors_policy_path.
+//
+// Default is the CORS policy of the virtual host. The policies in Apis and
+// PathPrefixes override it on the routes of an API or under a path prefix.
+// A path prefix policy takes precedence over an API policy, and the longest
+// matching prefix wins. The fields a route policy does not set fall back to
+// the default policy.
+type CorsPolicies struct {
+	Default *CorsPolicy `json:"default,omitempty"`
+	// Per-API policies, using api name as key.
+	Apis map[string]*CorsPolicy `json:"apis,omitempty"`
+	// Per-path policies, using path prefix as key.
+	PathPrefixes map[string]*CorsPolicy `json:"path_prefixes,omitempty"`
+}
+
+// CorsPolicy is one CORS policy.
+type CorsPolicy struct {
+	// Exact origins that are allowed.
+	AllowOrigins []string `json:"allow_origins,omitempty"`
+	// RE2 regexes of the origins that are allowed.
+	AllowOriginRegexes []string `json:"allow_origin_regexes,omitempty"`
+	// Values of the Access-Control-Allow-Methods, Access-Control-Allow-Headers
+	// and Access-Control-Expose-Headers headers, e.g. "GET,POST".
+	AllowMethods  string `json:"allow_methods,omitempty"`
+	AllowHeaders  string `json:"allow_headers,omitempty"`
+	ExposeHeaders string `json:"expose_headers,omitempty"`
+	// Seconds the result of a preflight request can be cached.
+	MaxAge           *uint32 `json:"max_age,omitempty"`
+	AllowCredentials *bool   `json:"allow_credentials,omitempty"`
+}
+
+// readCorsPolicies reads and validates the CORS policy file.
+func readCorsPolicies(path string) (*CorsPolicies, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read CORS policy file %s: %v", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	policies := &CorsPolicies{}
+	if err := decoder.Decode(policies); err != nil {
+		return nil, fmt.Errorf("fail to unmarshal CORS policy file %s: %v", path, err)
+	}
+
+	if policies.Default == nil {
+		return nil, fmt.Errorf("CORS policy file %s must set a default policy", path)
+	}
+	if err := policies.Default.validate(); err != nil {
+		return nil, fmt.Errorf("invalid default CORS policy: %v", err)
+	}
+	if len(policies.Default.AllowOrigins) == 0 && len(policies.Default.AllowOriginRegexes) == 0 {
+		return nil, fmt.Errorf("invalid default CORS policy: one of allow_origins and allow_origin_regexes must be set")
+	}
+	for api, policy := range policies.Apis {
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("invalid CORS policy for api %s: %v", api, err)
+		}
+		policy.inherit(policies.Default)
+	}
+	for prefix, policy := range policies.PathPrefixes {
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("CORS policy path prefix %s must start with /", prefix)
+		}
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("invalid CORS policy for path prefix %s: %v", prefix, err)
+		}
+		policy.inherit(policies.Default)
+	}
+	return policies, nil
+}
+
+// PolicyFor returns the CORS policy overriding the default policy for the
+// route of the API with the given uri template, or nil if there is none.
+func (p *CorsPolicies) PolicyFor(apiName, uriTemplate string) *CorsPolicy {
+	if p == nil {
+		return nil
+	}
+	if prefix := p.PathPrefixFor(uriTemplate); prefix != "" {
+		return p.PathPrefixes[prefix]
+	}
+	return p.Apis[apiName]
+}
+
+// PathPrefixFor returns the longest path prefix with a policy matching the
+// uri template, or "" if there is none.
+func (p *CorsPolicies) PathPrefixFor(uriTemplate string) string {
+	longest := ""
+	for prefix := range p.PathPrefixes {
+		if strings.HasPrefix(uriTemplate, prefix) && len(prefix) > len(longest) {
+			longest = prefix
+		}
+	}
+	return longest
+}
+
+// inherit copies the fields the policy does not set from the default policy.
+// Envoy uses a route CORS policy instead of the virtual host one, not on top
+// of it, so the fallback has to be done here. The origins are inherited
+// together: a policy setting either list replaces both.
+func (c *CorsPolicy) inherit(d *CorsPolicy) {
+	if len(c.AllowOrigins) == 0 && len(c.AllowOriginRegexes) == 0 {
+		c.AllowOrigins = d.AllowOrigins
+		c.AllowOriginRegexes = d.AllowOriginRegexes
+	}
+	if c.AllowMethods == "" {
+		c.AllowMethods = d.AllowMethods
+	}
+	if c.AllowHeaders == "" {
+		c.AllowHeaders = d.AllowHeaders
+	}
+	if c.ExposeHeaders == "" {
+		c.ExposeHeaders = d.ExposeHeaders
+	}
+	if c.MaxAge == nil {
+		c.MaxAge = d.MaxAge
+	}
+	if c.AllowCredentials == nil {
+		c.AllowCredentials = d.AllowCredentials
+	}
+}
+
+func (c *CorsPolicy) validate() error {
+	if c == nil {
+		return fmt.Errorf("policy must not be null")
+	}
+	for _, origin := range c.AllowOrigins {
+		if origin == "" {
+			return fmt.Errorf("allow_origins must not have an empty origin")
+		}
+	}
+	for _, re := range c.AllowOriginRegexes {
+		if _, err := regexp.Compile(re); err != nil {
+			return fmt.Errorf("allow_origin_regexes has invalid regex %s: %v", re, err)
+		}
+	}
+	return nil
+}
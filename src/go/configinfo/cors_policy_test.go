@@ -0,0 +1,216 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestProcessCorsPolicies(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "api-1",
+			},
+			{
+				Name: "api-2",
+			},
+		},
+	}
+	policies := `{
+  "default": {"allow_origins": ["https://a.example.com", "https://b.example.com"]},
+  "apis": {"api-2": {"allow_origins": ["https://api2.example.com"]}},
+  "path_prefixes": {
+    "/admin": {"allow_origins": ["https://admin.example.com"]},
+    "/admin/root": {"allow_origins": ["https://root.example.com"]}
+  }
+}`
+
+	testData := []struct {
+		desc        string
+		policies    string
+		corsPreset  string
+		apiName     string
+		uriTemplate string
+		// The first allowed origin of the overriding policy, or "" if there is
+		// none.
+		wantOrigin string
+		wantErr    string
+	}{
+		{
+			desc:        "Default policy",
+			policies:    policies,
+			apiName:     "api-1",
+			uriTemplate: "/shelves",
+		},
+		{
+			desc:        "API policy",
+			policies:    policies,
+			apiName:     "api-2",
+			uriTemplate: "/shelves",
+			wantOrigin:  "https://api2.example.com",
+		},
+		{
+			desc:        "Path prefix policy takes precedence over API policy",
+			policies:    policies,
+			apiName:     "api-2",
+			uriTemplate: "/admin/users/{id}",
+			wantOrigin:  "https://admin.example.com",
+		},
+		{
+			desc:        "Longest path prefix wins",
+			policies:    policies,
+			apiName:     "api-1",
+			uriTemplate: "/admin/root/{id}",
+			wantOrigin:  "https://root.example.com",
+		},
+		{
+			desc:       "Both cors_preset and the CORS policy file",
+			policies:   policies,
+			corsPreset: "basic",
+			wantErr:    "cors_preset and cors_policy_path cannot be both set",
+		},
+		{
+			desc:     "No default policy",
+			policies: `{"apis": {"api-1": {"allow_origins": ["https://a.example.com"]}}}`,
+			wantErr:  "must set a default policy",
+		},
+		{
+			desc:     "Default policy without origin",
+			policies: `{"default": {"max_age": 3600}}`,
+			wantErr:  "invalid default CORS policy: one of allow_origins and allow_origin_regexes must be set",
+		},
+		{
+			desc:     "Unknown api",
+			policies: `{"default": {"allow_origins": ["*"]}, "apis": {"api-3": {}}}`,
+			wantErr:  "CORS policy is set for unknown api api-3",
+		},
+		{
+			desc:     "Path prefix without leading slash",
+			policies: `{"default": {"allow_origins": ["*"]}, "path_prefixes": {"admin": {}}}`,
+			wantErr:  "CORS policy path prefix admin must start with /",
+		},
+		{
+			desc:     "Invalid origin regex",
+			policies: `{"default": {"allow_origin_regexes": ["https://(.*"]}}`,
+			wantErr:  "allow_origin_regexes has invalid regex https://(.*",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.CorsPolicyPath: tc.policies})()
+		opts.CorsPreset = tc.corsPreset
+		opts.CorsAllowOrigin = "https://a.example.com"
+		serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotOrigin := ""
+		if policy := serviceInfo.CorsPolicies.PolicyFor(tc.apiName, tc.uriTemplate); policy != nil {
+			gotOrigin = policy.AllowOrigins[0]
+		}
+		if gotOrigin != tc.wantOrigin {
+			t.Errorf("Test Desc(%d): %s, got policy with origin: %q, want: %q", i, tc.desc, gotOrigin, tc.wantOrigin)
+		}
+	}
+}
+
+func TestCorsPolicyInheritsDefault(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "api-1",
+			},
+		},
+	}
+	policies := `{
+  "default": {
+    "allow_origins": ["https://a.example.com"],
+    "allow_methods": "GET,POST",
+    "allow_headers": "content-type",
+    "expose_headers": "x-request-id",
+    "max_age": 3600,
+    "allow_credentials": true
+  },
+  "apis": {"api-1": {"allow_methods": "GET", "allow_credentials": false}},
+  "path_prefixes": {"/admin": {"allow_origin_regexes": ["https://.*\\.example\\.com"]}}
+}`
+
+	maxAge := uint32(3600)
+	allow, disallow := true, false
+	testData := []struct {
+		desc        string
+		uriTemplate string
+		wantPolicy  *CorsPolicy
+	}{
+		{
+			desc:        "API policy inherits the unset fields",
+			uriTemplate: "/shelves",
+			wantPolicy: &CorsPolicy{
+				AllowOrigins:     []string{"https://a.example.com"},
+				AllowMethods:     "GET",
+				AllowHeaders:     "content-type",
+				ExposeHeaders:    "x-request-id",
+				MaxAge:           &maxAge,
+				AllowCredentials: &disallow,
+			},
+		},
+		{
+			desc:        "Path prefix policy with its own origins does not inherit the default origins",
+			uriTemplate: "/admin/users",
+			wantPolicy: &CorsPolicy{
+				AllowOriginRegexes: []string{`https://.*\.example\.com`},
+				AllowMethods:       "GET,POST",
+				AllowHeaders:       "content-type",
+				ExposeHeaders:      "x-request-id",
+				MaxAge:             &maxAge,
+				AllowCredentials:   &allow,
+			},
+		},
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendProtocol = "http"
+	defer testutil.WriteTempFiles(t, map[*string]string{&opts.CorsPolicyPath: policies})()
+	serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tc := range testData {
+		got := serviceInfo.CorsPolicies.PolicyFor("api-1", tc.uriTemplate)
+		if !reflect.DeepEqual(got, tc.wantPolicy) {
+			t.Errorf("Test Desc(%d): %s, got policy: %+v, want: %+v", i, tc.desc, got, tc.wantPolicy)
+		}
+	}
+}
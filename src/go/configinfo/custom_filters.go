@@ -0,0 +1,199 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/jsonpb"
+	"gopkg.in/yaml.v2"
+
+	v2pb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+
+	// Register the typed configs of the Envoy filters commonly used as custom
+	// filters, so they can be resolved from the custom filter file.
+	_ "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/ext_authz/v2"
+	_ "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/header_to_metadata/v2"
+	_ "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/lua/v2"
+	_ "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rate_limit/v2"
+	_ "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rbac/v2"
+)
+
+// InsertionPoint is a named position of the filter chain where custom filters
+// can be inserted.
+type InsertionPoint string
+
+const (
+	// BeforeAuth is after the path matcher and health check filters, before
+	// the JWT Authn filter.
+	BeforeAuth InsertionPoint = "before_auth"
+	// AfterServiceControl is right after the Service Control filter, so the
+	// requests rejected by the custom filters are still reported.
+	AfterServiceControl InsertionPoint = "after_service_control"
+	// BeforeRouter is right before the Router filter.
+	BeforeRouter InsertionPoint = "before_router"
+)
+
+// InsertionPoints lists the insertion points in the order of the filter chain.
+var InsertionPoints = []InsertionPoint{BeforeAuth, AfterServiceControl, BeforeRouter}
+
+// IsValid returns true if the insertion point is one of InsertionPoints.
+func (p InsertionPoint) IsValid() bool {
+	for _, point := range InsertionPoints {
+		if point == p {
+			return true
+		}
+	}
+	return false
+}
+
+// customFiltersFile is the content of the file specified by --custom_filters_path.
+// Filters and clusters are in the Envoy JSON or YAML format, typed configs must set "@type".
+type customFiltersFile struct {
+	Filters []struct {
+		InsertionPoint InsertionPoint  `json:"insertion_point"`
+		Filter         json.RawMessage `json:"filter"`
+	} `json:"filters"`
+	Clusters []json.RawMessage `json:"clusters"`
+}
+
+// CustomFilter is a filter of the custom filter file.
+type CustomFilter struct {
+	InsertionPoint InsertionPoint
+	Filter         *hcmpb.HttpFilter
+}
+
+// CustomFilters are the filters and clusters of the custom filter file.
+type CustomFilters struct {
+	Filters  []*CustomFilter
+	Clusters []*v2pb.Cluster
+}
+
+// readCustomFilters reads and validates the custom filter file, in the JSON
+// or YAML format.
+func readCustomFilters(path string) (*CustomFilters, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read custom filter file %s: %v", path, err)
+	}
+	// JSON is valid YAML, so both formats are converted.
+	data, err = yamlToJson(data)
+	if err != nil {
+		return nil, fmt.Errorf("fail to unmarshal custom filter file %s: %v", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	file := &customFiltersFile{}
+	if err := decoder.Decode(file); err != nil {
+		return nil, fmt.Errorf("fail to unmarshal custom filter file %s: %v", path, err)
+	}
+
+	unmarshaler := &jsonpb.Unmarshaler{
+		AnyResolver: util.Resolver,
+	}
+	out := &CustomFilters{}
+	for i, f := range file.Filters {
+		if !f.InsertionPoint.IsValid() {
+			return nil, fmt.Errorf("custom filter %d has unknown insertion point: %q", i, f.InsertionPoint)
+		}
+		filter := &hcmpb.HttpFilter{}
+		if err := unmarshaler.Unmarshal(bytes.NewReader(f.Filter), filter); err != nil {
+			return nil, fmt.Errorf("fail to unmarshal custom filter %d: %v", i, err)
+		}
+		if err := filter.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid custom filter %d: %v", i, err)
+		}
+		out.Filters = append(out.Filters, &CustomFilter{
+			InsertionPoint: f.InsertionPoint,
+			Filter:         filter,
+		})
+	}
+
+	for i, c := range file.Clusters {
+		cluster := &v2pb.Cluster{}
+		if err := unmarshaler.Unmarshal(bytes.NewReader(c), cluster); err != nil {
+			return nil, fmt.Errorf("fail to unmarshal custom cluster %d: %v", i, err)
+		}
+		if err := cluster.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid custom cluster %d: %v", i, err)
+		}
+		out.Clusters = append(out.Clusters, cluster)
+	}
+	return out, nil
+}
+
+// yamlToJson converts the YAML document to JSON, so it can be decoded with
+// the JSON field names and jsonpb.
+func yamlToJson(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	doc, err := yamlToJsonValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// yamlToJsonValue replaces the YAML maps, which have interface{} keys, by
+// JSON objects.
+func yamlToJsonValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("map key %v is not a string", key)
+			}
+			value, err := yamlToJsonValue(value)
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = value
+		}
+		return obj, nil
+	case []interface{}:
+		for i, item := range v {
+			item, err := yamlToJsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = item
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// FiltersAt returns the custom filters at the given insertion point, in the
+// order of the file.
+func (c *CustomFilters) FiltersAt(point InsertionPoint) []*hcmpb.HttpFilter {
+	var filters []*hcmpb.HttpFilter
+	for _, f := range c.Filters {
+		if f.InsertionPoint == point {
+			filters = append(filters, f.Filter)
+		}
+	}
+	return filters
+}
@@ -0,0 +1,280 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+)
+
+// JwtProviderOptionsFile is the content of the file specified by --jwt_provider_options_path.
+//
+// Options in Default apply to every JWT provider whose issuer does not set
+// the same option in Issuers. The local JWKS, jwks_path or jwks, can only be
+// set per issuer: the keys of different issuers are unlikely to be the same.
+type JwtProviderOptionsFile struct {
+	Default *JwtProviderOptions `json:"default,omitempty"`
+	// Per-provider options, using issuer as key.
+	Issuers map[string]*JwtProviderOptions `json:"issuers,omitempty"`
+}
+
+// JwtProviderOptions contains the options that can be set for one JWT provider.
+type JwtProviderOptions struct {
+	// Locations to extract the JWT from, replacing the default locations:
+	// the "Authorization" header with "Bearer " prefix, the
+	// "X-Goog-Iap-Jwt-Assertion" header and the "access_token" query parameter.
+	// The AuthProvider of the supported service config API has no
+	// jwt_locations, so they can only be set here.
+	JwtLocations []*JwtLocation `json:"jwt_locations,omitempty"`
+	// Path of a local JWKS file, used instead of fetching the jwks_uri of
+	// the provider.
+	JwksPath string `json:"jwks_path,omitempty"`
+	// Inline JWKS, used instead of fetching the jwks_uri of the provider.
+	Jwks json.RawMessage `json:"jwks,omitempty"`
+	// Claims of the verified JWT to forward to the backend as headers,
+	// replacing the headers of the same names from the client.
+	ClaimToHeaders []*ClaimToHeader `json:"claim_to_headers,omitempty"`
+	// Whether to remove the Authorization header of the requests with a
+	// verified JWT before forwarding them. For the operations using backend
+	// authentication, it is moved to the X-Forwarded-Authorization header.
+	StripAuthorization *bool `json:"strip_authorization,omitempty"`
+	// DNS lookup family of the cluster fetching the JWKS: "auto", "v4only"
+	// or "v6only". The default is "v4only".
+	DnsLookupFamily string `json:"dns_lookup_family,omitempty"`
+	// Timeout of fetching the JWKS, e.g. "10s". The default is --http_request_timeout_s.
+	// It also caps the connect timeout of the JWKS cluster.
+	JwksFetchTimeout string `json:"jwks_fetch_timeout,omitempty"`
+	// Duration to cache the fetched JWKS, e.g. "1h". The default is
+	// --jwks_cache_duration_in_s.
+	JwksCacheDuration string `json:"jwks_cache_duration,omitempty"`
+}
+
+// ClaimToHeader forwards a top-level claim of the JWT payload as a header.
+// Only string, number and boolean claims are forwarded.
+type ClaimToHeader struct {
+	Claim  string `json:"claim"`
+	Header string `json:"header"`
+}
+
+// The locations of the JWT for the providers not configuring them.
+var defaultJwtLocations = []*JwtLocation{
+	{
+		Header:      "Authorization",
+		ValuePrefix: "Bearer ",
+	},
+	{
+		Header: "X-Goog-Iap-Jwt-Assertion",
+	},
+	{
+		Query: "access_token",
+	},
+}
+
+// JwtLocation is one location of the JWT. Exactly one of Header and Query
+// must be set. JWT in cookies is not supported, the JWT Authn filter of the
+// supported Envoy version can only extract it from headers and query
+// parameters.
+type JwtLocation struct {
+	Header string `json:"header,omitempty"`
+	Query  string `json:"query,omitempty"`
+	// Prefix before the JWT in the header value, e.g. "Bearer ".
+	ValuePrefix string `json:"value_prefix,omitempty"`
+}
+
+// readJwtProviderOptions reads and validates the JWT provider options file.
+func readJwtProviderOptions(path string) (*JwtProviderOptionsFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read JWT provider options file %s: %v", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	file := &JwtProviderOptionsFile{}
+	if err := decoder.Decode(file); err != nil {
+		return nil, fmt.Errorf("fail to unmarshal JWT provider options file %s: %v", path, err)
+	}
+
+	if err := file.Default.validate(); err != nil {
+		return nil, fmt.Errorf("invalid default JWT provider options: %v", err)
+	}
+	if file.Default != nil && (file.Default.JwksPath != "" || len(file.Default.Jwks) > 0) {
+		return nil, fmt.Errorf("invalid default JWT provider options: jwks_path and jwks can only be set per issuer")
+	}
+	for issuer, opts := range file.Issuers {
+		if err := opts.validate(); err != nil {
+			return nil, fmt.Errorf("invalid JWT provider options for issuer %s: %v", issuer, err)
+		}
+	}
+	return file, nil
+}
+
+// optionsFor returns the effective options for the given issuer, falling back
+// to the default options for every option the issuer does not set.
+func (f *JwtProviderOptionsFile) optionsFor(issuer string) *JwtProviderOptions {
+	opts := &JwtProviderOptions{}
+	if f.Default != nil {
+		*opts = *f.Default
+	}
+
+	issuerOpts := f.Issuers[issuer]
+	if issuerOpts == nil {
+		return opts
+	}
+	if len(issuerOpts.JwtLocations) > 0 {
+		opts.JwtLocations = issuerOpts.JwtLocations
+	}
+	if len(issuerOpts.ClaimToHeaders) > 0 {
+		opts.ClaimToHeaders = issuerOpts.ClaimToHeaders
+	}
+	if issuerOpts.StripAuthorization != nil {
+		opts.StripAuthorization = issuerOpts.StripAuthorization
+	}
+	if issuerOpts.DnsLookupFamily != "" {
+		opts.DnsLookupFamily = issuerOpts.DnsLookupFamily
+	}
+	if issuerOpts.JwksFetchTimeout != "" {
+		opts.JwksFetchTimeout = issuerOpts.JwksFetchTimeout
+	}
+	if issuerOpts.JwksCacheDuration != "" {
+		opts.JwksCacheDuration = issuerOpts.JwksCacheDuration
+	}
+	// Local JWKS is only set per issuer.
+	opts.JwksPath = issuerOpts.JwksPath
+	opts.Jwks = issuerOpts.Jwks
+	return opts
+}
+
+func (o *JwtProviderOptions) validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.JwksPath != "" && len(o.Jwks) > 0 {
+		return fmt.Errorf("only one of jwks_path and jwks can be set")
+	}
+	if len(o.Jwks) > 0 {
+		if err := validateJwks(o.Jwks); err != nil {
+			return fmt.Errorf("invalid jwks: %v", err)
+		}
+	}
+	for i, c := range o.ClaimToHeaders {
+		if c.Claim == "" {
+			return fmt.Errorf("claim_to_headers[%d] must set claim", i)
+		}
+		if !headerNameRegexp.MatchString(c.Header) {
+			return fmt.Errorf("claim_to_headers[%d] has invalid header name %q", i, c.Header)
+		}
+		if strings.EqualFold(c.Header, "Authorization") || strings.EqualFold(c.Header, util.ForwardedAuthorizationHeader) {
+			return fmt.Errorf("claim_to_headers[%d] cannot set header %s", i, c.Header)
+		}
+	}
+	switch o.DnsLookupFamily {
+	case "", "auto", "v4only", "v6only":
+	default:
+		return fmt.Errorf("invalid dns_lookup_family %q, only auto, v4only or v6only are valid", o.DnsLookupFamily)
+	}
+	for name, value := range map[string]string{
+		"jwks_fetch_timeout":  o.JwksFetchTimeout,
+		"jwks_cache_duration": o.JwksCacheDuration,
+	} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s %q, it must be a positive duration such as \"5s\"", name, value)
+		}
+	}
+	for i, loc := range o.JwtLocations {
+		if (loc.Header == "") == (loc.Query == "") {
+			return fmt.Errorf("jwt_locations[%d] must set exactly one of header and query", i)
+		}
+		if loc.ValuePrefix != "" && loc.Header == "" {
+			return fmt.Errorf("jwt_locations[%d] can only set value_prefix with header", i)
+		}
+	}
+	return nil
+}
+
+// Header names are tokens as defined in RFC 7230.
+var headerNameRegexp = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// A jwks_uri with this prefix is the path of a local JWKS file.
+const fileUriPrefix = "file://"
+
+// LocalJwks is a JWKS loaded from a local file or inlined in the options,
+// which does not need to be fetched.
+type LocalJwks struct {
+	// Path of the JWKS file, empty for an inline JWKS.
+	Path string
+	// Modification time of the file when it is read.
+	ModTime time.Time
+	Content string
+}
+
+// readLocalJwks reads and validates the JWKS file at path.
+func readLocalJwks(path string) (*LocalJwks, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read JWKS file %s: %v", path, err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read JWKS file %s: %v", path, err)
+	}
+	if err := validateJwks(data); err != nil {
+		return nil, fmt.Errorf("invalid JWKS file %s: %v", path, err)
+	}
+	return &LocalJwks{
+		Path:    path,
+		ModTime: info.ModTime(),
+		Content: string(data),
+	}, nil
+}
+
+// Changed returns whether the JWKS file has been modified since it was read.
+// An inline JWKS never changes.
+func (j *LocalJwks) Changed() bool {
+	if j.Path == "" {
+		return false
+	}
+	info, err := os.Stat(j.Path)
+	if err != nil {
+		glog.Warningf("fail to stat JWKS file %s: %v", j.Path, err)
+		return false
+	}
+	return !info.ModTime().Equal(j.ModTime)
+}
+
+func validateJwks(data []byte) error {
+	jwks := struct {
+		Keys []json.RawMessage `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return err
+	}
+	if len(jwks.Keys) == 0 {
+		return fmt.Errorf("no keys")
+	}
+	return nil
+}
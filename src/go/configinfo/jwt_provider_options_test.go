@@ -0,0 +1,303 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestProcessJwtProviderOptions(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "mobile_provider",
+					Issuer:  "https://mobile.example.com",
+					JwksUri: "https://mobile.example.com/jwks",
+				},
+				{
+					Id:      "web_provider",
+					Issuer:  "https://web.example.com",
+					JwksUri: "https://web.example.com/jwks",
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc             string
+		options          string
+		wantJwtLocations map[string][]*JwtLocation
+		wantQueryParams  []string
+		wantErr          string
+	}{
+		{
+			desc: "Issuer options override the default options",
+			options: `{
+  "default": {
+    "jwt_locations": [
+      {
+        "header": "Authorization",
+        "value_prefix": "Bearer "
+      }
+    ]
+  },
+  "issuers": {
+    "https://mobile.example.com": {
+      "jwt_locations": [
+        {
+          "header": "X-Mobile-Token"
+        },
+        {
+          "query": "mobile_token"
+        }
+      ]
+    }
+  }
+}`,
+			wantJwtLocations: map[string][]*JwtLocation{
+				"mobile_provider": {
+					{
+						Header: "X-Mobile-Token",
+					},
+					{
+						Query: "mobile_token",
+					},
+				},
+				"web_provider": {
+					{
+						Header:      "Authorization",
+						ValuePrefix: "Bearer ",
+					},
+				},
+			},
+			wantQueryParams: []string{"mobile_token"},
+		},
+		{
+			desc:    "Providers without options use the default locations",
+			options: `{"issuers": {"https://web.example.com": {"jwt_locations": [{"query": "token"}]}}}`,
+			wantJwtLocations: map[string][]*JwtLocation{
+				"mobile_provider": defaultJwtLocations,
+				"web_provider": {
+					{
+						Query: "token",
+					},
+				},
+			},
+			wantQueryParams: []string{"access_token", "token"},
+		},
+		{
+			desc:    "Unknown issuer",
+			options: `{"issuers": {"https://unknown.example.com": {}}}`,
+			wantErr: "JWT provider options are set for unknown issuer https://unknown.example.com",
+		},
+		{
+			desc:    "Location with both header and query",
+			options: `{"default": {"jwt_locations": [{"header": "X-Token", "query": "token"}]}}`,
+			wantErr: "jwt_locations[0] must set exactly one of header and query",
+		},
+		{
+			desc:    "Local JWKS in the default options",
+			options: `{"default": {"jwks_path": "/etc/jwks.json"}}`,
+			wantErr: "invalid default JWT provider options: jwks_path and jwks can only be set per issuer",
+		},
+		{
+			desc:    "Value prefix for a query parameter",
+			options: `{"default": {"jwt_locations": [{"query": "token", "value_prefix": "Bearer "}]}}`,
+			wantErr: "jwt_locations[0] can only set value_prefix with header",
+		},
+		{
+			desc:    "Cookie location",
+			options: `{"issuers": {"https://web.example.com": {"jwt_locations": [{"cookie": "session"}]}}}`,
+			wantErr: `unknown field "cookie"`,
+		},
+		{
+			desc:    "Claim header with invalid name",
+			options: `{"default": {"claim_to_headers": [{"claim": "sub", "header": "X User"}]}}`,
+			wantErr: `claim_to_headers[0] has invalid header name "X User"`,
+		},
+		{
+			desc:    "Claim header replacing Authorization",
+			options: `{"default": {"claim_to_headers": [{"claim": "sub", "header": "authorization"}]}}`,
+			wantErr: "claim_to_headers[0] cannot set header authorization",
+		},
+		{
+			desc:    "Claim header without claim",
+			options: `{"default": {"claim_to_headers": [{"header": "X-User-Id"}]}}`,
+			wantErr: "claim_to_headers[0] must set claim",
+		},
+		{
+			desc:    "Invalid DNS lookup family",
+			options: `{"issuers": {"https://web.example.com": {"dns_lookup_family": "v5only"}}}`,
+			wantErr: `invalid dns_lookup_family "v5only", only auto, v4only or v6only are valid`,
+		},
+		{
+			desc:    "Invalid JWKS fetch timeout",
+			options: `{"default": {"jwks_fetch_timeout": "10"}}`,
+			wantErr: `invalid jwks_fetch_timeout "10", it must be a positive duration`,
+		},
+		{
+			desc:    "Negative JWKS cache duration",
+			options: `{"default": {"jwks_cache_duration": "-1h"}}`,
+			wantErr: `invalid jwks_cache_duration "-1h", it must be a positive duration`,
+		},
+		{
+			desc:    "Unknown field",
+			options: `{"default": {"locations": []}}`,
+			wantErr: `unknown field "locations"`,
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.JwtProviderOptionsPath: tc.options})()
+		serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for id, wantJwtLocations := range tc.wantJwtLocations {
+			if got := serviceInfo.JwtLocations(id); !cmp.Equal(got, wantJwtLocations) {
+				t.Errorf("Test Desc(%d): %s, provider %s,\ngot JwtLocations: %v,\nwant JwtLocations: %v", i, tc.desc, id, got, wantJwtLocations)
+			}
+		}
+		if got := serviceInfo.JwtQueryParameters(); !cmp.Equal(got, tc.wantQueryParams) {
+			t.Errorf("Test Desc(%d): %s, got JwtQueryParameters: %v, want: %v", i, tc.desc, got, tc.wantQueryParams)
+		}
+	}
+}
+
+func TestProcessLocalJwks(t *testing.T) {
+	fakeJwks := `{"keys": [{"kty": "RSA", "kid": "key-0", "n": "fake-n", "e": "AQAB"}]}`
+	var jwksPath string
+	defer testutil.WriteTempFiles(t, map[*string]string{&jwksPath: fakeJwks})()
+
+	testData := []struct {
+		desc          string
+		jwksUri       string
+		options       string
+		wantLocalJwks *LocalJwks
+		wantErr       string
+	}{
+		{
+			desc:    "Remote JWKS",
+			jwksUri: "https://issuer.example.com/jwks",
+		},
+		{
+			desc:    "JWKS file from file:// jwks_uri",
+			jwksUri: "file://" + jwksPath,
+			wantLocalJwks: &LocalJwks{
+				Path:    jwksPath,
+				Content: fakeJwks,
+			},
+		},
+		{
+			desc:    "JWKS file from options, without OpenID Connect Discovery",
+			options: fmt.Sprintf(`{"issuers": {"https://issuer.example.com": {"jwks_path": "%s"}}}`, jwksPath),
+			wantLocalJwks: &LocalJwks{
+				Path:    jwksPath,
+				Content: fakeJwks,
+			},
+		},
+		{
+			desc:    "Inline JWKS from options",
+			jwksUri: "https://issuer.example.com/jwks",
+			options: fmt.Sprintf(`{"issuers": {"https://issuer.example.com": {"jwks": %s}}}`, fakeJwks),
+			wantLocalJwks: &LocalJwks{
+				Content: fakeJwks,
+			},
+		},
+		{
+			desc:    "Missing JWKS file",
+			jwksUri: "file:///non-existent/jwks.json",
+			wantErr: "fail to load JWKS of provider auth_provider: fail to read JWKS file /non-existent/jwks.json",
+		},
+		{
+			desc:    "Inline JWKS without keys",
+			options: `{"issuers": {"https://issuer.example.com": {"jwks": {"keys": []}}}}`,
+			wantErr: "invalid jwks: no keys",
+		},
+		{
+			desc:    "Both JWKS path and inline JWKS",
+			options: fmt.Sprintf(`{"issuers": {"https://issuer.example.com": {"jwks_path": "%s", "jwks": %s}}}`, jwksPath, fakeJwks),
+			wantErr: "only one of jwks_path and jwks can be set",
+		},
+	}
+
+	for i, tc := range testData {
+		fakeServiceConfig := &confpb.Service{
+			Name: testProjectName,
+			Apis: []*apipb.Api{
+				{
+					Name: testApiName,
+				},
+			},
+			Authentication: &confpb.Authentication{
+				Providers: []*confpb.AuthProvider{
+					{
+						Id:      "auth_provider",
+						Issuer:  "https://issuer.example.com",
+						JwksUri: tc.jwksUri,
+					},
+				},
+			},
+		}
+
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.JwtProviderOptionsPath: tc.options})()
+		serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotLocalJwks := serviceInfo.LocalJwks["auth_provider"]
+		if !cmp.Equal(gotLocalJwks, tc.wantLocalJwks, cmpopts.IgnoreFields(LocalJwks{}, "ModTime")) {
+			t.Errorf("Test Desc(%d): %s,\ngot LocalJwks: %+v,\nwant LocalJwks: %+v", i, tc.desc, gotLocalJwks, tc.wantLocalJwks)
+		}
+		if serviceInfo.LocalJwksChanged() {
+			t.Errorf("Test Desc(%d): %s, LocalJwksChanged got true before the file is modified", i, tc.desc)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	commonpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/common"
+)
+
+// The classes of the local replies of the ESPv2 filters, used as keys of
+// --local_reply_status_codes and of LocalReplyConfigs.
+const (
+	// The path matcher filter rejecting a request matching no operation.
+	LocalReplyPathNotFound = "path_not_found"
+	// The service control filter rejecting a request denied by the check.
+	LocalReplyServiceControlDenied = "service_control_denied"
+	// The backend auth filter failing to get the backend ID token.
+	LocalReplyBackendAuthFailure = "backend_auth_failure"
+)
+
+var localReplyClasses = []string{
+	LocalReplyPathNotFound,
+	LocalReplyServiceControlDenied,
+	LocalReplyBackendAuthFailure,
+}
+
+// processLocalReplies builds the local reply config of each class from the
+// local reply options.
+func (s *ServiceInfo) processLocalReplies() error {
+	statusCodes, err := parseLocalReplyStatusCodes(s.Options.LocalReplyStatusCodes)
+	if err != nil {
+		return err
+	}
+	if s.Options.LocalReplyBodyFormat == "" && len(statusCodes) == 0 {
+		return nil
+	}
+
+	contentType := ""
+	if s.Options.LocalReplyBodyFormat != "" {
+		contentType = s.Options.LocalReplyContentType
+		if strings.HasSuffix(contentType, "json") && !json.Valid([]byte(renderLocalReplyExample(s.Options.LocalReplyBodyFormat))) {
+			return fmt.Errorf("local_reply_body_format is not valid JSON with content type %s: %s", contentType, s.Options.LocalReplyBodyFormat)
+		}
+	}
+
+	s.LocalReplyConfigs = make(map[string]*commonpb.LocalReplyConfig)
+	for _, class := range localReplyClasses {
+		s.LocalReplyConfigs[class] = &commonpb.LocalReplyConfig{
+			BodyFormat:  s.Options.LocalReplyBodyFormat,
+			ContentType: contentType,
+			StatusCode:  statusCodes[class],
+		}
+	}
+	return nil
+}
+
+// parseLocalReplyStatusCodes parses the comma separated "class=code" entries
+// of --local_reply_status_codes.
+func parseLocalReplyStatusCodes(value string) (map[string]uint32, error) {
+	statusCodes := make(map[string]uint32)
+	if value == "" {
+		return statusCodes, nil
+	}
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf(`local_reply_status_codes entries must be "class=code", got %q`, entry)
+		}
+		class := strings.TrimSpace(parts[0])
+		found := false
+		for _, c := range localReplyClasses {
+			found = found || c == class
+		}
+		if !found {
+			return nil, fmt.Errorf("only the local replies of the ESPv2 filters can be customized: local_reply_status_codes class must be one of %s, got %q", strings.Join(localReplyClasses, ", "), class)
+		}
+		code, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("local_reply_status_codes has invalid status code for %s: %q", class, parts[1])
+		}
+		// The replies reject the requests, so they must keep an error code.
+		if code < 400 || code > 599 {
+			return nil, fmt.Errorf("local_reply_status_codes status code for %s must be a 4xx or 5xx code, got %d", class, code)
+		}
+		statusCodes[class] = uint32(code)
+	}
+	return statusCodes, nil
+}
+
+// renderLocalReplyExample renders the body format like the filters do, to
+// validate it.
+func renderLocalReplyExample(bodyFormat string) string {
+	return strings.NewReplacer("%CODE%", "404", "%GRPC_CODE%", "5", "%MESSAGE%", "message").Replace(bodyFormat)
+}
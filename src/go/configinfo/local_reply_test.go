@@ -0,0 +1,140 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/golang/protobuf/proto"
+
+	commonpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/common"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestProcessLocalReplies(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+	}
+	bodyFormat := `{"error":{"code":%CODE%,"status":%GRPC_CODE%,"message":"%MESSAGE%"}}`
+	testData := []struct {
+		desc        string
+		bodyFormat  string
+		contentType string
+		statusCodes string
+		wantConfigs map[string]*commonpb.LocalReplyConfig
+		wantErr     string
+	}{
+		{
+			desc: "Local replies not customized",
+		},
+		{
+			desc:        "Body format for all the classes",
+			bodyFormat:  bodyFormat,
+			contentType: "application/json",
+			wantConfigs: map[string]*commonpb.LocalReplyConfig{
+				LocalReplyPathNotFound:         {BodyFormat: bodyFormat, ContentType: "application/json"},
+				LocalReplyServiceControlDenied: {BodyFormat: bodyFormat, ContentType: "application/json"},
+				LocalReplyBackendAuthFailure:   {BodyFormat: bodyFormat, ContentType: "application/json"},
+			},
+		},
+		{
+			desc:        "Status codes without body format",
+			contentType: "application/json",
+			statusCodes: "path_not_found=400, backend_auth_failure = 503",
+			wantConfigs: map[string]*commonpb.LocalReplyConfig{
+				LocalReplyPathNotFound:         {StatusCode: 400},
+				LocalReplyServiceControlDenied: {},
+				LocalReplyBackendAuthFailure:   {StatusCode: 503},
+			},
+		},
+		{
+			desc:        "Non-JSON body format with a non-JSON content type",
+			bodyFormat:  "error %CODE%: %MESSAGE%",
+			contentType: "text/plain",
+			wantConfigs: map[string]*commonpb.LocalReplyConfig{
+				LocalReplyPathNotFound:         {BodyFormat: "error %CODE%: %MESSAGE%", ContentType: "text/plain"},
+				LocalReplyServiceControlDenied: {BodyFormat: "error %CODE%: %MESSAGE%", ContentType: "text/plain"},
+				LocalReplyBackendAuthFailure:   {BodyFormat: "error %CODE%: %MESSAGE%", ContentType: "text/plain"},
+			},
+		},
+		{
+			desc:        "Invalid JSON body format",
+			bodyFormat:  `{"message":%MESSAGE%}`,
+			contentType: "application/problem+json",
+			wantErr:     "local_reply_body_format is not valid JSON",
+		},
+		{
+			desc:        "Envoy local reply class",
+			statusCodes: "jwt_authn_failure=403",
+			wantErr:     "only the local replies of the ESPv2 filters can be customized",
+		},
+		{
+			desc:        "Entry without status code",
+			statusCodes: "path_not_found",
+			wantErr:     `local_reply_status_codes entries must be "class=code", got "path_not_found"`,
+		},
+		{
+			desc:        "Invalid status code",
+			statusCodes: "path_not_found=99",
+			wantErr:     `local_reply_status_codes status code for path_not_found must be a 4xx or 5xx code, got 99`,
+		},
+		{
+			desc:        "Success status code",
+			statusCodes: "service_control_denied=200",
+			wantErr:     `local_reply_status_codes status code for service_control_denied must be a 4xx or 5xx code, got 200`,
+		},
+		{
+			desc:        "Non numeric status code",
+			statusCodes: "service_control_denied=forbidden",
+			wantErr:     `local_reply_status_codes has invalid status code for service_control_denied: "forbidden"`,
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.LocalReplyBodyFormat = tc.bodyFormat
+		opts.LocalReplyContentType = tc.contentType
+		opts.LocalReplyStatusCodes = tc.statusCodes
+		serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(serviceInfo.LocalReplyConfigs) != len(tc.wantConfigs) {
+			t.Errorf("Test Desc(%d): %s, got LocalReplyConfigs: %v, want: %v", i, tc.desc, serviceInfo.LocalReplyConfigs, tc.wantConfigs)
+			continue
+		}
+		for class, want := range tc.wantConfigs {
+			if got := serviceInfo.LocalReplyConfigs[class]; !proto.Equal(got, want) {
+				t.Errorf("Test Desc(%d): %s, got LocalReplyConfig of %s: %v, want: %v", i, tc.desc, class, got, want)
+			}
+		}
+	}
+}
@@ -34,8 +34,45 @@ type methodInfo struct {
 	SkipServiceControl bool
 	APIKeyLocations    []*scpb.APIKeyLocation
 	MetricCosts        []*scpb.MetricCost
+	// Quota limits enforced by the proxy with --enable_per_worker_local_quota.
+	LocalQuotaLimits []*LocalQuotaLimit
 	// All non-unary gRPC methods are considered streaming.
 	IsStreaming bool
+	// Trace sampling overrides from the operation policy file.
+	TracingPolicy *TracingPolicy
+	// External authorization override from the operation policy file.
+	ExtAuthzPolicy *ExtAuthzPolicy
+	// Claim and source IP restrictions from the operation policy file.
+	AuthorizationPolicy *AuthorizationPolicy
+	// JWT requirement relaxation from the operation policy file.
+	AuthenticationPolicy *AuthenticationPolicy
+	// Header manipulation from the operation policy file.
+	HeadersPolicy *HeadersPolicy
+	// Rate limit descriptors from the operation policy file.
+	RateLimitPolicy *RateLimitPolicy
+	// Request body size limit from the operation policy file.
+	RequestBodyPolicy *RequestBodyPolicy
+	// WebSocket upgrade override from the operation policy file.
+	WebsocketPolicy *WebsocketPolicy
+	// Traffic mirroring override from the operation policy file.
+	MirrorPolicy *MirrorPolicy
+	// Whether the routes of the method allow WebSocket upgrades, from
+	// --enable_websocket and WebsocketPolicy.
+	AllowWebsocket bool
+	// Weighted backends from the backend split file, nil if the method has
+	// a single backend.
+	BackendSplit *BackendSplit
+}
+
+// LocalQuotaLimit is a per-minute quota limit of a method, enforced for each
+// consumer with a token bucket.
+type LocalQuotaLimit struct {
+	// Name of the quota limit in the service config.
+	Name string
+	// Tokens taken by each request of the method.
+	Cost int64
+	// Size of the token bucket, refilled in one minute.
+	PerMinute int64
 }
 
 // backendInfo stores information from Backend rule for backend rerouting.
@@ -0,0 +1,101 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+)
+
+// The JWKS of a disabled JWT provider. It has no key, so the JWT of the
+// provider always fails the verification.
+const disabledProviderJwks = `{"keys": []}`
+
+// newOpenIDDiscoveryClient returns the HTTP client of OpenID Connect
+// Discovery, trusting the root certs of the options.
+func newOpenIDDiscoveryClient(opts options.ConfigGeneratorOptions) *http.Client {
+	client := &http.Client{
+		Timeout: opts.OpenIDDiscoveryTimeout,
+	}
+	caCert, err := ioutil.ReadFile(opts.RootCertsPath)
+	if err != nil {
+		glog.Warningf("fail to read root certs %s, using the system root certs for OpenID Connect Discovery: %v", opts.RootCertsPath, err)
+		return client
+	}
+	caCertPool := x509.NewCertPool()
+	caCertPool.AppendCertsFromPEM(caCert)
+	client.Transport = &http.Transport{
+		TLSClientConfig: &tls.Config{
+			RootCAs: caCertPool,
+		},
+	}
+	return client
+}
+
+// openIDDiscovery resolves the jwks_uri of the issuers by OpenID Connect
+// Discovery. The sleep between retries is injectable for the tests.
+type openIDDiscovery struct {
+	client *http.Client
+	cache  *util.JwksUriCache
+	opts   options.ConfigGeneratorOptions
+	sleep  func(time.Duration)
+}
+
+func newOpenIDDiscovery(opts options.ConfigGeneratorOptions) *openIDDiscovery {
+	cache := opts.OpenIDDiscoveryCache
+	if cache == nil {
+		cache = util.NewJwksUriCache("")
+	}
+	return &openIDDiscovery{
+		client: newOpenIDDiscoveryClient(opts),
+		cache:  cache,
+		opts:   opts,
+		sleep:  time.Sleep,
+	}
+}
+
+// resolveJwksUri resolves the jwks_uri of the issuer, retrying with
+// exponential backoff. If all the attempts fail, the cached jwks_uri of the
+// issuer is used.
+func (d *openIDDiscovery) resolveJwksUri(issuer string) (string, error) {
+	backoff := d.opts.OpenIDDiscoveryRetryBackoff
+	var err error
+	for attempt := 0; attempt <= d.opts.OpenIDDiscoveryRetries; attempt++ {
+		if attempt > 0 {
+			d.sleep(backoff)
+			backoff *= 2
+		}
+		var uri string
+		if uri, err = util.ResolveJwksUriUsingOpenID(d.client, issuer); err == nil {
+			d.cache.Set(issuer, uri)
+			return uri, nil
+		}
+		glog.Errorf("attempt %d of OpenID Connect Discovery for issuer %s failed: %v", attempt+1, issuer, err)
+	}
+
+	if uri, ok := d.cache.Get(issuer); ok {
+		glog.Errorf("using cached jwks_uri %s for issuer %s, OpenID Connect Discovery failed: %v", uri, issuer, err)
+		return uri, nil
+	}
+	return "", fmt.Errorf("failed OpenID Connect Discovery for issuer %s after %d attempts: %v", issuer, d.opts.OpenIDDiscoveryRetries+1, err)
+}
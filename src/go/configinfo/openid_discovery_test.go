@@ -0,0 +1,122 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResolveJwksUri(t *testing.T) {
+	testData := []struct {
+		desc string
+		// Number of discovery requests failing before the first success, -1 if
+		// all fail.
+		failures     int
+		retries      int
+		cacheContent string
+		wantJwksUri  string
+		wantBackoffs []time.Duration
+		wantErr      bool
+	}{
+		{
+			desc:        "Succeed at the first attempt",
+			failures:    0,
+			retries:     2,
+			wantJwksUri: "https://example.com/jwks",
+		},
+		{
+			desc:         "Succeed after retries",
+			failures:     2,
+			retries:      2,
+			wantJwksUri:  "https://example.com/jwks",
+			wantBackoffs: []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			desc:         "Fail after retries without cache",
+			failures:     3,
+			retries:      2,
+			wantBackoffs: []time.Duration{time.Second, 2 * time.Second},
+			wantErr:      true,
+		},
+		{
+			desc:         "Fail after retries, using the cached jwks_uri",
+			failures:     -1,
+			retries:      1,
+			cacheContent: "valid",
+			wantJwksUri:  "https://example.com/cached_jwks",
+			wantBackoffs: []time.Duration{time.Second},
+		},
+		{
+			desc:         "Invalid cache file is ignored",
+			failures:     -1,
+			retries:      0,
+			cacheContent: "invalid",
+			wantErr:      true,
+		},
+	}
+
+	for i, tc := range testData {
+		attempts := 0
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if tc.failures < 0 || attempts <= tc.failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`{"jwks_uri": "https://example.com/jwks"}`))
+		}))
+
+		var cachePath string
+		content := tc.cacheContent
+		// The issuer is only known after the server starts.
+		if content == "valid" {
+			content = fmt.Sprintf(`{%q: "https://example.com/cached_jwks"}`, s.URL)
+		}
+		cleanup := testutil.WriteTempFiles(t, map[*string]string{&cachePath: content})
+
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.OpenIDDiscoveryRetries = tc.retries
+		opts.OpenIDDiscoveryRetryBackoff = time.Second
+		opts.OpenIDDiscoveryCache = util.NewJwksUriCache(cachePath)
+		discovery := newOpenIDDiscovery(opts)
+		var gotBackoffs []time.Duration
+		discovery.sleep = func(d time.Duration) {
+			gotBackoffs = append(gotBackoffs, d)
+		}
+
+		gotJwksUri, err := discovery.resolveJwksUri(s.URL)
+		s.Close()
+		cleanup()
+		if (err != nil) != tc.wantErr {
+			t.Errorf("Test Desc(%d): %s, got error: %v, want error: %v", i, tc.desc, err, tc.wantErr)
+			continue
+		}
+		if gotJwksUri != tc.wantJwksUri {
+			t.Errorf("Test Desc(%d): %s, got jwks_uri: %v, want: %v", i, tc.desc, gotJwksUri, tc.wantJwksUri)
+		}
+		if !cmp.Equal(gotBackoffs, tc.wantBackoffs) {
+			t.Errorf("Test Desc(%d): %s, got backoffs: %v, want: %v", i, tc.desc, gotBackoffs, tc.wantBackoffs)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+)
+
+// OperationPolicies is the content of the file specified by --operation_policy_path.
+//
+// Policies in Default apply to every operation that does not set its own
+// policy of the same kind in Operations.
+type OperationPolicies struct {
+	Default *OperationPolicy `json:"default,omitempty"`
+	// Per-operation policies, using selector as key.
+	Operations map[string]*OperationPolicy `json:"operations,omitempty"`
+}
+
+// OperationPolicy contains all the policies that can be set for one operation.
+type OperationPolicy struct {
+	Tracing        *TracingPolicy        `json:"tracing,omitempty"`
+	ExtAuthz       *ExtAuthzPolicy       `json:"ext_authz,omitempty"`
+	Authorization  *AuthorizationPolicy  `json:"authorization,omitempty"`
+	Authentication *AuthenticationPolicy `json:"authentication,omitempty"`
+	ApiKey         *ApiKeyPolicy         `json:"api_key,omitempty"`
+	Headers        *HeadersPolicy        `json:"headers,omitempty"`
+	RateLimit      *RateLimitPolicy      `json:"rate_limit,omitempty"`
+	RequestBody    *RequestBodyPolicy    `json:"request_body,omitempty"`
+	Websocket      *WebsocketPolicy      `json:"websocket,omitempty"`
+	Mirror         *MirrorPolicy         `json:"mirror,omitempty"`
+}
+
+// TracingPolicy overrides the trace sampling of the routes for an operation.
+// All values are percentages in the range [0, 100].
+type TracingPolicy struct {
+	ClientSampling  *float64 `json:"client_sampling,omitempty"`
+	RandomSampling  *float64 `json:"random_sampling,omitempty"`
+	OverallSampling *float64 `json:"overall_sampling,omitempty"`
+}
+
+// ExtAuthzPolicy controls the external authorization check of an operation.
+// It has no effect if --ext_authz_address is not set.
+type ExtAuthzPolicy struct {
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// AuthorizationPolicy restricts the callers of an operation. A request is
+// denied with 403 unless it meets all the conditions.
+type AuthorizationPolicy struct {
+	// Claims that must be in the verified JWT payload, keyed by claim name.
+	// If values are set, the claim must be equal to one of them, or be a list
+	// containing one of them.
+	RequiredClaims map[string][]string `json:"required_claims,omitempty"`
+	// Scopes that must all be in the space-delimited "scope" claim.
+	Scopes []string `json:"scopes,omitempty"`
+	// CIDR ranges, one of which must contain the source address of the
+	// downstream connection. It is the address of the direct peer, e.g. a load
+	// balancer, not the client address in the x-forwarded-for header.
+	SourceCidrs []string `json:"source_cidrs,omitempty"`
+}
+
+// Modes of AuthenticationPolicy.
+const (
+	// AllowMissingOrFailed accepts the requests without JWT or with an
+	// invalid JWT. The payload of a valid JWT is still forwarded.
+	AllowMissingOrFailed = "allow_missing_or_failed"
+	// AllowMissing would only accept the requests without JWT. It is rejected:
+	// the JWT Authn filter of the supported Envoy version has no allow_missing
+	// requirement.
+	AllowMissing = "allow_missing"
+)
+
+// AuthenticationPolicy relaxes the JWT requirements of an operation. It has
+// no effect on the operations without JWT requirements.
+type AuthenticationPolicy struct {
+	// AllowMissingOrFailed, or empty if a valid JWT is required.
+	Mode string `json:"mode,omitempty"`
+}
+
+// ApiKeyPolicy adds locations of the API key of an operation, which cannot be
+// set by the system parameters of the service config.
+type ApiKeyPolicy struct {
+	// Names of the cookies to extract the API key from, after the header and
+	// query parameter locations.
+	Cookies []string `json:"cookies,omitempty"`
+}
+
+// HeadersPolicy manipulates the request headers sent to the backend and the
+// response headers sent to the client for an operation.
+type HeadersPolicy struct {
+	RequestHeadersToAdd     []*HeaderToAdd `json:"request_headers_to_add,omitempty"`
+	RequestHeadersToRemove  []string       `json:"request_headers_to_remove,omitempty"`
+	ResponseHeadersToAdd    []*HeaderToAdd `json:"response_headers_to_add,omitempty"`
+	ResponseHeadersToRemove []string       `json:"response_headers_to_remove,omitempty"`
+}
+
+// HeaderToAdd is a header to add. It overwrites the existing values of the
+// header, unless Append is set.
+type HeaderToAdd struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Append bool   `json:"append,omitempty"`
+}
+
+// Entries of the descriptors of RateLimitPolicy.
+const (
+	// RateLimitOperation is the operation name, sent with key "generic_key".
+	RateLimitOperation = "operation"
+	// RateLimitApiKey is the API key, from the locations of the operation.
+	RateLimitApiKey = "api_key"
+	// RateLimitJwtSub is the sub claim of the verified JWT.
+	RateLimitJwtSub = "jwt_sub"
+	// RateLimitClientIP is the client IP, sent with key "remote_address".
+	RateLimitClientIP = "client_ip"
+)
+
+// RateLimitPolicy sets the descriptors sent to the rate limit service for an
+// operation. It has no effect if --rate_limit_service_address is not set.
+type RateLimitPolicy struct {
+	// Each descriptor is a list of entries. No descriptor disables rate
+	// limiting for the operation.
+	Descriptors [][]string `json:"descriptors"`
+}
+
+// usesServiceControlHeaders returns whether a descriptor has the API key or
+// the JWT sub claim, which are set in request headers by the Service Control
+// filter.
+func (p *RateLimitPolicy) usesServiceControlHeaders() bool {
+	if p == nil {
+		return false
+	}
+	for _, descriptor := range p.Descriptors {
+		for _, entry := range descriptor {
+			if entry == RateLimitApiKey || entry == RateLimitJwtSub {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RequestBodyPolicy overrides --max_request_bytes for an operation. It has no
+// effect on streaming methods, whose requests are never buffered.
+type RequestBodyPolicy struct {
+	// Requests with a larger body are rejected with 413.
+	MaxRequestBytes uint32 `json:"max_request_bytes"`
+}
+
+// WebsocketPolicy overrides --enable_websocket for an operation. It can only
+// be enabled for the operations with an HTTP backend.
+type WebsocketPolicy struct {
+	Enabled bool `json:"enabled"`
+}
+
+// MirrorPolicy overrides --mirror_percent for an operation. It has no effect
+// if --mirror_backend_address is not set.
+type MirrorPolicy struct {
+	// Percentage in the range [0, 100], 0 disables the mirroring.
+	Percent float64 `json:"percent"`
+}
+
+// readOperationPolicies reads and validates the operation policy file.
+func readOperationPolicies(path string) (*OperationPolicies, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read operation policy file %s: %v", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	policies := &OperationPolicies{}
+	if err := decoder.Decode(policies); err != nil {
+		return nil, fmt.Errorf("fail to unmarshal operation policy file %s: %v", path, err)
+	}
+
+	if err := policies.Default.validate(); err != nil {
+		return nil, fmt.Errorf("invalid default operation policy: %v", err)
+	}
+	for selector, policy := range policies.Operations {
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("invalid operation policy for %s: %v", selector, err)
+		}
+	}
+	return policies, nil
+}
+
+// policyFor returns the effective policy for the given selector, falling back
+// to the default policy for every kind of policy the operation does not set.
+func (p *OperationPolicies) policyFor(selector string) *OperationPolicy {
+	policy := &OperationPolicy{}
+	if p.Default != nil {
+		*policy = *p.Default
+	}
+
+	op := p.Operations[selector]
+	if op == nil {
+		return policy
+	}
+	if op.Tracing != nil {
+		policy.Tracing = op.Tracing
+	}
+	if op.ExtAuthz != nil {
+		policy.ExtAuthz = op.ExtAuthz
+	}
+	if op.Authorization != nil {
+		policy.Authorization = op.Authorization
+	}
+	if op.Authentication != nil {
+		policy.Authentication = op.Authentication
+	}
+	if op.ApiKey != nil {
+		policy.ApiKey = op.ApiKey
+	}
+	if op.Headers != nil {
+		policy.Headers = op.Headers
+	}
+	if op.RateLimit != nil {
+		policy.RateLimit = op.RateLimit
+	}
+	if op.RequestBody != nil {
+		policy.RequestBody = op.RequestBody
+	}
+	if op.Websocket != nil {
+		policy.Websocket = op.Websocket
+	}
+	if op.Mirror != nil {
+		policy.Mirror = op.Mirror
+	}
+	return policy
+}
+
+func (p *OperationPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.Tracing != nil {
+		for name, value := range map[string]*float64{
+			"client_sampling":  p.Tracing.ClientSampling,
+			"random_sampling":  p.Tracing.RandomSampling,
+			"overall_sampling": p.Tracing.OverallSampling,
+		} {
+			if value != nil && (*value < 0 || *value > 100) {
+				return fmt.Errorf("tracing %s must be >= 0 and <= 100, got %v", name, *value)
+			}
+		}
+	}
+	if p.Authentication != nil {
+		switch p.Authentication.Mode {
+		case "", AllowMissingOrFailed:
+		case AllowMissing:
+			return fmt.Errorf("authentication mode %s is not supported by the JWT Authn filter, use %s", AllowMissing, AllowMissingOrFailed)
+		default:
+			return fmt.Errorf("authentication mode must be %s, got %q", AllowMissingOrFailed, p.Authentication.Mode)
+		}
+	}
+	if p.ApiKey != nil {
+		for _, cookie := range p.ApiKey.Cookies {
+			if !headerNameRegexp.MatchString(cookie) {
+				return fmt.Errorf("api_key has invalid cookie name %q", cookie)
+			}
+		}
+	}
+	if p.Headers != nil {
+		if err := p.Headers.validate(); err != nil {
+			return err
+		}
+	}
+	if p.Mirror != nil && (p.Mirror.Percent < 0 || p.Mirror.Percent > 100) {
+		return fmt.Errorf("mirror percent must be >= 0 and <= 100, got %v", p.Mirror.Percent)
+	}
+	if p.RequestBody != nil && p.RequestBody.MaxRequestBytes == 0 {
+		return fmt.Errorf("request_body max_request_bytes must be > 0")
+	}
+	if p.RateLimit != nil {
+		for i, descriptor := range p.RateLimit.Descriptors {
+			if len(descriptor) == 0 {
+				return fmt.Errorf("rate_limit descriptors[%d] must not be empty", i)
+			}
+			seen := make(map[string]bool)
+			for _, entry := range descriptor {
+				switch entry {
+				case RateLimitOperation, RateLimitApiKey, RateLimitJwtSub, RateLimitClientIP:
+				default:
+					return fmt.Errorf("rate_limit descriptors[%d] has unknown entry %q, must be one of %s, %s, %s and %s",
+						i, entry, RateLimitOperation, RateLimitApiKey, RateLimitJwtSub, RateLimitClientIP)
+				}
+				if seen[entry] {
+					return fmt.Errorf("rate_limit descriptors[%d] has duplicated entry %s", i, entry)
+				}
+				seen[entry] = true
+			}
+		}
+	}
+	if p.Authorization != nil {
+		for claim := range p.Authorization.RequiredClaims {
+			if claim == "" {
+				return fmt.Errorf("authorization required_claims must not have an empty claim name")
+			}
+		}
+		for _, scope := range p.Authorization.Scopes {
+			if scope == "" || strings.ContainsAny(scope, " \t") {
+				return fmt.Errorf("authorization scope must be non-empty without spaces, got %q", scope)
+			}
+		}
+		for _, cidr := range p.Authorization.SourceCidrs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("authorization source_cidrs has invalid CIDR %s: %v", cidr, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (h *HeadersPolicy) validate() error {
+	for field, headers := range map[string][]*HeaderToAdd{
+		"request_headers_to_add":  h.RequestHeadersToAdd,
+		"response_headers_to_add": h.ResponseHeadersToAdd,
+	} {
+		for i, header := range headers {
+			if err := validateManipulatedHeader(header.Name); err != nil {
+				return fmt.Errorf("headers %s[%d] %v", field, i, err)
+			}
+		}
+	}
+	for field, names := range map[string][]string{
+		"request_headers_to_remove":  h.RequestHeadersToRemove,
+		"response_headers_to_remove": h.ResponseHeadersToRemove,
+	} {
+		for i, name := range names {
+			if err := validateManipulatedHeader(name); err != nil {
+				return fmt.Errorf("headers %s[%d] %v", field, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Pseudo headers are rejected by the name check. The Host header is used
+// for routing, so it cannot be manipulated either.
+func validateManipulatedHeader(name string) error {
+	if !headerNameRegexp.MatchString(name) {
+		return fmt.Errorf("has invalid header name %q", name)
+	}
+	if strings.EqualFold(name, "Host") {
+		return fmt.Errorf("cannot manipulate header %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+	"github.com/google/go-cmp/cmp"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
+
+func TestProcessOperationPolicies(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "DeleteShelf",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                 string
+		policy               string
+		wantTracingPolicies  map[string]*TracingPolicy
+		wantExtAuthzPolicies map[string]*ExtAuthzPolicy
+		// Set --rate_limit_service_address without a service control filter.
+		withRateLimitService bool
+		wantErr              string
+	}{
+		{
+			desc: "Operation policy overrides the default policy",
+			policy: `{
+  "default": {
+    "tracing": {
+      "random_sampling": 1
+    }
+  },
+  "operations": {
+    "endpoints.examples.bookstore.Bookstore.ListShelves": {
+      "tracing": {
+        "random_sampling": 0.5,
+        "client_sampling": 100
+      }
+    }
+  }
+}`,
+			wantTracingPolicies: map[string]*TracingPolicy{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					RandomSampling: float64Ptr(0.5),
+					ClientSampling: float64Ptr(100),
+				},
+				"endpoints.examples.bookstore.Bookstore.DeleteShelf": {
+					RandomSampling: float64Ptr(1),
+				},
+			},
+		},
+		{
+			desc:   "No default policy",
+			policy: `{"operations": {"endpoints.examples.bookstore.Bookstore.DeleteShelf": {"tracing": {"overall_sampling": 10}}}}`,
+			wantTracingPolicies: map[string]*TracingPolicy{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": nil,
+				"endpoints.examples.bookstore.Bookstore.DeleteShelf": {
+					OverallSampling: float64Ptr(10),
+				},
+			},
+		},
+		{
+			desc: "Ext authz is disabled by default, but enabled for one operation",
+			policy: `{
+  "default": {
+    "ext_authz": {
+      "disabled": true
+    }
+  },
+  "operations": {
+    "endpoints.examples.bookstore.Bookstore.DeleteShelf": {
+      "ext_authz": {
+        "disabled": false
+      }
+    }
+  }
+}`,
+			wantExtAuthzPolicies: map[string]*ExtAuthzPolicy{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {
+					Disabled: true,
+				},
+				"endpoints.examples.bookstore.Bookstore.DeleteShelf": {
+					Disabled: false,
+				},
+			},
+		},
+		{
+			desc:    "Unknown selector",
+			policy:  `{"operations": {"endpoints.examples.bookstore.Bookstore.GetShelf": {}}}`,
+			wantErr: "operation policy is set for unknown selector endpoints.examples.bookstore.Bookstore.GetShelf",
+		},
+		{
+			desc:    "Sampling percentage out of range",
+			policy:  `{"default": {"tracing": {"random_sampling": 101}}}`,
+			wantErr: "tracing random_sampling must be >= 0 and <= 100, got 101",
+		},
+		{
+			desc:    "Invalid source CIDR in authorization policy",
+			policy:  `{"default": {"authorization": {"source_cidrs": ["10.0.0.0/33"]}}}`,
+			wantErr: "authorization source_cidrs has invalid CIDR 10.0.0.0/33",
+		},
+		{
+			desc:    "Scope with a space in authorization policy",
+			policy:  `{"default": {"authorization": {"scopes": ["read write"]}}}`,
+			wantErr: `authorization scope must be non-empty without spaces, got "read write"`,
+		},
+		{
+			desc:    "Unknown authentication mode",
+			policy:  `{"default": {"authentication": {"mode": "optional"}}}`,
+			wantErr: `authentication mode must be allow_missing_or_failed, got "optional"`,
+		},
+		{
+			desc:    "Unsupported allow_missing authentication mode",
+			policy:  `{"operations": {"endpoints.examples.bookstore.Bookstore.ListShelves": {"authentication": {"mode": "allow_missing"}}}}`,
+			wantErr: "authentication mode allow_missing is not supported by the JWT Authn filter, use allow_missing_or_failed",
+		},
+		{
+			desc:    "Invalid API key cookie name",
+			policy:  `{"default": {"api_key": {"cookies": ["api key"]}}}`,
+			wantErr: `api_key has invalid cookie name "api key"`,
+		},
+		{
+			desc:    "Invalid header name in headers policy",
+			policy:  `{"default": {"headers": {"request_headers_to_add": [{"name": ":authority", "value": "example.com"}]}}}`,
+			wantErr: `headers request_headers_to_add[0] has invalid header name ":authority"`,
+		},
+		{
+			desc:    "Removing the Host header in headers policy",
+			policy:  `{"default": {"headers": {"request_headers_to_remove": ["host"]}}}`,
+			wantErr: "headers request_headers_to_remove[0] cannot manipulate header host",
+		},
+		{
+			desc:    "Zero request body size limit",
+			policy:  `{"default": {"request_body": {"max_request_bytes": 0}}}`,
+			wantErr: "request_body max_request_bytes must be > 0",
+		},
+		{
+			desc:    "Mirror percentage out of range",
+			policy:  `{"operations": {"endpoints.examples.bookstore.Bookstore.ListShelves": {"mirror": {"percent": -1}}}}`,
+			wantErr: "mirror percent must be >= 0 and <= 100, got -1",
+		},
+		{
+			desc:    "Empty rate limit descriptor",
+			policy:  `{"default": {"rate_limit": {"descriptors": [["operation"], []]}}}`,
+			wantErr: "rate_limit descriptors[1] must not be empty",
+		},
+		{
+			desc:    "Unknown rate limit descriptor entry",
+			policy:  `{"default": {"rate_limit": {"descriptors": [["operation", "user"]]}}}`,
+			wantErr: `rate_limit descriptors[0] has unknown entry "user"`,
+		},
+		{
+			desc:                 "Rate limit descriptor with JWT sub claim without the service control filter",
+			policy:               `{"default": {"rate_limit": {"descriptors": [["operation", "jwt_sub"]]}}}`,
+			withRateLimitService: true,
+			wantErr:              "use api_key or jwt_sub, which require the service control filter",
+		},
+		{
+			desc:    "Unknown field",
+			policy:  `{"default": {"tracing": {"sampling": 1}}}`,
+			wantErr: `unknown field "sampling"`,
+		},
+		{
+			desc:    "Compression policy is not supported",
+			policy:  `{"default": {"compression": {"disabled": true}}}`,
+			wantErr: `unknown field "compression"`,
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "grpc"
+		if tc.withRateLimitService {
+			opts.RateLimitServiceAddress = "grpc://ratelimit:8081"
+		}
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: tc.policy})()
+		serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for selector, wantTracingPolicy := range tc.wantTracingPolicies {
+			gotTracingPolicy := serviceInfo.Methods[selector].TracingPolicy
+			if !cmp.Equal(gotTracingPolicy, wantTracingPolicy) {
+				t.Errorf("Test Desc(%d): %s, selector %s,\ngot TracingPolicy: %+v,\nwant TracingPolicy: %+v", i, tc.desc, selector, gotTracingPolicy, wantTracingPolicy)
+			}
+		}
+		for selector, wantExtAuthzPolicy := range tc.wantExtAuthzPolicies {
+			gotExtAuthzPolicy := serviceInfo.Methods[selector].ExtAuthzPolicy
+			if !cmp.Equal(gotExtAuthzPolicy, wantExtAuthzPolicy) {
+				t.Errorf("Test Desc(%d): %s, selector %s,\ngot ExtAuthzPolicy: %+v,\nwant ExtAuthzPolicy: %+v", i, tc.desc, selector, gotExtAuthzPolicy, wantExtAuthzPolicy)
+			}
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"net"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
@@ -42,6 +43,8 @@ type ServiceInfo struct {
 
 	// An array to store all the api names
 	ApiNames []string
+	// The version of each api, keyed by api name.
+	ApiVersions map[string]string
 	// A sorted array to store all the method name for this service.
 	// Should always iterate this array to avoid test fail due to order issue.
 	Operations []string
@@ -62,6 +65,28 @@ type ServiceInfo struct {
 	serviceConfig *confpb.Service
 	AccessToken   *commonpb.AccessToken
 	Options       options.ConfigGeneratorOptions
+	// Filters and clusters from the custom filter file.
+	CustomFilters *CustomFilters
+	// Options of the JWT providers, using provider id as key.
+	JwtProviderOptions map[string]*JwtProviderOptions
+	// JWKS of the providers not fetching it remotely, using provider id as key.
+	LocalJwks map[string]*LocalJwks
+	// Header manipulation of the routes not belonging to an operation, from
+	// the default section of the operation policy file.
+	DefaultHeadersPolicy *HeadersPolicy
+	// Trace sampling of the routes not belonging to an operation, from the
+	// default section of the operation policy file.
+	DefaultTracingPolicy *TracingPolicy
+	// CORS policies from the CORS policy file.
+	CorsPolicies *CorsPolicies
+	// Local reply configs of the ESPv2 filters, using the local reply class as
+	// key. Nil if the local replies are not customized.
+	LocalReplyConfigs map[string]*commonpb.LocalReplyConfig
+	// The shadow backend receiving the mirrored requests, nil if the requests
+	// are not mirrored.
+	MirrorBackend *BackendRoutingCluster
+	// Weighted backends of the catch-all route, from the backend split file.
+	CatchAllBackendSplit *BackendSplit
 }
 
 type BackendRoutingCluster struct {
@@ -99,16 +124,37 @@ func NewServiceInfoFromServiceConfig(serviceConfig *confpb.Service, id string, o
 	//    used by processBackendRule
 	// * BackendIsGrpc:
 	//     set by processBackendRule, buildCatchAllBackend
-	//     used by addGrpcHttpRules
+	//     used by addGrpcHttpRules, processCaseInsensitiveMatching
+	// * Methods:
+	//     set by processApis, processHttpRule, addGrpcHttpRules and others
+	//     used by processOperationPolicies
+	// * WebsocketPolicy:
+	//     set by processOperationPolicies
+	//     used by processWebsocket
+	// * BackendRoutingClusters:
+	//     set by processBackendRule, processBackendSplits
+	//     used by processWebsocket, processBackendSplits
+	// * JwtProviderOptions:
+	//     set by processJwtProviderOptions
+	//     used by processLocalJwks
+	// * LocalJwks:
+	//     set by processLocalJwks
+	//     used by processEmptyJwksUriByOpenID
 	if err := serviceInfo.buildCatchAllBackend(); err != nil {
 		return nil, err
 	}
 	serviceInfo.processEndpoints()
 	serviceInfo.processApis()
 	serviceInfo.processQuota()
+	if err := serviceInfo.processLocalQuota(); err != nil {
+		return nil, err
+	}
 	if err := serviceInfo.processBackendRule(); err != nil {
 		return nil, err
 	}
+	if err := serviceInfo.processCaseInsensitiveMatching(); err != nil {
+		return nil, err
+	}
 	if err := serviceInfo.processHttpRule(); err != nil {
 		return nil, err
 	}
@@ -121,6 +167,33 @@ func NewServiceInfoFromServiceConfig(serviceConfig *confpb.Service, id string, o
 	serviceInfo.processAccessToken()
 	serviceInfo.processTypes()
 	serviceInfo.addGrpcHttpRules()
+	if err := serviceInfo.processOperationPolicies(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processCustomFilters(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processWebsocket(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processMirrorBackend(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processBackendSplits(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processCorsPolicies(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processLocalReplies(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processJwtProviderOptions(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processLocalJwks(); err != nil {
+		return nil, err
+	}
 
 	if err := serviceInfo.processEmptyJwksUriByOpenID(); err != nil {
 		return nil, err
@@ -160,31 +233,57 @@ func (s *ServiceInfo) ServiceConfig() *confpb.Service {
 	return s.serviceConfig
 }
 
+// processEmptyJwksUriByOpenID resolves the empty jwks_uri of the providers
+// using the OpenID Connect Discovery protocol, concurrently. A provider whose
+// jwks_uri cannot be resolved is disabled, instead of failing the whole config:
+// its JWTs are always rejected. With OpenIDDiscoveryFailFast, it fails the
+// config instead.
 func (s *ServiceInfo) processEmptyJwksUriByOpenID() error {
-	authn := s.serviceConfig.GetAuthentication()
-	for _, provider := range authn.GetProviders() {
-		jwksUri := provider.GetJwksUri()
-
-		// Note: When jwksUri is empty, proxy will try to find jwksUri using the
-		// OpenID Connect Discovery protocol.
-		if jwksUri == "" {
-			glog.Infof("jwks_uri is empty, using OpenID Connect Discovery protocol")
-			jwksUriByOpenID, err := util.ResolveJwksUriUsingOpenID(provider.GetIssuer())
-			if err != nil {
-				return fmt.Errorf("failed OpenID Connect Discovery protocol: %v", err)
-			} else {
-				jwksUri = jwksUriByOpenID
-			}
-			provider.JwksUri = jwksUri
+	var providers []*confpb.AuthProvider
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		if _, ok := s.LocalJwks[provider.GetId()]; ok {
+			continue
 		}
+		if provider.GetJwksUri() == "" {
+			providers = append(providers, provider)
+		}
+	}
+	if len(providers) == 0 {
+		return nil
 	}
 
+	discovery := newOpenIDDiscovery(s.Options)
+	errs := make([]error, len(providers))
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(i int, provider *confpb.AuthProvider) {
+			defer wg.Done()
+			glog.Infof("jwks_uri of provider %s is empty, using OpenID Connect Discovery protocol", provider.GetId())
+			provider.JwksUri, errs[i] = discovery.resolveJwksUri(provider.GetIssuer())
+		}(i, provider)
+	}
+	wg.Wait()
+
+	for i, provider := range providers {
+		if errs[i] != nil {
+			if s.Options.OpenIDDiscoveryFailFast {
+				return fmt.Errorf("failed OpenID Connect Discovery protocol for provider %s: %v", provider.GetId(), errs[i])
+			}
+			glog.Errorf("JWT provider %s is disabled, all its JWTs will be rejected: %v", provider.GetId(), errs[i])
+			s.LocalJwks[provider.GetId()] = &LocalJwks{
+				Content: disabledProviderJwks,
+			}
+		}
+	}
 	return nil
 }
 
 func (s *ServiceInfo) processApis() {
+	s.ApiVersions = make(map[string]string)
 	for _, api := range s.serviceConfig.GetApis() {
 		s.ApiNames = append(s.ApiNames, api.Name)
+		s.ApiVersions[api.Name] = api.GetVersion()
 
 		for _, method := range api.GetMethods() {
 			selector := fmt.Sprintf("%s.%s", api.GetName(), method.GetName())
@@ -254,6 +353,63 @@ func (s *ServiceInfo) processQuota() {
 	}
 }
 
+// The only unit of the quota limits enforced locally: a number of tokens per
+// minute for each consumer project.
+const localQuotaLimitUnit = "1/min/{project}"
+
+// processLocalQuota sets the quota limits of the methods enforced by the proxy
+// itself when local quota is enabled. They are enforced by the Service Control
+// filter, so it must not be skipped.
+func (s *ServiceInfo) processLocalQuota() error {
+	if !s.Options.EnablePerWorkerLocalQuota {
+		return nil
+	}
+	if s.Options.SkipServiceControlFilter || s.ServiceConfig().GetControl().GetEnvironment() == "" {
+		return fmt.Errorf("enable_per_worker_local_quota requires the service control filter, it cannot be used with skip_service_control_filter or without a control environment")
+	}
+
+	limitsByMetric := make(map[string][]*confpb.QuotaLimit)
+	for _, limit := range s.ServiceConfig().GetQuota().GetLimits() {
+		if limit.GetUnit() != localQuotaLimitUnit {
+			glog.Warningf("quota limit %s is not enforced locally, its unit %s is not %s", limit.GetName(), limit.GetUnit(), localQuotaLimitUnit)
+			continue
+		}
+		limitsByMetric[limit.GetMetric()] = append(limitsByMetric[limit.GetMetric()], limit)
+	}
+
+	for _, metricRule := range s.ServiceConfig().GetQuota().GetMetricRules() {
+		method, ok := s.Methods[metricRule.GetSelector()]
+		if !ok {
+			continue
+		}
+		var metrics []string
+		for metric := range metricRule.GetMetricCosts() {
+			metrics = append(metrics, metric)
+		}
+		sort.Strings(metrics)
+
+		for _, metric := range metrics {
+			cost := metricRule.GetMetricCosts()[metric]
+			if cost <= 0 {
+				continue
+			}
+			for _, limit := range limitsByMetric[metric] {
+				// A negative value means no limit.
+				perMinute, ok := limit.GetValues()["STANDARD"]
+				if !ok || perMinute < 0 {
+					continue
+				}
+				method.LocalQuotaLimits = append(method.LocalQuotaLimits, &LocalQuotaLimit{
+					Name:      limit.GetName(),
+					Cost:      cost,
+					PerMinute: perMinute,
+				})
+			}
+		}
+	}
+	return nil
+}
+
 func (s *ServiceInfo) processEndpoints() {
 	for _, endpoint := range s.ServiceConfig().GetEndpoints() {
 		if endpoint.GetName() == s.ServiceConfig().GetName() && endpoint.GetAllowCors() {
@@ -516,6 +672,26 @@ func (s *ServiceInfo) processSystemParameters() error {
 	return nil
 }
 
+// DefaultAPIKeyLocations are the locations of the API key used by the Service
+// Control filter for the methods not configuring them.
+var DefaultAPIKeyLocations = []*scpb.APIKeyLocation{
+	{
+		Key: &scpb.APIKeyLocation_Query{
+			Query: "key",
+		},
+	},
+	{
+		Key: &scpb.APIKeyLocation_Query{
+			Query: "api_key",
+		},
+	},
+	{
+		Key: &scpb.APIKeyLocation_Header{
+			Header: "x-api-key",
+		},
+	},
+}
+
 func extractAPIKeyLocations(method *methodInfo, parameters []*confpb.SystemParameter) {
 	var urlQueryNames, headerNames []*scpb.APIKeyLocation
 	for _, parameter := range parameters {
@@ -538,6 +714,493 @@ func extractAPIKeyLocations(method *methodInfo, parameters []*confpb.SystemParam
 	method.APIKeyLocations = append(method.APIKeyLocations, headerNames...)
 }
 
+func (s *ServiceInfo) processOperationPolicies() error {
+	if s.Options.OperationPolicyPath == "" {
+		return nil
+	}
+	policies, err := readOperationPolicies(s.Options.OperationPolicyPath)
+	if err != nil {
+		return err
+	}
+
+	for selector := range policies.Operations {
+		if _, ok := s.Methods[selector]; !ok {
+			return fmt.Errorf("operation policy is set for unknown selector %s", selector)
+		}
+	}
+	if policies.Default != nil {
+		s.DefaultHeadersPolicy = policies.Default.Headers
+		s.DefaultTracingPolicy = policies.Default.Tracing
+	}
+	for selector, method := range s.Methods {
+		policy := policies.policyFor(selector)
+		method.TracingPolicy = policy.Tracing
+		method.ExtAuthzPolicy = policy.ExtAuthz
+		method.AuthorizationPolicy = policy.Authorization
+		method.AuthenticationPolicy = policy.Authentication
+		method.HeadersPolicy = policy.Headers
+		method.RateLimitPolicy = policy.RateLimit
+		if s.Options.RateLimitServiceAddress != "" && policy.RateLimit.usesServiceControlHeaders() &&
+			(s.Options.SkipServiceControlFilter || s.ServiceConfig().GetControl().GetEnvironment() == "") {
+			return fmt.Errorf("rate_limit descriptors of %s use %s or %s, which require the service control filter", selector, RateLimitApiKey, RateLimitJwtSub)
+		}
+		method.RequestBodyPolicy = policy.RequestBody
+		method.WebsocketPolicy = policy.Websocket
+		method.MirrorPolicy = policy.Mirror
+		if policy.ApiKey != nil && len(policy.ApiKey.Cookies) > 0 {
+			// Cookies are added to the locations from the system parameters,
+			// or to the default locations.
+			if len(method.APIKeyLocations) == 0 {
+				method.APIKeyLocations = append(method.APIKeyLocations, DefaultAPIKeyLocations...)
+			}
+			for _, cookie := range policy.ApiKey.Cookies {
+				method.APIKeyLocations = append(method.APIKeyLocations, &scpb.APIKeyLocation{
+					Key: &scpb.APIKeyLocation_Cookie{
+						Cookie: cookie,
+					},
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// processCustomFilters reads the custom filter file once, for both the
+// filter chain and the clusters.
+func (s *ServiceInfo) processCustomFilters() error {
+	if s.Options.CustomFiltersPath == "" {
+		return nil
+	}
+	customFilters, err := readCustomFilters(s.Options.CustomFiltersPath)
+	if err != nil {
+		return err
+	}
+	s.CustomFilters = customFilters
+	return nil
+}
+
+// processCaseInsensitiveMatching rejects --case_insensitive_matching with a
+// gRPC backend, since the gRPC method paths are case-sensitive.
+func (s *ServiceInfo) processCaseInsensitiveMatching() error {
+	if s.Options.CaseInsensitiveMatching && s.BackendIsGrpc {
+		return fmt.Errorf("case_insensitive_matching is not supported with a gRPC backend, gRPC method paths are case-sensitive")
+	}
+	return nil
+}
+
+// processWebsocket decides which methods allow WebSocket upgrades. The
+// global flag only applies to the methods with an HTTP backend, while
+// enabling it explicitly for other methods is an error.
+func (s *ServiceInfo) processWebsocket() error {
+	if s.Options.EnableWebsocket && s.CatchAllBackend.Protocol != util.HTTP {
+		return fmt.Errorf("enable_websocket requires an HTTP backend, got backend protocol %s", s.Options.BackendProtocol)
+	}
+	for selector, method := range s.Methods {
+		isHttp := !method.IsStreaming && s.backendProtocol(method) == util.HTTP
+		if method.WebsocketPolicy == nil {
+			method.AllowWebsocket = s.Options.EnableWebsocket && isHttp && !method.IsGenerated
+			continue
+		}
+		if method.WebsocketPolicy.Enabled && !isHttp {
+			return fmt.Errorf("websocket can only be enabled for operations with an HTTP backend, got %s", selector)
+		}
+		method.AllowWebsocket = method.WebsocketPolicy.Enabled
+	}
+	return nil
+}
+
+// processMirrorBackend builds the shadow backend from --mirror_backend_address.
+// Its protocol must be the one of the backends of the mirrored methods, a gRPC
+// request can not be sent to an HTTP backend and vice versa.
+func (s *ServiceInfo) processMirrorBackend() error {
+	address := s.Options.MirrorBackendAddress
+	if address == "" {
+		return nil
+	}
+	if !strings.Contains(address, "://") {
+		return fmt.Errorf("invalid mirror backend address %s: scheme must be one of grpc, grpcs, http or https", address)
+	}
+	scheme, hostname, port, path, err := util.ParseURI(address)
+	if err != nil {
+		return fmt.Errorf("invalid mirror backend address %s: %v", address, err)
+	}
+	if path != "" {
+		return fmt.Errorf("invalid mirror backend address %s: path is not allowed", address)
+	}
+	protocol, tls, err := util.ParseBackendProtocol(scheme)
+	if err != nil {
+		return fmt.Errorf("invalid mirror backend address %s: %v", address, err)
+	}
+
+	for selector, method := range s.Methods {
+		percent := s.Options.MirrorPercent
+		if method.MirrorPolicy != nil {
+			percent = method.MirrorPolicy.Percent
+		}
+		if percent == 0 || method.IsStreaming {
+			continue
+		}
+		if s.backendProtocol(method) != protocol {
+			return fmt.Errorf("the protocol of mirror backend address %s must be the one of the backend of operation %s", address, selector)
+		}
+	}
+
+	s.MirrorBackend = &BackendRoutingCluster{
+		ClusterName:  util.MirrorClusterName,
+		Hostname:     hostname,
+		Port:         port,
+		UseTLS:       tls,
+		Protocol:     protocol,
+		HttpProtocol: util.HTTP1,
+	}
+	return nil
+}
+
+// backendProtocol returns the protocol of the backend the method is routed to.
+func (s *ServiceInfo) backendProtocol(method *methodInfo) util.BackendProtocol {
+	if method.BackendInfo == nil {
+		return s.CatchAllBackend.Protocol
+	}
+	for _, cluster := range s.BackendRoutingClusters {
+		if cluster.ClusterName == method.BackendInfo.ClusterName {
+			return cluster.Protocol
+		}
+	}
+	return s.CatchAllBackend.Protocol
+}
+
+// processBackendSplits reads the backend split file. The backends get the
+// cluster of the catch-all backend or of a BackendRule with the same address,
+// or a new backend routing cluster.
+//
+// With dynamic routing, only the operations with a BackendRule address are
+// routed, see MakeRouteConfig, so the other splits are rejected instead of
+// being ignored.
+func (s *ServiceInfo) processBackendSplits() error {
+	if s.Options.BackendSplitPath == "" {
+		return nil
+	}
+	splits, err := readBackendSplits(s.Options.BackendSplitPath)
+	if err != nil {
+		return err
+	}
+
+	dynamicRouting := false
+	for _, method := range s.Methods {
+		if method.BackendInfo != nil {
+			dynamicRouting = true
+			break
+		}
+	}
+	if splits.CatchAll != nil {
+		if dynamicRouting {
+			return fmt.Errorf("catch-all backend split is not supported with dynamic routing, split the operations with a BackendRule address instead")
+		}
+		if err := s.addBackendSplitClusters(splits.CatchAll, s.CatchAllBackend.Protocol, "", false); err != nil {
+			return fmt.Errorf("invalid catch-all backend split: %v", err)
+		}
+		s.CatchAllBackendSplit = splits.CatchAll
+	}
+	for selector, split := range splits.Operations {
+		method, ok := s.Methods[selector]
+		if !ok {
+			return fmt.Errorf("backend split is set for unknown selector %s", selector)
+		}
+		if dynamicRouting && method.BackendInfo == nil {
+			return fmt.Errorf("backend split for %s is not supported with dynamic routing, the operation has no BackendRule address", selector)
+		}
+		if err := s.addBackendSplitClusters(split, s.backendProtocol(method), s.derivedJwtAudience(selector, method), method.BackendInfo != nil); err != nil {
+			return fmt.Errorf("invalid backend split for %s: %v", selector, err)
+		}
+	}
+	for selector, method := range s.Methods {
+		if split, ok := splits.Operations[selector]; ok {
+			method.BackendSplit = split
+		} else if method.BackendInfo == nil {
+			method.BackendSplit = s.CatchAllBackendSplit
+		}
+	}
+	return nil
+}
+
+// derivedJwtAudience returns the JWT audience of the method if it is derived
+// from the address of its BackendRule, or "" if the audience is set explicitly
+// or backend auth is disabled.
+func (s *ServiceInfo) derivedJwtAudience(selector string, method *methodInfo) string {
+	if method.BackendInfo == nil {
+		return ""
+	}
+	for _, r := range s.ServiceConfig().GetBackend().GetRules() {
+		if r.GetSelector() != selector {
+			continue
+		}
+		if _, ok := r.GetAuthentication().(*confpb.BackendRule_JwtAudience); ok {
+			return ""
+		}
+	}
+	return method.BackendInfo.JwtAudience
+}
+
+// addBackendSplitClusters sets the clusters of the backends of the split.
+// If jwtAudience, derived from the BackendRule address, is not empty, the
+// backends without jwt_audience get the one derived from their address.
+// The backends of a split with dynamic routing must have a domain name, like
+// the BackendRule addresses.
+func (s *ServiceInfo) addBackendSplitClusters(split *BackendSplit, protocol util.BackendProtocol, jwtAudience string, dynamicRouting bool) error {
+	for i, backend := range split.Backends {
+		scheme, hostname, port, path, err := util.ParseURI(backend.Address)
+		if err != nil {
+			return fmt.Errorf("backends[%d] has invalid address %s: %v", i, backend.Address, err)
+		}
+		if path != "" {
+			return fmt.Errorf("backends[%d] address %s must not have a path", i, backend.Address)
+		}
+		backendProtocol, tls, err := util.ParseBackendProtocol(scheme)
+		if err != nil {
+			return fmt.Errorf("backends[%d] has invalid address %s: %v", i, backend.Address, err)
+		}
+		// The filters, e.g. the transcoder, are generated for the protocol of
+		// the original backend.
+		if backendProtocol != protocol {
+			return fmt.Errorf("backends[%d] address %s must have the protocol of the backend it splits", i, backend.Address)
+		}
+		if backend.JwtAudience == "" && jwtAudience != "" {
+			if derived := getJwtAudienceFromBackendAddr(scheme, hostname); derived != jwtAudience {
+				backend.JwtAudience = derived
+			}
+		}
+
+		if s.CatchAllBackend.Hostname == hostname && s.CatchAllBackend.Port == port {
+			backend.ClusterName = s.CatchAllBackend.ClusterName
+			continue
+		}
+		address := fmt.Sprintf("%v:%v", hostname, port)
+		backend.ClusterName = address
+		exists := false
+		for _, cluster := range s.BackendRoutingClusters {
+			if cluster.ClusterName == address {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			if dynamicRouting && net.ParseIP(hostname) != nil {
+				return fmt.Errorf("backends[%d] address must be a domain name, got IP address: %v", i, hostname)
+			}
+			s.BackendRoutingClusters = append(s.BackendRoutingClusters,
+				&BackendRoutingCluster{
+					ClusterName:  address,
+					UseTLS:       tls,
+					Protocol:     backendProtocol,
+					HttpProtocol: util.HTTP1,
+					Hostname:     hostname,
+					Port:         port,
+				})
+		}
+	}
+	return nil
+}
+
+// BackendSplitJwtAudiences returns the sorted JWT audiences of the backends of
+// the splits, which override the ones of the operations.
+func (s *ServiceInfo) BackendSplitJwtAudiences() []string {
+	splits := []*BackendSplit{s.CatchAllBackendSplit}
+	for _, method := range s.Methods {
+		splits = append(splits, method.BackendSplit)
+	}
+	seen := make(map[string]bool)
+	var audiences []string
+	for _, split := range splits {
+		if split == nil {
+			continue
+		}
+		for _, backend := range split.Backends {
+			if backend.JwtAudience != "" && !seen[backend.JwtAudience] {
+				seen[backend.JwtAudience] = true
+				audiences = append(audiences, backend.JwtAudience)
+			}
+		}
+	}
+	sort.Strings(audiences)
+	return audiences
+}
+
+// HasWebsocket returns true if any route allows WebSocket upgrades.
+func (s *ServiceInfo) HasWebsocket() bool {
+	if s.Options.EnableWebsocket {
+		return true
+	}
+	for _, method := range s.Methods {
+		if method.AllowWebsocket {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ServiceInfo) processCorsPolicies() error {
+	if s.Options.CorsPolicyPath == "" {
+		return nil
+	}
+	if s.Options.CorsPreset != "" {
+		return fmt.Errorf("cors_preset and cors_policy_path cannot be both set")
+	}
+	policies, err := readCorsPolicies(s.Options.CorsPolicyPath)
+	if err != nil {
+		return err
+	}
+
+	for apiName := range policies.Apis {
+		found := false
+		for _, name := range s.ApiNames {
+			if name == apiName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("CORS policy is set for unknown api %s", apiName)
+		}
+	}
+	s.CorsPolicies = policies
+	return nil
+}
+
+func (s *ServiceInfo) processJwtProviderOptions() error {
+	if s.Options.JwtProviderOptionsPath == "" {
+		return nil
+	}
+	file, err := readJwtProviderOptions(s.Options.JwtProviderOptionsPath)
+	if err != nil {
+		return err
+	}
+
+	providers := s.serviceConfig.GetAuthentication().GetProviders()
+	for issuer := range file.Issuers {
+		found := false
+		for _, provider := range providers {
+			if provider.GetIssuer() == issuer {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("JWT provider options are set for unknown issuer %s", issuer)
+		}
+	}
+	s.JwtProviderOptions = make(map[string]*JwtProviderOptions)
+	for _, provider := range providers {
+		s.JwtProviderOptions[provider.GetId()] = file.optionsFor(provider.GetIssuer())
+	}
+	return nil
+}
+
+// processLocalJwks loads the JWKS of the providers with a "file://" jwks_uri,
+// or with a local JWKS in their options.
+func (s *ServiceInfo) processLocalJwks() error {
+	s.LocalJwks = make(map[string]*LocalJwks)
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		var path string
+		if strings.HasPrefix(provider.GetJwksUri(), fileUriPrefix) {
+			path = strings.TrimPrefix(provider.GetJwksUri(), fileUriPrefix)
+		}
+		if opts := s.JwtProviderOptions[provider.GetId()]; opts != nil {
+			if len(opts.Jwks) > 0 {
+				s.LocalJwks[provider.GetId()] = &LocalJwks{
+					Content: string(opts.Jwks),
+				}
+				continue
+			}
+			if opts.JwksPath != "" {
+				path = opts.JwksPath
+			}
+		}
+		if path == "" {
+			continue
+		}
+
+		jwks, err := readLocalJwks(path)
+		if err != nil {
+			return fmt.Errorf("fail to load JWKS of provider %s: %v", provider.GetId(), err)
+		}
+		s.LocalJwks[provider.GetId()] = jwks
+	}
+	return nil
+}
+
+// LocalJwksChanged returns whether any local JWKS file has been modified
+// since the ServiceInfo was created.
+func (s *ServiceInfo) LocalJwksChanged() bool {
+	for _, jwks := range s.LocalJwks {
+		if jwks.Changed() {
+			return true
+		}
+	}
+	return false
+}
+
+// JwtLocations returns the locations of the JWT for the given provider id,
+// or the default locations if the provider does not configure them.
+func (s *ServiceInfo) JwtLocations(providerId string) []*JwtLocation {
+	if opts := s.JwtProviderOptions[providerId]; opts != nil && len(opts.JwtLocations) > 0 {
+		return opts.JwtLocations
+	}
+	return defaultJwtLocations
+}
+
+// JwksDnsLookupFamily returns the DNS lookup family of the cluster fetching
+// the JWKS of the provider.
+func (s *ServiceInfo) JwksDnsLookupFamily(providerId string) string {
+	if opts := s.JwtProviderOptions[providerId]; opts != nil && opts.DnsLookupFamily != "" {
+		return opts.DnsLookupFamily
+	}
+	return "v4only"
+}
+
+// JwksFetchTimeout returns the timeout of fetching the JWKS of the provider.
+func (s *ServiceInfo) JwksFetchTimeout(providerId string) time.Duration {
+	if opts := s.JwtProviderOptions[providerId]; opts != nil && opts.JwksFetchTimeout != "" {
+		// Validated when the options are read.
+		d, _ := time.ParseDuration(opts.JwksFetchTimeout)
+		return d
+	}
+	return s.Options.HttpRequestTimeout
+}
+
+// JwksConnectTimeout returns the connect timeout of the cluster fetching the
+// JWKS of the provider, which is capped by its jwks_fetch_timeout.
+func (s *ServiceInfo) JwksConnectTimeout(providerId string) time.Duration {
+	if opts := s.JwtProviderOptions[providerId]; opts != nil && opts.JwksFetchTimeout != "" {
+		if d := s.JwksFetchTimeout(providerId); d < s.Options.ClusterConnectTimeout {
+			return d
+		}
+	}
+	return s.Options.ClusterConnectTimeout
+}
+
+// JwksCacheDuration returns the duration to cache the JWKS of the provider.
+func (s *ServiceInfo) JwksCacheDuration(providerId string) time.Duration {
+	if opts := s.JwtProviderOptions[providerId]; opts != nil && opts.JwksCacheDuration != "" {
+		d, _ := time.ParseDuration(opts.JwksCacheDuration)
+		return d
+	}
+	return time.Duration(s.Options.JwksCacheDurationInS) * time.Second
+}
+
+// JwtQueryParameters returns the names of the query parameters carrying JWT,
+// in the order of the providers.
+func (s *ServiceInfo) JwtQueryParameters() []string {
+	var names []string
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		for _, loc := range s.JwtLocations(provider.GetId()) {
+			if loc.Query != "" {
+				names = append(names, loc.Query)
+			}
+		}
+	}
+	return names
+}
+
 func (s *ServiceInfo) processTypes() {
 	// Create snake name to JSON name mapping.
 	for _, t := range s.ServiceConfig().GetTypes() {
@@ -20,11 +20,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
 	"github.com/golang/protobuf/proto"
 	"github.com/google/go-cmp/cmp"
 	"github.com/gorilla/mux"
@@ -1384,6 +1386,594 @@ func TestProcessQuota(t *testing.T) {
 	}
 }
 
+func TestProcessLocalQuota(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Control: &confpb.Control{
+			Environment: "servicecontrol.googleapis.com",
+		},
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+				},
+			},
+		},
+		Quota: &confpb.Quota{
+			Limits: []*confpb.QuotaLimit{
+				{
+					Name:   "per-minute-limit",
+					Metric: "metric_a",
+					Unit:   "1/min/{project}",
+					Values: map[string]int64{"STANDARD": 100},
+				},
+				{
+					Name:   "per-day-limit",
+					Metric: "metric_a",
+					Unit:   "1/d/{project}",
+					Values: map[string]int64{"STANDARD": 10000},
+				},
+				{
+					Name:   "unlimited",
+					Metric: "metric_b",
+					Unit:   "1/min/{project}",
+					Values: map[string]int64{"STANDARD": -1},
+				},
+				{
+					Name:   "free-metric-limit",
+					Metric: "metric_c",
+					Unit:   "1/min/{project}",
+					Values: map[string]int64{"STANDARD": 5},
+				},
+			},
+			MetricRules: []*confpb.MetricRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					MetricCosts: map[string]int64{
+						"metric_a": 2,
+						"metric_b": 1,
+						"metric_c": 0,
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                      string
+		enablePerWorkerLocalQuota bool
+		skipServiceControlFilter  bool
+		wantLimits                []*LocalQuotaLimit
+		wantErr                   string
+	}{
+		{
+			desc: "Local quota is disabled",
+		},
+		{
+			desc:                      "Only the per-minute limits with a cost and a value are enforced",
+			enablePerWorkerLocalQuota: true,
+			wantLimits: []*LocalQuotaLimit{
+				{
+					Name:      "per-minute-limit",
+					Cost:      2,
+					PerMinute: 100,
+				},
+			},
+		},
+		{
+			desc:                      "Service control filter is skipped",
+			enablePerWorkerLocalQuota: true,
+			skipServiceControlFilter:  true,
+			wantErr:                   "enable_per_worker_local_quota requires the service control filter",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "grpc"
+		opts.EnablePerWorkerLocalQuota = tc.enablePerWorkerLocalQuota
+		opts.SkipServiceControlFilter = tc.skipServiceControlFilter
+		serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Test Desc(%d): %s, expected err: %v, got: %v", i, tc.desc, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotLimits := serviceInfo.Methods["endpoints.examples.bookstore.Bookstore.ListShelves"].LocalQuotaLimits
+		if !cmp.Equal(gotLimits, tc.wantLimits) {
+			t.Errorf("Test Desc(%d): %s, got local quota limits: %v, want: %v", i, tc.desc, gotLimits, tc.wantLimits)
+		}
+	}
+}
+
+func TestProcessWebsocket(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "GetShelf",
+					},
+				},
+			},
+		},
+		Backend: &confpb.Backend{
+			Rules: []*confpb.BackendRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+					Address:  "grpc://shelves.example.com:8081",
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc            string
+		backendProtocol string
+		enableWebsocket bool
+		policy          string
+		wantAllow       map[string]bool
+		wantErr         string
+	}{
+		{
+			desc:            "Enabled globally, only for the operations with an HTTP backend",
+			backendProtocol: "http",
+			enableWebsocket: true,
+			wantAllow: map[string]bool{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": true,
+				"endpoints.examples.bookstore.Bookstore.GetShelf":    false,
+			},
+		},
+		{
+			desc:            "Disabled globally, enabled for one operation",
+			backendProtocol: "http",
+			policy:          `{"operations": {"endpoints.examples.bookstore.Bookstore.ListShelves": {"websocket": {"enabled": true}}}}`,
+			wantAllow: map[string]bool{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": true,
+				"endpoints.examples.bookstore.Bookstore.GetShelf":    false,
+			},
+		},
+		{
+			desc:            "Enabled globally with a gRPC backend",
+			backendProtocol: "grpc",
+			enableWebsocket: true,
+			wantErr:         "enable_websocket requires an HTTP backend, got backend protocol grpc",
+		},
+		{
+			desc:            "Enabled for an operation with a gRPC backend",
+			backendProtocol: "http",
+			policy:          `{"operations": {"endpoints.examples.bookstore.Bookstore.GetShelf": {"websocket": {"enabled": true}}}}`,
+			wantErr:         "websocket can only be enabled for operations with an HTTP backend, got endpoints.examples.bookstore.Bookstore.GetShelf",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = tc.backendProtocol
+		opts.EnableWebsocket = tc.enableWebsocket
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: tc.policy})()
+		serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want: %s", i, tc.desc, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for selector, wantAllow := range tc.wantAllow {
+			if got := serviceInfo.Methods[selector].AllowWebsocket; got != wantAllow {
+				t.Errorf("Test Desc(%d): %s, got AllowWebsocket for %s: %v, want: %v", i, tc.desc, selector, got, wantAllow)
+			}
+		}
+	}
+}
+
+func TestProcessCaseInsensitiveMatching(t *testing.T) {
+	testData := []struct {
+		desc            string
+		backendProtocol string
+		backendRules    []*confpb.BackendRule
+		wantErr         string
+	}{
+		{
+			desc:            "HTTP backend",
+			backendProtocol: "http",
+		},
+		{
+			desc:            "gRPC backend",
+			backendProtocol: "grpc",
+			wantErr:         "case_insensitive_matching is not supported with a gRPC backend, gRPC method paths are case-sensitive",
+		},
+		{
+			desc:            "gRPC backend of a BackendRule",
+			backendProtocol: "http",
+			backendRules: []*confpb.BackendRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+					Address:  "grpc://shelves.example.com:8081",
+				},
+			},
+			wantErr: "case_insensitive_matching is not supported with a gRPC backend, gRPC method paths are case-sensitive",
+		},
+	}
+
+	for i, tc := range testData {
+		fakeServiceConfig := &confpb.Service{
+			Apis: []*apipb.Api{
+				{
+					Name: testApiName,
+					Methods: []*apipb.Method{
+						{
+							Name: "GetShelf",
+						},
+					},
+				},
+			},
+			Backend: &confpb.Backend{
+				Rules: tc.backendRules,
+			},
+		}
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = tc.backendProtocol
+		opts.CaseInsensitiveMatching = true
+		_, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("Test Desc(%d): %s, got error: %v", i, tc.desc, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tc.wantErr {
+			t.Errorf("Test Desc(%d): %s, got error: %v, want: %s", i, tc.desc, err, tc.wantErr)
+		}
+	}
+}
+
+func TestProcessMirrorBackend(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "GetShelf",
+					},
+				},
+			},
+		},
+		Backend: &confpb.Backend{
+			Rules: []*confpb.BackendRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+					Address:  "grpc://shelves.example.com:8081",
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc                 string
+		mirrorBackendAddress string
+		mirrorPercent        float64
+		policy               string
+		wantMirrorBackend    *BackendRoutingCluster
+		wantErr              string
+	}{
+		{
+			desc:                 "Mirror backend with the protocol of the mirrored operation",
+			mirrorBackendAddress: "https://bookstore-v2.example.com",
+			policy:               `{"operations": {"endpoints.examples.bookstore.Bookstore.ListShelves": {"mirror": {"percent": 10}}}}`,
+			wantMirrorBackend: &BackendRoutingCluster{
+				ClusterName:  util.MirrorClusterName,
+				Hostname:     "bookstore-v2.example.com",
+				Port:         443,
+				UseTLS:       true,
+				Protocol:     util.HTTP,
+				HttpProtocol: util.HTTP1,
+			},
+		},
+		{
+			desc:                 "HTTP mirror backend for an operation with a gRPC backend",
+			mirrorBackendAddress: "http://bookstore-v2:8080",
+			mirrorPercent:        10,
+			wantErr:              "the protocol of mirror backend address http://bookstore-v2:8080 must be the one of the backend of operation endpoints.examples.bookstore.Bookstore.GetShelf",
+		},
+		{
+			desc:                 "gRPC mirror backend for an operation with an HTTP backend",
+			mirrorBackendAddress: "grpc://bookstore-v2:8080",
+			policy:               `{"operations": {"endpoints.examples.bookstore.Bookstore.ListShelves": {"mirror": {"percent": 10}}}}`,
+			wantErr:              "the protocol of mirror backend address grpc://bookstore-v2:8080 must be the one of the backend of operation endpoints.examples.bookstore.Bookstore.ListShelves",
+		},
+		{
+			desc:                 "Operation with a different protocol not mirrored",
+			mirrorBackendAddress: "grpc://bookstore-v2:8080",
+			policy:               `{"operations": {"endpoints.examples.bookstore.Bookstore.GetShelf": {"mirror": {"percent": 10}}}}`,
+			wantMirrorBackend: &BackendRoutingCluster{
+				ClusterName:  util.MirrorClusterName,
+				Hostname:     "bookstore-v2",
+				Port:         8080,
+				Protocol:     util.GRPC,
+				HttpProtocol: util.HTTP1,
+			},
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		opts.MirrorBackendAddress = tc.mirrorBackendAddress
+		opts.MirrorPercent = tc.mirrorPercent
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.OperationPolicyPath: tc.policy})()
+		serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want: %s", i, tc.desc, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !cmp.Equal(serviceInfo.MirrorBackend, tc.wantMirrorBackend) {
+			t.Errorf("Test Desc(%d): %s, got MirrorBackend: %+v, want: %+v", i, tc.desc, serviceInfo.MirrorBackend, tc.wantMirrorBackend)
+		}
+	}
+}
+
+func TestProcessBackendSplits(t *testing.T) {
+	apis := []*apipb.Api{
+		{
+			Name: testApiName,
+			Methods: []*apipb.Method{
+				{
+					Name: "ListShelves",
+				},
+				{
+					Name: "GetShelf",
+				},
+				{
+					Name: "DeleteShelf",
+				},
+			},
+		},
+	}
+	catchAllServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: apis,
+	}
+	dynamicRoutingServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: apis,
+		Backend: &confpb.Backend{
+			Rules: []*confpb.BackendRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+					Address:  "https://shelves.example.com:8443",
+					Authentication: &confpb.BackendRule_JwtAudience{
+						JwtAudience: "https://shelves",
+					},
+				},
+				{
+					// The JWT audience is derived from the address.
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Address:  "https://books.example.com",
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc          string
+		serviceConfig *confpb.Service
+		split         string
+		// Cluster names of the backends, keyed by selector.
+		wantClusters map[string][]string
+		// JWT audiences of the backends, keyed by selector.
+		wantJwtAudiences       map[string][]string
+		wantCatchAllClusters   []string
+		wantBackendRoutingHost []string
+		wantErr                string
+	}{
+		{
+			desc:          "Catch-all split reuses the catch-all cluster, operation split overrides it",
+			serviceConfig: catchAllServiceConfig,
+			split: `{"catch_all": {"backends": [
+				{"address": "http://127.0.0.1:8082", "weight": 90},
+				{"address": "http://bookstore-v2:8080", "weight": 10}]},
+				"operations": {"endpoints.examples.bookstore.Bookstore.GetShelf": {"backends": [
+				{"address": "http://shelves.example.com:8080", "weight": 1}]}}}`,
+			wantClusters: map[string][]string{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {"bookstore.endpoints.project123.cloud.goog_local", "bookstore-v2:8080"},
+				"endpoints.examples.bookstore.Bookstore.GetShelf":    {"shelves.example.com:8080"},
+			},
+			wantCatchAllClusters:   []string{"bookstore.endpoints.project123.cloud.goog_local", "bookstore-v2:8080"},
+			wantBackendRoutingHost: []string{"bookstore-v2", "shelves.example.com"},
+		},
+		{
+			desc:          "Split without dynamic routing to an IP address",
+			serviceConfig: catchAllServiceConfig,
+			split: `{"operations": {"endpoints.examples.bookstore.Bookstore.GetShelf": {"backends": [
+				{"address": "http://127.0.0.1:8082", "weight": 1},
+				{"address": "http://10.0.0.2:8080", "weight": 1}]}}}`,
+			wantClusters: map[string][]string{
+				"endpoints.examples.bookstore.Bookstore.GetShelf": {"bookstore.endpoints.project123.cloud.goog_local", "10.0.0.2:8080"},
+			},
+			wantBackendRoutingHost: []string{"10.0.0.2"},
+		},
+		{
+			desc:          "Split with dynamic routing to an IP address",
+			serviceConfig: dynamicRoutingServiceConfig,
+			split: `{"operations": {"endpoints.examples.bookstore.Bookstore.GetShelf": {"backends": [
+				{"address": "https://10.0.0.2:8443", "weight": 1}]}}}`,
+			wantErr: "invalid backend split for endpoints.examples.bookstore.Bookstore.GetShelf: backends[0] address must be a domain name, got IP address: 10.0.0.2",
+		},
+		{
+			desc:          "Operation split reuses the cluster of the BackendRule",
+			serviceConfig: dynamicRoutingServiceConfig,
+			split: `{"operations": {"endpoints.examples.bookstore.Bookstore.GetShelf": {"backends": [
+				{"address": "https://shelves.example.com:8443", "weight": 1},
+				{"address": "https://shelves-canary.example.com:8443", "weight": 1, "pin_header": {"name": "x-canary", "value": "true"}}]}}}`,
+			wantClusters: map[string][]string{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": nil,
+				"endpoints.examples.bookstore.Bookstore.GetShelf":    {"shelves.example.com:8443", "shelves-canary.example.com:8443"},
+			},
+			wantBackendRoutingHost: []string{"shelves.example.com", "books.example.com", "shelves-canary.example.com"},
+		},
+		{
+			desc:          "Operation split to backends with the JWT audience derived from the BackendRule address",
+			serviceConfig: dynamicRoutingServiceConfig,
+			split: `{"operations": {"endpoints.examples.bookstore.Bookstore.ListShelves": {"backends": [
+				{"address": "https://books.example.com", "weight": 1},
+				{"address": "https://books.example.com:8443", "weight": 1}]}}}`,
+			wantClusters: map[string][]string{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {"books.example.com:443", "books.example.com:8443"},
+			},
+			wantBackendRoutingHost: []string{"shelves.example.com", "books.example.com", "books.example.com"},
+		},
+		{
+			desc:          "Operation split to a backend with another JWT audience derived from its address",
+			serviceConfig: dynamicRoutingServiceConfig,
+			split: `{"operations": {"endpoints.examples.bookstore.Bookstore.ListShelves": {"backends": [
+				{"address": "https://books.example.com", "weight": 1},
+				{"address": "https://books-canary.example.com", "weight": 1}]}}}`,
+			wantClusters: map[string][]string{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {"books.example.com:443", "books-canary.example.com:443"},
+			},
+			wantJwtAudiences: map[string][]string{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": {"", "https://books-canary.example.com"},
+			},
+			wantBackendRoutingHost: []string{"shelves.example.com", "books.example.com", "books-canary.example.com"},
+		},
+		{
+			desc:          "Per-backend JWT audience",
+			serviceConfig: dynamicRoutingServiceConfig,
+			split: `{"operations": {"endpoints.examples.bookstore.Bookstore.GetShelf": {"backends": [
+				{"address": "https://shelves.example.com:8443", "weight": 1},
+				{"address": "https://shelves-canary.example.com:8443", "weight": 1, "jwt_audience": "https://shelves-canary"}]}}}`,
+			wantClusters: map[string][]string{
+				"endpoints.examples.bookstore.Bookstore.GetShelf": {"shelves.example.com:8443", "shelves-canary.example.com:8443"},
+			},
+			wantJwtAudiences: map[string][]string{
+				"endpoints.examples.bookstore.Bookstore.GetShelf": {"", "https://shelves-canary"},
+			},
+			wantBackendRoutingHost: []string{"shelves.example.com", "books.example.com", "shelves-canary.example.com"},
+		},
+		{
+			desc:          "Catch-all split with dynamic routing",
+			serviceConfig: dynamicRoutingServiceConfig,
+			split:         `{"catch_all": {"backends": [{"address": "http://bookstore-v2:8080", "weight": 1}]}}`,
+			wantErr:       "catch-all backend split is not supported with dynamic routing, split the operations with a BackendRule address instead",
+		},
+		{
+			desc:          "Split of an operation without BackendRule address with dynamic routing",
+			serviceConfig: dynamicRoutingServiceConfig,
+			split:         `{"operations": {"endpoints.examples.bookstore.Bookstore.DeleteShelf": {"backends": [{"address": "http://bookstore-v2:8080", "weight": 1}]}}}`,
+			wantErr:       "backend split for endpoints.examples.bookstore.Bookstore.DeleteShelf is not supported with dynamic routing, the operation has no BackendRule address",
+		},
+		{
+			desc:          "Unknown selector",
+			serviceConfig: dynamicRoutingServiceConfig,
+			split:         `{"operations": {"endpoints.examples.bookstore.Bookstore.Unknown": {"backends": [{"address": "http://bookstore-v2:8080", "weight": 1}]}}}`,
+			wantErr:       "backend split is set for unknown selector endpoints.examples.bookstore.Bookstore.Unknown",
+		},
+		{
+			desc:          "Protocol differs from the backend of the operation",
+			serviceConfig: dynamicRoutingServiceConfig,
+			split:         `{"operations": {"endpoints.examples.bookstore.Bookstore.GetShelf": {"backends": [{"address": "grpc://shelves-v2.example.com:8081", "weight": 1}]}}}`,
+			wantErr:       "invalid backend split for endpoints.examples.bookstore.Bookstore.GetShelf: backends[0] address grpc://shelves-v2.example.com:8081 must have the protocol of the backend it splits",
+		},
+		{
+			desc:          "Address with a path",
+			serviceConfig: catchAllServiceConfig,
+			split:         `{"catch_all": {"backends": [{"address": "http://bookstore-v2:8080/v2", "weight": 1}]}}`,
+			wantErr:       "invalid catch-all backend split: backends[0] address http://bookstore-v2:8080/v2 must not have a path",
+		},
+		{
+			desc:          "Zero total weight",
+			serviceConfig: catchAllServiceConfig,
+			split:         `{"catch_all": {"backends": [{"address": "http://bookstore-v2:8080", "weight": 0}]}}`,
+			wantErr:       "invalid catch-all backend split: the sum of the weights must be > 0 and fit in 32 bits, got 0",
+		},
+		{
+			desc:          "Duplicated pin header",
+			serviceConfig: catchAllServiceConfig,
+			split: `{"catch_all": {"backends": [
+				{"address": "http://bookstore-v1:8080", "weight": 1, "pin_header": {"name": "x-canary", "value": "true"}},
+				{"address": "http://bookstore-v2:8080", "weight": 1, "pin_header": {"name": "x-canary", "value": "true"}}]}}`,
+			wantErr: "invalid catch-all backend split: backends[1] has duplicated pin_header x-canary: true",
+		},
+	}
+
+	for i, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendProtocol = "http"
+		defer testutil.WriteTempFiles(t, map[*string]string{&opts.BackendSplitPath: tc.split})()
+		serviceInfo, err := NewServiceInfoFromServiceConfig(tc.serviceConfig, testConfigID, opts)
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("Test Desc(%d): %s, got error: %v, want: %s", i, tc.desc, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		clusterNames := func(split *BackendSplit) []string {
+			if split == nil {
+				return nil
+			}
+			var names []string
+			for _, backend := range split.Backends {
+				names = append(names, backend.ClusterName)
+			}
+			return names
+		}
+		for selector, wantClusters := range tc.wantClusters {
+			if got := clusterNames(serviceInfo.Methods[selector].BackendSplit); !cmp.Equal(got, wantClusters) {
+				t.Errorf("Test Desc(%d): %s, got backend split clusters for %s: %v, want: %v", i, tc.desc, selector, got, wantClusters)
+			}
+		}
+		for selector, wantJwtAudiences := range tc.wantJwtAudiences {
+			var got []string
+			for _, backend := range serviceInfo.Methods[selector].BackendSplit.Backends {
+				got = append(got, backend.JwtAudience)
+			}
+			if !cmp.Equal(got, wantJwtAudiences) {
+				t.Errorf("Test Desc(%d): %s, got backend JWT audiences for %s: %v, want: %v", i, tc.desc, selector, got, wantJwtAudiences)
+			}
+		}
+		if got := clusterNames(serviceInfo.CatchAllBackendSplit); !cmp.Equal(got, tc.wantCatchAllClusters) {
+			t.Errorf("Test Desc(%d): %s, got catch-all backend split clusters: %v, want: %v", i, tc.desc, got, tc.wantCatchAllClusters)
+		}
+		var gotHosts []string
+		for _, cluster := range serviceInfo.BackendRoutingClusters {
+			gotHosts = append(gotHosts, cluster.Hostname)
+		}
+		if !cmp.Equal(gotHosts, tc.wantBackendRoutingHost) {
+			t.Errorf("Test Desc(%d): %s, got backend routing cluster hosts: %v, want: %v", i, tc.desc, gotHosts, tc.wantBackendRoutingHost)
+		}
+	}
+}
+
 func TestProcessEmptyJwksUriByOpenID(t *testing.T) {
 	r := mux.NewRouter()
 	jwksUriEntry, _ := json.Marshal(map[string]string{"jwks_uri": "this-is-jwksUri"})
@@ -1396,8 +1986,10 @@ func TestProcessEmptyJwksUriByOpenID(t *testing.T) {
 	testData := []struct {
 		desc              string
 		fakeServiceConfig *confpb.Service
+		failFast          bool
 		wantedJwksUri     string
-		wantErr           bool
+		wantDisabled      bool
+		wantErr           string
 	}{
 		{
 			desc: "Empty jwksUri, use jwksUri acquired by openID",
@@ -1419,7 +2011,26 @@ func TestProcessEmptyJwksUriByOpenID(t *testing.T) {
 			wantedJwksUri: "this-is-jwksUri",
 		},
 		{
-			desc: "Empty jwksUri and Open ID Connect Discovery failed",
+			desc: "Empty jwksUri and Open ID Connect Discovery failed, the provider is disabled",
+			fakeServiceConfig: &confpb.Service{
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:     "auth_provider",
+							Issuer: "aaaaa.bbbbbb.ccccc/inaccessible_uri/",
+						},
+					},
+				},
+			},
+			wantDisabled: true,
+		},
+		{
+			desc: "Empty jwksUri and Open ID Connect Discovery failed, fail fast",
 			fakeServiceConfig: &confpb.Service{
 				Apis: []*apipb.Api{
 					{
@@ -1435,22 +2046,33 @@ func TestProcessEmptyJwksUriByOpenID(t *testing.T) {
 					},
 				},
 			},
-			wantErr: true,
+			failFast: true,
+			wantErr:  "failed OpenID Connect Discovery protocol for provider auth_provider",
 		},
 	}
 
 	for i, tc := range testData {
 		opts := options.DefaultConfigGeneratorOptions()
 		opts.BackendProtocol = "grpc"
+		opts.OpenIDDiscoveryRetries = 0
+		opts.OpenIDDiscoveryFailFast = tc.failFast
 		serviceInfo, err := NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
-
-		if tc.wantErr {
-			if err == nil {
-				t.Errorf("Test Desc(%d): %s, process jwksUri got: no err, but expected err", i, tc.desc)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Test Desc(%d): %s, process jwksUri got: %v, want err: %v", i, tc.desc, err, tc.wantErr)
 			}
-		} else if err != nil {
+			continue
+		}
+		if err != nil {
 			t.Errorf("Test Desc(%d): %s, process jwksUri got: %v, but expected no err", i, tc.desc, err)
-		} else if jwksUri := serviceInfo.serviceConfig.Authentication.Providers[0].JwksUri; jwksUri != tc.wantedJwksUri {
+			continue
+		}
+
+		_, gotDisabled := serviceInfo.LocalJwks["auth_provider"]
+		if gotDisabled != tc.wantDisabled {
+			t.Errorf("Test Desc(%d): %s, provider disabled got: %v, want: %v", i, tc.desc, gotDisabled, tc.wantDisabled)
+		}
+		if jwksUri := serviceInfo.serviceConfig.Authentication.Providers[0].JwksUri; jwksUri != tc.wantedJwksUri {
 			t.Errorf("Test Desc(%d): %s, process jwksUri got: %v, want: %v", i, tc.desc, jwksUri, tc.wantedJwksUri)
 		}
 	}
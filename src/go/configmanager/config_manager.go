@@ -18,6 +18,7 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/commonflags"
@@ -36,6 +37,7 @@ import (
 var (
 	// These flags are used by config manage only.
 	checkNewRolloutInterval = flag.Duration("check_rollout_interval", 60*time.Second, `the interval periodically to call servicemanagment to check the latest rolloutil.`)
+	checkLocalJwksInterval  = flag.Duration("check_local_jwks_interval", 10*time.Second, `the interval periodically to check if the local JWKS files of JWT providers are modified.`)
 	CheckMetadata           = flag.Bool("check_metadata", false, `enable fetching service name, config ID and rollout strategy from service metadata server`)
 	RolloutStrategy         = flag.String("rollout_strategy", "fixed", `service config rollout strategy, must be either "managed" or "fixed"`)
 	ServiceConfigID         = flag.String("service_config_id", "", "initial service config id")
@@ -61,6 +63,11 @@ type ConfigManager struct {
 
 	cache               cache.SnapshotCache
 	checkRolloutsTicker *time.Ticker
+	// Number of times the config is updated because of local JWKS changes,
+	// used to make a new snapshot version.
+	localJwksUpdates int
+	// Protects the config from concurrent updates.
+	mutex sync.Mutex
 
 	metadataFetcher *metadata.MetadataFetcher
 }
@@ -92,6 +99,7 @@ func NewConfigManager(mf *metadata.MetadataFetcher, opts options.ConfigGenerator
 		}
 
 		glog.Infof("create new Config Manager from static service config json file at %v", *ServicePath)
+		m.watchLocalJwks()
 		return m, nil
 	}
 
@@ -173,6 +181,7 @@ func NewConfigManager(mf *metadata.MetadataFetcher, opts options.ConfigGenerator
 				if err != nil {
 					glog.Errorf("error occurred when checking new rollouts, %v", err)
 				}
+				m.mutex.Lock()
 				if m.curRolloutID != newRolloutID && m.curConfigID != newConfigID {
 					m.curRolloutID = newRolloutID
 					m.curConfigID = newConfigID
@@ -180,12 +189,34 @@ func NewConfigManager(mf *metadata.MetadataFetcher, opts options.ConfigGenerator
 						glog.Errorf("error occurred when checking new rollouts, %v", err)
 					}
 				}
+				m.mutex.Unlock()
 			}
 		}()
 	}
+	m.watchLocalJwks()
 	return m, nil
 }
 
+// watchLocalJwks periodically checks the local JWKS files of JWT providers,
+// and applies the service config again when any of them is modified, so the
+// new keys are pushed to Envoy.
+func (m *ConfigManager) watchLocalJwks() {
+	ticker := time.NewTicker(*checkLocalJwksInterval)
+	go func() {
+		for range ticker.C {
+			m.mutex.Lock()
+			if m.serviceInfo.LocalJwksChanged() {
+				glog.Infof("local JWKS is modified, updating config for service %v", m.serviceName)
+				m.localJwksUpdates++
+				if err := m.applyServiceConfig(m.serviceInfo.ServiceConfig()); err != nil {
+					glog.Errorf("error occurred when updating local JWKS, %v", err)
+				}
+			}
+			m.mutex.Unlock()
+		}
+	}()
+}
+
 // updateSnapshot should be called when starting up the server.
 // It calls ServiceManager Server to fetch the service configuration in order
 // to dynamically configure Envoy.
@@ -210,11 +241,12 @@ func (m *ConfigManager) readAndApplyServiceConfig(servicePath string) error {
 }
 
 func (m *ConfigManager) applyServiceConfig(serviceConfig *confpb.Service) error {
-	var err error
-	m.serviceInfo, err = configinfo.NewServiceInfoFromServiceConfig(serviceConfig, m.curConfigID, m.envoyConfigOptions)
+	// Keep the current ServiceInfo if the new one is invalid.
+	serviceInfo, err := configinfo.NewServiceInfoFromServiceConfig(serviceConfig, m.curConfigID, m.envoyConfigOptions)
 	if err != nil {
 		return fmt.Errorf("fail to initialize ServiceInfo, %s", err)
 	}
+	m.serviceInfo = serviceInfo
 
 	if m.metadataFetcher != nil {
 		attrs, err := m.metadataFetcher.FetchGCPAttributes()
@@ -250,7 +282,11 @@ func (m *ConfigManager) makeSnapshot() (*cache.Snapshot, error) {
 		return nil, err
 	}
 
-	snapshot := cache.NewSnapshot(m.curConfigID, endpoints, clusterResources, routes, []cache.Resource{listener}, runtimes)
+	version := m.curConfigID
+	if m.localJwksUpdates > 0 {
+		version = fmt.Sprintf("%s-jwks-%d", m.curConfigID, m.localJwksUpdates)
+	}
+	snapshot := cache.NewSnapshot(version, endpoints, clusterResources, routes, []cache.Resource{listener}, runtimes)
 	m.Infof("Envoy Dynamic Configuration is cached for service: %v", m.serviceName)
 	return &snapshot, nil
 }
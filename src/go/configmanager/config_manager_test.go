@@ -19,8 +19,10 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"sort"
 	"strings"
 	"testing"
@@ -944,10 +946,14 @@ func TestFetchListeners(t *testing.T) {
                            },
                            "requirements":[
                               {
+                                 "apiName":"endpoints.examples.bookstore.Bookstore",
+                                 "apiVersion":"v1",
                                  "operationName":"endpoints.examples.bookstore.Bookstore.CreateShelf",
                                  "serviceName":"bookstore.endpoints.project123.cloud.goog"
                               },
                               {
+                                 "apiName":"endpoints.examples.bookstore.Bookstore",
+                                 "apiVersion":"v1",
                                  "operationName":"endpoints.examples.bookstore.Bookstore.ListShelves",
                                  "serviceName":"bookstore.endpoints.project123.cloud.goog"
                               }
@@ -1310,10 +1316,12 @@ func TestFetchListeners(t *testing.T) {
                                  "apiKey":{
                                     "allowWithoutApiKey":true
                                  },
+                                 "apiName":"1.echo_api_endpoints_cloudesf_testing_cloud_goog",
                                  "operationName":"1.echo_api_endpoints_cloudesf_testing_cloud_goog.CORS_simplegetcors",
                                  "serviceName":"bookstore.endpoints.project123.cloud.goog"
                               },
                               {
+                                 "apiName":"1.echo_api_endpoints_cloudesf_testing_cloud_goog",
                                  "operationName":"1.echo_api_endpoints_cloudesf_testing_cloud_goog.Simplegetcors",
                                  "serviceName":"bookstore.endpoints.project123.cloud.goog"
                               }
@@ -1698,6 +1706,98 @@ func TestServiceConfigAutoUpdate(t *testing.T) {
 	})
 }
 
+func TestLocalJwksAutoUpdate(t *testing.T) {
+	jwksFile, err := ioutil.TempFile("", "esp_v2_jwks_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(jwksFile.Name())
+	if _, err := jwksFile.WriteString(`{"keys": [{"kty": "RSA", "kid": "key-0", "n": "fake-n", "e": "AQAB"}]}`); err != nil {
+		t.Fatal(err)
+	}
+	jwksFile.Close()
+
+	serviceConfigFile, err := ioutil.TempFile("", "esp_v2_service_config_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(serviceConfigFile.Name())
+	if _, err := serviceConfigFile.WriteString(fmt.Sprintf(`{
+    "name": "%s",
+    "id": "%s",
+    "apis": [
+        {
+            "name": "%s"
+        }
+    ],
+    "authentication": {
+        "providers": [
+            {
+                "id": "local_provider",
+                "issuer": "https://local.example.com",
+                "jwks_uri": "file://%s"
+            }
+        ]
+    }
+}`, testProjectName, testConfigID, testEndpointName, jwksFile.Name())); err != nil {
+		t.Fatal(err)
+	}
+	serviceConfigFile.Close()
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendProtocol = "http"
+	flag.Set("service_json_path", serviceConfigFile.Name())
+	flag.Set("check_local_jwks_interval", "100ms")
+	defer flag.Set("service_json_path", "")
+
+	manager, err := NewConfigManager(nil, opts)
+	if err != nil {
+		t.Fatal("fail to initialize Config Manager: ", err)
+	}
+	ctx := context.Background()
+	req := v2pb.DiscoveryRequest{
+		Node: &corepb.Node{
+			Id: opts.Node,
+		},
+		TypeUrl: cache.ListenerType,
+	}
+	resp, err := manager.cache.Fetch(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Version != testConfigID {
+		t.Errorf("snapshot cache fetch got version: %v, want: %v", resp.Version, testConfigID)
+	}
+
+	newJwks := `{"keys": [{"kty": "RSA", "kid": "key-1", "n": "fake-n", "e": "AQAB"}]}`
+	if err := ioutil.WriteFile(jwksFile.Name(), []byte(newJwks), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the modification time changes on file systems with a coarse
+	// time granularity.
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(jwksFile.Name(), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(*checkLocalJwksInterval + time.Second)
+
+	resp, err = manager.cache.Fetch(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantVersion := testConfigID + "-jwks-1"
+	if resp.Version != wantVersion {
+		t.Errorf("snapshot cache fetch got version: %v, want: %v", resp.Version, wantVersion)
+	}
+	manager.mutex.Lock()
+	gotJwks := manager.serviceInfo.LocalJwks["local_provider"].Content
+	manager.mutex.Unlock()
+	if gotJwks != newJwks {
+		t.Errorf("got local JWKS: %v, want: %v", gotJwks, newJwks)
+	}
+}
+
 // Test Environment setup.
 
 type testEnv struct {
@@ -41,6 +41,13 @@ var (
 	CorsAllowOriginRegex = flag.String("cors_allow_origin_regex", "", "set Access-Control-Allow-Origin to a regular expression")
 	CorsExposeHeaders    = flag.String("cors_expose_headers", "", "set Access-Control-Expose-Headers to the specified headers")
 	CorsPreset           = flag.String("cors_preset", "", `enable CORS support, must be either "basic" or "cors_with_regex"`)
+	CorsPolicyPath       = flag.String("cors_policy_path", "", `Path to a JSON file with CORS policies, instead of the other cors flags. The "default" policy applies to
+	the whole service, the policies in "apis" (keyed by api name) and "path_prefixes" (keyed by path prefix) override it on the matching routes.
+	Example: {"default": {"allow_origins": ["https://a.example.com", "https://b.example.com"], "max_age": 3600}, "path_prefixes": {"/admin": {"allow_origins": ["https://admin.example.com"]}}}`)
+
+	// Security response headers configurations.
+	SecurityHeadersPreset    = flag.String("security_headers_preset", "off", `add security headers to every response, must be one of "off", "basic" and "strict". "basic" and "strict" also hide the "server: envoy" header`)
+	SecurityHeadersOverrides = flag.String("security_headers_overrides", "", `JSON object of response headers overriding or extending the security headers preset, e.g. {"X-Frame-Options": "SAMEORIGIN"}. An empty value removes a header of the preset, and "Server" sets the server header`)
 
 	// Backend routing configurations.
 	BackendDnsLookupFamily = flag.String("backend_dns_lookup_family", "auto", `Define the dns lookup family for all backends. The options are "auto", "v4only" and "v6only". The default is "auto".`)
@@ -72,6 +79,28 @@ var (
 	EnvoyUseRemoteAddress  = flag.Bool("envoy_use_remote_address", false, "Envoy HttpConnectionManager configuration, please refer to envoy documentation for detailed information.")
 	EnvoyXffNumTrustedHops = flag.Int("envoy_xff_num_trusted_hops", 2, "Envoy HttpConnectionManager configuration, please refer to envoy documentation for detailed information.")
 
+	ListenerCodecType     = flag.String("listener_codec_type", "auto", `The HTTP codec of the listener, must be one of "auto", "http1" and "http2". Use "http1" to disable HTTP/2.`)
+	ConnectionIdleTimeout = flag.Duration("connection_idle_timeout", 0, "The time after which a downstream connection without active streams is closed. The default 0 means the Envoy default of 1h.")
+	StreamIdleTimeout     = flag.Duration("stream_idle_timeout", 0, "The time after which a stream without activity is reset. The default 0 means the Envoy default of 5m.")
+	RequestTimeout        = flag.Duration("request_timeout", 0, `The time to receive the entire request. It also applies to streaming methods and upgraded connections.
+	The default 0 means no timeout.`)
+	DrainTimeout              = flag.Duration("drain_timeout", 0, "The time between the GOAWAY frames sent when draining HTTP/2 connections. The default 0 means the Envoy default of 5s.")
+	MaxRequestHeadersKb       = flag.Int("max_request_headers_kb", 0, "The maximum size of the request headers in KiB, at most 96. The default 0 means the Envoy default of 60.")
+	Http2MaxConcurrentStreams = flag.Int("http2_max_concurrent_streams", 0, "The maximum number of concurrent streams of a downstream HTTP/2 connection. The default 0 means the Envoy default.")
+	Http2StreamWindowSize     = flag.Int("http2_initial_stream_window_size", 0, "The initial window size in bytes of the downstream HTTP/2 streams, at least 65535. The default 0 means the Envoy default.")
+	Http2ConnectionWindowSize = flag.Int("http2_initial_connection_window_size", 0, "The initial window size in bytes of the downstream HTTP/2 connections, at least 65535. The default 0 means the Envoy default.")
+	StreamingIdleTimeout      = flag.Duration("streaming_idle_timeout", 0, `The idle timeout of the routes of streaming methods, which have no response timeout.
+	The default 0 means --stream_idle_timeout.`)
+
+	NormalizePath = flag.Bool("normalize_path", false, `Normalize the request paths according to RFC 3986 before any matching, e.g. "/v1/shelves/../admin" becomes "/v1/admin".
+	Percent-encoded slashes are not decoded, see --reject_encoded_slashes.`)
+	MergeSlashes          = flag.Bool("merge_slashes", false, `Merge the adjacent slashes of the request paths before any matching, e.g. "//v1//shelves" becomes "/v1/shelves".`)
+	RejectEncodedSlashes  = flag.Bool("reject_encoded_slashes", false, `Reject the requests with percent-encoded slashes or backslashes ("%2F" or "%5C") in their path with 400.`)
+	TrailingSlashMatching = flag.Bool("trailing_slash_matching", false, `Route the request paths with trailing slashes like the paths without them, e.g. "/v1/shelves/" is routed as "/v1/shelves".
+	The operations are already matched this way by the path matcher filter, so the routes become consistent with it.`)
+	CaseInsensitiveMatching = flag.Bool("case_insensitive_matching", false, `Match the request paths case-insensitively in the routes and in the path matcher filter, e.g. "/V1/Shelves" is routed as "/v1/shelves".
+	The extracted path parameters keep their case. It cannot be used with a gRPC backend, including the gRPC backends of the BackendRules.`)
+
 	LogJwtPayloads = flag.String("log_jwt_payloads", "", `Log corresponding JWT JSON payload primitive fields through service control, separated by comma. Example, when --log_jwt_payload=sub,project_id, log
 	will have jwt_payload: sub=[SUBJECT];project_id=[PROJECT_ID] if the fields are available. The value must be a primitive field, JSON objects and arrays will not be logged.`)
 	LogRequestHeaders = flag.String("log_request_headers", "", `Log corresponding request headers through service control, separated by comma. Example, when --log_request_headers=
@@ -88,6 +117,25 @@ var (
 
 	JwksCacheDurationInS = flag.Int("jwks_cache_duration_in_s", 300, "Specify JWT public key cache duration in seconds. The default is 5 minutes.")
 
+	JwtProviderOptionsPath = flag.String("jwt_provider_options_path", "", `Path to a JSON file with JWT provider options keyed by issuer, plus a "default"
+	section applied to every provider without its own options. "jwt_locations" replaces the default JWT locations of the provider,
+	each location sets one of "header" (with optional "value_prefix") or "query", JWT in cookies is not supported. "jwks_path" (a local JWKS file) or "jwks"
+	(an inline JWKS), which can only be set per issuer, is used instead of fetching the JWKS from the jwks_uri; a "file://" jwks_uri also loads a local JWKS file.
+	"claim_to_headers" forwards claims of the verified JWT as headers, e.g. [{"claim": "sub", "header": "X-User-Id"}].
+	"strip_authorization" removes the Authorization header of the requests with a verified JWT, or moves it to
+	X-Forwarded-Authorization for the operations using backend authentication. "dns_lookup_family" ("auto", "v4only" or
+	"v6only"), "jwks_fetch_timeout" (also capping the connect timeout of the JWKS cluster) and "jwks_cache_duration"
+	(durations such as "1h") tune fetching the JWKS. Example:
+	{"issuers": {"https://issuer.example.com": {"jwt_locations": [{"header": "X-Token"}, {"query": "token"}]}}}`)
+
+	OpenIDDiscoveryTimeout      = flag.Duration("openid_discovery_timeout", 5*time.Second, "Timeout of each OpenID Connect Discovery request for the JWT providers without jwks_uri.")
+	OpenIDDiscoveryRetries      = flag.Int("openid_discovery_retries", 2, "Number of retries of a failed OpenID Connect Discovery request.")
+	OpenIDDiscoveryRetryBackoff = flag.Duration("openid_discovery_retry_backoff", 500*time.Millisecond, "Backoff before the first retry of OpenID Connect Discovery, doubled for each following retry.")
+	OpenIDDiscoveryCachePath    = flag.String("openid_discovery_cache_path", "", `Path to a file persisting the jwks_uri resolved by OpenID Connect Discovery, keyed by issuer.
+	A cached jwks_uri is used when the discovery of its issuer fails, e.g. at startup.`)
+	OpenIDDiscoveryFailFast = flag.Bool("openid_discovery_fail_fast", false, `Fail the config generation if the jwks_uri of a JWT provider cannot be resolved by OpenID Connect Discovery.
+	By default, the provider is disabled instead, so all its JWTs are rejected.`)
+
 	ScCheckTimeoutMs  = flag.Int("service_control_check_timeout_ms", 0, `Set the timeout in millisecond for service control Check request. Must be > 0 and the default is 1000 if not set.`)
 	ScQuotaTimeoutMs  = flag.Int("service_control_quota_timeout_ms", 0, `Set the timeout in millisecond for service control Quota request. Must be > 0 and the default is 1000 if not set.`)
 	ScReportTimeoutMs = flag.Int("service_control_report_timeout_ms", 0, `Set the timeout in millisecond for service control Report request. Must be > 0 and the default is 2000 if not set.`)
@@ -96,7 +144,89 @@ var (
 	ScQuotaRetries  = flag.Int("service_control_quota_retries", -1, `Set the retry times for service control Quota request. Must be >= 0 and the default is 1 if not set.`)
 	ScReportRetries = flag.Int("service_control_report_retries", -1, `Set the retry times for service control Report request. Must be >= 0 and the default is 5 if not set.`)
 
+	EnablePerWorkerLocalQuota = flag.Bool("enable_per_worker_local_quota", false, `Enforce the "1/min/{project}" quota limits of the service config in the proxy, in addition to
+	service control. The limits are enforced by the service control filter, before its quota call, so it cannot be skipped.
+	Each consumer gets a token bucket per limit, refilled continuously. The consumer is identified by its API key once the
+	service control check has verified it, or else by its client IP, derived from X-Forwarded-For with --envoy_xff_num_trusted_hops.
+	The buckets are not shared by the Envoy worker threads: each worker enforces the limit, so the limit of the proxy is the
+	quota limit multiplied by the number of workers (--concurrency).`)
+
 	ComputePlatformOverride = flag.String("compute_platform_override", "", "the overridden platform where the proxy is running at")
+
+	TracingRequestHeadersForTags = flag.String("tracing_request_headers_for_tags", "", `Comma separated request headers whose values are added as tags to the span, e.g.
+	"x-client-id,x-request-source". The tag name is the header name.`)
+
+	EnableOperationStats = flag.Bool("enable_operation_stats", false, `Emit upstream request stats (count, latency, response codes) per operation, using the operation name as
+	the virtual cluster name. Dots in the operation name are replaced by underscores.`)
+
+	CustomFiltersPath = flag.String("custom_filters_path", "", `Path to a JSON or YAML file with extra HTTP filters and clusters, in the Envoy JSON or YAML format.
+	Each filter is inserted at one of the insertion points: "before_auth", "after_service_control" or "before_router".
+	Custom clusters must not have the name of a generated cluster.`)
+
+	ExtAuthzAddress = flag.String("ext_authz_address", "", `The address of the external authorization server, consulted after JWT validation.
+	Its scheme selects the protocol: "grpc://" or "grpcs://" for a gRPC server, "http://" or "https://" for an HTTP server, whose path is used
+	as the path prefix of the authorization requests. It is consulted after the Service Control check, so its denials are reported.
+	The operation name is sent in the x-esp-v2-ext-authz-operation header. gRPC servers get all the request headers and the JWT payloads
+	in the metadata context. HTTP servers get the Authorization, X-Endpoint-API-UserInfo and x-esp-v2-ext-authz-operation headers.
+	The check can be disabled per operation with the "ext_authz" policy of --operation_policy_path.`)
+	ExtAuthzTimeout          = flag.Duration("ext_authz_timeout", 200*time.Millisecond, "The timeout of the external authorization requests.")
+	ExtAuthzFailureModeAllow = flag.Bool("ext_authz_failure_mode_allow", false, "If true, requests are allowed when the external authorization server fails or is unreachable.")
+
+	EnableResponseCompression = flag.Bool("enable_response_compression", false, `Compress the responses with gzip for the clients accepting it. The responses of transcoded gRPC
+	methods are compressed after transcoding. Compression applies to all the operations.`)
+	CompressionContentTypes = flag.String("compression_content_types", "", `Comma separated content types of the responses to compress, e.g. "application/json,text/html".
+	The default is the Envoy gzip filter default, which includes application/json and the common text types.`)
+	CompressionMinLength = flag.Int("compression_min_length", 30, "The minimum content length in bytes of the responses to compress.")
+	CompressionLevel     = flag.String("compression_level", "default", `The gzip compression level, must be one of "default", "best" and "speed".`)
+
+	LocalReplyBodyFormat = flag.String("local_reply_body_format", "", `The body of the requests rejected by the ESPv2 filters (no matching operation, service control
+	denial, missing backend ID token), e.g. '{"code":%CODE%,"message":"%MESSAGE%"}'. %CODE% is replaced by the HTTP status code,
+	%GRPC_CODE% by the gRPC status code and %MESSAGE% by the JSON escaped error message. gRPC requests keep the message in grpc-message.
+	The replies of the Envoy filters, e.g. JWT failures, missing routes and timeouts, can not be customized with this Envoy version.`)
+	LocalReplyContentType = flag.String("local_reply_content_type", "application/json", "The content type of the bodies rendered from --local_reply_body_format.")
+	LocalReplyStatusCodes = flag.String("local_reply_status_codes", "", `Comma separated overrides of the status codes of the requests rejected by the ESPv2 filters,
+	e.g. "path_not_found=400,service_control_denied=403". The classes are "path_not_found", "service_control_denied" and "backend_auth_failure".
+	The codes must be 4xx or 5xx codes. The replies of the Envoy filters are not covered: the JWT authentication failures, the requests
+	matching no route and the upstream timeouts keep their status codes.`)
+
+	MaxRequestBytes = flag.Uint64("max_request_bytes", 0, `Reject the requests whose body is larger than this number of bytes with 413, after buffering them.
+	The "request_body" policy of --operation_policy_path overrides it per operation, e.g. {"request_body": {"max_request_bytes": 52428800}}.
+	Streaming methods are never buffered nor limited. The default 0 means no limit.`)
+
+	EnableWebsocket = flag.Bool("enable_websocket", false, `Allow WebSocket upgrades on all the operations with an HTTP backend, and on the catch-all route.
+	The "websocket" policy of --operation_policy_path overrides it per operation, e.g. {"websocket": {"enabled": true}}.
+	The routes allowing upgrades have no response timeout, so long-lived connections are only closed by --websocket_idle_timeout.`)
+	WebsocketIdleTimeout = flag.Duration("websocket_idle_timeout", time.Hour, "The idle timeout of the routes allowing WebSocket upgrades.")
+
+	RateLimitServiceAddress = flag.String("rate_limit_service_address", "", `The address of a gRPC rate limit service implementing envoy.service.ratelimit.v2, e.g. "grpc://ratelimit:8081"
+	or "grpcs://ratelimit.example.com". Each operation sends the descriptors of the "rate_limit" policy of --operation_policy_path,
+	built from the entries "operation" (key "generic_key"), "api_key", "jwt_sub" and "client_ip" (key "remote_address").
+	The URL-decoded "api_key" and the "jwt_sub" claim of the verified JWT are set by the service control filter, so they cannot
+	be used with --skip_service_control_filter. A descriptor is not sent if one of its entries is missing from the request.
+	The operations without policy send [["operation"]].`)
+	RateLimitDomain          = flag.String("rate_limit_domain", "", "The domain of the rate limit requests. The default is the service name.")
+	RateLimitTimeout         = flag.Duration("rate_limit_timeout", 20*time.Millisecond, "The timeout of the rate limit requests.")
+	RateLimitFailureModeDeny = flag.Bool("rate_limit_failure_mode_deny", false, "If true, requests are denied when the rate limit service fails or is unreachable.")
+
+	MirrorBackendAddress = flag.String("mirror_backend_address", "", `The address of a shadow backend receiving a copy of the requests, e.g. "https://bookstore-v2.example.com".
+	Its scheme must match the protocol of the backends of the mirrored operations. The responses of the shadow backend are ignored,
+	and its Host header gets a "-shadow" suffix. Streaming methods and WebSocket upgrades are never mirrored.`)
+	MirrorPercent = flag.Float64("mirror_percent", 0, `The percentage of the requests of every operation to mirror to --mirror_backend_address, in the range [0, 100].
+	The "mirror" policy of --operation_policy_path overrides it per operation, e.g. {"mirror": {"percent": 10}}.
+	It is the default value of the runtime key "mirror.<selector>".`)
+	MirrorSkipNonIdempotent = flag.Bool("mirror_skip_non_idempotent", false, "If true, the requests with a non-idempotent HTTP method, such as POST and PATCH, are never mirrored.")
+
+	BackendSplitPath = flag.String("backend_split_path", "", `Path to a JSON file splitting the traffic of the catch-all backend ("catch_all") or of operations ("operations", keyed by selector)
+	across weighted backends, e.g. {"catch_all": {"backends": [{"address": "http://v1:8080", "weight": 90},
+	{"address": "http://v2:8080", "weight": 10, "pin_header": {"name": "x-canary", "value": "true"}}]}}.
+	The requests with the pin_header of a backend are always sent to it. All the backends of an operation share the path translation
+	of its BackendRule. A backend can set its own "jwt_audience" for the backend auth token. Otherwise, if the JWT audience of the
+	operation is derived from its BackendRule address, each backend gets the one derived from its own address. With dynamic routing
+	(any BackendRule with an address), "catch_all" is rejected, only the operations with a BackendRule address can be split and the
+	backend addresses must be domain names.`)
+
+	OperationPolicyPath = flag.String("operation_policy_path", "", `Path to a JSON file with per-operation policies keyed by selector, plus a "default"
+	section applied to every operation without its own policy, and to the catch-all route for "headers". Example: {"operations": {"Bookstore.ListShelves": {"tracing": {"random_sampling": 1}}}}`)
 )
 
 func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
@@ -111,6 +241,9 @@ func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
 		CorsAllowOriginRegex:          *CorsAllowOriginRegex,
 		CorsExposeHeaders:             *CorsExposeHeaders,
 		CorsPreset:                    *CorsPreset,
+		CorsPolicyPath:                *CorsPolicyPath,
+		SecurityHeadersPreset:         *SecurityHeadersPreset,
+		SecurityHeadersOverrides:      *SecurityHeadersOverrides,
 		BackendDnsLookupFamily:        *BackendDnsLookupFamily,
 		ClusterConnectTimeout:         *ClusterConnectTimeout,
 		ClusterAddress:                *ClusterAddress,
@@ -125,6 +258,21 @@ func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
 		SkipServiceControlFilter:      *SkipServiceControlFilter,
 		EnvoyUseRemoteAddress:         *EnvoyUseRemoteAddress,
 		EnvoyXffNumTrustedHops:        *EnvoyXffNumTrustedHops,
+		ListenerCodecType:             *ListenerCodecType,
+		ConnectionIdleTimeout:         *ConnectionIdleTimeout,
+		StreamIdleTimeout:             *StreamIdleTimeout,
+		RequestTimeout:                *RequestTimeout,
+		DrainTimeout:                  *DrainTimeout,
+		MaxRequestHeadersKb:           *MaxRequestHeadersKb,
+		Http2MaxConcurrentStreams:     *Http2MaxConcurrentStreams,
+		Http2StreamWindowSize:         *Http2StreamWindowSize,
+		Http2ConnectionWindowSize:     *Http2ConnectionWindowSize,
+		StreamingIdleTimeout:          *StreamingIdleTimeout,
+		NormalizePath:                 *NormalizePath,
+		MergeSlashes:                  *MergeSlashes,
+		RejectEncodedSlashes:          *RejectEncodedSlashes,
+		TrailingSlashMatching:         *TrailingSlashMatching,
+		CaseInsensitiveMatching:       *CaseInsensitiveMatching,
 		LogJwtPayloads:                *LogJwtPayloads,
 		LogRequestHeaders:             *LogRequestHeaders,
 		LogResponseHeaders:            *LogResponseHeaders,
@@ -132,12 +280,44 @@ func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
 		SuppressEnvoyHeaders:          *SuppressEnvoyHeaders,
 		ServiceControlNetworkFailOpen: *ServiceControlNetworkFailOpen,
 		JwksCacheDurationInS:          *JwksCacheDurationInS,
+		JwtProviderOptionsPath:        *JwtProviderOptionsPath,
+		OpenIDDiscoveryTimeout:        *OpenIDDiscoveryTimeout,
+		OpenIDDiscoveryRetries:        *OpenIDDiscoveryRetries,
+		OpenIDDiscoveryRetryBackoff:   *OpenIDDiscoveryRetryBackoff,
+		OpenIDDiscoveryFailFast:       *OpenIDDiscoveryFailFast,
+		OpenIDDiscoveryCache:          util.NewJwksUriCache(*OpenIDDiscoveryCachePath),
 		ScCheckTimeoutMs:              *ScCheckTimeoutMs,
 		ScQuotaTimeoutMs:              *ScQuotaTimeoutMs,
 		ScReportTimeoutMs:             *ScReportTimeoutMs,
 		ScCheckRetries:                *ScCheckRetries,
 		ScQuotaRetries:                *ScQuotaRetries,
 		ScReportRetries:               *ScReportRetries,
+		EnablePerWorkerLocalQuota:     *EnablePerWorkerLocalQuota,
+		TracingRequestHeadersForTags:  *TracingRequestHeadersForTags,
+		EnableOperationStats:          *EnableOperationStats,
+		CustomFiltersPath:             *CustomFiltersPath,
+		ExtAuthzAddress:               *ExtAuthzAddress,
+		ExtAuthzTimeout:               *ExtAuthzTimeout,
+		ExtAuthzFailureModeAllow:      *ExtAuthzFailureModeAllow,
+		EnableResponseCompression:     *EnableResponseCompression,
+		CompressionContentTypes:       *CompressionContentTypes,
+		CompressionMinLength:          *CompressionMinLength,
+		CompressionLevel:              *CompressionLevel,
+		LocalReplyBodyFormat:          *LocalReplyBodyFormat,
+		LocalReplyContentType:         *LocalReplyContentType,
+		LocalReplyStatusCodes:         *LocalReplyStatusCodes,
+		MaxRequestBytes:               *MaxRequestBytes,
+		EnableWebsocket:               *EnableWebsocket,
+		WebsocketIdleTimeout:          *WebsocketIdleTimeout,
+		RateLimitServiceAddress:       *RateLimitServiceAddress,
+		RateLimitDomain:               *RateLimitDomain,
+		RateLimitTimeout:              *RateLimitTimeout,
+		RateLimitFailureModeDeny:      *RateLimitFailureModeDeny,
+		MirrorBackendAddress:          *MirrorBackendAddress,
+		MirrorPercent:                 *MirrorPercent,
+		MirrorSkipNonIdempotent:       *MirrorSkipNonIdempotent,
+		BackendSplitPath:              *BackendSplitPath,
+		OperationPolicyPath:           *OperationPolicyPath,
 	}
 
 	glog.Infof("Config Generator options: %+v", opts)
@@ -369,6 +369,9 @@ var (
                            "name":"backend",
                            "routes":[
                               {
+                                 "decorator":{
+                                    "operation":"1.echo_api_endpoints_cloudesf_testing_cloud_goog.dynamic_routing_AddPet"
+                                 },
                                  "match":{
                                     "headers":[
                                        {
@@ -385,6 +388,9 @@ var (
                                  }
                               },
                               {
+                                 "decorator":{
+                                    "operation":"1.echo_api_endpoints_cloudesf_testing_cloud_goog.dynamic_routing_Hello"
+                                 },
                                  "match":{
                                     "headers":[
                                        {
@@ -392,20 +398,18 @@ var (
                                           "name":":method"
                                        }
                                     ],
-                                    "safeRegex":{
-                                      "googleRe2":{
-                                        "maxProgramSize":1000
-                                      },
-                                      "regex":"/pet/[^\\/]+$"
-                                    }
+                                    "path":"/hello"
                                  },
                                  "route":{
-                                    "cluster":"pets.appspot.com:8008",
-                                    "hostRewrite":"pets.appspot.com",
+                                    "cluster":"us-central1-cloud-esf.cloudfunctions.net:443",
+                                    "hostRewrite":"us-central1-cloud-esf.cloudfunctions.net",
                                     "timeout":"15s"
                                  }
                               },
                               {
+                                 "decorator":{
+                                    "operation":"1.echo_api_endpoints_cloudesf_testing_cloud_goog.dynamic_routing_ListPets"
+                                 },
                                  "match":{
                                     "headers":[
                                        {
@@ -413,15 +417,18 @@ var (
                                           "name":":method"
                                        }
                                     ],
-                                    "path":"/hello"
+                                    "path":"/pets"
                                  },
                                  "route":{
-                                    "cluster":"us-central1-cloud-esf.cloudfunctions.net:443",
-                                    "hostRewrite":"us-central1-cloud-esf.cloudfunctions.net",
+                                    "cluster":"pets.appspot.com:443",
+                                    "hostRewrite":"pets.appspot.com",
                                     "timeout":"15s"
                                  }
                               },
                               {
+                                 "decorator":{
+                                    "operation":"1.echo_api_endpoints_cloudesf_testing_cloud_goog.dynamic_routing_Search"
+                                 },
                                  "match":{
                                     "headers":[
                                        {
@@ -429,15 +436,18 @@ var (
                                           "name":":method"
                                        }
                                     ],
-                                    "path":"/pets"
+                                    "path":"/search"
                                  },
                                  "route":{
-                                    "cluster":"pets.appspot.com:443",
-                                    "hostRewrite":"pets.appspot.com",
+                                    "cluster":"us-west2-cloud-esf.cloudfunctions.net:443",
+                                    "hostRewrite":"us-west2-cloud-esf.cloudfunctions.net",
                                     "timeout":"15s"
                                  }
                               },
                               {
+                                 "decorator":{
+                                    "operation":"1.echo_api_endpoints_cloudesf_testing_cloud_goog.dynamic_routing_GetPetById"
+                                 },
                                  "match":{
                                     "headers":[
                                        {
@@ -445,11 +455,16 @@ var (
                                           "name":":method"
                                        }
                                     ],
-                                    "path":"/search"
+                                    "safeRegex":{
+                                      "googleRe2":{
+                                        "maxProgramSize":1000
+                                      },
+                                      "regex":"/pet/[^\\/]+$"
+                                    }
                                  },
                                  "route":{
-                                    "cluster":"us-west2-cloud-esf.cloudfunctions.net:443",
-                                    "hostRewrite":"us-west2-cloud-esf.cloudfunctions.net",
+                                    "cluster":"pets.appspot.com:8008",
+                                    "hostRewrite":"pets.appspot.com",
                                     "timeout":"15s"
                                  }
                               }
@@ -40,6 +40,12 @@ type CommonOptions struct {
 	TracingMaxNumMessageEvents int64
 	TracingMaxNumLinks         int64
 
+	// Flags for stats
+	StatsdAddress     string
+	StatsdFormat      string
+	PrometheusAddress string
+	PrometheusPort    int
+
 	// Flags for metadata
 	NonGCP             bool
 	HttpRequestTimeout time.Duration
@@ -94,6 +100,10 @@ func DefaultCommonOptions() CommonOptions {
 		TracingMaxNumAnnotations:   32,
 		TracingMaxNumMessageEvents: 128,
 		TracingMaxNumLinks:         128,
+		StatsdAddress:              "",
+		StatsdFormat:               "statsd",
+		PrometheusAddress:          "0.0.0.0",
+		PrometheusPort:             0,
 		MetadataURL:                "http://169.254.169.254/computeMetadata",
 		IamURL:                     "https://iamcredentials.googleapis.com",
 		ServiceControlCredentials:  nil,
@@ -36,6 +36,11 @@ type ConfigGeneratorOptions struct {
 	CorsAllowOriginRegex string
 	CorsExposeHeaders    string
 	CorsPreset           string
+	CorsPolicyPath       string
+
+	// Security response headers configurations.
+	SecurityHeadersPreset    string
+	SecurityHeadersOverrides string
 
 	// Backend routing configurations.
 	BackendDnsLookupFamily string
@@ -63,6 +68,27 @@ type ConfigGeneratorOptions struct {
 	EnvoyUseRemoteAddress  bool
 	EnvoyXffNumTrustedHops int
 
+	// Http Connection Manager configurations, 0 means the Envoy default.
+	ListenerCodecType         string
+	ConnectionIdleTimeout     time.Duration
+	StreamIdleTimeout         time.Duration
+	RequestTimeout            time.Duration
+	DrainTimeout              time.Duration
+	MaxRequestHeadersKb       int
+	Http2MaxConcurrentStreams int
+	Http2StreamWindowSize     int
+	Http2ConnectionWindowSize int
+	// Idle timeout of the routes of streaming methods, 0 means the stream
+	// idle timeout of the Http Connection Manager.
+	StreamingIdleTimeout time.Duration
+
+	// Request path hardening related configurations.
+	NormalizePath           bool
+	MergeSlashes            bool
+	RejectEncodedSlashes    bool
+	TrailingSlashMatching   bool
+	CaseInsensitiveMatching bool
+
 	LogJwtPayloads            string
 	LogRequestHeaders         string
 	LogResponseHeaders        string
@@ -74,6 +100,18 @@ type ConfigGeneratorOptions struct {
 
 	JwksCacheDurationInS int
 
+	// Path to the issuer-keyed JWT provider options file.
+	JwtProviderOptionsPath string
+
+	// OpenID Connect Discovery of the jwks_uri of the JWT providers.
+	OpenIDDiscoveryTimeout      time.Duration
+	OpenIDDiscoveryRetries      int
+	OpenIDDiscoveryRetryBackoff time.Duration
+	OpenIDDiscoveryFailFast     bool
+	// The jwks_uri resolved by OpenID Connect Discovery, kept across the
+	// service config rollouts.
+	OpenIDDiscoveryCache *util.JwksUriCache
+
 	ScCheckTimeoutMs  int
 	ScQuotaTimeoutMs  int
 	ScReportTimeoutMs int
@@ -82,7 +120,60 @@ type ConfigGeneratorOptions struct {
 	ScQuotaRetries  int
 	ScReportRetries int
 
+	// Enforce the per-minute quota limits of the service config locally, in
+	// each Envoy worker thread.
+	EnablePerWorkerLocalQuota bool
+
 	ComputePlatformOverride string
+
+	// Tracing related configurations.
+	TracingRequestHeadersForTags string
+
+	// Stats related configurations.
+	EnableOperationStats bool
+
+	// Path to the file with extra HTTP filters and clusters.
+	CustomFiltersPath string
+
+	// External authorization related configurations.
+	ExtAuthzAddress          string
+	ExtAuthzTimeout          time.Duration
+	ExtAuthzFailureModeAllow bool
+
+	// Response compression related configurations.
+	EnableResponseCompression bool
+	CompressionContentTypes   string
+	CompressionMinLength      int
+	CompressionLevel          string
+
+	// Local replies of the ESPv2 filters related configurations.
+	LocalReplyBodyFormat  string
+	LocalReplyContentType string
+	LocalReplyStatusCodes string
+
+	// Requests with a larger body are rejected, 0 means no limit.
+	MaxRequestBytes uint64
+
+	// WebSocket upgrade related configurations.
+	EnableWebsocket      bool
+	WebsocketIdleTimeout time.Duration
+
+	// Global rate limiting related configurations.
+	RateLimitServiceAddress  string
+	RateLimitDomain          string
+	RateLimitTimeout         time.Duration
+	RateLimitFailureModeDeny bool
+
+	// Traffic mirroring related configurations.
+	MirrorBackendAddress    string
+	MirrorPercent           float64
+	MirrorSkipNonIdempotent bool
+
+	// Path to the file splitting the traffic across weighted backends.
+	BackendSplitPath string
+
+	// Path to the selector-keyed operation policy file.
+	OperationPolicyPath string
 }
 
 // DefaultConfigGeneratorOptions returns ConfigGeneratorOptions with default values.
@@ -104,9 +195,33 @@ func DefaultConfigGeneratorOptions() ConfigGeneratorOptions {
 		CorsAllowOriginRegex:          "",
 		CorsExposeHeaders:             "",
 		CorsPreset:                    "",
+		CorsPolicyPath:                "",
+		SecurityHeadersPreset:         "off",
+		SecurityHeadersOverrides:      "",
 		EnvoyUseRemoteAddress:         false,
 		EnvoyXffNumTrustedHops:        2,
+		ListenerCodecType:             "auto",
+		ConnectionIdleTimeout:         0,
+		StreamIdleTimeout:             0,
+		RequestTimeout:                0,
+		DrainTimeout:                  0,
+		MaxRequestHeadersKb:           0,
+		Http2MaxConcurrentStreams:     0,
+		Http2StreamWindowSize:         0,
+		Http2ConnectionWindowSize:     0,
+		StreamingIdleTimeout:          0,
+		NormalizePath:                 false,
+		MergeSlashes:                  false,
+		RejectEncodedSlashes:          false,
+		TrailingSlashMatching:         false,
+		CaseInsensitiveMatching:       false,
 		JwksCacheDurationInS:          300,
+		JwtProviderOptionsPath:        "",
+		OpenIDDiscoveryTimeout:        5 * time.Second,
+		OpenIDDiscoveryRetries:        2,
+		OpenIDDiscoveryRetryBackoff:   500 * time.Millisecond,
+		OpenIDDiscoveryFailFast:       false,
+		OpenIDDiscoveryCache:          util.NewJwksUriCache(""),
 		ListenerAddress:               "0.0.0.0",
 		ListenerPort:                  8080,
 		RootCertsPath:                 util.DefaultRootCAPaths,
@@ -122,8 +237,34 @@ func DefaultConfigGeneratorOptions() ConfigGeneratorOptions {
 		ScQuotaTimeoutMs:              0,
 		ScReportRetries:               -1,
 		ScReportTimeoutMs:             0,
+		EnablePerWorkerLocalQuota:     false,
 		SkipJwtAuthnFilter:            false,
 		SkipServiceControlFilter:      false,
 		SuppressEnvoyHeaders:          false,
+		TracingRequestHeadersForTags:  "",
+		EnableOperationStats:          false,
+		CustomFiltersPath:             "",
+		ExtAuthzAddress:               "",
+		ExtAuthzTimeout:               200 * time.Millisecond,
+		ExtAuthzFailureModeAllow:      false,
+		EnableResponseCompression:     false,
+		CompressionContentTypes:       "",
+		CompressionMinLength:          30,
+		CompressionLevel:              "default",
+		LocalReplyBodyFormat:          "",
+		LocalReplyContentType:         "application/json",
+		LocalReplyStatusCodes:         "",
+		MaxRequestBytes:               0,
+		EnableWebsocket:               false,
+		WebsocketIdleTimeout:          time.Hour,
+		RateLimitServiceAddress:       "",
+		RateLimitDomain:               "",
+		RateLimitTimeout:              20 * time.Millisecond,
+		RateLimitFailureModeDeny:      false,
+		MirrorBackendAddress:          "",
+		MirrorPercent:                 0,
+		MirrorSkipNonIdempotent:       false,
+		BackendSplitPath:              "",
+		OperationPolicyPath:           "",
 	}
 }
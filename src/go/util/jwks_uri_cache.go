@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// JwksUriCache keeps the jwks_uri resolved by OpenID Connect Discovery, keyed
+// by issuer, across service config rollouts. It is loaded from and saved to
+// its file, if set, so it is also kept across restarts.
+type JwksUriCache struct {
+	mutex  sync.Mutex
+	path   string
+	loaded bool
+	uris   map[string]string
+}
+
+// NewJwksUriCache returns a cache persisted in the file at path. The cache is
+// only kept in memory if path is empty.
+func NewJwksUriCache(path string) *JwksUriCache {
+	return &JwksUriCache{
+		path: path,
+	}
+}
+
+// Get returns the cached jwks_uri of the issuer.
+func (c *JwksUriCache) Get(issuer string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.load()
+	uri, ok := c.uris[issuer]
+	return uri, ok
+}
+
+// Set caches the jwks_uri of the issuer, and saves the cache file if set.
+func (c *JwksUriCache) Set(issuer, uri string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.load()
+	if c.uris[issuer] == uri {
+		return
+	}
+	c.uris[issuer] = uri
+	if c.path == "" {
+		return
+	}
+	data, _ := json.MarshalIndent(c.uris, "", "  ")
+	if err := ioutil.WriteFile(c.path, data, 0644); err != nil {
+		glog.Warningf("fail to save OpenID Connect Discovery cache file %s: %v", c.path, err)
+	}
+}
+
+func (c *JwksUriCache) load() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+	c.uris = make(map[string]string)
+	if c.path == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		glog.Infof("OpenID Connect Discovery cache file %s is not loaded: %v", c.path, err)
+		return
+	}
+	if err := json.Unmarshal(data, &c.uris); err != nil {
+		glog.Warningf("fail to unmarshal OpenID Connect Discovery cache file %s: %v", c.path, err)
+		c.uris = make(map[string]string)
+	}
+}
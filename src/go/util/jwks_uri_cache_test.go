@@ -0,0 +1,53 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+)
+
+func TestJwksUriCacheSaved(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "openid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cachePath := filepath.Join(tmpDir, "cache.json")
+
+	NewJwksUriCache(cachePath).Set("issuer-1", "https://example.com/jwks")
+
+	// A new process loads the saved cache.
+	cache := NewJwksUriCache(cachePath)
+	if uri, ok := cache.Get("issuer-1"); !ok || uri != "https://example.com/jwks" {
+		t.Errorf("got cached jwks_uri: %v, %v, want: https://example.com/jwks, true", uri, ok)
+	}
+	if _, ok := cache.Get("issuer-2"); ok {
+		t.Errorf("got cached jwks_uri for unknown issuer")
+	}
+}
+
+func TestJwksUriCacheInvalidFile(t *testing.T) {
+	var cachePath string
+	defer testutil.WriteTempFiles(t, map[*string]string{&cachePath: "invalid"})()
+
+	if _, ok := NewJwksUriCache(cachePath).Get("issuer-1"); ok {
+		t.Errorf("got cached jwks_uri from an invalid cache file")
+	}
+}
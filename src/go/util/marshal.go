@@ -19,6 +19,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
+	"strings"
 
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
@@ -28,11 +30,17 @@ import (
 	pmpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/path_matcher"
 	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/http/service_control"
 	authpb "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	bufferpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/buffer/v2"
+	extauthzpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/ext_authz/v2"
 	gspb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/grpc_stats/v2alpha"
+	gzippb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/gzip/v2"
 	jwtpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/jwt_authn/v2alpha"
+	ratelimitpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rate_limit/v2"
+	rbacpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rbac/v2"
 	routerpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/router/v2"
 	transcoderpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/transcoder/v2"
 	hcmpb "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	metricspb "github.com/envoyproxy/go-control-plane/envoy/config/metrics/v2"
 	structpb "github.com/golang/protobuf/ptypes/struct"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
@@ -77,8 +85,22 @@ var Resolver = FuncResolver(func(url string) (proto.Message, error) {
 		return new(gspb.FilterConfig), nil
 	case "type.googleapis.com/envoy.config.filter.http.transcoder.v2.GrpcJsonTranscoder":
 		return new(transcoderpb.GrpcJsonTranscoder), nil
+	case "type.googleapis.com/envoy.config.filter.http.gzip.v2.Gzip":
+		return new(gzippb.Gzip), nil
 	case "type.googleapis.com/envoy.config.filter.http.jwt_authn.v2alpha.JwtAuthentication":
 		return new(jwtpb.JwtAuthentication), nil
+	case "type.googleapis.com/envoy.config.filter.http.buffer.v2.Buffer":
+		return new(bufferpb.Buffer), nil
+	case "type.googleapis.com/envoy.config.filter.http.buffer.v2.BufferPerRoute":
+		return new(bufferpb.BufferPerRoute), nil
+	case "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthz":
+		return new(extauthzpb.ExtAuthz), nil
+	case "type.googleapis.com/envoy.config.filter.http.ext_authz.v2.ExtAuthzPerRoute":
+		return new(extauthzpb.ExtAuthzPerRoute), nil
+	case "type.googleapis.com/envoy.config.filter.http.rate_limit.v2.RateLimit":
+		return new(ratelimitpb.RateLimit), nil
+	case "type.googleapis.com/envoy.config.filter.http.rbac.v2.RBAC":
+		return new(rbacpb.RBAC), nil
 	case "type.googleapis.com/envoy.config.filter.network.http_connection_manager.v2.HttpConnectionManager":
 		return new(hcmpb.HttpConnectionManager), nil
 	case "type.googleapis.com/google.api.envoy.http.path_matcher.FilterConfig":
@@ -87,13 +109,23 @@ var Resolver = FuncResolver(func(url string) (proto.Message, error) {
 		return new(scpb.FilterConfig), nil
 	case "type.googleapis.com/google.api.envoy.http.backend_auth.FilterConfig":
 		return new(bapb.FilterConfig), nil
+	case "type.googleapis.com/google.api.envoy.http.backend_auth.PerRouteFilterConfig":
+		return new(bapb.PerRouteFilterConfig), nil
 	case "type.googleapis.com/google.api.envoy.http.backend_routing.FilterConfig":
 		return new(drpb.FilterConfig), nil
 	case "type.googleapis.com/envoy.config.filter.http.router.v2.Router":
 		return new(routerpb.Router), nil
 	case "type.googleapis.com/envoy.api.v2.auth.UpstreamTlsContext":
 		return new(authpb.UpstreamTlsContext), nil
+	case "type.googleapis.com/envoy.config.metrics.v2.StatsdSink":
+		return new(metricspb.StatsdSink), nil
+	case "type.googleapis.com/envoy.config.metrics.v2.DogStatsdSink":
+		return new(metricspb.DogStatsdSink), nil
 	default:
+		// Fall back to the registered types, e.g. for the custom filters.
+		if mt := proto.MessageType(strings.TrimPrefix(url, "type.googleapis.com/")); mt != nil {
+			return reflect.New(mt.Elem()).Interface().(proto.Message), nil
+		}
 		return nil, fmt.Errorf("unexpected protobuf.Any with url: %s", url)
 	}
 })
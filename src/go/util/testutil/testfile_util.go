@@ -0,0 +1,51 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testutil has the helpers shared by the tests of the Go packages.
+package testutil
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// WriteTempFiles writes the test fixtures to temporary files. Each key is the
+// option receiving the path of its file, e.g. &opts.OperationPolicyPath.
+// Empty contents are skipped, so their options stay unset. The returned
+// function removes the files.
+func WriteTempFiles(t *testing.T, files map[*string]string) func() {
+	var paths []string
+	for option, content := range files {
+		if content == "" {
+			continue
+		}
+		f, err := ioutil.TempFile("", "esp_v2_test_*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, f.Name())
+		_, err = f.WriteString(content)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		*option = f.Name()
+	}
+	return func() {
+		for _, path := range paths {
+			os.Remove(path)
+		}
+	}
+}
@@ -76,9 +76,8 @@ func ParseBackendProtocol(protocol string) (BackendProtocol, bool, error) {
 }
 
 // Note: the path of openID discovery may be https
-var getRemoteContent = func(path string) ([]byte, error) {
+var getRemoteContent = func(client *http.Client, path string) ([]byte, error) {
 	req, _ := http.NewRequest("GET", path, nil)
-	client := &http.Client{}
 	resp, err := client.Do(req)
 
 	if err != nil {
@@ -92,14 +91,16 @@ var getRemoteContent = func(path string) ([]byte, error) {
 	return ioutil.ReadAll(resp.Body)
 }
 
-func ResolveJwksUriUsingOpenID(uri string) (string, error) {
+// ResolveJwksUriUsingOpenID fetches the OpenID Connect Discovery document of
+// the issuer with the client, and returns its jwks_uri.
+func ResolveJwksUriUsingOpenID(client *http.Client, uri string) (string, error) {
 	if !strings.HasPrefix(uri, "http") {
 		uri = fmt.Sprintf("https://%s", uri)
 	}
 	uri = strings.TrimSuffix(uri, "/")
 	uri = fmt.Sprintf("%s%s", uri, OpenIDDiscoveryCfgURLSuffix)
 
-	body, err := getRemoteContent(uri)
+	body, err := getRemoteContent(client, uri)
 	if err != nil {
 		return "", fmt.Errorf("Failed to fetch jwks_uri from %s: %v", uri, err)
 	}
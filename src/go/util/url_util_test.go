@@ -294,7 +294,7 @@ func TestResolveJwksUriUsingOpenID(t *testing.T) {
 		},
 	}
 	for i, tc := range testData {
-		uri, err := ResolveJwksUriUsingOpenID(tc.issuer)
+		uri, err := ResolveJwksUriUsingOpenID(&http.Client{}, tc.issuer)
 		if uri != tc.wantUri {
 			t.Errorf("Test Desc(%d): %s, resolve jwksUri by openID got: %v, want: %v", i, tc.desc, uri, tc.wantUri)
 		}
@@ -45,8 +45,20 @@ const (
 	BackendAuth = "envoy.filters.http.backend_auth"
 	// BackendRouting filter.
 	BackendRouting = "envoy.filters.http.backend_routing"
+	// ExtAuthz HTTP filter
+	ExtAuthz = "envoy.filters.http.ext_authz"
+	// RBAC HTTP filter
+	RBAC = "envoy.filters.http.rbac"
+	// RateLimit HTTP filter
+	RateLimit = "envoy.filters.http.ratelimit"
+	// Gzip HTTP filter
+	Gzip = "envoy.filters.http.gzip"
 	// GrpcStats filter name
 	GrpcStatsFilterName = "envoy.filters.http.grpc_stats"
+	// StatsdSink is Envoy StatsD stats sink name.
+	StatsdSink = "envoy.stat_sinks.statsd"
+	// DogStatsdSink is Envoy DogStatsD stats sink name.
+	DogStatsdSink = "envoy.stat_sinks.dog_statsd"
 	// TLSTransportSocket is Envoy TLS Transport Socket name.
 	TLSTransportSocket = "envoy.transport_sockets.tls"
 	// DefaultRootCAPaths is the default certs path.
@@ -54,6 +66,25 @@ const (
 
 	// JwtPayloadMetadataName is the field name passed into metadata
 	JwtPayloadMetadataName = "jwt_payloads"
+	// OperationMetadataName is the field name of the operation set by the
+	// Path Matcher filter in its dynamic metadata.
+	OperationMetadataName = "operation"
+	// ExtAuthzOperationHeader carries the operation to the HTTP external
+	// authorization server. It is removed before the requests are sent to
+	// the backend.
+	ExtAuthzOperationHeader = "x-esp-v2-ext-authz-operation"
+	// JwtPayloadHeader is the header the JWT Authn filter forwards the
+	// verified JWT payload in.
+	JwtPayloadHeader = "X-Endpoint-API-UserInfo"
+	// ForwardedAuthorizationHeader keeps the original Authorization header
+	// when it is replaced by the Backend Auth filter.
+	ForwardedAuthorizationHeader = "X-Forwarded-Authorization"
+	// RateLimitApiKeyHeader and RateLimitJwtSubHeader carry the API key and
+	// the JWT sub claim from the Service Control filter to the rate limit
+	// actions of the routes. They are removed before the requests are sent to
+	// the backend.
+	RateLimitApiKeyHeader = "x-esp-v2-rate-limit-api-key"
+	RateLimitJwtSubHeader = "x-esp-v2-rate-limit-jwt-sub"
 
 	// Supported Http Methods.
 
@@ -95,6 +126,18 @@ const (
 	// The service control server cluster name.
 	ServiceControlClusterName = "service-control-cluster"
 
+	// The external authorization server cluster name.
+	ExtAuthzClusterName = "ext-authz-cluster"
+
+	// The rate limit service cluster name.
+	RateLimitClusterName = "rate-limit-cluster"
+
+	// The shadow backend cluster name, receiving the mirrored requests.
+	MirrorClusterName = "mirror-backend-cluster"
+
+	// The cluster name of the local admin interface, used to serve Prometheus stats.
+	AdminClusterName = "admin-cluster"
+
 	// Platforms
 
 	GAEFlex = "GAE_FLEX(ESPv2)"
@@ -107,6 +150,10 @@ const (
 	// Default response deadline used if user does not specify one in the BackendRule.
 	DefaultResponseDeadline = 15 * time.Second
 
+	// The upgrade type of WebSocket connections, and the header requesting it.
+	WebsocketUpgradeType = "websocket"
+	UpgradeHeader        = "upgrade"
+
 	// A limit configured to reduce resource usage in Envoy's SafeRegex GoogleRE2 matcher.
 	// b/148606900: It is safe to set this to a fairly high value.
 	// This won't impact resource usage for customers who have short UriTemplates.
@@ -67,6 +67,7 @@ const (
 	TestDeadlinesForGrpcDynamicRouting
 	TestManagedServiceConfig
 	TestMultiGrpcServices
+	TestPerWorkerLocalQuota
 	TestPreflightCorsWithBasicPreset
 	TestPreflightRequestWithAllowCors
 	TestReportGCPAttributes
@@ -527,6 +527,8 @@ func TestServiceControlRequestWithAllowCors(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/bookstore/shelves?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.CorsShelves",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
@@ -559,6 +561,8 @@ func TestServiceControlRequestWithAllowCors(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/bookstore/shelves/1",
 					ApiKey:            "",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.CORS_bookstore_shelves_shelf",
 					ProducerProjectID: "producer-project",
 					FrontendProtocol:  "http",
@@ -695,6 +699,8 @@ func TestServiceControlRequestWithoutAllowCors(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/bookstore/shelves?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.CorsShelves",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
@@ -366,6 +366,8 @@ func TestServiceControlRequestForDynamicRouting(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/echo?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
@@ -399,6 +401,8 @@ func TestServiceControlRequestForDynamicRouting(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/sc/searchpet?key=api-key&timezone=EST",
 					ApiKey:            "api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.dynamic_routing_SearchPetWithServiceControlVerification",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
@@ -432,6 +436,8 @@ func TestServiceControlRequestForDynamicRouting(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/sc/pet/0325/num/2019?key=api-key&lang=en",
 					ApiKey:            "api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.dynamic_routing_GetPetByIdWithServiceControlVerification",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
@@ -510,6 +516,8 @@ func TestDynamicBackendRoutingTLS(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/sc/searchpet?key=api-key&timezone=EST",
 					ApiKey:            "api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.dynamic_routing_SearchPetWithServiceControlVerification",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
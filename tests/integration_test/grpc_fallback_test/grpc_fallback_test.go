@@ -103,6 +103,7 @@ results {
 				ServiceName:       "bookstore.endpoints.cloudesf-testing.cloud.goog",
 				ServiceConfigID:   "test-config-id",
 				URL:               "/test.grpc.Test/Echo",
+				ApiName:           "endpoints.examples.bookstore.Bookstore",
 				ApiMethod:         "endpoints.examples.bookstore.Bookstore.Unspecified",
 				ProducerProjectID: "producer project",
 				FrontendProtocol:  "grpc",
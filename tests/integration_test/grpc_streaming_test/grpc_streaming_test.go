@@ -82,6 +82,7 @@ results {
 			ServiceConfigID:   "test-config-id",
 			URL:               "/test.grpc.Test/EchoStream",
 			ApiKey:            "this-is-an-api-key",
+			ApiName:           "test.grpc.Test",
 			ApiMethod:         "test.grpc.Test.EchoStream",
 			ProducerProjectID: "producer-project",
 			ConsumerProjectID: "123456",
@@ -0,0 +1,139 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local_quota_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/tests/endpoints/echo/client"
+	"github.com/GoogleCloudPlatform/esp-v2/tests/env"
+	"github.com/GoogleCloudPlatform/esp-v2/tests/env/platform"
+
+	comp "github.com/GoogleCloudPlatform/esp-v2/tests/env/components"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+)
+
+func TestPerWorkerLocalQuota(t *testing.T) {
+
+	configId := "test-config-id"
+	// The client address is the connection address, whatever x-forwarded-for
+	// the client sends.
+	args := []string{"--service_config_id=" + configId,
+		"--backend_protocol=http", "--rollout_strategy=fixed", "--suppress_envoy_headers",
+		"--enable_per_worker_local_quota", "--envoy_use_remote_address", "--envoy_xff_num_trusted_hops=0"}
+
+	s := env.NewTestEnv(comp.TestPerWorkerLocalQuota, platform.EchoSidecar)
+	s.OverrideQuota(&confpb.Quota{
+		Limits: []*confpb.QuotaLimit{
+			{
+				Name:   "echo-limit",
+				Metric: "echo-requests",
+				Unit:   "1/min/{project}",
+				Values: map[string]int64{"STANDARD": 2},
+			},
+		},
+		MetricRules: []*confpb.MetricRule{
+			{
+				Selector:    "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo",
+				MetricCosts: map[string]int64{"echo-requests": 1},
+			},
+			{
+				Selector:    "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo_nokey",
+				MetricCosts: map[string]int64{"echo-requests": 1},
+			},
+		},
+	})
+	defer s.TearDown()
+	if err := s.Setup(args); err != nil {
+		t.Fatalf("fail to setup test env, %v", err)
+	}
+
+	// The test Envoy has a single worker thread, so all the requests share
+	// its buckets. The API key of Echo is verified by Check, so each key gets
+	// its own bucket. Echo_nokey does not call Check, so its requests are
+	// keyed by client address.
+	testData := []struct {
+		desc          string
+		path          string
+		requestHeader map[string]string
+		wantResp      string
+		wantError     string
+	}{
+		{
+			desc:     "succeed, first request of the API key",
+			path:     "/echo?key=api-key-1",
+			wantResp: `{"message":"hello"}`,
+		},
+		{
+			desc: "succeed, second request of the API key in a header",
+			path: "/echo",
+			requestHeader: map[string]string{
+				"X-API-KEY": "api-key-1",
+			},
+			wantResp: `{"message":"hello"}`,
+		},
+		{
+			desc:      "fail, third request of the API key",
+			path:      "/echo?key=api-key-1",
+			wantError: "429 Too Many Requests",
+		},
+		{
+			desc:     "succeed, another API key has its own bucket",
+			path:     "/echo?key=api-key-2",
+			wantResp: `{"message":"hello"}`,
+		},
+		{
+			desc:     "succeed, first request of the client without API key",
+			path:     "/echo/nokey",
+			wantResp: `{"message":"hello"}`,
+		},
+		{
+			desc:     "succeed, second request of the client without API key",
+			path:     "/echo/nokey",
+			wantResp: `{"message":"hello"}`,
+		},
+		{
+			desc:      "fail, third request of the client without API key",
+			path:      "/echo/nokey",
+			wantError: "429 Too Many Requests",
+		},
+		{
+			desc: "fail, a spoofed x-forwarded-for does not get a new bucket",
+			path: "/echo/nokey",
+			requestHeader: map[string]string{
+				"X-Forwarded-For": "10.1.2.3",
+			},
+			wantError: "429 Too Many Requests",
+		},
+	}
+	for _, tc := range testData {
+		url := fmt.Sprintf("http://localhost:%v%v", s.Ports().ListenerPort, tc.path)
+		resp, err := client.DoWithHeaders(url, "POST", "hello", tc.requestHeader)
+		if tc.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test (%s): failed, expected err: %v, got: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test (%s): failed, %v", tc.desc, err)
+		}
+		if !strings.Contains(string(resp), tc.wantResp) {
+			t.Errorf("Test (%s): failed, expected: %s, got: %s", tc.desc, tc.wantResp, string(resp))
+		}
+	}
+}
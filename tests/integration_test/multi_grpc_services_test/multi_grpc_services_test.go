@@ -70,6 +70,7 @@ func TestMultiGrpcServices(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/endpoints.examples.bookstore.Bookstore/GetShelf",
 					ApiKey:            "api-key-1",
+					ApiName:           "endpoints.examples.bookstore.Bookstore",
 					ApiMethod:         "endpoints.examples.bookstore.Bookstore.GetShelf",
 					ProducerProjectID: "producer project",
 					ConsumerProjectID: "123456",
@@ -105,6 +106,7 @@ func TestMultiGrpcServices(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/v1/shelves/100?key=api-key-2",
 					ApiKey:            "api-key-2",
+					ApiName:           "endpoints.examples.bookstore.Bookstore",
 					ApiMethod:         "endpoints.examples.bookstore.Bookstore.GetShelf",
 					ProducerProjectID: "producer project",
 					ConsumerProjectID: "123456",
@@ -143,6 +145,7 @@ func TestMultiGrpcServices(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/endpoints.examples.bookstore.v2.Bookstore/GetShelf",
 					ApiKey:            "api-key-1",
+					ApiName:           "endpoints.examples.bookstore.v2.Bookstore",
 					ApiMethod:         "endpoints.examples.bookstore.v2.Bookstore.GetShelf",
 					ProducerProjectID: "producer project",
 					ConsumerProjectID: "123456",
@@ -179,6 +182,7 @@ func TestMultiGrpcServices(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/v2/shelves/100?key=api-key-2",
 					ApiKey:            "api-key-2",
+					ApiName:           "endpoints.examples.bookstore.v2.Bookstore",
 					ApiMethod:         "endpoints.examples.bookstore.v2.Bookstore.GetShelf",
 					ProducerProjectID: "producer project",
 					ConsumerProjectID: "123456",
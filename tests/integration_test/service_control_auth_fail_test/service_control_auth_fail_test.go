@@ -83,6 +83,7 @@ func TestServiceControlJwtAuthFail(t *testing.T) {
 					ServiceName:       "bookstore.endpoints.cloudesf-testing.cloud.goog",
 					ServiceConfigID:   "test-config-id",
 					URL:               "/v1/shelves?key=api-key",
+					ApiName:           "endpoints.examples.bookstore.Bookstore",
 					ApiMethod:         "endpoints.examples.bookstore.Bookstore.ListShelves",
 					ProducerProjectID: "producer project",
 					ApiKey:            "api-key",
@@ -97,6 +97,8 @@ func TestServiceControlBasic(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/simpleget?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Simpleget",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
@@ -131,6 +133,8 @@ func TestServiceControlBasic(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/echo?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
@@ -158,6 +162,8 @@ func TestServiceControlBasic(t *testing.T) {
 					URL:               "/echo",
 					ErrorType:         "4xx",
 					StatusCode:        "16",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo",
 					ProducerProjectID: "producer-project",
 					FrontendProtocol:  "http",
@@ -181,6 +187,8 @@ func TestServiceControlBasic(t *testing.T) {
 					ServiceName:       "echo-api.endpoints.cloudesf-testing.cloud.goog",
 					ServiceConfigID:   "test-config-id",
 					URL:               "/echo/nokey",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo_nokey",
 					ProducerProjectID: "producer-project",
 					HttpMethod:        "POST",
@@ -206,6 +214,8 @@ func TestServiceControlBasic(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					ApiKey:            "api-key",
 					URL:               "/echo/nokey?key=api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo_nokey",
 					ProducerProjectID: "producer-project",
 					HttpMethod:        "POST",
@@ -233,6 +243,8 @@ func TestServiceControlBasic(t *testing.T) {
 					ServiceName:       "echo-api.endpoints.cloudesf-testing.cloud.goog",
 					ServiceConfigID:   "test-config-id",
 					URL:               "/echo/nokey",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo_nokey",
 					ProducerProjectID: "producer-project",
 					HttpMethod:        "POST",
@@ -261,6 +273,8 @@ func TestServiceControlBasic(t *testing.T) {
 					ServiceName:       "echo-api.endpoints.cloudesf-testing.cloud.goog",
 					ServiceConfigID:   "test-config-id",
 					URL:               "/echo/nokey/OverrideAsGet",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo_nokey_override_as_get",
 					ProducerProjectID: "producer-project",
 					HttpMethod:        "GET",
@@ -285,6 +299,8 @@ func TestServiceControlBasic(t *testing.T) {
 					ServiceName:       "echo-api.endpoints.cloudesf-testing.cloud.goog",
 					ServiceConfigID:   "test-config-id",
 					URL:               "/anypath/x/y/z",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog._post_anypath",
 					ProducerProjectID: "producer-project",
 					HttpMethod:        "POST",
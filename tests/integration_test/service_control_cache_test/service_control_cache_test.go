@@ -71,6 +71,8 @@ func TestServiceControlCache(t *testing.T) {
 			ServiceConfigID:   "test-config-id",
 			URL:               "/echo?key=api-key",
 			ApiKey:            "api-key",
+			ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+			ApiVersion:        "1.0.0",
 			ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo",
 			ProducerProjectID: "producer-project",
 			ConsumerProjectID: "123456",
@@ -91,6 +91,8 @@ func TestServiceControlCheckError(t *testing.T) {
 					ServiceName:       "echo-api.endpoints.cloudesf-testing.cloud.goog",
 					ServiceConfigID:   "test-config-id",
 					URL:               "/echo?key=api-key-1",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo",
 					ProducerProjectID: "producer-project",
 					FrontendProtocol:  "http",
@@ -131,6 +133,8 @@ func TestServiceControlCheckError(t *testing.T) {
 					ServiceName:       "echo-api.endpoints.cloudesf-testing.cloud.goog",
 					ServiceConfigID:   "test-config-id",
 					URL:               "/echo?key=api-key-2",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo",
 					ProducerProjectID: "producer-project",
 					FrontendProtocol:  "http",
@@ -180,6 +184,8 @@ func TestServiceControlCheckError(t *testing.T) {
 					ServiceName: "echo-api.endpoints.cloudesf-testing.cloud.goog", ServiceConfigID: "test-config-id",
 					URL:               "/auth/info/auth0?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Auth0",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
@@ -95,6 +95,7 @@ func TestServiceControlCredentialId(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/v1/shelves",
 					JwtAuth:           "issuer=YXBpLXByb3h5LXRlc3RpbmdAY2xvdWQuZ29vZw&audience=Ym9va3N0b3JlX3Rlc3RfY2xpZW50LmNsb3VkLmdvb2c",
+					ApiName:           "endpoints.examples.bookstore.Bookstore",
 					ApiMethod:         "endpoints.examples.bookstore.Bookstore.ListShelves",
 					ProducerProjectID: "producer project",
 					FrontendProtocol:  "http",
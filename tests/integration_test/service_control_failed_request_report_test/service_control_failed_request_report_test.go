@@ -115,6 +115,7 @@ func TestServiceControlFailedRequestReport(t *testing.T) {
 					ServiceName:       "bookstore.endpoints.cloudesf-testing.cloud.goog",
 					ServiceConfigID:   "test-config-id",
 					URL:               "/v1/shelves?key=api-key",
+					ApiName:           "endpoints.examples.bookstore.Bookstore",
 					ApiMethod:         "endpoints.examples.bookstore.Bookstore.ListShelves",
 					ApiKey:            "api-key",
 					ProducerProjectID: "producer project",
@@ -142,6 +143,7 @@ func TestServiceControlFailedRequestReport(t *testing.T) {
 					ServiceName:       "bookstore.endpoints.cloudesf-testing.cloud.goog",
 					ServiceConfigID:   "test-config-id",
 					URL:               "/v1/shelves/0/books/0",
+					ApiName:           "endpoints.examples.bookstore.Bookstore",
 					ApiMethod:         "endpoints.examples.bookstore.Bookstore.GetBook",
 					ProducerProjectID: "producer project",
 					FrontendProtocol:  "http",
@@ -106,6 +106,8 @@ func TestServiceControlAllHTTPMethods(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/echoMethod?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.echoGET",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
@@ -140,6 +142,8 @@ func TestServiceControlAllHTTPMethods(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/echoMethod?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.echoPOST",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
@@ -174,6 +178,8 @@ func TestServiceControlAllHTTPMethods(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/echoMethod?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.echoPUT",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
@@ -208,6 +214,8 @@ func TestServiceControlAllHTTPMethods(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/echoMethod?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.echoPATCH",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
@@ -241,6 +249,8 @@ func TestServiceControlAllHTTPMethods(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/echoMethod?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.echoDELETE",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
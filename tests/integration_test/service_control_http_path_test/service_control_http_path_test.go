@@ -65,6 +65,8 @@ func TestServiceControlAllHTTPPath(t *testing.T) {
 					ServiceName:       "echo-api.endpoints.cloudesf-testing.cloud.goog",
 					ServiceConfigID:   "test-config-id",
 					URL:               "/",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Root",
 					ProducerProjectID: "producer-project",
 					FrontendProtocol:  "http",
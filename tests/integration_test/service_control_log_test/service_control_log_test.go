@@ -93,6 +93,8 @@ func TestServiceControlLogHeaders(t *testing.T) {
 					ServiceName: "echo-api.endpoints.cloudesf-testing.cloud.goog", ServiceConfigID: "test-config-id",
 					URL:               "/echo?key=api-key-2",
 					ApiKey:            "api-key-2",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.Echo",
 					ProducerProjectID: "producer-project",
 					ConsumerProjectID: "123456",
@@ -207,6 +209,7 @@ func TestServiceControlLogJwtPayloads(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/v1/shelves?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "endpoints.examples.bookstore.Bookstore",
 					ApiMethod:         "endpoints.examples.bookstore.Bookstore.ListShelves",
 					ProducerProjectID: "producer project",
 					ConsumerProjectID: "123456",
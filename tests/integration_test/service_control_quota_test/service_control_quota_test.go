@@ -101,6 +101,7 @@ func TestServiceControlQuota(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/v1/shelves?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "endpoints.examples.bookstore.Bookstore",
 					ApiMethod:         "endpoints.examples.bookstore.Bookstore.ListShelves",
 					ProducerProjectID: "producer project",
 					ConsumerProjectID: "123456",
@@ -302,6 +303,7 @@ func TestServiceControlQuotaExhausted(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/v1/shelves?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "endpoints.examples.bookstore.Bookstore",
 					ApiMethod:         "endpoints.examples.bookstore.Bookstore.ListShelves",
 					ProducerProjectID: "producer project",
 					ConsumerProjectID: "123456",
@@ -346,6 +348,7 @@ func TestServiceControlQuotaExhausted(t *testing.T) {
 					ServiceConfigID:   "test-config-id",
 					URL:               "/v1/shelves?key=api-key",
 					ApiKey:            "api-key",
+					ApiName:           "endpoints.examples.bookstore.Bookstore",
 					ApiMethod:         "endpoints.examples.bookstore.Bookstore.ListShelves",
 					ProducerProjectID: "producer project",
 					ConsumerProjectID: "123456",
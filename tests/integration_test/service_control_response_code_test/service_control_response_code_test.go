@@ -96,6 +96,8 @@ func TestServiceControlReportResponseCode(t *testing.T) {
 					ServiceName:       "echo-api.endpoints.cloudesf-testing.cloud.goog",
 					ServiceConfigID:   "test-config-id",
 					URL:               "/simpleget/304",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.SimplegetNotModified",
 					ProducerProjectID: "producer-project",
 					FrontendProtocol:  "http",
@@ -118,6 +120,8 @@ func TestServiceControlReportResponseCode(t *testing.T) {
 					ServiceName:       "echo-api.endpoints.cloudesf-testing.cloud.goog",
 					ServiceConfigID:   "test-config-id",
 					URL:               "/simpleget/403",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.SimplegetForbidden",
 					ProducerProjectID: "producer-project",
 					ErrorType:         "4xx",
@@ -141,6 +145,8 @@ func TestServiceControlReportResponseCode(t *testing.T) {
 					ServiceName:       "echo-api.endpoints.cloudesf-testing.cloud.goog",
 					ServiceConfigID:   "test-config-id",
 					URL:               "/simpleget/401",
+					ApiName:           "1.echo_api_endpoints_cloudesf_testing_cloud_goog",
+					ApiVersion:        "1.0.0",
 					ApiMethod:         "1.echo_api_endpoints_cloudesf_testing_cloud_goog.SimplegetUnauthorized",
 					ProducerProjectID: "producer-project",
 					ErrorType:         "4xx",
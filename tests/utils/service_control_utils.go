@@ -56,6 +56,7 @@ type ExpectedReport struct {
 	Version           string
 	ServiceName       string
 	ServiceConfigID   string
+	ApiName           string
 	ApiVersion        string
 	ApiMethod         string
 	ApiKey            string
@@ -325,6 +326,9 @@ func createLogEntry(er *ExpectedReport) *scpb.LogEntry {
 	pl["api_method"] = makeStringValue(er.ApiMethod)
 	pl["http_response_code"] = makeNumberValue(int64(er.ResponseCode))
 
+	if er.ApiName != "" {
+		pl["api_name"] = makeStringValue(er.ApiName)
+	}
 	if er.ApiVersion != "" {
 		pl["api_version"] = makeStringValue(er.ApiVersion)
 	}